@@ -15,17 +15,19 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
 	"tgdp/internal/cli"
 	"tgdp/internal/config"
 	"tgdp/internal/flags"
+	"tgdp/internal/load"
 	"tgdp/internal/lua"
 	"tgdp/internal/repl"
+	"tgdp/internal/scenario"
 	"tgdp/internal/server"
 	"tgdp/internal/version"
 
 	"tgdp/pkg/diameter"
-	"tgdp/pkg/diameter/dict"
 )
 
 // Functions
@@ -38,8 +40,22 @@ func exitOnError(err error) {
 	}
 }
 
+// exitOnFailure exits with code 1 if the test run fails, the PCAP file is closed before exit.
+func exitOnFailure(d *diameter.Diameter, err error) {
+	if err != nil {
+		slog.Error(err.Error())
+		d.PcapClose() // nolint: errcheck
+		os.Exit(1)
+	}
+}
+
 func usage() {
 	fmt.Printf("Usage: %s [flags] [<peer> <app> <command> [<command> ...]]\n", os.Args[0])
+	fmt.Printf("       %s [flags] load <peer> <app> <command> --rate <rate> [load flags]\n", os.Args[0])
+	fmt.Printf("       %s [flags] load --mix <file> [--rate <rate>] [load flags]\n", os.Args[0])
+	fmt.Printf("       %s [flags] load --scenario <file> --rate <rate> [load flags]\n", os.Args[0])
+	fmt.Printf("       %s [flags] scenario run <file> [<file> ...]\n", os.Args[0])
+	fmt.Printf("       %s [flags] -batch <file>[,<file> ...]\n", os.Args[0])
 	fmt.Printf("       %s [-c <string>] @<Lua script> [args]\n", os.Args[0])
 	fmt.Printf("       %s [-c <string>] -y\n", os.Args[0])
 	fmt.Println("  <peer>    - Name of peer (must be present in 'node.yaml')")
@@ -73,7 +89,7 @@ func main() {
 		exitOnError(d.PcapOpen(*flags.W, *flags.A))
 	}
 
-	exitOnError(d.LoadDict(config.DialDictFile(), dict.FormatPkl))
+	exitOnError(d.LoadDict(config.DialDictFile(), config.DictFormat()))
 
 	if *flags.D {
 		d.Dict().Show()
@@ -89,6 +105,9 @@ func main() {
 	}
 
 	exitOnError(d.LoadData(config.AvpsDataFile()))
+	exitOnError(d.LoadProfiles(config.YamlDir()))
+	exitOnError(config.LoadFeeds(d))
+	exitOnError(config.ApplyOverload(d))
 	exitOnError(d.LoadPeers(config.PeersDataFile()))
 
 	d.SetTraceLevel(int32(*flags.V))
@@ -103,7 +122,12 @@ func main() {
 	}
 
 	if flag.NArg() > 0 && flag.Args()[0][0] == '@' {
-		lua.Run(d, flag.Args())
+		exitOnFailure(d, lua.Script(d, flag.Args()))
+		return
+	}
+
+	if *flags.Batch != "" {
+		exitOnFailure(d, repl.Batch(d, strings.Split(*flags.Batch, ",")))
 		return
 	}
 
@@ -112,9 +136,19 @@ func main() {
 		return
 	}
 
+	if flag.Arg(0) == load.Command {
+		exitOnFailure(d, load.Run(d, flag.Args()[1:]))
+		return
+	}
+
+	if flag.Arg(0) == scenario.Command {
+		exitOnFailure(d, scenario.Run(d, flag.Args()[1:]))
+		return
+	}
+
 	if flag.NArg() < 3 {
 		usage()
 	}
 
-	cli.Run(d, flag.Args())
+	exitOnFailure(d, cli.Run(d, flag.Args()))
 }
@@ -13,8 +13,10 @@ package cli
 import (
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"tgdp/internal/flags"
+	"tgdp/internal/report"
 
 	"tgdp/pkg/diameter"
 	"tgdp/pkg/diameter/diwe"
@@ -25,11 +27,31 @@ import (
 // Functions
 //
 
-func Run(env *diameter.Diameter, args []string) {
-	_ = Send(env, args, true, true, true)
+// Run sends the commands of the command line: <peer> <app> <command> [<command> ...].
+// Each command is the report case, the failed case is the error or the answer with the failed result.
+// Returns ErrTestFailed if any case is failed.
+func Run(env *diameter.Diameter, args []string) error {
+	report.Start(env, "cli", true)
+	report.Suite(strings.Join(args, " "), "")
+
+	for i, cmd := range args[2:] {
+		report.Case(strings.Join([]string{args[0], args[1], cmd}, " "))
+		_ = Send(env, []string{args[0], args[1], cmd}, true, true, i == len(args)-3)
+	}
+
+	return report.Finish(env)
 }
 
-func Send(env *diameter.Diameter, args []string, request, recv bool, disconnect bool) error {
+// Send sends the commands to the peer and receives the answers if recv is set.
+// The sending is stopped on the error, the answer with the failed result does not stop the sending
+// and its error is returned at the end. The errors fail the current report case.
+func Send(env *diameter.Diameter, args []string, request, recv bool, disconnect bool) (err error) {
+	defer func() {
+		if err != nil {
+			report.Fail(err)
+		}
+	}()
+
 	peer, err := env.Peers().GetByName(args[0])
 	if err != nil {
 		slog.Error(err.Error())
@@ -44,37 +66,52 @@ func Send(env *diameter.Diameter, args []string, request, recv bool, disconnect
 		env.Trace(peer, diameter.TracePeer)
 	}
 
+	var resultErr error
 	for _, cmd := range args[2:] {
-		msg, err := env.NewMessage(args[1], cmd, request, true)
+		var msg *diameter.Message
+		msg, err = env.NewPeerMessage(peer.Name, args[1], cmd, request, true)
 		if err != nil {
 			slog.Error(err.Error())
 			break
 		}
+		if err = env.AdmitRequest(peer, msg); err != nil {
+			msg.Release()
+			slog.Error(err.Error())
+			break
+		}
 		env.Trace(msg, diameter.TraceMsg)
 
-		_, err = msg.Serialize()
-		if err != nil {
+		if _, err = msg.Serialize(); err != nil {
+			msg.Release()
 			slog.Error(err.Error())
 			break
 		}
 
-		err = env.Pcap().Write(msg.Bytes(), peer, pcap.DirOutgoing)
-		if err != nil {
+		if err := env.Pcap().Write(msg.Bytes(), peer, pcap.DirOutgoing); err != nil {
 			slog.Error(err.Error())
 		}
 		env.Pcap().Append(pcap.Append)
 
 		if !OfflineMode() {
-			if err = env.SendMessage(peer, msg); err != nil {
-				slog.Error(err.Error())
-				break
-			}
+			err = env.SendMessage(peer, msg)
+		}
+		msg.Release()
+		if err != nil {
+			slog.Error(err.Error())
+			break
+		}
 
-			if recv {
-				if _, err := Receive(env, peer, true); err != nil {
-					return err
+		if !OfflineMode() && recv {
+			var ans *diameter.Message
+			if ans, err = Receive(env, peer, true); err != nil {
+				return err
+			}
+			if !ans.IsRequest() {
+				if err := report.CheckResult(ans); err != nil && resultErr == nil {
+					resultErr = err
 				}
 			}
+			ans.Release()
 		}
 	}
 
@@ -84,13 +121,68 @@ func Send(env *diameter.Diameter, args []string, request, recv bool, disconnect
 		}
 	}
 
+	if err != nil {
+		return err
+	}
+
+	return resultErr
+}
+
+// SendRaw sends the raw payload (deliberately malformed message) to the peer as is.
+// The errors fail the current report case.
+func SendRaw(env *diameter.Diameter, peerName string, data []byte, recv bool) (err error) {
+	defer func() {
+		if err != nil {
+			report.Fail(err)
+		}
+	}()
+
+	peer, err := env.Peers().GetByName(peerName)
+	if err != nil {
+		slog.Error(err.Error())
+		return err
+	}
+
+	if !OfflineMode() && !peer.IsOpen() {
+		if err = peer.Connect(); err != nil {
+			slog.Error(err.Error())
+			return err
+		}
+		env.Trace(peer, diameter.TracePeer)
+	}
+	env.Trace(diameter.RawMessage(data), diameter.TraceMsg)
+
+	if err := env.Pcap().Write(data, peer, pcap.DirOutgoing); err != nil {
+		slog.Error(err.Error())
+	}
+	env.Pcap().Append(pcap.Append)
+
+	if OfflineMode() {
+		return nil
+	}
+	if err = env.SendRaw(peer, data); err != nil {
+		slog.Error(err.Error())
+		return err
+	}
+	if recv {
+		msg, err := Receive(env, peer, true)
+		if err != nil {
+			return err
+		}
+		msg.Release()
+	}
+
 	return nil
 }
 
+// Receive receives the message from the peer, the error fails the current report case.
+// The message is owned by the caller, see Message.Release.
+// Returns ErrNoData if there is no data and wait is not set.
 func Receive(env *diameter.Diameter, peer *node.Node, wait bool) (*diameter.Message, error) {
 	if peer.HasData() || wait {
 		msg, err := env.RecvMessage(peer, wait)
 		if err != nil {
+			report.Fail(err)
 			switch err.(type) {
 			case *diwe.InfInterrupted:
 				fmt.Printf("\n%v\n", err)
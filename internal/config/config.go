@@ -14,7 +14,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
 	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/dict"
 
 	"gopkg.in/yaml.v3"
 )
@@ -45,9 +48,11 @@ const (
 
 type Config struct {
 	// Diameter protocol parameters
-	DiaDictFile string `yaml:"dictionary_file"`
-	DiaMode     string `yaml:"diameter_mode"`
-	DiaModeId   int32
+	DiaDictFile   string `yaml:"dictionary_file"`
+	DiaDictFormat string `yaml:"dictionary_format"`
+	DiaDictWatch  string `yaml:"dictionary_watch"`
+	DiaMode       string `yaml:"diameter_mode"`
+	DiaModeId     int32
 
 	// Data files
 	AvpsDataFile  string `yaml:"avps_data_file"`
@@ -56,6 +61,28 @@ type Config struct {
 	// Subdirectories
 	BatchSubdir string `yaml:"batch_subdir"`
 	YamlSubdir  string `yaml:"yaml_subdir"`
+
+	// External data feeds bound to AVP values
+	Feeds map[string]FeedConfig `yaml:"feeds"`
+	// DOIC overload control (RFC 7683)
+	OverloadControl bool                  `yaml:"overload_control"`
+	OverloadReport  *OverloadReportConfig `yaml:"overload_report"`
+}
+
+type FeedConfig struct {
+	File       string            `yaml:"file"`
+	Format     string            `yaml:"format"`
+	Select     string            `yaml:"select"`
+	Partitions int               `yaml:"partitions"`
+	OnEnd      string            `yaml:"on_end"`
+	Scope      string            `yaml:"scope"`
+	Bind       map[string]string `yaml:"bind"` // AVP name -> column name
+}
+
+type OverloadReportConfig struct {
+	Type      string `yaml:"type"`
+	Reduction uint32 `yaml:"reduction"`
+	Validity  string `yaml:"validity"`
 }
 
 // Variables
@@ -131,6 +158,27 @@ func DialDictFile() string {
 	return getConfigPath(config.DiaDictFile)
 }
 
+func DictFormat() int {
+	switch strings.ToLower(config.DiaDictFormat) {
+	case "json":
+		return dict.FormatJson
+	case "yaml":
+		return dict.FormatYaml
+	default:
+		return dict.FormatPkl
+	}
+}
+
+// DictWatchInterval returns the dictionary files polling interval in server mode,
+// zero if watching is disabled.
+func DictWatchInterval() time.Duration {
+	interval, err := time.ParseDuration(config.DiaDictWatch)
+	if err != nil || interval < 0 {
+		return 0
+	}
+	return interval
+}
+
 func AvpsDataFile() string {
 	return getConfigPath(config.AvpsDataFile)
 }
@@ -139,6 +187,63 @@ func PeersDataFile() string {
 	return getConfigPath(config.PeersDataFile)
 }
 
+// LoadFeeds loads the data feeds defined in the configuration and binds the AVPs to their columns.
+func LoadFeeds(d *diameter.Diameter) error {
+	for name, feed := range config.Feeds {
+		opts, err := diameter.ParseFeedOptions(feed.Format, feed.Select, feed.OnEnd, feed.Scope, feed.Partitions)
+		if err != nil {
+			return err
+		}
+
+		if _, err := d.LoadFeed(name, FeedFile(feed.File), opts); err != nil {
+			return err
+		}
+
+		for avp, column := range feed.Bind {
+			if err := d.BindFeed(avp, name, column); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplyOverload enables the DOIC overload control and sets the overload report of the answers
+// defined in the configuration.
+func ApplyOverload(d *diameter.Diameter) error {
+	if config.OverloadControl {
+		if err := d.SetOverloadControl(true); err != nil {
+			return err
+		}
+	}
+
+	report := config.OverloadReport
+	if report == nil {
+		return nil
+	}
+	typ, err := diameter.ParseOverloadType(report.Type)
+	if err != nil {
+		return err
+	}
+	validity := diameter.OverloadDefaultValidity
+	if report.Validity != "" {
+		if validity, err = time.ParseDuration(report.Validity); err != nil {
+			return err
+		}
+	}
+
+	return d.SetOverloadAnswer(&diameter.OverloadReport{Type: typ, Reduction: report.Reduction, Validity: validity})
+}
+
+// FeedFile returns the path of the data feed file, relative paths are in the data directory.
+func FeedFile(file string) string {
+	if filepath.IsAbs(file) || strings.HasPrefix(file, ".") {
+		return file
+	}
+	return getConfigPath(file)
+}
+
 func BatchDir() string {
 	return getConfigPath(config.BatchSubdir)
 }
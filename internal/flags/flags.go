@@ -25,5 +25,8 @@ var (
 	W = flag.String("w", "", "Write PCAP file")
 	Y = flag.Bool("y", false, "verifY Diameter dictionary")
 
+	Batch   = flag.String("batch", "", "run REPL Batch files (comma separated) and exit")
+	Report  = flag.String("report", "", "write test Report files (comma separated): <file>.xml (JUnit), <file>.json, <file>.html")
+	Metrics = flag.String("metrics", "", "expose Prometheus metrics on [host]:port, e.g. :9100")
 	Version = flag.Bool("version", false, "Show version information")
 )
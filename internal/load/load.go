@@ -0,0 +1,346 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: load.go
+// Description: CLI load generation mode
+//
+
+package load
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+
+	"tgdp/internal/flags"
+	"tgdp/internal/metrics"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+	dl "tgdp/pkg/diameter/load"
+	"tgdp/pkg/diameter/scenario"
+)
+
+// Consts
+//
+
+// Command is the first command line argument of the load mode.
+const Command = "load"
+
+// progressInterval is the interval of the load progress output.
+const progressInterval = time.Second
+
+// runtimeInterval is the interval of the runtime statistics output in the load progress.
+const runtimeInterval = time.Minute
+
+// Types
+//
+
+// options are the load flags other than the load configuration.
+type options struct {
+	scenario    string
+	failedLog   string
+	mix         string
+	rateProfile string
+}
+
+// Functions
+//
+
+// Run runs the load: tgdp [flags] load <peer> <app> <command> [load flags],
+// the traffic mix load: tgdp [flags] load --mix <file> [load flags]
+// or the call load: tgdp [flags] load --scenario <file> [load flags].
+// The load is stopped by Ctrl-C through the Diameter environment context.
+// Returns an error if the load cannot run or it is stopped by the leak guard, the summary is printed before.
+func Run(d *diameter.Diameter, args []string) error {
+	cfg, opts, err := parseArgs(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(255)
+	}
+
+	if *flags.N {
+		return &diwe.ErrOfflineUnsupported{Mode: Command}
+	}
+
+	// the rate profile is open-loop: the busy-hour curve is kept when the peer slows down
+	if opts.rateProfile != "" {
+		if cfg.Profile, err = dl.LoadRateProfile(opts.rateProfile); err != nil {
+			return err
+		}
+		cfg.OpenLoop = true
+	}
+
+	if opts.scenario != "" {
+		return runCalls(d, cfg, opts)
+	}
+
+	gen, err := newGenerator(d, cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	exporter, err := metrics.Start(d, gen)
+	if err != nil {
+		return err
+	}
+	defer exporter.Shutdown()
+
+	done := start(d, gen.Abandon)
+	defer close(done)
+	go progress(func() fmt.Stringer { return gen.Stats() }, done)
+
+	err = gen.Run(d.Context())
+	summary(gen.Stats())
+
+	return err
+}
+
+// Helpers
+//
+
+// newGenerator creates the load generator of the command or of the traffic mix file.
+func newGenerator(d *diameter.Diameter, cfg dl.Config, opts options) (*dl.Generator, error) {
+	if opts.mix == "" {
+		return dl.New(d, cfg)
+	}
+
+	mix, err := dl.LoadMix(d, opts.mix)
+	if err != nil {
+		return nil, err
+	}
+
+	return dl.NewMix(d, mix, cfg)
+}
+
+// runCalls runs the scenario calls at the load rate.
+func runCalls(d *diameter.Diameter, cfg dl.Config, opts options) error {
+	sc, err := scenario.Load(d, opts.scenario)
+	if err != nil {
+		return err
+	}
+
+	var failedLog io.Writer
+	if opts.failedLog != "" {
+		file, err := os.Create(opts.failedLog)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		failedLog = file
+	}
+
+	calls, err := dl.NewCalls(d, sc, cfg, failedLog)
+	if err != nil {
+		return err
+	}
+
+	exporter, err := metrics.Start(d, calls)
+	if err != nil {
+		return err
+	}
+	defer exporter.Shutdown()
+
+	done := start(d, nil)
+	defer close(done)
+	go progress(func() fmt.Stringer { return calls.Stats() }, done)
+
+	err = calls.Run(d.Context())
+	callSummary(sc, calls.Stats())
+
+	return err
+}
+
+// start cancels the Diameter environment context on Ctrl-C until the returned channel is closed.
+// The second Ctrl-C calls abandon (optional) to stop the waiting for the outstanding requests.
+func start(d *diameter.Diameter, abandon func()) chan struct{} {
+	done := make(chan struct{})
+
+	ccChan := make(chan os.Signal, 1)
+	signal.Notify(ccChan, os.Interrupt)
+	go func() {
+		defer signal.Stop(ccChan)
+		select {
+		case <-ccChan:
+			d.Cancel()
+		case <-done:
+			return
+		}
+		if abandon == nil {
+			return
+		}
+		select {
+		case <-ccChan:
+			slog.Warn("Interrupted again, the outstanding requests are abandoned")
+			abandon()
+		case <-done:
+		}
+	}()
+
+	return done
+}
+
+// parseArgs parses the positional arguments and the load flags, the flags may follow the arguments.
+func parseArgs(args []string) (dl.Config, options, error) {
+	var (
+		cfg  dl.Config
+		opts options
+	)
+
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	rate := fs.String("rate", "", "request rate <number>[/s | /m | /h], e.g. 500/s")
+	fs.StringVar(&opts.rateProfile, "rate-profile", "", "rate profile file (YAML or CSV), replaces the rate and the ramps")
+	fs.BoolVar(&cfg.OpenLoop, "open-loop", false, "count the requests over the concurrency as missed, do not wait")
+	fs.DurationVar(&cfg.Duration, "duration", 0, "steady phase duration, until Ctrl-C if not set")
+	fs.DurationVar(&cfg.RampUp, "ramp-up", 0, "ramp-up phase duration")
+	fs.DurationVar(&cfg.RampDown, "ramp-down", 0, "ramp-down phase duration")
+	fs.IntVar(&cfg.Concurrency, "concurrency", dl.DefaultConcurrency, "maximum outstanding requests")
+	fs.DurationVar(&cfg.Timeout, "timeout", dl.DefaultTimeout, "answer timeout")
+	fs.StringVar(&opts.scenario, "scenario", "", "scenario file of the calls, the concurrency limits the active calls")
+	fs.StringVar(&opts.failedLog, "failed-log", "", "file of the failed calls exchange (scenario)")
+	fs.StringVar(&opts.mix, "mix", "", "traffic mix file of the weighted requests, the rate is shared by the weights")
+	fs.DurationVar(&cfg.Reconnect, "reconnect", 0, "soak: reconnect the peers every interval, e.g. 10m")
+	maxHeap := fs.String("max-heap", "", "soak: stop the load if the live heap grows over the size, e.g. 512MiB")
+	fs.IntVar(&cfg.MaxGoroutines, "max-goroutines", 0, "soak: stop the load if the goroutines grow over the number")
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s [flags] %s <peer> <app> <command> --rate <rate> [load flags]\n", os.Args[0], Command)
+		fmt.Printf("       %s [flags] %s --mix <file> [--rate <rate>] [load flags]\n", os.Args[0], Command)
+		fmt.Printf("       %s [flags] %s --scenario <file> --rate <rate> [load flags]\n", os.Args[0], Command)
+		fmt.Println("The --rate-profile <file> may replace the --rate and the ramps.")
+		fmt.Println("Load flags:")
+		fs.PrintDefaults()
+	}
+
+	positional := []string{}
+	for rest := args; ; {
+		if err := fs.Parse(rest); err != nil {
+			return cfg, opts, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	arguments := 3
+	if opts.scenario != "" || opts.mix != "" {
+		arguments = 0
+	}
+	// the mix entries may have own rates only
+	noRate := *rate == "" && opts.mix == "" && opts.rateProfile == ""
+	if len(positional) != arguments || noRate || (opts.scenario != "" && opts.mix != "") {
+		fs.Usage()
+		return cfg, opts, flag.ErrHelp
+	}
+	if arguments > 0 {
+		cfg.Peer, cfg.App, cfg.Cmd = positional[0], positional[1], positional[2]
+	}
+
+	var err error
+	if *maxHeap != "" {
+		if cfg.MaxHeap, err = dl.ParseSize(*maxHeap); err != nil {
+			return cfg, opts, err
+		}
+	}
+	if *rate == "" {
+		return cfg, opts, nil
+	}
+	cfg.Rate, err = dl.ParseRate(*rate)
+
+	return cfg, opts, err
+}
+
+// progress prints the load counters every progressInterval and the runtime statistics
+// every runtimeInterval until done.
+func progress(stats func() fmt.Stringer, done chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	reported := time.Now()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			fmt.Println(stats())
+			if now.Sub(reported) >= runtimeInterval {
+				reported = now
+				fmt.Printf("Runtime: %s\n", diameter.RuntimeStats())
+			}
+		}
+	}
+}
+
+// summary prints the final load counters and the answers by the result codes,
+// the counters and the answers of the mix entries.
+func summary(stats dl.Stats) {
+	fmt.Println()
+	fmt.Println(stats)
+	fmt.Printf("Unexpected messages: %d\n", stats.Unexpected)
+	if stats.LastError != "" {
+		fmt.Printf("Last error: %s\n", stats.LastError)
+	}
+
+	for _, code := range slices.Sorted(maps.Keys(stats.Results)) {
+		fmt.Printf("Result-Code %d: %d\n", code, stats.Results[code])
+	}
+	missed(stats.Missed, stats.Sent+stats.Errors, "requests")
+	if stats.Abated > 0 {
+		fmt.Printf("Abated by the overload control: %d requests\n", stats.Abated)
+	}
+	if stats.Reconnects > 0 {
+		fmt.Printf("Reconnections: %d, dropped outstanding requests: %d\n", stats.Reconnects, stats.Dropped)
+	}
+	if stats.Abandoned > 0 {
+		fmt.Printf("Abandoned outstanding requests: %d\n", stats.Abandoned)
+	}
+	fmt.Printf("Runtime: %s\n", diameter.RuntimeStats())
+
+	if len(stats.Entries) < 2 {
+		return
+	}
+	fmt.Println()
+	for _, entry := range stats.Entries {
+		fmt.Println(entry)
+		for _, code := range slices.Sorted(maps.Keys(entry.Results)) {
+			fmt.Printf("  Result-Code %d: %d\n", code, entry.Results[code])
+		}
+	}
+}
+
+// callSummary prints the final call counters and the failed calls by the steps.
+func callSummary(sc *scenario.Scenario, stats dl.CallStats) {
+	fmt.Println()
+	fmt.Println(stats)
+	if stats.LastError != "" {
+		fmt.Printf("Last error: %s\n", stats.LastError)
+	}
+	missed(stats.Missed, stats.Started, "calls")
+	fmt.Printf("Runtime: %s\n", diameter.RuntimeStats())
+
+	for i, failed := range stats.Failures {
+		if failed > 0 {
+			fmt.Printf("Step %d '%s': %d failed\n", i+1, &sc.Steps[i], failed)
+		}
+	}
+}
+
+// missed prints the warning if the target rate was not kept: the missed and the done requests (calls).
+func missed(missed, done uint64, what string) {
+	if missed == 0 {
+		return
+	}
+
+	fmt.Printf("Target rate not kept: %d %s missed (%.2f%% of the target)\n",
+		missed, what, 100*float64(missed)/float64(missed+done))
+}
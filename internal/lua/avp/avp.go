@@ -11,8 +11,11 @@
 package l_avp
 
 import (
+	"fmt"
 	"net/netip"
 	"strings"
+	"time"
+
 	"tgdp/internal/lua/l2g"
 	"tgdp/pkg/diameter"
 	"tgdp/pkg/diameter/diwe"
@@ -34,6 +37,7 @@ const (
 	keyVendorId = "vendor_id"
 	keyValue    = "value"
 	keyMembers  = "members"
+	keyFormat   = "format"
 )
 
 // Variables
@@ -77,17 +81,71 @@ func Fetch(L *lvm.LState) int {
 		return 2
 	}
 
-	avps := L.NewTable()
-	for _, avp := range env.Store().Fetch(avpd.Code) {
+	L.Push(AvpsTable(L, env.Store().Fetch(avpd.Code)))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// GetPath returns AVP instancies from the environment AvpStore defined by the path,
+// e.g. "Subscription-Data.APN-Configuration-Profile.APN-Configuration[1].Service-Selection".
+func GetPath(L *lvm.LState) int {
+	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	avps, err := env.Store().GetPath(L.CheckString(1))
+	if err != nil {
+		L.Push(lvm.LNil)
+		L.Push(lvm.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(AvpsTable(L, avps))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// SetPath sets the value of the AVP in the environment AvpStore defined by the path.
+func SetPath(L *lvm.LState) int {
+	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	if err := env.Store().SetPath(L.CheckString(1), PopValue(L, 2, nil)); err != nil {
+		L.Push(lvm.LString(err.Error()))
+		return 1
+	}
+
+	return 0
+}
+
+// AddPath adds the AVP to the environment AvpStore defined by the path.
+func AddPath(L *lvm.LState) int {
+	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	if err := env.Store().AddPath(L.CheckString(1), PopValue(L, 2, nil)); err != nil {
+		L.Push(lvm.LString(err.Error()))
+		return 1
+	}
+
+	return 0
+}
+
+// DeletePath deletes the AVP from the environment AvpStore defined by the path.
+func DeletePath(L *lvm.LState) int {
+	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	if err := env.Store().DeletePath(L.CheckString(1)); err != nil {
+		L.Push(lvm.LString(err.Error()))
+		return 1
+	}
+
+	return 0
+}
+
+// AvpsTable returns the table of AVP objects.
+func AvpsTable(L *lvm.LState, avps []*diameter.Avp) *lvm.LTable {
+	t := L.NewTable()
+	for _, avp := range avps {
 		ud := L.NewUserData()
 		ud.Value = avp
 		L.SetMetatable(ud, MetaTable())
-		avps.Append(ud)
+		t.Append(ud)
 	}
 
-	L.Push(avps)
-	L.Push(lvm.LNil)
-	return 2
+	return t
 }
 
 func GetValue(L *lvm.LState) int {
@@ -117,9 +175,14 @@ func PushValue(L *lvm.LState, avp *diameter.Avp) int {
 	case env.Dict().AvpDataType().Float64:
 		L.Push(lvm.LNumber(avp.Data().Value.(float64)))
 	case env.Dict().AvpDataType().Address:
-		L.Push(lvm.LString(avp.Data().Value.(netip.Addr).StringExpanded()))
+		switch v := avp.Data().Value.(type) {
+		case netip.Addr:
+			L.Push(lvm.LString(v.StringExpanded()))
+		default:
+			L.Push(lvm.LString(fmt.Sprint(v)))
+		}
 	case env.Dict().AvpDataType().Time:
-		L.Push(lvm.LNumber(avp.Data().Value.(uint32)))
+		L.Push(lvm.LNumber(avp.Data().Value.(time.Time).Unix()))
 	case env.Dict().AvpDataType().UTF8String:
 		L.Push(lvm.LString(avp.Data().Value.(string)))
 	case env.Dict().AvpDataType().Identity:
@@ -168,56 +231,24 @@ func SetValue(L *lvm.LState) int {
 }
 
 func PopValue(L *lvm.LState, n int, avp *diameter.Avp) any {
-	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
-
-	value := L.CheckAny(n)
-
-	switch avp.Type() {
-	case env.Dict().AvpDataType().OctetString:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().Integer32:
-		return l2g.Int32(value)
-	case env.Dict().AvpDataType().Integer64:
-		return l2g.Int64(value)
-	case env.Dict().AvpDataType().Unsigned32:
-		return l2g.UInt32(value)
-	case env.Dict().AvpDataType().Unsigned64:
-		return l2g.UInt64(value)
-	case env.Dict().AvpDataType().Float32:
-		return l2g.Float32(value)
-	case env.Dict().AvpDataType().Float64:
-		return l2g.Float64(value)
-	case env.Dict().AvpDataType().Address:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().Time:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().UTF8String:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().Identity:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().URI:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().IPFilterRule:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().QoSFilterRule:
-		return l2g.String(value)
-	case env.Dict().AvpDataType().Enumerated:
-		switch value.Type() {
-		case lvm.LTNumber:
-			return l2g.Int(value)
-		case lvm.LTString:
-			return l2g.String(value)
-		}
-	case env.Dict().AvpDataType().Grouped:
-		if t, ok := value.(*lvm.LTable); ok {
-			members := make([]*diameter.Avp, 0, t.Len())
-			t.ForEach(func(k, v lvm.LValue) {
-				if member, ok := v.(*lvm.LUserData); ok {
-					members = append(members, member.Value.(*diameter.Avp))
+	// Numbers and strings are converted to the AVP type by Avp.SetValue
+	switch value := L.CheckAny(n).(type) {
+	case lvm.LNumber:
+		return float64(value)
+	case lvm.LString:
+		return string(value)
+	case *lvm.LTable:
+		members := make([]*diameter.Avp, 0, value.Len())
+		value.ForEach(func(k, v lvm.LValue) {
+			if member, ok := v.(*lvm.LUserData); ok {
+				if m, ok := member.Value.(*diameter.Avp); ok {
+					members = append(members, m)
 				}
-			})
-			return members
-		}
+			}
+		})
+		return members
+	case *lvm.LUserData:
+		return value.Value
 	}
 
 	return nil
@@ -230,9 +261,7 @@ func ToText(L *lvm.LState) int {
 		return 0
 	}
 
-	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
-
-	if codec, exists := env.Codec(avp.Type()); exists {
+	if codec, exists := avp.Codec(); exists {
 		L.Push(lvm.LString(codec.ToText(avp)))
 		return 1
 	}
@@ -305,6 +334,10 @@ func Register(L *lvm.LState) *lvm.LTable {
 
 	L.SetField(metaTable, "new", L.NewFunction(New))
 	L.SetField(metaTable, "fetch", L.NewFunction(Fetch))
+	L.SetField(metaTable, "get_path", L.NewFunction(GetPath))
+	L.SetField(metaTable, "set_path", L.NewFunction(SetPath))
+	L.SetField(metaTable, "add_path", L.NewFunction(AddPath))
+	L.SetField(metaTable, "delete_path", L.NewFunction(DeletePath))
 	L.SetField(metaTable, "__index", L.NewFunction(index))
 	L.SetField(metaTable, "__newindex", L.NewFunction(newIndex))
 
@@ -324,6 +357,8 @@ func index(L *lvm.LState) int {
 		L.Push(lvm.LString(avp.Name()))
 	case keyVendorId:
 		L.Push(lvm.LNumber(avp.VendorId()))
+	case keyFormat:
+		L.Push(lvm.LString(avp.Format()))
 	case keyValue:
 		return PushValue(L, avp)
 	case keyMembers:
@@ -0,0 +1,120 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: capture.go
+// Description: Lua API: capture of the received AVP values
+//
+
+package l_capture
+
+import (
+	"tgdp/internal/lua/l2g"
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+
+	lvm "github.com/yuin/gopher-lua"
+)
+
+// Consts
+//
+
+const LuaModuleName = "capture"
+
+// Variables
+//
+
+var functions map[string]lvm.LGFunction
+
+// Functions
+//
+
+// Add adds the capture rule: on <app> <cmd> capture <from> into <to> (the same AVP if omitted),
+// the increment (optional) is added to the captured integer value.
+func Add(L *lvm.LState) int {
+	var to any
+	if L.GetTop() >= 4 && L.Get(4) != lvm.LNil {
+		to = l2g.CheckId(L, 4)
+	}
+
+	rule, err := envOf(L).AddCapture(l2g.CheckId(L, 1), L.CheckString(2), l2g.CheckId(L, 3), to, L.OptInt64(5, 0))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(ruleTable(L, rule))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// List returns the list of the capture rules.
+func List(L *lvm.LState) int {
+	rules := L.NewTable()
+	for _, rule := range envOf(L).Captures() {
+		rules.Append(ruleTable(L, rule))
+	}
+
+	L.Push(rules)
+	return 1
+}
+
+// Remove removes the capture rule by index (1-based), all rules if the index is omitted.
+func Remove(L *lvm.LState) int {
+	index := L.OptInt(1, 0)
+	if index < 0 {
+		return pushError(L, &diwe.ErrIndexOutOfRange{Index: index})
+	}
+
+	if err := envOf(L).RemoveCapture(index - 1); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Register creates the capture module table.
+func Register(L *lvm.LState) *lvm.LTable {
+	module := L.NewTable()
+	for name, fn := range functions {
+		L.SetField(module, name, L.NewFunction(fn))
+	}
+
+	return module
+}
+
+// Helpers
+//
+
+func envOf(L *lvm.LState) *diameter.Diameter {
+	return L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+}
+
+func pushError(L *lvm.LState, err error) int {
+	L.Push(lvm.LNil)
+	L.Push(lvm.LString(err.Error()))
+	return 2
+}
+
+func ruleTable(L *lvm.LState, rule diameter.CaptureRule) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "command", lvm.LString(rule.Command))
+	L.SetField(t, "from", lvm.LString(rule.From))
+	L.SetField(t, "to", lvm.LString(rule.To))
+	L.SetField(t, "increment", lvm.LNumber(rule.Increment))
+
+	return t
+}
+
+// Init
+//
+
+func init() {
+	functions = make(map[string]lvm.LGFunction)
+	functions["add"] = Add
+	functions["list"] = List
+	functions["remove"] = Remove
+}
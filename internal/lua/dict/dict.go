@@ -0,0 +1,350 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: dict.go
+// Description: Lua API: Diameter dictionary
+//
+
+package l_dict
+
+import (
+	"tgdp/internal/lua/l2g"
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+
+	lvm "github.com/yuin/gopher-lua"
+)
+
+// Consts
+//
+
+const LuaModuleName = "dict"
+
+// Variables
+//
+
+var functions map[string]lvm.LGFunction
+
+// Functions
+//
+
+// Apps returns the list of applications.
+func Apps(L *lvm.LState) int {
+	d := envDict(L)
+
+	apps := L.NewTable()
+	for app := range d.AppIter() {
+		apps.Append(appTable(L, d, app))
+	}
+
+	L.Push(apps)
+	return 1
+}
+
+// App returns the application by ID or name.
+func App(L *lvm.LState) int {
+	d := envDict(L)
+
+	app, err := d.GetApp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(appTable(L, d, app))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Commands returns the list of application commands (without AVP rules).
+func Commands(L *lvm.LState) int {
+	d := envDict(L)
+
+	app, err := d.GetApp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	cmds := L.NewTable()
+	for cmd := range d.CmdIter(app) {
+		cmds.Append(cmdTable(L, cmd, false))
+	}
+
+	L.Push(cmds)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Command returns the application command with request and answer AVP rules.
+func Command(L *lvm.LState) int {
+	d := envDict(L)
+
+	app, err := d.GetApp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	cmd, err := d.GetCmd(l2g.CheckId(L, 2), app)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(cmdTable(L, cmd, true))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Avps returns the list of all AVP definitions.
+func Avps(L *lvm.LState) int {
+	d := envDict(L)
+
+	avps := L.NewTable()
+	for avp := range d.AvpIter() {
+		avps.Append(avpTable(L, avp))
+	}
+
+	L.Push(avps)
+	return 1
+}
+
+// Avp returns the AVP definition by code or name.
+func Avp(L *lvm.LState) int {
+	avp, err := envDict(L).GetAvp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(avpTable(L, avp))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Members returns the member rules of a grouped AVP.
+func Members(L *lvm.LState) int {
+	avp, err := envDict(L).GetAvp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	if avp.Group == nil {
+		return pushError(L, &diwe.ErrAvpIsNotGrouped{AvpName: avp.Name})
+	}
+
+	L.Push(rulesTable(L, avp.Group.Members))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// EnumCode returns the code of an enumerated AVP item by its name.
+func EnumCode(L *lvm.LState) int {
+	d := envDict(L)
+
+	avp, err := d.GetAvp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	code, err := d.GetEnumCode(avp.Code, L.CheckString(2))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LNumber(code))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// EnumName returns the name of an enumerated AVP item by its code.
+func EnumName(L *lvm.LState) int {
+	d := envDict(L)
+
+	avp, err := d.GetAvp(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	name, err := d.GetEnumName(avp.Code, int32(L.CheckInt(2)))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LString(name))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Result returns the result code definition by code or name and vendor ID
+// (0 or omitted for Result-Code).
+func Result(L *lvm.LState) int {
+	rc, err := envDict(L).GetResultCode(l2g.CheckId(L, 1), uint32(L.OptInt(2, 0)))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(ResultTable(L, rc.Code, rc.VndId, rc))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Results returns the list of result code definitions.
+// If the vendor ID is given, only the definitions of this vendor are returned.
+func Results(L *lvm.LState) int {
+	vndId := L.OptInt(1, -1)
+
+	results := L.NewTable()
+	for rc := range envDict(L).ResultCodeIter() {
+		if vndId < 0 || rc.VndId == uint32(vndId) {
+			results.Append(ResultTable(L, rc.Code, rc.VndId, rc))
+		}
+	}
+
+	L.Push(results)
+	return 1
+}
+
+// ResultClass returns the result class name ("success", "transient", etc.) of the code.
+func ResultClass(L *lvm.LState) int {
+	L.Push(lvm.LString(dict.ResultClassName(dict.ResultClass(uint32(L.CheckInt(1))))))
+	return 1
+}
+
+// ResultTable makes the result table. The definition is optional,
+// the name and description are empty if the code is not described in the dictionary.
+func ResultTable(L *lvm.LState, code, vndId uint32, rc *dict.ResultCode) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "code", lvm.LNumber(code))
+	L.SetField(t, "vendor_id", lvm.LNumber(vndId))
+	L.SetField(t, "class", lvm.LString(dict.ResultClassName(dict.ResultClass(code))))
+	if rc != nil {
+		L.SetField(t, "name", lvm.LString(rc.Name))
+		L.SetField(t, "description", lvm.LString(rc.Description))
+	} else {
+		L.SetField(t, "name", lvm.LString(""))
+		L.SetField(t, "description", lvm.LString(""))
+	}
+
+	return t
+}
+
+// Register creates the dictionary module table.
+func Register(L *lvm.LState) *lvm.LTable {
+	module := L.NewTable()
+	for name, fn := range functions {
+		L.SetField(module, name, L.NewFunction(fn))
+	}
+
+	return module
+}
+
+// Helpers
+//
+
+func envDict(L *lvm.LState) *dict.Dict {
+	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	return env.Dict()
+}
+
+func pushError(L *lvm.LState, err error) int {
+	L.Push(lvm.LNil)
+	L.Push(lvm.LString(err.Error()))
+	return 2
+}
+
+func appTable(L *lvm.LState, d *dict.Dict, app *dict.App) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "id", lvm.LNumber(app.Id))
+	L.SetField(t, "name", lvm.LString(app.Name))
+	L.SetField(t, "vendor", lvm.LString(app.Vnd))
+	L.SetField(t, "vendor_id", lvm.LNumber(app.VndId))
+
+	cmds := L.NewTable()
+	for cmd := range d.CmdIter(app) {
+		cmds.Append(lvm.LString(cmd.Short))
+	}
+	L.SetField(t, "commands", cmds)
+
+	return t
+}
+
+func cmdTable(L *lvm.LState, cmd *dict.Command, withRules bool) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "code", lvm.LNumber(cmd.Code))
+	L.SetField(t, "name", lvm.LString(cmd.Name))
+	L.SetField(t, "short", lvm.LString(cmd.Short))
+	L.SetField(t, "flags", lvm.LNumber(cmd.Flags))
+
+	if withRules {
+		L.SetField(t, "request", rulesTable(L, cmd.Request))
+		L.SetField(t, "answer", rulesTable(L, cmd.Answer))
+	}
+
+	return t
+}
+
+func rulesTable(L *lvm.LState, rules []dict.AvpRule) *lvm.LTable {
+	t := L.NewTable()
+	for _, rule := range rules {
+		r := L.NewTable()
+		L.SetField(r, "name", lvm.LString(rule.Name))
+		L.SetField(r, "required", lvm.LBool(rule.Required))
+		if rule.Max != nil {
+			L.SetField(r, "max", lvm.LNumber(*rule.Max))
+		} else {
+			L.SetField(r, "max", lvm.LNumber(0))
+		}
+		t.Append(r)
+	}
+
+	return t
+}
+
+func avpTable(L *lvm.LState, avp *dict.Avp) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "code", lvm.LNumber(avp.Code))
+	L.SetField(t, "name", lvm.LString(avp.Name))
+	L.SetField(t, "flags", lvm.LNumber(avp.Flags))
+	L.SetField(t, "vendor_id", lvm.LNumber(avp.VndId))
+	L.SetField(t, "type", lvm.LNumber(avp.Type))
+	if avp.Format != nil {
+		L.SetField(t, "format", lvm.LString(*avp.Format))
+	}
+
+	if avp.Enum != nil {
+		items := L.NewTable()
+		for _, item := range avp.Enum.Items {
+			i := L.NewTable()
+			L.SetField(i, "code", lvm.LNumber(item.Code))
+			L.SetField(i, "name", lvm.LString(item.Name))
+			items.Append(i)
+		}
+		L.SetField(t, "enum", items)
+	}
+
+	if avp.Group != nil {
+		L.SetField(t, "members", rulesTable(L, avp.Group.Members))
+	}
+
+	return t
+}
+
+// Init
+//
+
+func init() {
+	functions = make(map[string]lvm.LGFunction)
+	functions["apps"] = Apps
+	functions["app"] = App
+	functions["commands"] = Commands
+	functions["command"] = Command
+	functions["avps"] = Avps
+	functions["avp"] = Avp
+	functions["members"] = Members
+	functions["enum_code"] = EnumCode
+	functions["enum_name"] = EnumName
+	functions["result"] = Result
+	functions["results"] = Results
+	functions["result_class"] = ResultClass
+}
@@ -0,0 +1,212 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: feed.go
+// Description: Lua API: external data feeds bound to AVP values
+//
+
+package l_feed
+
+import (
+	"tgdp/internal/config"
+	"tgdp/internal/lua/l2g"
+	"tgdp/pkg/diameter"
+
+	lvm "github.com/yuin/gopher-lua"
+)
+
+// Consts
+//
+
+const LuaModuleName = "feed"
+
+// Variables
+//
+
+var functions map[string]lvm.LGFunction
+
+// Functions
+//
+
+// Load loads the data feed from a CSV or JSONL file.
+// Options table: format, select, partitions, on_end, scope (all optional).
+func Load(L *lvm.LState) int {
+	name := L.CheckString(1)
+	file := L.CheckString(2)
+	opts := L.OptTable(3, L.NewTable())
+
+	feedOpts, err := diameter.ParseFeedOptions(
+		lvm.LVAsString(opts.RawGetString("format")),
+		lvm.LVAsString(opts.RawGetString("select")),
+		lvm.LVAsString(opts.RawGetString("on_end")),
+		lvm.LVAsString(opts.RawGetString("scope")),
+		int(lvm.LVAsNumber(opts.RawGetString("partitions"))),
+	)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	feed, err := envOf(L).LoadFeed(name, config.FeedFile(file), feedOpts)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(feedTable(L, feed))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Feeds returns the list of the data feeds.
+func Feeds(L *lvm.LState) int {
+	feeds := L.NewTable()
+	for feed := range envOf(L).FeedIter() {
+		feeds.Append(feedTable(L, feed))
+	}
+
+	L.Push(feeds)
+	return 1
+}
+
+// Bind binds the AVP (ID or name) value to the data feed column.
+func Bind(L *lvm.LState) int {
+	if err := envOf(L).BindFeed(l2g.CheckId(L, 1), L.CheckString(2), L.CheckString(3)); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Unbind removes the data feed binding of the AVP, returns false if the AVP is not bound.
+func Unbind(L *lvm.LState) int {
+	bound, err := envOf(L).UnbindFeed(l2g.CheckId(L, 1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LBool(bound))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Next takes the next row of the data feed for the worker (0 if omitted)
+// and returns it as a table of column values.
+func Next(L *lvm.LState) int {
+	feed, err := envOf(L).Feed(L.CheckString(1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	row, err := feed.NextRow(L.OptInt(2, 0))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	t := L.NewTable()
+	for column, value := range row {
+		L.SetField(t, column, lvm.LString(value))
+	}
+
+	L.Push(t)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// NewSession makes the next message of the worker (0 if omitted) take the next row
+// of the data feed with the session scope.
+func NewSession(L *lvm.LState) int {
+	feed, err := envOf(L).Feed(L.CheckString(1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	feed.NewSession(L.OptInt(2, 0))
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Reset starts the data feed over from the first row.
+func Reset(L *lvm.LState) int {
+	feed, err := envOf(L).Feed(L.CheckString(1))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	feed.Reset()
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Remove removes the data feed and its AVP bindings.
+func Remove(L *lvm.LState) int {
+	if err := envOf(L).RemoveFeed(L.CheckString(1)); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Register creates the data feeds module table.
+func Register(L *lvm.LState) *lvm.LTable {
+	module := L.NewTable()
+	for name, fn := range functions {
+		L.SetField(module, name, L.NewFunction(fn))
+	}
+
+	return module
+}
+
+// Helpers
+//
+
+func envOf(L *lvm.LState) *diameter.Diameter {
+	return L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+}
+
+func pushError(L *lvm.LState, err error) int {
+	L.Push(lvm.LNil)
+	L.Push(lvm.LString(err.Error()))
+	return 2
+}
+
+func feedTable(L *lvm.LState, feed *diameter.AvpFeed) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "name", lvm.LString(feed.Name()))
+	L.SetField(t, "file", lvm.LString(feed.File()))
+	L.SetField(t, "options", lvm.LString(feed.Describe()))
+	L.SetField(t, "rows", lvm.LNumber(feed.Len()))
+	L.SetField(t, "used", lvm.LNumber(feed.Used()))
+
+	columns := L.NewTable()
+	for _, column := range feed.Columns() {
+		columns.Append(lvm.LString(column))
+	}
+	L.SetField(t, "columns", columns)
+
+	return t
+}
+
+// Init
+//
+
+func init() {
+	functions = make(map[string]lvm.LGFunction)
+	functions["load"] = Load
+	functions["feeds"] = Feeds
+	functions["bind"] = Bind
+	functions["unbind"] = Unbind
+	functions["next"] = Next
+	functions["new_session"] = NewSession
+	functions["reset"] = Reset
+	functions["remove"] = Remove
+}
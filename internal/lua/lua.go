@@ -13,12 +13,19 @@ package lua
 import (
 	"context"
 	"log/slog"
+	"path/filepath"
 	"strings"
 	"sync"
 
 	l_avp "tgdp/internal/lua/avp"
+	l_capture "tgdp/internal/lua/capture"
+	l_dict "tgdp/internal/lua/dict"
+	l_feed "tgdp/internal/lua/feed"
 	l_msg "tgdp/internal/lua/message"
 	l_peer "tgdp/internal/lua/peer"
+	l_report "tgdp/internal/lua/report"
+	l_session "tgdp/internal/lua/session"
+	"tgdp/internal/report"
 
 	"tgdp/pkg/diameter"
 
@@ -46,8 +53,22 @@ var statePool = sync.Pool{
 
 // Functions
 //
+// Script executes a Lua script as the test run: the script is the report suite, the cases are started
+// by the script ('diameter.report.case'), the script error is the case error.
+// Returns ErrTestFailed if any case fails.
+func Script(env *diameter.Diameter, argv []string) error {
+	script := strings.TrimLeft(argv[0], "@")
+
+	report.Start(env, "lua", true)
+	report.Suite(filepath.Base(script), script)
+	_ = Run(env, argv)
+
+	return report.Finish(env)
+}
+
 // Run executes a Lua script with the given Diameter environment and arguments.
-func Run(env *diameter.Diameter, argv []string) {
+// Returns the script error, it is also the error of the current report case.
+func Run(env *diameter.Diameter, argv []string) error {
 	script := strings.TrimLeft(argv[0], "@")
 
 	L := statePool.Get().(*lvm.LState)
@@ -71,7 +92,11 @@ func Run(env *diameter.Diameter, argv []string) {
 
 	if err := L.DoFile(script); err != nil {
 		slog.Error("Error executing script", slog.String("script", script), slog.Any("error", err))
+		report.Error(err)
+		return err
 	}
+
+	return nil
 }
 
 func registerConstants(L *lvm.LState, module *lvm.LTable) {
@@ -109,6 +134,11 @@ func registerTypes(L *lvm.LState, module *lvm.LTable) {
 	L.SetField(module, l_peer.LuaTypeName, l_peer.Register(L))
 	L.SetField(module, l_msg.LuaTypeName, l_msg.Register(L))
 	L.SetField(module, l_avp.LuaTypeName, l_avp.Register(L))
+	L.SetField(module, l_dict.LuaModuleName, l_dict.Register(L))
+	L.SetField(module, l_feed.LuaModuleName, l_feed.Register(L))
+	L.SetField(module, l_session.LuaModuleName, l_session.Register(L))
+	L.SetField(module, l_capture.LuaModuleName, l_capture.Register(L))
+	L.SetField(module, l_report.LuaModuleName, l_report.Register(L))
 
 	L.SetField(module, "write_pcap", L.NewFunction(writePcap))
 	L.SetField(module, "dump", L.NewFunction(trace))
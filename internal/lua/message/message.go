@@ -11,8 +11,10 @@
 package l_msg
 
 import (
+	"encoding/hex"
 	"strings"
 	l_avp "tgdp/internal/lua/avp"
+	l_dict "tgdp/internal/lua/dict"
 	"tgdp/internal/lua/l2g"
 	"tgdp/pkg/diameter"
 
@@ -59,6 +61,7 @@ func newMessage(L *lvm.LState, fecthAvp bool) int {
 	appId := l2g.CheckId(L, 1)
 	cmdId := l2g.CheckId(L, 2)
 	request := L.CheckBool(3)
+	peer := L.OptString(4, "")
 
 	env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
@@ -76,7 +79,7 @@ func newMessage(L *lvm.LState, fecthAvp bool) int {
 		return 2
 	}
 
-	msg, err := env.NewMessage(app, cmd, request, fecthAvp)
+	msg, err := env.NewPeerMessage(peer, app, cmd, request, fecthAvp)
 	if err != nil {
 		L.Push(lvm.LNil)
 		L.Push(lvm.LString(err.Error()))
@@ -149,7 +152,7 @@ func SetAvpValue(L *lvm.LState) int {
 			return 1
 		}
 		value := l_avp.PopValue(L, 3, avp)
-		err = avp.SetValue(&value)
+		err = avp.SetValue(value)
 		if err != nil {
 			L.Push(lvm.LString(err.Error()))
 			return 1
@@ -158,6 +161,101 @@ func SetAvpValue(L *lvm.LState) int {
 	return 0
 }
 
+// GetPath returns the message AVPs defined by the path.
+func GetPath(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		avps, err := msg.GetPath(L.CheckString(2))
+		if err != nil {
+			L.Push(lvm.LNil)
+			L.Push(lvm.LString(err.Error()))
+		} else {
+			L.Push(l_avp.AvpsTable(L, avps))
+			L.Push(lvm.LNil)
+		}
+	}
+	return 2
+}
+
+// SetPath sets the value of the message AVP defined by the path.
+func SetPath(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		if err := msg.SetPath(L.CheckString(2), l_avp.PopValue(L, 3, nil)); err != nil {
+			L.Push(lvm.LString(err.Error()))
+			return 1
+		}
+	}
+	return 0
+}
+
+// AddPath adds the message AVP defined by the path.
+func AddPath(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		if err := msg.AddPath(L.CheckString(2), l_avp.PopValue(L, 3, nil)); err != nil {
+			L.Push(lvm.LString(err.Error()))
+			return 1
+		}
+	}
+	return 0
+}
+
+// DeletePath deletes the message AVP defined by the path.
+func DeletePath(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		if err := msg.DeletePath(L.CheckString(2)); err != nil {
+			L.Push(lvm.LString(err.Error()))
+			return 1
+		}
+	}
+	return 0
+}
+
+// Corrupt returns the serialized message with the faults applied as the raw string.
+func Corrupt(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+		faults := []diameter.MessageFault{}
+		for n := 2; n <= L.GetTop(); n++ {
+			fault, err := env.ParseFault(L.CheckString(n))
+			if err != nil {
+				L.Push(lvm.LNil)
+				L.Push(lvm.LString(err.Error()))
+				return 2
+			}
+			faults = append(faults, fault)
+		}
+
+		data, err := msg.Corrupt(faults...)
+		if err != nil {
+			L.Push(lvm.LNil)
+			L.Push(lvm.LString(err.Error()))
+		} else {
+			L.Push(lvm.LString(data))
+			L.Push(lvm.LNil)
+		}
+	}
+	return 2
+}
+
+// FromHex returns the raw string of the hex payload.
+func FromHex(L *lvm.LState) int {
+	data, err := diameter.ParseHex(L.CheckString(1))
+	if err != nil {
+		L.Push(lvm.LNil)
+		L.Push(lvm.LString(err.Error()))
+	} else {
+		L.Push(lvm.LString(data))
+		L.Push(lvm.LNil)
+	}
+	return 2
+}
+
+// ToHex returns the hex text of the raw string.
+func ToHex(L *lvm.LState) int {
+	L.Push(lvm.LString(hex.EncodeToString([]byte(L.CheckString(1)))))
+	return 1
+}
+
 func IsRequest(L *lvm.LState) int {
 	if msg := Check(L, 1); msg != nil {
 		L.Push(lvm.LBool(msg.IsRequest()))
@@ -166,6 +264,49 @@ func IsRequest(L *lvm.LState) int {
 	return 0
 }
 
+func ResultCode(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		code, vndId, err := msg.ResultCode()
+		if err != nil {
+			L.Push(lvm.LNil)
+			L.Push(lvm.LNil)
+			L.Push(lvm.LString(err.Error()))
+			return 3
+		}
+		L.Push(lvm.LNumber(code))
+		L.Push(lvm.LNumber(vndId))
+		L.Push(lvm.LNil)
+		return 3
+	}
+	return 0
+}
+
+func Result(L *lvm.LState) int {
+	if msg := Check(L, 1); msg != nil {
+		code, vndId, err := msg.ResultCode()
+		if err != nil {
+			L.Push(lvm.LNil)
+			L.Push(lvm.LString(err.Error()))
+			return 2
+		}
+		rc, _ := msg.Result()
+		L.Push(l_dict.ResultTable(L, code, vndId, rc))
+		L.Push(lvm.LNil)
+		return 2
+	}
+	return 0
+}
+
+// Release returns the message and its AVPs to the pools, the released message cannot be used anymore.
+func Release(L *lvm.LState) int {
+	ud := L.CheckUserData(1)
+	if msg, ok := ud.Value.(*diameter.Message); ok {
+		msg.Release()
+		ud.Value = nil
+	}
+	return 0
+}
+
 func MetaTable() *lvm.LTable {
 	return metaTable
 }
@@ -185,6 +326,8 @@ func Register(L *lvm.LState) *lvm.LTable {
 
 	L.SetField(metaTable, "new", L.NewFunction(New))
 	L.SetField(metaTable, "fetch", L.NewFunction(Fetch))
+	L.SetField(metaTable, "from_hex", L.NewFunction(FromHex))
+	L.SetField(metaTable, "to_hex", L.NewFunction(ToHex))
 	L.SetField(metaTable, "__index", L.NewFunction(index))
 	L.SetField(metaTable, "__newindex", L.NewFunction(newIndex))
 
@@ -269,5 +412,13 @@ func init() {
 	methods["remove_avp"] = RemoveAvp
 	methods["get_avp_value"] = GetAvpValue
 	methods["set_avp_value"] = SetAvpValue
+	methods["get_path"] = GetPath
+	methods["set_path"] = SetPath
+	methods["add_path"] = AddPath
+	methods["delete_path"] = DeletePath
+	methods["corrupt"] = Corrupt
 	methods["is_request"] = IsRequest
+	methods["result_code"] = ResultCode
+	methods["result"] = Result
+	methods["release"] = Release
 }
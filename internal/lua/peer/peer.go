@@ -125,6 +125,23 @@ func SendTo(L *lvm.LState) int {
 	return 0
 }
 
+// SendRaw sends the raw string (e.g. the corrupted message) to the peer as is.
+func SendRaw(L *lvm.LState) int {
+	if peer := Check(L, 1); peer != nil {
+		env := L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+		if err := env.SendRaw(peer, []byte(L.CheckString(2))); err != nil {
+			L.Push(lvm.LString(err.Error()))
+		} else {
+			L.Push(lvm.LNil)
+		}
+
+		return 1
+	}
+
+	return 0
+}
+
 func RecvFrom(L *lvm.LState) int {
 	peer := Check(L, 1)
 	if peer == nil {
@@ -225,6 +242,7 @@ func init() {
 	methods["connect"] = Connect
 	methods["disconnect"] = Disconnect
 	methods["send_to"] = SendTo
+	methods["send_raw"] = SendRaw
 	methods["recv_from"] = RecvFrom
 	methods["set_timeout"] = SetTimeout
 }
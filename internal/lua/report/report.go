@@ -0,0 +1,100 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: report.go
+// Description: Lua API: test report cases and assertions
+//
+
+package l_report
+
+import (
+	"errors"
+
+	l_msg "tgdp/internal/lua/message"
+	"tgdp/internal/report"
+
+	lvm "github.com/yuin/gopher-lua"
+)
+
+// Consts
+//
+
+const LuaModuleName = "report"
+
+// Variables
+//
+
+var functions map[string]lvm.LGFunction
+
+// Functions
+//
+
+// Case starts the report case, the messages and the checks that follow belong to the case.
+func Case(L *lvm.LState) int {
+	report.Case(L.CheckString(1))
+	return 0
+}
+
+// Check adds the assertion: the name, the condition and the optional message. Returns the condition.
+func Check(L *lvm.LState) int {
+	passed := lvm.LVAsBool(L.Get(2))
+	report.Check(L.CheckString(1), passed, L.OptString(3, ""))
+
+	L.Push(lvm.LBool(passed))
+	return 1
+}
+
+// Result adds the assertion of the answer success result. Returns true or false and the error.
+func Result(L *lvm.LState) int {
+	msg := l_msg.Check(L, 1)
+	if msg == nil {
+		return 0
+	}
+
+	if err := report.CheckResult(msg); err != nil {
+		L.Push(lvm.LFalse)
+		L.Push(lvm.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Fail fails the report case with the message.
+func Fail(L *lvm.LState) int {
+	report.Fail(errors.New(L.CheckString(1)))
+	return 0
+}
+
+// Skip marks the report case as skipped with the reason.
+func Skip(L *lvm.LState) int {
+	report.Skip(L.OptString(1, ""))
+	return 0
+}
+
+// Register creates the report module table.
+func Register(L *lvm.LState) *lvm.LTable {
+	module := L.NewTable()
+	for name, fn := range functions {
+		L.SetField(module, name, L.NewFunction(fn))
+	}
+
+	return module
+}
+
+// Init
+//
+
+func init() {
+	functions = make(map[string]lvm.LGFunction)
+	functions["case"] = Case
+	functions["check"] = Check
+	functions["result"] = Result
+	functions["fail"] = Fail
+	functions["skip"] = Skip
+}
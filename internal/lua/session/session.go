@@ -0,0 +1,139 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: session.go
+// Description: Lua API: Diameter sessions
+//
+
+package l_session
+
+import (
+	"tgdp/pkg/diameter"
+
+	lvm "github.com/yuin/gopher-lua"
+)
+
+// Consts
+//
+
+const LuaModuleName = "session"
+
+// Variables
+//
+
+var functions map[string]lvm.LGFunction
+
+// Functions
+//
+
+// New starts a new session for the peer (optional) and makes it current.
+func New(L *lvm.LState) int {
+	s, err := envOf(L).NewSession(L.OptString(1, ""))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(sessionTable(L, s))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Use makes the session (sequence number or Session-Id) current.
+func Use(L *lvm.LState) int {
+	s, err := envOf(L).UseSession(lvm.LVAsString(L.CheckAny(1)))
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(sessionTable(L, s))
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Close ends the session (sequence number or Session-Id), the current session if omitted.
+func Close(L *lvm.LState) int {
+	id := ""
+	if L.GetTop() > 0 && L.Get(1) != lvm.LNil {
+		id = lvm.LVAsString(L.Get(1))
+	}
+
+	if err := envOf(L).EndSession(id); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lvm.LTrue)
+	L.Push(lvm.LNil)
+	return 2
+}
+
+// Current returns the current session, nil if there is no current session.
+func Current(L *lvm.LState) int {
+	s := envOf(L).CurrentSession()
+	if s == nil {
+		L.Push(lvm.LNil)
+		return 1
+	}
+
+	L.Push(sessionTable(L, s))
+	return 1
+}
+
+// List returns the list of the sessions.
+func List(L *lvm.LState) int {
+	sessions := L.NewTable()
+	for s := range envOf(L).SessionIter() {
+		sessions.Append(sessionTable(L, s))
+	}
+
+	L.Push(sessions)
+	return 1
+}
+
+// Register creates the sessions module table.
+func Register(L *lvm.LState) *lvm.LTable {
+	module := L.NewTable()
+	for name, fn := range functions {
+		L.SetField(module, name, L.NewFunction(fn))
+	}
+
+	return module
+}
+
+// Helpers
+//
+
+func envOf(L *lvm.LState) *diameter.Diameter {
+	return L.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+}
+
+func pushError(L *lvm.LState, err error) int {
+	L.Push(lvm.LNil)
+	L.Push(lvm.LString(err.Error()))
+	return 2
+}
+
+func sessionTable(L *lvm.LState, s *diameter.Session) *lvm.LTable {
+	t := L.NewTable()
+	L.SetField(t, "id", lvm.LString(s.Id()))
+	L.SetField(t, "num", lvm.LNumber(s.Num()))
+	L.SetField(t, "peer", lvm.LString(s.Peer()))
+	L.SetField(t, "messages", lvm.LNumber(s.Messages()))
+	L.SetField(t, "started", lvm.LNumber(s.Started().Unix()))
+
+	return t
+}
+
+// Init
+//
+
+func init() {
+	functions = make(map[string]lvm.LGFunction)
+	functions["new"] = New
+	functions["use"] = Use
+	functions["close"] = Close
+	functions["current"] = Current
+	functions["list"] = List
+}
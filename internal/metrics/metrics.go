@@ -0,0 +1,44 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: metrics.go
+// Description: CLI metrics endpoint handling
+//
+
+package metrics
+
+import (
+	"fmt"
+
+	"tgdp/internal/flags"
+
+	"tgdp/pkg/diameter"
+	dm "tgdp/pkg/diameter/metrics"
+)
+
+// Functions
+//
+
+// Start starts the metrics endpoint of the '-metrics' flag with the traffic and runtime collectors and the mode collectors.
+// Returns nil if the flag is not set.
+func Start(d *diameter.Diameter, collectors ...dm.Collector) (*dm.Exporter, error) {
+	if *flags.Metrics == "" {
+		return nil, nil
+	}
+
+	exporter := dm.New(*flags.Metrics)
+	exporter.Register(dm.Traffic(d))
+	exporter.Register(dm.Runtime())
+	for _, c := range collectors {
+		exporter.Register(c)
+	}
+	if err := exporter.Start(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Metrics on: http://%s%s\n", exporter.Addr(), dm.Path)
+
+	return exporter, nil
+}
@@ -12,10 +12,12 @@ package avp
 
 import (
 	"fmt"
+	"maps"
 	"path/filepath"
 	"slices"
 	"sort"
 	"strconv"
+	"strings"
 
 	"tgdp/internal/config"
 	"tgdp/internal/repl/comp"
@@ -24,6 +26,7 @@ import (
 
 	"github.com/chzyer/readline"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // Constants
@@ -37,15 +40,15 @@ const padOffset = 2
 var (
 	RootCommand = &cobra.Command{
 		Use:   "avp",
-		Short: "avp <list | info | get | set | add | delete | load | purge> [parameters]",
+		Short: "avp <list | info | get | set | add | delete | load | save | purge | feed | bind | unbind> [parameters]",
 		Long:  "Manage AVP global values",
 	}
 
 	SubCommandList = &cobra.Command{
 		Use:     "list",
-		Short:   "avp list",
-		Long:    "Show list of AVP values",
-		Example: "avp list",
+		Short:   "avp list [-p [-a] [<app> <cmd> [peer]]]",
+		Long:    "Show list of AVP values, the list of AVP profiles or the effective AVP values of the command",
+		Example: "avp list --profile S6a UL hss",
 		Run:     list,
 	}
 
@@ -59,33 +62,33 @@ var (
 
 	SubCommandGet = &cobra.Command{
 		Use:     "get",
-		Short:   "avp get <id | name>",
-		Long:    "Get AVP value",
-		Example: "avp get 264",
+		Short:   "avp get <id | name | path>",
+		Long:    "Get AVP value, the path selects the grouped AVP members",
+		Example: "avp get Subscription-Data.APN-Configuration-Profile.APN-Configuration[1].Service-Selection",
 		Run:     get,
 	}
 
 	SubCommandSet = &cobra.Command{
 		Use:     "set",
-		Short:   "avp set <id | name> <index> <value>",
-		Long:    "Set AVP value",
-		Example: "avp set Origin-Host 0 dra01.epc.mnc000.mcc000.3gppnetwork.org",
+		Short:   "avp set <id | name> <index> <value> | <path> <value>",
+		Long:    "Set AVP value, the path selects the grouped AVP member (the missing members are created)",
+		Example: "avp set Subscription-Data.AMBR.Max-Requested-Bandwidth-UL 100000000",
 		Run:     set,
 	}
 
 	SubCommandAdd = &cobra.Command{
 		Use:     "add",
-		Short:   "avp add <id | name> <value>",
-		Long:    "Add value to AVP",
-		Example: "avp add Auth-Application-Id 16777218",
+		Short:   "avp add <id | name | path> <value>",
+		Long:    "Add value to AVP, the path adds the grouped AVP member",
+		Example: "avp add Subscription-Data.APN-Configuration-Profile.APN-Configuration {Context-Identifier: 3, Service-Selection: mms}",
 		Run:     add,
 	}
 
 	SubCommandDel = &cobra.Command{
 		Use:     "delete",
 		Aliases: []string{"del", "rm"},
-		Short:   "avp delete <id | name> <index>",
-		Long:    "Delete value to AVP",
+		Short:   "avp delete <id | name> <index> | <path>",
+		Long:    "Delete value to AVP, the path deletes the grouped AVP member (all occurrences if the index is omitted)",
 		Example: "avp del 258 2",
 		Run:     del,
 	}
@@ -98,6 +101,14 @@ var (
 		Run:     load,
 	}
 
+	SubCommandSave = &cobra.Command{
+		Use:     "save",
+		Short:   "avp save <file.yaml>",
+		Long:    "Save AVP data to a YAML file",
+		Example: "avp save subs-data.yaml",
+		Run:     save,
+	}
+
 	SubCommandPurge = &cobra.Command{
 		Use:     "purge",
 		Short:   "avp purge",
@@ -105,6 +116,42 @@ var (
 		Example: "avp purge",
 		Run:     purge,
 	}
+
+	SubCommandFeed = &cobra.Command{
+		Use:     "feed",
+		Short:   "avp feed [flags] [<name> [<file.csv | file.jsonl>]]",
+		Long:    "Load a data feed from a file, show the data feed or list all data feeds",
+		Example: "avp feed -s random subs data/subscribers.csv",
+		Run:     feed,
+	}
+
+	SubCommandBind = &cobra.Command{
+		Use:     "bind",
+		Short:   "avp bind [<id | name> <feed> <column>]",
+		Long:    "Bind the AVP value to a data feed column or list the bindings",
+		Example: "avp bind User-Name subs imsi",
+		Run:     bind,
+	}
+
+	SubCommandUnbind = &cobra.Command{
+		Use:     "unbind",
+		Short:   "avp unbind <id | name>",
+		Long:    "Remove the AVP data feed binding",
+		Example: "avp unbind User-Name",
+		Run:     unbind,
+	}
+)
+
+var (
+	flagProfile    bool
+	flagAnswer     bool
+	flagFormat     string
+	flagSelect     string
+	flagPartitions int
+	flagOnEnd      string
+	flagScope      string
+	flagReset      bool
+	flagRemove     bool
 )
 
 // Functions
@@ -114,13 +161,21 @@ func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
 	pciSub := []readline.PrefixCompleterInterface{}
 
 	for _, sub := range RootCommand.Commands() {
+		subFlags := []readline.PrefixCompleterInterface{}
+		sub.Flags().VisitAll(func(f *pflag.Flag) {
+			subFlags = append(subFlags, readline.PcItem("-"+f.Shorthand))
+			subFlags = append(subFlags, readline.PcItem("--"+f.Name))
+		})
+
 		switch sub {
 		case SubCommandList:
-			pciSub = append(pciSub, readline.PcItem(sub.Use))
-		case SubCommandLoad:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, append(subFlags, comp.AppList(env, true)...)...))
+		case SubCommandLoad, SubCommandSave:
 			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.FileList(config.YamlDir())...))
+		case SubCommandFeed:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, subFlags...))
 		default:
-			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.AvpList(env)...))
+			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.AvpPathList(env)...))
 		}
 	}
 
@@ -128,8 +183,23 @@ func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
 }
 
 func list(cmd *cobra.Command, args []string) {
+	defer func() {
+		flagProfile, flagAnswer = false, false
+	}()
+
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	if flagProfile {
+		listProfile(cmd, env, args)
+		return
+	}
+
 	listAvpsData(env.Store(), 0)
+
+	if bindings := env.FeedBindings(); len(bindings) > 0 {
+		fmt.Println("Bound to data feeds:")
+		listBindings(env, bindings, padOffset)
+	}
 }
 
 func info(cmd *cobra.Command, args []string) {
@@ -152,6 +222,9 @@ func info(cmd *cobra.Command, args []string) {
 		fmt.Printf("Vendor ID: %d\n", avp.VndId)
 	}
 	fmt.Printf("Type: %s\n", env.Dict().AvpDataTypeName(avp.Type))
+	if avp.Format != nil {
+		fmt.Printf("Format: %s\n", *avp.Format)
+	}
 	switch avp.Type {
 	case env.Dict().AvpDataType().Enumerated:
 		showEnumeratedInfo(avp)
@@ -168,19 +241,37 @@ func get(cmd *cobra.Command, args []string) {
 
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
+	if diameter.IsAvpPath(args[0]) {
+		avps, err := env.Store().GetPath(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, avp := range avps {
+			showAvpData(avp, 0)
+		}
+		return
+	}
+
 	getAvpValues(env, args[0], 0)
 }
 
 func set(cmd *cobra.Command, args []string) {
-	if len(args) < 3 {
+	if len(args) < 2 {
 		fmt.Println(cmd.Short)
 		return
 	}
 
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
-	setAvpValue(env, args)
-	getAvpValues(env, args[0], 0)
+	if diameter.IsAvpPath(args[0]) || len(args) == 2 {
+		if err := env.Store().SetPath(args[0], strings.Join(args[1:], " ")); err != nil {
+			fmt.Println(err)
+		}
+	} else {
+		setAvpValue(env, args)
+	}
+	getAvpValues(env, pathRoot(args[0]), 0)
 }
 
 func add(cmd *cobra.Command, args []string) {
@@ -191,6 +282,14 @@ func add(cmd *cobra.Command, args []string) {
 
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
+	if diameter.IsAvpPath(args[0]) {
+		if err := env.Store().AddPath(args[0], strings.Join(args[1:], " ")); err != nil {
+			fmt.Println(err)
+		}
+		getAvpValues(env, pathRoot(args[0]), 0)
+		return
+	}
+
 	yamlText := fmt.Sprintf("%s: %s", args[0], args[1])
 	if err := env.Store().MakeFromYaml(yamlText, diameter.AvpStoreAppend, 0); err != nil {
 		fmt.Println(err)
@@ -200,13 +299,21 @@ func add(cmd *cobra.Command, args []string) {
 }
 
 func del(cmd *cobra.Command, args []string) {
-	if len(args) != 2 {
+	if len(args) != 1 && len(args) != 2 {
 		fmt.Println(cmd.Short)
 		return
 	}
 
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
+	if len(args) == 1 {
+		if err := env.Store().DeletePath(args[0]); err != nil {
+			fmt.Println(err)
+		}
+		getAvpValues(env, pathRoot(args[0]), 0)
+		return
+	}
+
 	avp, err := env.Dict().GetAvp(args[0])
 	if err != nil {
 		fmt.Println(err)
@@ -246,14 +353,196 @@ func load(cmd *cobra.Command, args []string) {
 	}
 }
 
+func save(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	file := args[0]
+	if file[0] != '/' && file[0] != '.' {
+		file = filepath.Join(config.YamlDir(), file)
+	}
+	if err := env.Store().SaveToFile(file); err != nil {
+		fmt.Println(err)
+	}
+}
+
 func purge(cmd *cobra.Command, args []string) {
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 	env.Store().Purge()
 }
 
+func feed(cmd *cobra.Command, args []string) {
+	defer func() {
+		flagFormat, flagSelect, flagOnEnd, flagScope = "", "", "", ""
+		flagPartitions = 0
+		flagReset, flagRemove = false, false
+	}()
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	switch len(args) {
+	case 0:
+		for f := range env.FeedIter() {
+			showFeed(f)
+		}
+	case 1:
+		if flagRemove {
+			if err := env.RemoveFeed(args[0]); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+
+		f, err := env.Feed(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if flagReset {
+			f.Reset()
+		}
+		showFeed(f)
+		fmt.Printf("  columns: %s\n", strings.Join(f.Columns(), ", "))
+	default:
+		opts, err := diameter.ParseFeedOptions(flagFormat, flagSelect, flagOnEnd, flagScope, flagPartitions)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		f, err := env.LoadFeed(args[0], config.FeedFile(args[1]), opts)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		showFeed(f)
+		fmt.Printf("  columns: %s\n", strings.Join(f.Columns(), ", "))
+	}
+}
+
+func bind(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	switch len(args) {
+	case 0:
+		listBindings(env, env.FeedBindings(), 0)
+	case 3:
+		if err := env.BindFeed(args[0], args[1], args[2]); err != nil {
+			fmt.Println(err)
+		}
+	default:
+		fmt.Println(cmd.Short)
+	}
+}
+
+func unbind(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	bound, err := env.UnbindFeed(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if !bound {
+		fmt.Printf("AVP %s is not bound to a data feed\n", args[0])
+	}
+}
+
 // Helpers
 //
 
+func listProfile(cmd *cobra.Command, env *diameter.Diameter, args []string) {
+	switch len(args) {
+	case 0:
+		for _, name := range env.Profiles() {
+			fmt.Println(name)
+		}
+		return
+	case 1:
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	var peer string
+	if len(args) > 2 {
+		peer = args[2]
+	}
+
+	values, err := env.Profile(peer, args[0], args[1], !flagAnswer)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	width := len("-")
+	for _, value := range values {
+		width = max(width, len(value.Source))
+	}
+
+	for _, value := range values {
+		source := value.Source
+		if source == "" {
+			source = "-"
+		}
+
+		if len(value.Avps) == 0 {
+			fmt.Printf("%*s%-*s %s", padOffset, "", width, source, value.Rule.Name)
+			if value.Rule.Required && !strings.HasPrefix(value.Source, "feed") {
+				fmt.Print(" - required, no value")
+			}
+			fmt.Println()
+			continue
+		}
+
+		for _, avp := range value.Avps {
+			fmt.Printf("%*s%-*s ", padOffset, "", width, source)
+			if avp.IsGrouped() {
+				fmt.Printf("%s (%d)\n", avp.Name(), avp.Code())
+				for _, member := range avp.Value().([]*diameter.Avp) {
+					showAvpData(member, padOffset+width+1+padOffset)
+				}
+			} else {
+				showAvpData(avp, 0)
+			}
+		}
+	}
+}
+
+func showFeed(f *diameter.AvpFeed) {
+	fmt.Printf("%s: %s (%s), rows %d, used %d\n", f.Name(), f.File(), f.Describe(), f.Len(), f.Used())
+}
+
+func listBindings(env *diameter.Diameter, bindings map[uint32]diameter.FeedBinding, shift int) {
+	codes := slices.Collect(maps.Keys(bindings))
+	names := make(map[uint32]string, len(codes))
+	for _, code := range codes {
+		names[code] = strconv.Itoa(int(code))
+		if avp, err := env.Dict().GetAvp(code); err == nil {
+			names[code] = avp.Name
+		}
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		return names[codes[i]] < names[codes[j]]
+	})
+
+	for _, code := range codes {
+		for range shift {
+			fmt.Print(" ")
+		}
+		fmt.Printf("%s (%d) <- %s:%s\n", names[code], code, bindings[code].Feed, bindings[code].Column)
+	}
+}
+
 func listAvpsData(store *diameter.AvpStore, shift int) {
 	var list []*diameter.Avp
 	for _, avps := range slices.Collect(store.Iter()) {
@@ -281,7 +570,9 @@ func showAvpData(avp *diameter.Avp, shift int) {
 			showAvpData(member, shift+2)
 		}
 	} else {
-		if codec, exists := avp.Env().Codec(avp.Type()); exists {
+		if tmpl := avp.Template(); tmpl != "" {
+			fmt.Printf(" = %s\n", tmpl)
+		} else if codec, exists := avp.Codec(); exists {
 			fmt.Printf(" = %s\n", codec.ToText(avp))
 		} else {
 			fmt.Printf(" = %v\n", avp.Value())
@@ -342,6 +633,13 @@ func getAvpValues(env *diameter.Diameter, avpId any, shift int) {
 	}
 }
 
+// pathRoot returns the top level AVP of the path.
+func pathRoot(path string) string {
+	root, _, _ := strings.Cut(path, ".")
+	root, _, _ = strings.Cut(root, "[")
+	return root
+}
+
 func setAvpValue(env *diameter.Diameter, args []string) {
 	index, err := strconv.Atoi(args[1])
 	if err != nil {
@@ -366,5 +664,20 @@ func init() {
 	RootCommand.AddCommand(SubCommandAdd)
 	RootCommand.AddCommand(SubCommandDel)
 	RootCommand.AddCommand(SubCommandLoad)
+	RootCommand.AddCommand(SubCommandSave)
 	RootCommand.AddCommand(SubCommandPurge)
+	RootCommand.AddCommand(SubCommandFeed)
+	RootCommand.AddCommand(SubCommandBind)
+	RootCommand.AddCommand(SubCommandUnbind)
+
+	SubCommandList.Flags().BoolVarP(&flagProfile, "profile", "p", false, "show the AVP profiles or the effective values of the command")
+	SubCommandList.Flags().BoolVarP(&flagAnswer, "answer", "a", false, "show the effective values of the answer")
+
+	SubCommandFeed.Flags().StringVarP(&flagFormat, "format", "f", "", "data file format: csv | jsonl")
+	SubCommandFeed.Flags().StringVarP(&flagSelect, "select", "s", "", "row selection: sequential | random | partitioned")
+	SubCommandFeed.Flags().IntVarP(&flagPartitions, "partitions", "p", 0, "number of partitions (workers)")
+	SubCommandFeed.Flags().StringVarP(&flagOnEnd, "on-end", "e", "", "end of data: wrap | stop")
+	SubCommandFeed.Flags().StringVarP(&flagScope, "scope", "c", "", "next row is taken for each: message | session")
+	SubCommandFeed.Flags().BoolVarP(&flagReset, "reset", "r", false, "start the feed over from the first row")
+	SubCommandFeed.Flags().BoolVarP(&flagRemove, "remove", "d", false, "remove the feed and its bindings")
 }
@@ -0,0 +1,153 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: capture.go
+// Description: REPL: 'capture' command implementation
+//
+
+package capture
+
+import (
+	"fmt"
+	"strconv"
+
+	"tgdp/internal/repl/comp"
+	"tgdp/pkg/diameter"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Variables
+//
+
+var (
+	flagIncrement int64
+
+	RootCommand = &cobra.Command{
+		Use:   "capture",
+		Short: "capture <list | add | delete> [parameters]",
+		Long:  "Capture AVP values of the received messages for the next messages",
+		Run:   list,
+	}
+
+	SubCommandList = &cobra.Command{
+		Use:     "list",
+		Short:   "capture list",
+		Long:    "Show list of capture rules",
+		Example: "capture list",
+		Run:     list,
+	}
+
+	SubCommandAdd = &cobra.Command{
+		Use:     "add",
+		Short:   "capture add [-i <increment>] <app> <cmd[R|A]> <from-avp> [to-avp]",
+		Long:    "Add the capture rule: the AVP value of the received message is stored to the session or global AVP store",
+		Example: "capture add S6a ULA Origin-Host Destination-Host",
+		Run:     add,
+	}
+
+	SubCommandDel = &cobra.Command{
+		Use:     "delete",
+		Short:   "capture delete [num]",
+		Long:    "Delete the capture rule, all rules if the number is not specified",
+		Example: "capture delete 1",
+		Run:     del,
+	}
+)
+
+// Functions
+//
+
+func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
+	pciSub := []readline.PrefixCompleterInterface{}
+
+	for _, sub := range RootCommand.Commands() {
+		subFlags := []readline.PrefixCompleterInterface{}
+		sub.Flags().VisitAll(func(f *pflag.Flag) {
+			subFlags = append(subFlags, readline.PcItem("-"+f.Shorthand))
+			subFlags = append(subFlags, readline.PcItem("--"+f.Name))
+		})
+
+		switch sub {
+		case SubCommandAdd:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, append(subFlags, comp.AppList(env, true)...)...))
+		default:
+			pciSub = append(pciSub, readline.PcItem(sub.Use))
+		}
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItem(RootCommand.Use, pciSub...)}
+}
+
+func list(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	for i, rule := range env.Captures() {
+		fmt.Printf("%3d  on %s capture %s into %s", i+1, rule.Command, rule.From, rule.To)
+		if rule.Increment != 0 {
+			fmt.Printf(" %+d", rule.Increment)
+		}
+		fmt.Println()
+	}
+}
+
+func add(cmd *cobra.Command, args []string) {
+	defer func() {
+		flagIncrement = 0
+	}()
+
+	if len(args) < 3 || len(args) > 4 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	to := ""
+	if len(args) == 4 {
+		to = args[3]
+	}
+
+	if _, err := env.AddCapture(args[0], args[1], args[2], to, flagIncrement); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func del(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	index := -1
+	if len(args) == 1 {
+		num, err := strconv.Atoi(args[0])
+		if err != nil || num < 1 {
+			fmt.Println("Invalid rule number:", args[0])
+			return
+		}
+		index = num - 1
+	}
+
+	if err := env.RemoveCapture(index); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Init
+//
+
+func init() {
+	RootCommand.AddCommand(SubCommandList)
+	RootCommand.AddCommand(SubCommandAdd)
+	RootCommand.AddCommand(SubCommandDel)
+
+	SubCommandAdd.Flags().Int64VarP(&flagIncrement, "increment", "i", 0, "add the increment to the captured integer value")
+}
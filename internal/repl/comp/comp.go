@@ -12,6 +12,7 @@ package comp
 
 import (
 	"os"
+	"strings"
 	"tgdp/pkg/diameter"
 	"tgdp/pkg/diameter/dict"
 
@@ -115,6 +116,25 @@ func AvpList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
 	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(avpsNames())}
 }
 
+// AvpPathList completes the AVP paths: the AVP names and the members of the grouped AVPs
+// defined by the dictionary ("Subscription-Data." is completed with its members).
+func AvpPathList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
+	avpPaths := func() func(string) []string {
+		return func(line string) []string {
+			word := ""
+			if fields := strings.Fields(line); len(fields) > 0 && !strings.HasSuffix(line, " ") {
+				word = fields[len(fields)-1]
+			}
+			if i := strings.LastIndex(word, "."); i >= 0 {
+				return env.AvpPathMembers(word[:i])
+			}
+			return env.AvpPathMembers("")
+		}
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(avpPaths())}
+}
+
 func AvpDataList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
 	avpsNames := func() func(string) []string {
 		return func(line string) []string {
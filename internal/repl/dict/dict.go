@@ -0,0 +1,485 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: dict.go
+// Description: REPL: 'dict' command implementation
+//
+
+package dict
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tgdp/internal/config"
+	"tgdp/internal/repl/comp"
+	"tgdp/pkg/diameter"
+	dd "tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+)
+
+// Variables
+//
+
+var (
+	RootCommand = &cobra.Command{
+		Use:   "dict",
+		Short: "dict <apps | cmds | cmd | avp | results | result | search | reload> [parameters]",
+		Long:  "Explore the Diameter dictionary",
+	}
+
+	SubCommandApps = &cobra.Command{
+		Use:     "apps",
+		Short:   "dict apps",
+		Long:    "Show list of applications",
+		Example: "dict apps",
+		Run:     apps,
+	}
+
+	SubCommandCmds = &cobra.Command{
+		Use:     "cmds",
+		Short:   "dict cmds <app>",
+		Long:    "Show list of application commands",
+		Example: "dict cmds S6a",
+		Run:     cmds,
+	}
+
+	SubCommandCmd = &cobra.Command{
+		Use:     "cmd",
+		Short:   "dict cmd <app> <cmd>",
+		Long:    "Show command request and answer AVP rules",
+		Example: "dict cmd S6a UL",
+		Run:     command,
+	}
+
+	SubCommandAvp = &cobra.Command{
+		Use:     "avp",
+		Short:   "dict avp <id | name>",
+		Long:    "Show AVP definition and its usage",
+		Example: "dict avp Subscription-Data",
+		Run:     avp,
+	}
+
+	SubCommandResults = &cobra.Command{
+		Use:     "results",
+		Short:   "dict results [vendor_id]",
+		Long:    "Show list of Result-Code and Experimental-Result-Code definitions",
+		Example: "dict results 10415",
+		Run:     results,
+	}
+
+	SubCommandResult = &cobra.Command{
+		Use:     "result",
+		Short:   "dict result <code | name> [vendor_id]",
+		Long:    "Show result code definition and class",
+		Example: "dict result 5001 10415",
+		Run:     result,
+	}
+
+	SubCommandSearch = &cobra.Command{
+		Use:     "search",
+		Short:   "dict search <pattern>",
+		Long:    "Search applications, commands, AVPs, enum items and result codes by name",
+		Example: "dict search *-Flags",
+		Run:     search,
+	}
+
+	SubCommandReload = &cobra.Command{
+		Use:     "reload",
+		Short:   "dict reload [file]",
+		Long:    "Reload the dictionary, peers stay connected",
+		Example: "dict reload",
+		Run:     reload,
+	}
+)
+
+// Functions
+//
+
+func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
+	pciSub := []readline.PrefixCompleterInterface{}
+
+	for _, sub := range RootCommand.Commands() {
+		switch sub {
+		case SubCommandCmds:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.AppList(env, false)...))
+		case SubCommandCmd:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.AppList(env, true)...))
+		case SubCommandAvp:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.AvpList(env)...))
+		case SubCommandReload:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.FileList(config.DataDir())...))
+		default:
+			pciSub = append(pciSub, readline.PcItem(sub.Use))
+		}
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItem(RootCommand.Use, pciSub...)}
+}
+
+func apps(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	for app := range env.Dict().AppIter() {
+		fmt.Printf("%-10d %-12s %3d commands", app.Id, app.Name, len(app.Cmds))
+		if app.VndId != 0 {
+			fmt.Printf("  vendor %s (%d)", app.Vnd, app.VndId)
+		}
+		fmt.Println()
+	}
+}
+
+func cmds(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	app, err := env.Dict().GetApp(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Application: %s (%d)\n", app.Name, app.Id)
+	for c := range env.Dict().CmdIter(app) {
+		fmt.Printf("  %-4s %-6d %s\n", c.Short, c.Code, c.Name)
+	}
+}
+
+func command(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	app, err := env.Dict().GetApp(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	c, err := env.Dict().GetCmd(args[1], app)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Application: %s (%d)\n", app.Name, app.Id)
+	fmt.Printf("Command: %s (%d) - %s\n", c.Short, c.Code, c.Name)
+	if flags := cmdFlagsText(env.Dict(), c.Flags); flags != "" {
+		fmt.Printf("Flags: %s\n", flags)
+	}
+	fmt.Printf("Request (%sR):\n", c.Short)
+	showRules(c.Request)
+	fmt.Printf("Answer (%sA):\n", c.Short)
+	showRules(c.Answer)
+}
+
+func avp(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	avp, err := env.Dict().GetAvp(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Code: %d\n", avp.Code)
+	fmt.Printf("Name: %s\n", avp.Name)
+	fmt.Printf("Flags: %s\n", avpFlagsText(env.Dict(), avp.Flags))
+	if avp.VndId != 0 {
+		fmt.Printf("Vendor ID: %d\n", avp.VndId)
+	}
+	fmt.Printf("Type: %s\n", env.Dict().AvpDataTypeName(avp.Type))
+	if avp.Format != nil {
+		fmt.Printf("Format: %s\n", *avp.Format)
+	}
+	if avp.Enum != nil {
+		fmt.Println("Values:")
+		for _, item := range avp.Enum.Items {
+			fmt.Printf("  %s (%d)\n", item.Name, item.Code)
+		}
+	}
+	if avp.Group != nil {
+		fmt.Println("Members:")
+		showRules(avp.Group.Members)
+	}
+
+	usage := avpUsage(env.Dict(), avp.Name)
+	if len(usage) > 0 {
+		fmt.Println("Used by:")
+		for _, user := range usage {
+			fmt.Printf("  %s\n", user)
+		}
+	}
+}
+
+func results(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	vndId, all := uint64(0), true
+	if len(args) > 0 {
+		var err error
+		if vndId, err = strconv.ParseUint(args[0], 10, 32); err != nil {
+			fmt.Println(cmd.Short)
+			return
+		}
+		all = false
+	}
+
+	for rc := range env.Dict().ResultCodeIter() {
+		if all || rc.VndId == uint32(vndId) {
+			showResult(rc)
+		}
+	}
+}
+
+func result(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	vndId := uint64(0)
+	if len(args) > 1 {
+		var err error
+		if vndId, err = strconv.ParseUint(args[1], 10, 32); err != nil {
+			fmt.Println(cmd.Short)
+			return
+		}
+	}
+
+	rc, err := env.Dict().GetResultCode(args[0], uint32(vndId))
+	if err != nil {
+		code, perr := strconv.ParseUint(args[0], 10, 32)
+		if perr != nil {
+			fmt.Println(err)
+			return
+		}
+		// Unknown code is still classified by its value
+		rc = &dd.ResultCode{Code: uint32(code), VndId: uint32(vndId)}
+	}
+
+	fmt.Printf("Code: %d\n", rc.Code)
+	if rc.Name != "" {
+		fmt.Printf("Name: %s\n", rc.Name)
+	}
+	if rc.VndId != 0 {
+		fmt.Printf("Vendor ID: %d (Experimental-Result-Code)\n", rc.VndId)
+	}
+	fmt.Printf("Class: %s\n", dd.ResultClassName(rc.Class()))
+	if rc.Description != "" {
+		fmt.Printf("Description: %s\n", rc.Description)
+	}
+}
+
+func search(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	match := matcher(args[0])
+	found := 0
+
+	for app := range env.Dict().AppIter() {
+		if match(app.Name) {
+			fmt.Printf("App:  %s (%d)\n", app.Name, app.Id)
+			found++
+		}
+		for c := range env.Dict().CmdIter(app) {
+			if match(c.Name) || match(c.Short+"R") || match(c.Short+"A") {
+				fmt.Printf("Cmd:  %s/%s (%d) - %s\n", app.Name, c.Short, c.Code, c.Name)
+				found++
+			}
+		}
+	}
+
+	for avp := range env.Dict().AvpIter() {
+		if match(avp.Name) {
+			fmt.Printf("AVP:  %s (%d)\n", avp.Name, avp.Code)
+			found++
+		}
+		if avp.Enum == nil {
+			continue
+		}
+		for _, item := range avp.Enum.Items {
+			if match(item.Name) {
+				fmt.Printf("Enum: %s = %s (%d)\n", avp.Name, item.Name, item.Code)
+				found++
+			}
+		}
+	}
+
+	for rc := range env.Dict().ResultCodeIter() {
+		if match(rc.Name) {
+			if rc.VndId != 0 {
+				fmt.Printf("Rc:   %s (%d, vendor %d)\n", rc.Name, rc.Code, rc.VndId)
+			} else {
+				fmt.Printf("Rc:   %s (%d)\n", rc.Name, rc.Code)
+			}
+			found++
+		}
+	}
+
+	if found == 0 {
+		fmt.Printf("Nothing found for '%s'\n", args[0])
+	}
+}
+
+func reload(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	file := config.DialDictFile()
+	if len(args) > 0 {
+		file = args[0]
+	}
+
+	if err := env.ReloadDict(file, config.DictFormat()); err != nil {
+		if e, ok := err.(*diwe.ErrInvalidDict); ok {
+			for _, problem := range e.Problems {
+				fmt.Println(problem)
+			}
+		}
+		fmt.Println(err)
+		fmt.Println("Dictionary is not changed")
+		return
+	}
+
+	fmt.Printf("Dictionary reloaded from '%s'\n", file)
+}
+
+// Helpers
+//
+
+// showRules prints AVP rules, asterisks '*' mark required AVPs.
+func showRules(rules []dd.AvpRule) {
+	for _, rule := range rules {
+		if rule.Required {
+			fmt.Print("* ")
+		} else {
+			fmt.Print("  ")
+		}
+
+		if rule.Max != nil && *rule.Max > 0 {
+			fmt.Printf("  %2d %s\n", *rule.Max, rule.Name)
+		} else {
+			fmt.Printf("  -- %s\n", rule.Name)
+		}
+	}
+}
+
+// showResult prints the result code line: code, vendor, class and name.
+func showResult(rc *dd.ResultCode) {
+	fmt.Printf("%-5d %-6d %-13s %s\n", rc.Code, rc.VndId, dd.ResultClassName(rc.Class()), rc.Name)
+}
+
+// avpUsage returns the commands (e.g. "S6a/ULR") and grouped AVPs using the AVP.
+func avpUsage(d *dd.Dict, name string) []string {
+	usage := []string{}
+
+	hasRule := func(rules []dd.AvpRule) bool {
+		for _, rule := range rules {
+			if strings.EqualFold(rule.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for app := range d.AppIter() {
+		for c := range d.CmdIter(app) {
+			if hasRule(c.Request) {
+				usage = append(usage, fmt.Sprintf("%s/%sR", app.Name, c.Short))
+			}
+			if hasRule(c.Answer) {
+				usage = append(usage, fmt.Sprintf("%s/%sA", app.Name, c.Short))
+			}
+		}
+	}
+
+	for avp := range d.AvpIter() {
+		if avp.Group != nil && hasRule(avp.Group.Members) {
+			usage = append(usage, avp.Name)
+		}
+	}
+
+	return usage
+}
+
+// matcher returns a case-insensitive name matcher: glob if the pattern
+// contains wildcards, substring otherwise.
+func matcher(pattern string) func(string) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.ContainsAny(pattern, "*?[") {
+		return func(name string) bool {
+			ok, _ := filepath.Match(pattern, strings.ToLower(name))
+			return ok
+		}
+	}
+
+	return func(name string) bool {
+		return strings.Contains(strings.ToLower(name), pattern)
+	}
+}
+
+func avpFlagsText(d *dd.Dict, flags uint8) string {
+	names := []string{}
+	for _, flag := range []uint8{d.AvpFlag().V, d.AvpFlag().M, d.AvpFlag().P} {
+		if flags&flag != 0 {
+			names = append(names, d.AvpFlagName(flag))
+		}
+	}
+
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, "+")
+}
+
+func cmdFlagsText(d *dd.Dict, flags uint8) string {
+	names := []string{}
+	for _, flag := range []uint8{d.CmdFlag().R, d.CmdFlag().P, d.CmdFlag().E, d.CmdFlag().T} {
+		if flags&flag != 0 {
+			names = append(names, d.CmdFlagName(flag))
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Init
+//
+
+func init() {
+	RootCommand.AddCommand(SubCommandApps)
+	RootCommand.AddCommand(SubCommandCmds)
+	RootCommand.AddCommand(SubCommandCmd)
+	RootCommand.AddCommand(SubCommandAvp)
+	RootCommand.AddCommand(SubCommandResults)
+	RootCommand.AddCommand(SubCommandResult)
+	RootCommand.AddCommand(SubCommandSearch)
+	RootCommand.AddCommand(SubCommandReload)
+}
@@ -0,0 +1,135 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: msg.go
+// Description: REPL: 'msg' command implementation
+//
+
+package msg
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"tgdp/internal/cli"
+	"tgdp/internal/repl/comp"
+	"tgdp/internal/repl/peer"
+	"tgdp/pkg/diameter"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Variables
+//
+
+var (
+	RootCommand = &cobra.Command{
+		Use:   "msg",
+		Short: "msg corrupt [-w | --wait] [-n | --dry-run] <peer> <app> <msg> <fault> [<fault> ...]",
+		Long:  "Build deliberately malformed messages for negative testing",
+	}
+
+	SubCommandCorrupt = &cobra.Command{
+		Use:   "corrupt",
+		Short: "msg corrupt [-w | --wait] [-n | --dry-run] <peer> <app> <msg> <fault> [<fault> ...]",
+		Long: "Build a request, apply the faults to the serialized message and send it to a peer.\n" +
+			"The fault is <kind>[:<avp path>][=<value>], the kinds are:\n" +
+			"  length=<N | +N | -N>         message length (default +4)\n" +
+			"  version=<N>                  protocol version (default 2)\n" +
+			"  flags=<bits>                 set the command flags bits (default 0x0F, reserved)\n" +
+			"  avp-length:<avp>=<N | +N | -N>  AVP length (default +1)\n" +
+			"  no-padding:<avp>             remove the AVP padding\n" +
+			"  enum:<avp>=<N>               Enumerated value (default out of the dictionary range)\n" +
+			"  avp-flags:<avp>=<+X | -X | ~X | N>  set, clear or toggle the V, M, P flags (default ~M)\n" +
+			"  truncate:<avp>=<N>           cut N bytes of the (grouped) AVP data (default 4)",
+		Example: "msg corrupt -w HSS S6a UL version=2 avp-length:User-Name=-2 truncate:Subscription-Data.APN-Configuration-Profile",
+		Run:     corrupt,
+	}
+)
+
+var (
+	flagWait   bool
+	flagDryRun bool
+)
+
+// Functions
+//
+
+func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
+	pciPeers := comp.PeerList(env, true)
+
+	pciSub := []readline.PrefixCompleterInterface{}
+	for _, sub := range RootCommand.Commands() {
+		subFlags := make([]readline.PrefixCompleterInterface, 0)
+		sub.Flags().VisitAll(func(f *pflag.Flag) {
+			subFlags = append(subFlags, readline.PcItem("-"+f.Shorthand, pciPeers...))
+			subFlags = append(subFlags, readline.PcItem("--"+f.Name, pciPeers...))
+		})
+		pciSub = append(pciSub, readline.PcItem(sub.Use, append(subFlags, pciPeers...)...))
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItem(RootCommand.Use, pciSub...)}
+}
+
+func corrupt(cmd *cobra.Command, args []string) {
+	defer func() {
+		flagWait = false
+		flagDryRun = false
+	}()
+
+	if len(args) < 4 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	faults := []diameter.MessageFault{}
+	for _, spec := range args[3:] {
+		fault, err := env.ParseFault(spec)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		faults = append(faults, fault)
+	}
+
+	peerName := peer.NameToId(args[0])
+	msg, err := env.NewPeerMessage(peerName, args[1], args[2], true, true)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer msg.Release()
+	env.Trace(msg, diameter.TraceMsg)
+
+	data, err := msg.Corrupt(faults...)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if flagDryRun {
+		// the payload for the 'send raw' command
+		fmt.Println(hex.EncodeToString(data))
+		return
+	}
+	if err := cli.SendRaw(env, peerName, data, flagWait); err != nil {
+		return
+	}
+}
+
+// Init
+//
+
+func init() {
+	SubCommandCorrupt.Flags().BoolVarP(&flagWait, "wait", "w", false, "wait for data")
+	SubCommandCorrupt.Flags().BoolVarP(&flagDryRun, "dry-run", "n", false, "print the hex payload, do not send")
+
+	RootCommand.AddCommand(SubCommandCorrupt)
+}
@@ -0,0 +1,132 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: overload.go
+// Description: REPL: 'overload' command implementation
+//
+
+package overload
+
+import (
+	"fmt"
+	"time"
+
+	"tgdp/pkg/diameter"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+)
+
+// Variables
+//
+
+var (
+	RootCommand = &cobra.Command{
+		Use:   "overload",
+		Short: "overload <status | on | off | clear>",
+		Long:  "DOIC (RFC 7683) overload control of the requests",
+		Run:   status,
+	}
+
+	SubCommandStatus = &cobra.Command{
+		Use:     "status",
+		Short:   "overload status",
+		Long:    "Show the overload control mode and the received overload reports",
+		Example: "overload status",
+		Run:     status,
+	}
+
+	SubCommandOn = &cobra.Command{
+		Use:     "on",
+		Short:   "overload on",
+		Long:    "Advertise the loss algorithm in the requests and abate the requests to the overloaded nodes",
+		Example: "overload on",
+		Run:     on,
+	}
+
+	SubCommandOff = &cobra.Command{
+		Use:     "off",
+		Short:   "overload off",
+		Long:    "Stop the overload control, the requests are sent as they are",
+		Example: "overload off",
+		Run:     off,
+	}
+
+	SubCommandClear = &cobra.Command{
+		Use:     "clear",
+		Short:   "overload clear",
+		Long:    "Remove the received overload reports",
+		Example: "overload clear",
+		Run:     clearReports,
+	}
+)
+
+// Functions
+//
+
+func CompList() []readline.PrefixCompleterInterface {
+	pciSub := []readline.PrefixCompleterInterface{}
+	for _, sub := range RootCommand.Commands() {
+		pciSub = append(pciSub, readline.PcItem(sub.Use))
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItem(RootCommand.Use, pciSub...)}
+}
+
+func status(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	mode := "OFF"
+	if env.OverloadControl() {
+		mode = "ON"
+	}
+	fmt.Printf("Overload control is: %s, abated requests: %d\n", mode, env.OverloadAbated())
+
+	reports := env.OverloadReports()
+	if len(reports) == 0 {
+		fmt.Println("  no overload reports")
+		return
+	}
+
+	fmt.Printf("  %-6s %-32s %20s %9s %10s %9s\n", "Type", "Node", "Sequence", "Reduction", "Expires in", "Abated")
+	for _, report := range reports {
+		fmt.Printf("  %-6s %-32s %20d %8d%% %10s %9d\n", diameter.OverloadTypeName(report.Type), report.Node,
+			report.Sequence, report.Reduction, time.Until(report.Expires).Truncate(time.Second), report.Abated)
+	}
+}
+
+func on(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	if err := env.SetOverloadControl(true); err != nil {
+		fmt.Println(err)
+		return
+	}
+	status(cmd, nil)
+}
+
+func off(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	env.SetOverloadControl(false) // nolint: errcheck
+	status(cmd, nil)
+}
+
+func clearReports(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	env.ClearOverloadReports()
+}
+
+// Init
+//
+
+func init() {
+	RootCommand.AddCommand(SubCommandStatus)
+	RootCommand.AddCommand(SubCommandOn)
+	RootCommand.AddCommand(SubCommandOff)
+	RootCommand.AddCommand(SubCommandClear)
+}
@@ -71,9 +71,11 @@ func receive(cmd *cobra.Command, args []string) {
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
 	args[0] = peer.NameToId(args[0])
-	if _, err := cli.Receive2(env, args[0], flagWait); !diwe.IsIgnorable(err) {
+	msg, err := cli.Receive2(env, args[0], flagWait)
+	if !diwe.IsIgnorable(err) {
 		fmt.Println(err)
 	}
+	msg.Release()
 }
 
 // Init
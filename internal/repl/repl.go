@@ -22,16 +22,23 @@ import (
 
 	"tgdp/internal/config"
 	"tgdp/internal/repl/avp"
+	"tgdp/internal/repl/capture"
 	"tgdp/internal/repl/comp"
+	"tgdp/internal/repl/dict"
 	"tgdp/internal/repl/echo"
+	"tgdp/internal/repl/msg"
+	"tgdp/internal/repl/overload"
 	"tgdp/internal/repl/pcap"
 	"tgdp/internal/repl/peer"
 	"tgdp/internal/repl/receive"
 	"tgdp/internal/repl/script"
 	"tgdp/internal/repl/send"
 	"tgdp/internal/repl/server"
+	"tgdp/internal/repl/session"
+	"tgdp/internal/repl/stats"
 	"tgdp/internal/repl/verbose"
 	"tgdp/internal/repl/version"
+	"tgdp/internal/report"
 	"tgdp/pkg/diameter"
 
 	"github.com/chzyer/readline"
@@ -47,13 +54,19 @@ var (
 		commandQuit,
 		commandBatch,
 		avp.RootCommand,
+		capture.RootCommand,
+		dict.RootCommand,
 		echo.RootCommand,
+		msg.RootCommand,
+		overload.RootCommand,
 		pcap.RootCommand,
 		peer.RootCommand,
 		receive.RootCommand,
 		script.RootCommand,
 		send.RootCommand,
 		server.RootCommand,
+		session.RootCommand,
+		stats.RootCommand,
 		verbose.RootCommand,
 		version.RootCommand,
 	}
@@ -92,17 +105,7 @@ var (
 //
 
 func Run(env *diameter.Diameter) {
-	for _, cmd := range commands {
-		rootCommand.AddCommand(cmd)
-		if cmd != commandHelp {
-			commandHelp.AddCommand(cmd)
-		}
-	}
-	commandHelp.Run = help
-
-	bg := context.Background()
-	ctx := context.WithValue(bg, diameter.EnvContext, env)
-	rootCommand.SetContext(ctx)
+	setup(env)
 
 	tgdpDir := config.DataDir()
 
@@ -163,6 +166,36 @@ func Run(env *diameter.Diameter) {
 	}
 }
 
+// Batch executes the batch files without the interactive input, each file is the report suite
+// and each command line is the report case. Returns ErrTestFailed if any command fails.
+func Batch(env *diameter.Diameter, files []string) error {
+	setup(env)
+	defer func() {
+		env.Cancel()
+		env.Wait()
+		env.Peers().DisconnectAll(false)
+	}()
+
+	report.Start(env, "batch", true)
+	batch(commandBatch, files)
+
+	return report.Finish(env)
+}
+
+func setup(env *diameter.Diameter) {
+	for _, cmd := range commands {
+		rootCommand.AddCommand(cmd)
+		if cmd != commandHelp {
+			commandHelp.AddCommand(cmd)
+		}
+	}
+	commandHelp.Run = help
+
+	bg := context.Background()
+	ctx := context.WithValue(bg, diameter.EnvContext, env)
+	rootCommand.SetContext(ctx)
+}
+
 func completionList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
 	pciList := []readline.PrefixCompleterInterface{}
 
@@ -170,13 +203,19 @@ func completionList(env *diameter.Diameter) []readline.PrefixCompleterInterface
 	pciList = append(pciList, readline.PcItem(commandQuit.Use))
 	pciList = append(pciList, readline.PcItem(commandBatch.Use, comp.FileList(config.BatchDir())...))
 	pciList = append(pciList, avp.CompList(env)...)
+	pciList = append(pciList, capture.CompList(env)...)
+	pciList = append(pciList, dict.CompList(env)...)
 	pciList = append(pciList, echo.CompList()...)
+	pciList = append(pciList, msg.CompList(env)...)
+	pciList = append(pciList, overload.CompList()...)
 	pciList = append(pciList, pcap.CompList(env)...)
 	pciList = append(pciList, peer.CompList(env)...)
 	pciList = append(pciList, receive.CompList(env)...)
 	pciList = append(pciList, script.CompList()...)
 	pciList = append(pciList, send.CompList(env)...)
 	pciList = append(pciList, server.CompList()...)
+	pciList = append(pciList, session.CompList(env)...)
+	pciList = append(pciList, stats.CompList(env)...)
 	pciList = append(pciList, verbose.CompList()...)
 	pciList = append(pciList, version.CompList()...)
 
@@ -225,9 +264,11 @@ func batch(cmd *cobra.Command, args []string) {
 			file = filepath.Join(config.BatchDir(), file)
 		}
 
+		report.Suite(filepath.Base(file), file)
 		fd, err := os.Open(file)
 		if err != nil {
 			fmt.Println(err)
+			report.Fail(err)
 			continue
 		}
 
@@ -240,14 +281,17 @@ func batch(cmd *cobra.Command, args []string) {
 			}
 
 			args := strings.Fields(input)
+			report.Case(input)
 			rootCommand.SetArgs(args)
 			if err := rootCommand.Execute(); err != nil {
 				fmt.Println(err)
+				report.Fail(err)
 			}
 		}
 
 		if err := scanner.Err(); err != nil {
 			fmt.Println(err)
+			report.Fail(err)
 		}
 
 		fd.Close() //nolint:errcheck
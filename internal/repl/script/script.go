@@ -51,5 +51,5 @@ func script(cmd *cobra.Command, args []string) {
 
 	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
 
-	lua.Run(env, args)
+	_ = lua.Run(env, args)
 }
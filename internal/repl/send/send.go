@@ -12,6 +12,7 @@ package send
 
 import (
 	"fmt"
+	"strings"
 
 	"tgdp/internal/cli"
 	"tgdp/internal/repl/comp"
@@ -29,7 +30,7 @@ import (
 var (
 	RootCommand = &cobra.Command{
 		Use:   "send",
-		Short: "send  <request [-w | --wait] | answer> <peer> <app> <msg> [<msg> ...]",
+		Short: "send  <request [-w | --wait] | answer | raw [-w | --wait]> <peer> <app> <msg> [<msg> ...] | <hex>",
 		Long:  "Send a message[s] to a peer",
 	}
 
@@ -50,6 +51,14 @@ var (
 		Example: "send answer DRA 0 dw",
 		Run:     answer,
 	}
+
+	SubCommandRaw = &cobra.Command{
+		Use:     "raw",
+		Short:   "send raw [-w | --wait] <peer> <hex> [<hex> ...]",
+		Long:    "Send a raw hex payload to a peer as is, e.g. a malformed message for negative testing",
+		Example: "send raw -w HSS 01000014 80000118 00000000 00000001 00000001",
+		Run:     raw,
+	}
 )
 
 var (
@@ -79,10 +88,11 @@ var (
 //   76 │ }
 
 func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
-	pciPeers := comp.PeerList(env, true)
-
 	pciSub := []readline.PrefixCompleterInterface{}
 	for _, sub := range RootCommand.Commands() {
+		// the raw payload has no application and command
+		pciPeers := comp.PeerList(env, sub != SubCommandRaw)
+
 		subFlags := make([]readline.PrefixCompleterInterface, 0)
 		sub.Flags().VisitAll(func(f *pflag.Flag) {
 			subFlags = append(subFlags, readline.PcItem("-"+f.Shorthand, pciPeers...))
@@ -124,12 +134,36 @@ func send(cmd *cobra.Command, args []string, request bool) {
 	}
 }
 
+func raw(cmd *cobra.Command, args []string) {
+	defer func() {
+		flagWait = false
+	}()
+
+	if len(args) < 2 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	data, err := diameter.ParseHex(strings.Join(args[1:], ""))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := cli.SendRaw(env, peer.NameToId(args[0]), data, flagWait); err != nil {
+		return
+	}
+}
+
 // Init
 //
 
 func init() {
 	SubCommandReq.Flags().BoolVarP(&flagWait, "wait", "w", false, "wait for data")
+	SubCommandRaw.Flags().BoolVarP(&flagWait, "wait", "w", false, "wait for data")
 
 	RootCommand.AddCommand(SubCommandReq)
 	RootCommand.AddCommand(SubCommandAns)
+	RootCommand.AddCommand(SubCommandRaw)
 }
@@ -13,7 +13,9 @@ package server
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"tgdp/pkg/diameter"
 	ds "tgdp/pkg/diameter/net/server"
@@ -34,7 +36,7 @@ var (
 var (
 	RootCommand = &cobra.Command{
 		Use:       "server",
-		Short:     "server <start | stop | status | autoreply> [<address> [port]]",
+		Short:     "server <start | stop | status | autoreply | overload> [<address> [port]]",
 		Long:      "Control Diameter server",
 		ValidArgs: []string{"start", "stop", "status"},
 	}
@@ -70,6 +72,14 @@ var (
 		Example: "server autoreply on",
 		Run:     autoreply,
 	}
+
+	SubCommandOverload = &cobra.Command{
+		Use:     "overload",
+		Short:   "server overload [off | <reduction> [validity] [host | realm]]",
+		Long:    "Add the overload report (OC-OLR) to the answers to the requests advertising DOIC support",
+		Example: "server overload 20 30s realm",
+		Run:     overload,
+	}
 )
 
 // Functions
@@ -81,6 +91,8 @@ func CompList() []readline.PrefixCompleterInterface {
 		switch sub {
 		case SubCommandAutoReply:
 			pciSub = append(pciSub, readline.PcItem(sub.Use, readline.PcItem("on"), readline.PcItem("off")))
+		case SubCommandOverload:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, readline.PcItem("off")))
 		case SubCommandStart:
 			pciSub = append(pciSub, readline.PcItem(sub.Use, getHostAddrs()...))
 		default:
@@ -162,6 +174,52 @@ func autoreply(cmd *cobra.Command, args []string) {
 	autoreply(cmd, nil)
 }
 
+func overload(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	if len(args) > 3 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	switch {
+	case len(args) == 0:
+	case strings.ToLower(args[0]) == "off":
+		env.SetOverloadAnswer(nil) // nolint: errcheck
+	default:
+		reduction, err := strconv.ParseUint(strings.TrimSuffix(args[0], "%"), 10, 32)
+		if err != nil {
+			fmt.Printf("Invalid reduction percentage: %s\n", args[0])
+			return
+		}
+		report := &diameter.OverloadReport{Reduction: uint32(reduction), Validity: diameter.OverloadDefaultValidity}
+		if len(args) > 1 {
+			if report.Validity, err = time.ParseDuration(args[1]); err != nil {
+				fmt.Printf("Invalid validity: %s\n", args[1])
+				return
+			}
+		}
+		if len(args) > 2 {
+			if report.Type, err = diameter.ParseOverloadType(args[2]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		if err := env.SetOverloadAnswer(report); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	report := env.OverloadAnswer()
+	if report == nil {
+		fmt.Println("Overload report is: OFF")
+		return
+	}
+	fmt.Printf("Overload report is: %s, sequence %d, reduction %d%%, validity %s\n",
+		strings.ToUpper(diameter.OverloadTypeName(report.Type)), report.Sequence, report.Reduction, report.Validity)
+}
+
 // Helpers
 //
 
@@ -187,4 +245,5 @@ func init() {
 	RootCommand.AddCommand(SubCommandStop)
 	RootCommand.AddCommand(SubCommandStatus)
 	RootCommand.AddCommand(SubCommandAutoReply)
+	RootCommand.AddCommand(SubCommandOverload)
 }
@@ -0,0 +1,208 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: session.go
+// Description: REPL: 'session' command implementation
+//
+
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"tgdp/internal/repl/comp"
+	"tgdp/pkg/diameter"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+)
+
+// Variables
+//
+
+var (
+	RootCommand = &cobra.Command{
+		Use:   "session",
+		Short: "session <list | new | use | end | show> [parameters]",
+		Long:  "Manage Diameter sessions",
+		Run:   list,
+	}
+
+	SubCommandList = &cobra.Command{
+		Use:     "list",
+		Short:   "session list",
+		Long:    "Show list of sessions, the current session is marked with '*'",
+		Example: "session list",
+		Run:     list,
+	}
+
+	SubCommandNew = &cobra.Command{
+		Use:     "new",
+		Short:   "session new [peer]",
+		Long:    "Start a new session and make it current",
+		Example: "session new hss",
+		Run:     newSession,
+	}
+
+	SubCommandUse = &cobra.Command{
+		Use:     "use",
+		Short:   "session use <num | Session-Id>",
+		Long:    "Make the session current",
+		Example: "session use 2",
+		Run:     use,
+	}
+
+	SubCommandEnd = &cobra.Command{
+		Use:     "end",
+		Short:   "session end [num | Session-Id]",
+		Long:    "End the session, the current session by default",
+		Example: "session end 2",
+		Run:     end,
+	}
+
+	SubCommandShow = &cobra.Command{
+		Use:     "show",
+		Short:   "session show [num | Session-Id]",
+		Long:    "Show the session AVP values, the current session by default",
+		Example: "session show",
+		Run:     show,
+	}
+)
+
+// Functions
+//
+
+func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
+	pciSub := []readline.PrefixCompleterInterface{}
+
+	sessionNums := func(line string) []string {
+		nums := []string{}
+		for s := range env.SessionIter() {
+			nums = append(nums, strconv.Itoa(s.Num()))
+		}
+		return nums
+	}
+
+	for _, sub := range RootCommand.Commands() {
+		switch sub {
+		case SubCommandNew:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, comp.PeerList(env, false)...))
+		case SubCommandUse, SubCommandEnd, SubCommandShow:
+			pciSub = append(pciSub, readline.PcItem(sub.Use, readline.PcItemDynamic(sessionNums)))
+		default:
+			pciSub = append(pciSub, readline.PcItem(sub.Use))
+		}
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItem(RootCommand.Use, pciSub...)}
+}
+
+func list(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	current := env.CurrentSession()
+	for s := range env.SessionIter() {
+		mark := "   "
+		if s == current {
+			mark = " * "
+		}
+		fmt.Printf("%3d%s%s \t%s \t%d \t%s\n", s.Num(), mark, s.Id(), s.Peer(), s.Messages(),
+			time.Since(s.Started()).Truncate(time.Second))
+	}
+}
+
+func newSession(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	peer := ""
+	if len(args) == 1 {
+		if _, err := env.Peers().GetByName(args[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+		peer = args[0]
+	}
+
+	if s, err := env.NewSession(peer); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Printf("Session %d started: %s\n", s.Num(), s.Id())
+	}
+}
+
+func use(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	if s, err := env.UseSession(args[0]); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Printf("Session %d is current: %s\n", s.Num(), s.Id())
+	}
+}
+
+func end(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	id := ""
+	if len(args) == 1 {
+		id = args[0]
+	}
+	if err := env.EndSession(id); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func show(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		fmt.Println(cmd.Short)
+		return
+	}
+
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+
+	s := env.CurrentSession()
+	if len(args) == 1 {
+		var err error
+		if s, err = env.Session(args[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else if s == nil {
+		fmt.Println("No current session")
+		return
+	}
+
+	fmt.Printf("Session %d: %s\n", s.Num(), s.Id())
+	s.Store().Dump(2)
+}
+
+// Init
+//
+
+func init() {
+	RootCommand.AddCommand(SubCommandList)
+	RootCommand.AddCommand(SubCommandNew)
+	RootCommand.AddCommand(SubCommandUse)
+	RootCommand.AddCommand(SubCommandEnd)
+	RootCommand.AddCommand(SubCommandShow)
+}
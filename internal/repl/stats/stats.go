@@ -0,0 +1,138 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: stats.go
+// Description: REPL: 'stats' command implementation
+//
+
+package stats
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"tgdp/pkg/diameter"
+	ds "tgdp/pkg/diameter/stats"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+)
+
+// Variables
+//
+
+var (
+	RootCommand = &cobra.Command{
+		Use:   "stats",
+		Short: "stats <show | reset>",
+		Long:  "Show or reset the traffic statistics",
+		Run:   show,
+	}
+
+	SubCommandShow = &cobra.Command{
+		Use:     "show",
+		Short:   "stats show",
+		Long:    "Show the messages, bytes, timeouts, result codes and latencies by peer and command, the runtime statistics",
+		Example: "stats show",
+		Run:     show,
+	}
+
+	SubCommandReset = &cobra.Command{
+		Use:     "reset",
+		Short:   "stats reset",
+		Long:    "Reset the traffic statistics",
+		Example: "stats reset",
+		Run:     reset,
+	}
+)
+
+// Functions
+//
+
+func CompList(env *diameter.Diameter) []readline.PrefixCompleterInterface {
+	pciSub := []readline.PrefixCompleterInterface{}
+	for _, sub := range RootCommand.Commands() {
+		pciSub = append(pciSub, readline.PcItem(sub.Use))
+	}
+
+	return []readline.PrefixCompleterInterface{readline.PcItem(RootCommand.Use, pciSub...)}
+}
+
+func show(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	snapshot := env.Stats().Snapshot()
+
+	fmt.Printf("Statistics for %s (since %s):\n",
+		snapshot.Elapsed().Truncate(time.Second), snapshot.Started.Format(time.TimeOnly))
+	defer printRuntime()
+	if len(snapshot.Entries) == 0 {
+		fmt.Println("  no traffic")
+		return
+	}
+
+	fmt.Printf("  %-24s %-8s %-6s %9s %9s %9s %9s %8s %8s %11s %11s\n", "Peer", "App", "Cmd",
+		"Req-Tx", "Req-Rx", "Ans-Tx", "Ans-Rx", "Timeout", "Retrans", "Bytes-Tx", "Bytes-Rx")
+	for _, entry := range snapshot.Entries {
+		appName, cmdName := env.CommandNames(entry.AppId, entry.CmdCode)
+		printCounters(entry.Peer, appName, cmdName, &entry.Counters)
+	}
+	total := snapshot.Total()
+	printCounters("Total", "", "", &total)
+
+	fmt.Println("Latency:")
+	for _, entry := range snapshot.Entries {
+		if entry.Latency.Count() > 0 {
+			appName, cmdName := env.CommandNames(entry.AppId, entry.CmdCode)
+			fmt.Printf("  %-24s %-8s %-6s %s\n", entry.Peer, appName, cmdName, &entry.Latency)
+		}
+	}
+
+	fmt.Println("Result codes:")
+	for _, code := range slices.Sorted(maps.Keys(total.Results)) {
+		name := ""
+		if rc, err := env.Dict().GetResultCodeByCode(code, 0); err == nil {
+			name = rc.Name
+		}
+		fmt.Printf("  %-6d %-40s %d\n", code, name, total.Results[code])
+	}
+}
+
+func reset(cmd *cobra.Command, args []string) {
+	env := cmd.Context().Value(diameter.EnvContext).(*diameter.Diameter)
+	env.Stats().Reset()
+}
+
+// Helpers
+//
+
+// printCounters prints the one line of the counters table.
+func printCounters(peer, app, cmd string, c *ds.Counters) {
+	fmt.Printf("  %-24s %-8s %-6s %9d %9d %9d %9d %8d %8d %11d %11d\n", peer, app, cmd,
+		c.RequestsSent, c.RequestsRecv, c.AnswersSent, c.AnswersRecv, c.Timeouts, c.Retransmissions,
+		c.BytesSent, c.BytesRecv)
+}
+
+// printRuntime prints the runtime statistics of the process and the use of the message and AVP pools.
+func printRuntime() {
+	rt := diameter.RuntimeStats()
+
+	fmt.Println("Runtime:")
+	fmt.Printf("  Heap live %s, allocated %s (%d objects), sys %s\n", ds.FormatBytes(rt.HeapLive),
+		ds.FormatBytes(rt.HeapAlloc), rt.HeapObjects, ds.FormatBytes(rt.Sys))
+	fmt.Printf("  GC cycles %d, goroutines %d\n", rt.GCs, rt.Goroutines)
+	fmt.Printf("  Message pool: %d gets, %d hits, %s\n", rt.Messages.Gets, rt.Messages.Hits(), rt.Messages)
+	fmt.Printf("  AVP pool:     %d gets, %d hits, %s\n", rt.Avps.Gets, rt.Avps.Hits(), rt.Avps)
+}
+
+// Init
+//
+
+func init() {
+	RootCommand.AddCommand(SubCommandShow)
+	RootCommand.AddCommand(SubCommandReset)
+}
@@ -0,0 +1,175 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: report.go
+// Description: CLI test report handling
+//
+
+package report
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"tgdp/internal/flags"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+	dr "tgdp/pkg/diameter/report"
+)
+
+// Variables
+//
+
+// recorder is the recorder of the test run, nil if the run is not started
+var recorder *dr.Recorder
+
+// Functions
+//
+
+// Start starts the test run report, the cases outcome is recorded for the exit code. With the '-report' flag
+// and tap set the messages of the peers are also recorded to the current case.
+func Start(d *diameter.Diameter, name string, tap bool) {
+	recorder = dr.NewRecorder(name)
+	if *flags.Report == "" || !tap {
+		return
+	}
+
+	d.Peers().SetTap(func(data []byte, peer *node.Node, sent bool) {
+		recorder.Message(Message(d, data, peer.Name, sent, time.Now()))
+	})
+}
+
+// Recorder returns the recorder of the started report, nil if the report is not started.
+func Recorder() *dr.Recorder {
+	return recorder
+}
+
+// Suite starts the report suite.
+func Suite(name, file string) {
+	if recorder != nil {
+		recorder.Suite(name, file)
+	}
+}
+
+// Case starts the report case.
+func Case(name string) {
+	if recorder != nil {
+		recorder.Case(name)
+	}
+}
+
+// Check adds the assertion to the report case.
+func Check(name string, passed bool, message string) {
+	if recorder != nil {
+		recorder.Check(name, passed, message)
+	}
+}
+
+// Fail fails the report case.
+func Fail(err error) {
+	if recorder != nil {
+		recorder.Fail(err)
+	}
+}
+
+// Error marks the report case as not completed because of the error.
+func Error(err error) {
+	if recorder != nil {
+		recorder.Error(err)
+	}
+}
+
+// Skip marks the report case as skipped.
+func Skip(reason string) {
+	if recorder != nil {
+		recorder.Skip(reason)
+	}
+}
+
+// CheckResult adds the result assertion of the answer to the report case.
+// Returns ErrUnexpectedResult if the result is not success.
+func CheckResult(msg *diameter.Message) error {
+	code, _, err := msg.ResultCode()
+	if err != nil {
+		Check("Result-Code", false, err.Error())
+		return err
+	}
+
+	text := fmt.Sprint(code)
+	if rc, _ := msg.Result(); rc != nil {
+		text = fmt.Sprintf("%s (%d)", rc.Name, code)
+	}
+	if msg.ResultClass() != dict.ResultClassSuccess {
+		err := &diwe.ErrUnexpectedResult{Result: text, Expected: "success"}
+		Check("Result-Code", false, err.Error())
+		return err
+	}
+	Check("Result-Code", true, text)
+
+	return nil
+}
+
+// Finish completes the test run and saves the report to the '-report' flag files.
+// Returns ErrTestFailed if any case is failed or the save error, nil if the run is not started.
+func Finish(d *diameter.Diameter) error {
+	if recorder == nil {
+		return nil
+	}
+	d.Peers().SetTap(nil)
+
+	rep := recorder.End()
+	counts := rep.Counts()
+	if *flags.Report != "" {
+		files := strings.Split(*flags.Report, ",")
+		if err := dr.Save(rep, files...); err != nil {
+			return err
+		}
+		fmt.Printf("Report: %d tests, %d failed, %d errors, %d skipped -> %s\n",
+			counts.Tests, counts.Failed, counts.Errors, counts.Skipped, strings.Join(files, ", "))
+	}
+
+	if !rep.Passed() {
+		return &diwe.ErrTestFailed{Failed: counts.Failed, Errors: counts.Errors}
+	}
+
+	return nil
+}
+
+// Message returns the report message of the message data, the message is decoded if it is valid.
+func Message(d *diameter.Diameter, data []byte, peer string, sent bool, t time.Time) dr.Message {
+	rm := dr.Message{Sent: sent, Peer: peer, Time: t, Hex: hex.EncodeToString(data)}
+
+	msg, err := d.BytesToMessage(data)
+	if err != nil {
+		rm.Command = "invalid: " + err.Error()
+		return rm
+	}
+	defer msg.Release()
+
+	rm.Command = fmt.Sprintf("%d/%d", msg.AppId, msg.CmdCode)
+	if app, _ := d.Dict().GetAppById(msg.AppId); app != nil {
+		if cmd, _ := d.Dict().GetCmdByCode(msg.CmdCode, app); cmd != nil {
+			rm.Command = fmt.Sprintf("%s %s", app.Name, cmd.Short)
+		}
+	}
+	if msg.IsRequest() {
+		rm.Command += "R"
+	} else {
+		rm.Command += "A"
+	}
+
+	sb := strings.Builder{}
+	if err := msg.WriteText(&sb); err == nil {
+		rm.Text = sb.String()
+	}
+
+	return rm
+}
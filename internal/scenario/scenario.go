@@ -0,0 +1,169 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: scenario.go
+// Description: CLI scenario mode
+//
+
+package scenario
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"tgdp/internal/flags"
+	"tgdp/internal/report"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+	dr "tgdp/pkg/diameter/report"
+	ds "tgdp/pkg/diameter/scenario"
+)
+
+// Consts
+//
+
+// Command is the first command line argument of the scenario mode.
+const Command = "scenario"
+
+// Functions
+//
+
+// Run runs the scenario files: tgdp [flags] scenario run <file> [<file> ...].
+// Returns ErrTestFailed if any scenario fails.
+func Run(d *diameter.Diameter, args []string) error {
+	if len(args) < 2 || args[0] != "run" {
+		fmt.Printf("Usage: %s [flags] %s run <file> [<file> ...]\n", os.Args[0], Command)
+		os.Exit(255)
+	}
+
+	if *flags.N {
+		return &diwe.ErrOfflineUnsupported{Mode: Command}
+	}
+
+	scenarios := []*ds.Scenario{}
+	for _, file := range args[1:] {
+		sc, err := ds.Load(d, file)
+		if err != nil {
+			return err
+		}
+		scenarios = append(scenarios, sc)
+	}
+
+	ccChan := make(chan os.Signal, 1)
+	signal.Notify(ccChan, os.Interrupt)
+	go func() {
+		if _, ok := <-ccChan; ok {
+			d.Cancel()
+		}
+	}()
+
+	report.Start(d, Command, false)
+	failed := 0
+	for _, sc := range scenarios {
+		result := sc.Run(d.Context(), d)
+		show(result)
+		record(d, result)
+		if !result.Passed() {
+			failed++
+		}
+	}
+	signal.Stop(ccChan)
+	close(ccChan)
+
+	disconnect(d)
+
+	if len(scenarios) > 1 {
+		fmt.Printf("\nScenarios: %d passed, %d failed\n", len(scenarios)-failed, failed)
+	}
+	if err := report.Finish(d); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &diwe.ErrTestFailed{Failed: failed}
+	}
+
+	return nil
+}
+
+// Helpers
+//
+
+// show prints the step results and the scenario summary.
+func show(result *ds.Result) {
+	sc := result.Scenario
+	fmt.Printf("\nScenario '%s' (%s)\n", sc.Name, sc.File())
+
+	for i, step := range result.Steps {
+		line := fmt.Sprintf("  %s  %2d. %s", step.Status, i+1, step.Step)
+		if step.Status != ds.StatusSkip {
+			line += fmt.Sprintf("  %s", step.Duration.Round(time.Millisecond))
+		}
+		if step.Err != nil {
+			line += fmt.Sprintf("\n        %v", step.Err)
+		}
+		fmt.Println(line)
+	}
+
+	status := ds.StatusPass
+	if !result.Passed() {
+		status = ds.StatusFail
+	}
+	passed, failed, skipped := result.Counts()
+	fmt.Printf("Result: %s (%d passed, %d failed, %d skipped) in %s\n",
+		status, passed, failed, skipped, result.Duration.Round(time.Millisecond))
+}
+
+// record adds the scenario result to the test report: the scenario is the suite, the steps are the cases
+// with the step messages.
+func record(d *diameter.Diameter, result *ds.Result) {
+	sc := result.Scenario
+	rec := report.Recorder()
+	rec.Suite(sc.Name, sc.File())
+
+	for i, step := range result.Steps {
+		c := &dr.Case{Name: fmt.Sprintf("%d. %s", i+1, step.Step), Duration: step.Duration}
+		switch step.Status {
+		case ds.StatusPass:
+			c.Status = dr.StatusPassed
+		case ds.StatusFail:
+			c.Status = dr.StatusFailed
+		default:
+			c.Status = dr.StatusSkipped
+		}
+		if step.Err != nil {
+			c.Error = step.Err.Error()
+		}
+		if step.Step.Expect != nil && step.Status != ds.StatusSkip {
+			c.Assertions = append(c.Assertions, dr.Assertion{Name: "expect", Passed: step.Status == ds.StatusPass, Message: c.Error})
+		}
+
+		for _, r := range result.Messages {
+			if r.Step != i+1 {
+				continue
+			}
+			if c.Started.IsZero() {
+				c.Started = r.Time
+			}
+			c.Messages = append(c.Messages, report.Message(d, r.Data, step.Step.Peer, r.Sent, r.Time))
+		}
+		rec.AddCase(c)
+	}
+}
+
+// disconnect disconnects the connected peers.
+func disconnect(d *diameter.Diameter) {
+	for peer := range d.Peers().Iter() {
+		if peer.IsOpen() && !peer.IsClient() {
+			if err := peer.Disconnect(); err != nil {
+				slog.Error(err.Error())
+			}
+		}
+	}
+}
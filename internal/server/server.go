@@ -15,7 +15,9 @@ import (
 	"os"
 	"os/signal"
 
+	"tgdp/internal/config"
 	"tgdp/internal/flags"
+	"tgdp/internal/metrics"
 
 	"tgdp/pkg/diameter"
 	ds "tgdp/pkg/diameter/net/server"
@@ -32,6 +34,18 @@ func Run(d *diameter.Diameter) {
 	}
 	server.Dump()
 
+	exporter, err := metrics.Start(d, server)
+	if err != nil {
+		slog.Error(err.Error())
+		server.Shutdown()
+		return
+	}
+	defer exporter.Shutdown()
+
+	if interval := config.DictWatchInterval(); interval > 0 {
+		d.WatchDict(config.DialDictFile(), config.DictFormat(), interval)
+	}
+
 	ccChan := make(chan os.Signal, 1)
 	signal.Notify(ccChan, os.Interrupt)
 	<-ccChan
@@ -37,6 +37,6 @@ type IDiameter interface {
 	IsCommonMessage(uint32) bool
 	IsRequest(byte) bool
 	GetResultCode([]byte) (uint32, error)
-	GetResultCodeEx([]byte) (uint32, error)
+	GetResultCodeEx([]byte) (uint32, uint32, error)
 	TraceMessage([]byte)
 }
@@ -14,7 +14,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"reflect"
+	"io"
+	"os"
+	"strings"
 
 	"tgdp/pkg/diameter/dict"
 	"tgdp/pkg/diameter/diwe"
@@ -35,6 +37,8 @@ type Avp struct {
 	env *Diameter
 	// length is the total AVP length in bytes (header + value + padding).
 	length uint32
+	// tmpl is the value template of the store AVP evaluated for each new message.
+	tmpl *avpTemplate
 }
 
 // Methods
@@ -70,6 +74,15 @@ func (avp *Avp) Type() int {
 	return avp.header.Type
 }
 
+// Format returns the derived data format name (e.g., "TBCD", "PLMN"),
+// or an empty string if the AVP value is handled by its base data type codec.
+func (avp *Avp) Format() string {
+	if avp.header.Format == nil {
+		return ""
+	}
+	return *avp.header.Format
+}
+
 // Enum returns the enumeration definition for Enumerated-type AVPs,
 // or nil if the AVP is not of Enumerated type.
 func (avp *Avp) Enum() *dict.Enum {
@@ -117,31 +130,40 @@ func (avp *Avp) Len() uint32 {
 	return avp.length
 }
 
+// Codec returns the codec functions used for the AVP value.
+// The codec of the derived data format (if any) takes precedence
+// over the codec of the base data type.
+func (avp *Avp) Codec() (CodecFuncs, bool) {
+	if format := avp.Format(); format != "" {
+		if codec, exists := avp.env.Codec(format); exists {
+			return codec, true
+		}
+	}
+
+	return avp.env.Codec(avp.Type())
+}
+
 // SetValue decodes and sets the AVP value from a Go value.
-// It validates that the input type matches the expected Go type for this
-// AVP's data type, then uses the appropriate codec to encode the value.
-// Returns an error if the value type is invalid or encoding fails.
+// The value is converted to the Go type of the AVP data type by ConvertValue
+// (numbers, strings, etc.), then the codec encodes the value.
+// Derived format codecs validate the input value themselves.
+// Returns an error if the value cannot be converted or encoding fails.
 func (avp *Avp) SetValue(value any) error {
-	// Validate input type matches expected Go type for this AVP
-	avpGoType, ok := avp.env.dia2go[avp.Type()]
-	if !ok {
+	codec, exists := avp.Codec()
+	if !exists {
 		return &diwe.ErrUnknownAvpType{Avp: avp.Name(), Type: avp.Type()}
 	}
-	valueType := reflect.TypeOf(value)
-	if valueType != avpGoType.type1 && valueType != avpGoType.type2 {
-		return &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
+
+	value, err := avp.ConvertValue(value)
+	if err != nil {
+		return err
 	}
 
-	// Use codec to create AvpData from input value
-	if codec, exists := avp.env.Codec(avp.Type()); exists {
-		v, err := codec.MakeValue(avp, value)
-		if err != nil {
-			return err
-		}
-		avp.value = v
-	} else {
-		return &diwe.ErrUnknownAvpType{Avp: avp.Name(), Type: avp.Type()}
+	v, err := codec.MakeValue(avp, value)
+	if err != nil {
+		return err
 	}
+	avp.value = v
 
 	return nil
 }
@@ -169,7 +191,7 @@ func (avp *Avp) Serialize(buf *bytes.Buffer) error {
 	}
 
 	// Serialize the AVP value data using the appropriate codec
-	if codec, exists := avp.env.Codec(avp.Type()); exists {
+	if codec, exists := avp.Codec(); exists {
 		if err := codec.Serialize(avp, buf); err != nil {
 			return err
 		}
@@ -198,6 +220,7 @@ func (avp *Avp) reset() {
 	avp.value = nil
 	avp.env = nil
 	avp.length = 0
+	avp.tmpl = nil
 }
 
 // Deserialize decodes an AVP from a byte slice.
@@ -237,7 +260,7 @@ func (avp *Avp) Deserialize(data []byte) (uint32, error) {
 	}
 
 	// Deserialize value data using the appropriate codec
-	if codec, exists := avp.env.codecs[avp.Type()]; exists {
+	if codec, exists := avp.Codec(); exists {
 		avp.value = codec.Deserialize(avp, data[offset:], avpLength-offset)
 	} else {
 		return avpLenAligned, &diwe.ErrUnknownAvpType{Avp: avp.Name(), Type: avp.Type()}
@@ -248,21 +271,23 @@ func (avp *Avp) Deserialize(data []byte) (uint32, error) {
 
 // Copy creates a deep copy of an AVP with copying its value.
 func (avp *Avp) Copy() (*Avp, error) {
-	if codec, exists := avp.env.Codec(avp.Type()); exists {
+	if codec, exists := avp.Codec(); exists {
 		value := codec.CopyValue(avp.Data())
 
 		newAvp := getAvp()
 		newAvp.header = dict.Avp{
-			Name:  avp.Name(),
-			Code:  avp.Code(),
-			Flags: avp.Flags(),
-			VndId: avp.VendorId(),
-			Type:  avp.Type(),
-			Enum:  avp.Enum(),
-			Group: avp.Group(),
+			Name:   avp.Name(),
+			Code:   avp.Code(),
+			Flags:  avp.Flags(),
+			VndId:  avp.VendorId(),
+			Type:   avp.Type(),
+			Format: avp.header.Format,
+			Enum:   avp.Enum(),
+			Group:  avp.Group(),
 		}
 		newAvp.env = avp.env
 		newAvp.value = value
+		newAvp.tmpl = avp.tmpl
 		return newAvp, nil
 	}
 
@@ -308,32 +333,37 @@ func (avp *Avp) Dump(shift ...int) {
 		indent = shift[0]
 	}
 
+	avp.WriteText(os.Stdout, indent)
+}
+
+// WriteText writes the AVP in the human-readable format of Dump with the indentation.
+func (avp *Avp) WriteText(w io.Writer, indent int) {
 	// Print indentation
-	for range indent {
-		fmt.Print(" ")
-	}
+	fmt.Fprint(w, strings.Repeat(" ", indent))
 
 	// Print AVP name and code
 	if len(avp.Name()) > 0 {
-		fmt.Printf("%s (%d): ", avp.Name(), avp.Code())
+		fmt.Fprintf(w, "%s (%d): ", avp.Name(), avp.Code())
 	} else {
-		fmt.Printf("Unknown <%d>", avp.Code())
+		fmt.Fprintf(w, "Unknown <%d>", avp.Code())
 	}
 
 	// Handle grouped AVPs - recursively dump members via AvpStore
 	if avp.IsGrouped() {
-		fmt.Println()
+		fmt.Fprintln(w)
 		for _, member := range avp.Value().([]*Avp) {
-			member.Dump(indent + 2)
+			member.WriteText(w, indent+2)
 		}
 		return
 	}
 
-	if codec, exists := avp.env.Codec(avp.Type()); exists {
-		fmt.Printf("%s", codec.ToText(avp))
+	if avp.tmpl != nil {
+		fmt.Fprintf(w, "%s", avp.tmpl.source)
+	} else if codec, exists := avp.Codec(); exists {
+		fmt.Fprintf(w, "%s", codec.ToText(avp))
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 }
 
 // Helpers
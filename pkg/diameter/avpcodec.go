@@ -32,11 +32,9 @@ const (
 	maskHigh4bits = 0xF0
 	maskLow4bits  = 0x0F
 
-	zeroChar = 0x30 // '0'
-	fChar    = 0x3F // 'F'
-
 	addrIPv4 = 1
 	addrIPv6 = 2
+	addrE164 = 8
 )
 
 // Types
@@ -46,6 +44,10 @@ const (
 // This allows the system to encode/decode different AVP data types dynamically.
 type AvpCodecs map[int]CodecFuncs
 
+// AvpFormats is a map of derived AVP data format names to their codec functions.
+// A derived format (e.g. TBCD, PLMN) refines the codec of its base data type.
+type AvpFormats map[string]CodecFuncs
+
 // CodecFuncs holds the three functions needed to work with an AVP type:
 // makeValue creates an AvpData from a Go value, serialize writes to wire format,
 // and deserialize parses from wire format.
@@ -80,84 +82,24 @@ type CopyValueFn func(*AvpData) *AvpData
 // It accepts source AVP data as parameter and returns an AvpData with the copied value.
 type ToTextFn func(*Avp) string
 
-// specEncodingFn is a function that performs special encoding for specific AVP codes.
-// These are custom encoders for vendor-specific or specialized AVP formats.
-type specEncodingFn func(data []byte) (*AvpData, error)
-
-// specToTextFn is a function that performs special conversation to text for specific AVP codes.
-// These are custom decoders for vendor-specific or specialized AVP formats.
-type specToTextFn func(data []byte) string
-
-// Variables
-//
-
-// specEncoders maps AVP codes to their special encoding functions.
-// Currently only contains the PLMN (Visited-PLMN-Id) encoder.
-var (
-	specEncoders = map[uint32]specEncodingFn{
-		1407: encodePLMN, // Visited-PLMN-Id
-	}
-
-	specToText = map[uint32]specToTextFn{
-		701:  toTextMSISDN, // MSISDN
-		1407: toTextPLMN,   // Visited-PLMN-Id
-	}
-)
-
 // Make Value Functions
 //
 // These functions convert Go values into AvpData for serialization.
 
 // mkvOctetString creates AvpData from a string or int value.
-// It handles special encoders for specific AVP codes and can convert
-// numeric strings to packed BCD format for compatibility.
+// The value is stored as is; derived formats (e.g. TBCD, PLMN) are handled
+// by their own codecs selected through the AVP 'format' dictionary property.
 func mkvOctetString(avp *Avp, value any) (*AvpData, error) {
-	rawBytes, err := func() ([]byte, error) {
-		switch v := (value).(type) {
-		case int:
-			return []byte(strconv.Itoa(v)), nil
-		case string:
-			return []byte(v), nil
-		default:
-			return nil, &diwe.ErrInvalidAvpValue{Avp: avp, Value: v}
-		}
-	}()
-
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if this AVP has a special encoder (e.g., PLMN)
-	if osse, exists := specEncoders[avp.Code()]; exists {
-		return osse(rawBytes)
-	}
-
-	// Check if the string contains only numeric characters
-	isNumeric := true
-	for _, r := range rawBytes {
-		if r < '0' || r > '9' {
-			isNumeric = false
-			break
-		}
-	}
-
-	// If numeric, pack as BCD (two digits per byte)
-	encoded := rawBytes
-	if isNumeric {
-		bytes := make([]byte, (len(rawBytes)+1)/2)
-		i := 0
-		for ; i < len(rawBytes); i++ {
-			if i&1 == 0 {
-				bytes[i/2] += (rawBytes[i] - '0')
-			} else {
-				bytes[i/2] += (rawBytes[i] - '0') << 4
-			}
-		}
-		// Add filler for odd-length strings
-		if i&1 != 0 {
-			bytes[i/2] += maskHigh4bits
-		}
-		encoded = bytes
+	var encoded []byte
+	switch v := (value).(type) {
+	case int:
+		encoded = []byte(strconv.Itoa(v))
+	case string:
+		encoded = []byte(v)
+	case []byte:
+		encoded = v
+	default:
+		return nil, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: v}
 	}
 
 	return &AvpData{
@@ -251,84 +193,69 @@ func mkvFloat64(avp *Avp, value any) (*AvpData, error) {
 		nil
 }
 
-// mkvIpAddress creates AvpData from an IP address string.
-// Supports both IPv4 (returns size 6) and IPv6 (returns size 18).
-// The size includes a 2-byte address type prefix (1 for IPv4, 2 for IPv6).
+// mkvIpAddress creates AvpData from an address: netip.Addr, net.IP, AvpAddress or the address text
+// (see ParseAddress). The size includes a 2-byte address family prefix (1 for IPv4, 2 for IPv6, etc.).
 func mkvIpAddress(avp *Avp, value any) (*AvpData, error) {
-	ip, size, err := func() (netip.Addr, uint32, error) {
-		// Handle netip.Addr directly
-		if v, ok := (value).(netip.Addr); ok {
-			// IPv4: 2-byte prefix + 4 bytes = 6 total
-			// IPv6: 2-byte prefix + 16 bytes = 18 total
-			if v.Is4() {
-				return v, 6, nil
-			} else {
-				return v, 18, nil
-			}
+	if v, ok := (value).(net.IP); ok {
+		if ip, ok := netip.AddrFromSlice(v); ok {
+			value = ip.Unmap()
 		}
-
-		// Handle net.IP (legacy Go type)
-		if v, ok := (value).(net.IP); ok {
-			ip, err := netip.ParseAddr(v.String())
-			if err != nil {
-				return netip.Addr{}, 0, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: v}
-			}
-			if ip.Is4() {
-				return ip, 6, nil
-			} else {
-				return ip, 18, nil
-			}
+	}
+	if v, ok := (value).(string); ok {
+		addr, err := ParseAddress(v)
+		if err != nil {
+			return nil, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: v}
 		}
+		value = addr
+	}
 
-		// Handle string (current behavior)
-		if v, ok := (value).(string); ok {
-			ip, err := netip.ParseAddr(v)
-			if err != nil {
-				return netip.Addr{}, 0, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: v}
-			}
-			if ip.Is4() {
-				return ip, 6, nil
-			} else {
-				return ip, 18, nil
-			}
+	switch v := (value).(type) {
+	case netip.Addr:
+		if v.IsValid() {
+			return &AvpData{
+				Value: v,
+				Size:  2 + uint32(v.BitLen()/8),
+			}, nil
 		}
-
-		return netip.Addr{}, 0, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
-	}()
-
-	if err != nil {
-		return nil, err
+	case AvpAddress:
+		return &AvpData{
+			Value: AvpAddress{Family: v.Family, Data: slices.Clone(v.Data)},
+			Size:  2 + uint32(len(v.Data)),
+		}, nil
 	}
 
-	return &AvpData{
-		Value: ip,
-		Size:  size,
-	}, nil
+	return nil, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
 }
 
-// mkvTime creates AvpData from a time.Time or RFC3339 string.
-// Diameter Time type uses seconds since Unix epoch (32-bit).
+// mkvTime creates AvpData from a time.Time, RFC3339 string or Unix epoch seconds.
+// Diameter Time type is the 32-bit NTP seconds, the time is checked against the NTP eras range.
 func mkvTime(avp *Avp, value any) (*AvpData, error) {
-	t, err := func() (int64, error) {
-		if v, ok := (value).(time.Time); ok {
-			return v.Unix(), nil
-		}
-
-		if v, ok := (value).(string); ok {
+	t, err := func() (time.Time, error) {
+		switch v := (value).(type) {
+		case time.Time:
+			return v, nil
+		case string:
 			if t, err := time.Parse(time.RFC3339, v); err == nil {
-				return t.Unix(), nil
+				return t, nil
 			}
+		case int64:
+			return time.Unix(v, 0), nil
+		case uint32:
+			return NtpTime(v), nil
 		}
 
-		return 0, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
+		return time.Time{}, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
 	}()
 
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := TimeNtp(t); !ok {
+		return nil, &diwe.ErrAvpValueRange{Avp: avp.Name(), Value: value, Type: avp.Dict().AvpDataTypeName(avp.Type())}
+	}
 
 	return &AvpData{
-			Value: t,
+			Value: time.Unix(t.Unix(), 0).UTC(),
 			Size:  4,
 		},
 		nil
@@ -354,6 +281,8 @@ func mkvUTF8String(avp *Avp, value any) (*AvpData, error) {
 func mkvEnumerated(avp *Avp, value any) (*AvpData, error) {
 	v, err := func() (int32, error) {
 		switch v := (value).(type) {
+		case int32:
+			return v, nil
 		case int:
 			return int32(v), nil
 		case string:
@@ -454,30 +383,38 @@ func serFloat64(avp *Avp, buf *bytes.Buffer) error {
 	return &diwe.ErrInvalidAvpValue{Avp: avp, Value: avp.Value()}
 }
 
-// serIpAddress writes an IP address with a 2-byte type prefix.
-// Type 1 = IPv4 (4 bytes follow), Type 2 = IPv6 (16 bytes follow).
+// serIpAddress writes an address with a 2-byte address family prefix.
+// Family 1 = IPv4 (4 bytes follow), 2 = IPv6 (16 bytes follow), other families are written as is.
 func serIpAddress(avp *Avp, buf *bytes.Buffer) error {
-	if addr, ok := avp.Value().(netip.Addr); ok {
-		var addrType uint16
-		if addr.Is4() {
-			addrType = 1
-		} else {
-			addrType = 2
+	var (
+		family uint16
+		data   []byte
+	)
+	switch v := avp.Value().(type) {
+	case netip.Addr:
+		family, data = addrIPv6, v.AsSlice()
+		if v.Is4() {
+			family = addrIPv4
 		}
+	case AvpAddress:
+		family, data = v.Family, v.Data
+	default:
+		return &diwe.ErrInvalidAvpValue{Avp: avp, Value: avp.Value()}
+	}
 
-		if err := binary.Write(buf, binary.BigEndian, addrType); err != nil {
-			return err
-		} else {
-			return binary.Write(buf, binary.BigEndian, addr.AsSlice())
-		}
+	if err := binary.Write(buf, binary.BigEndian, family); err != nil {
+		return err
 	}
-	return &diwe.ErrInvalidAvpValue{Avp: avp, Value: avp.Value()}
+	_, err := buf.Write(data)
+	return err
 }
 
-// serTime writes a 32-bit unsigned timestamp (seconds since Unix epoch).
+// serTime writes a 32-bit unsigned timestamp (NTP seconds).
 func serTime(avp *Avp, buf *bytes.Buffer) error {
-	if v, ok := avp.Value().(uint32); ok {
-		return binary.Write(buf, binary.BigEndian, v)
+	if v, ok := avp.Value().(time.Time); ok {
+		if seconds, ok := TimeNtp(v); ok {
+			return binary.Write(buf, binary.BigEndian, seconds)
+		}
 	}
 	return &diwe.ErrInvalidAvpValue{Avp: avp, Value: avp.Value()}
 }
@@ -570,38 +507,29 @@ func desFloat64(avp *Avp, data []byte, size uint32) *AvpData {
 	}
 }
 
-// desIpAddress reads an IP address from the 2-byte type prefix + address data.
+// desIpAddress reads an address from the 2-byte address family prefix + address data.
+// The addresses of the unknown families (or of the invalid length) are kept raw.
 func desIpAddress(avp *Avp, data []byte, size uint32) *AvpData {
-	var (
-		addr netip.Addr
-		ok   bool
-	)
-	// Read address type: 1 = IPv4, 2 = IPv6
-	addrType := binary.BigEndian.Uint16(data[:2])
-
-	switch addrType {
-	case addrIPv4:
-		addr, ok = netip.AddrFromSlice(data[2:6])
-		size = 4
-	case addrIPv6:
-		addr, ok = netip.AddrFromSlice(data[2:18])
-		size = 16
-	}
-
-	if !ok {
+	if size < 2 {
 		return nil
 	}
 
+	family := binary.BigEndian.Uint16(data[:2])
+
 	return &AvpData{
-		Value: addr,
+		Value: newAvpAddress(family, slices.Clone(data[2:size])),
 		Size:  size,
 	}
 }
 
-// desTime reads a 32-bit unsigned timestamp (seconds since Unix epoch).
+// desTime reads a 32-bit unsigned timestamp (NTP seconds).
 func desTime(avp *Avp, data []byte, size uint32) *AvpData {
+	if size < 4 {
+		return nil
+	}
+
 	return &AvpData{
-		Value: binary.BigEndian.Uint32(data[:4]),
+		Value: NtpTime(binary.BigEndian.Uint32(data[:4])),
 		Size:  4,
 	}
 }
@@ -704,10 +632,15 @@ func cpvFloat64(srcData *AvpData) *AvpData {
 	}
 }
 
-// cpvIpAddress creates a copy of an IP address as the value.
+// cpvIpAddress creates a copy of an address as the value.
 func cpvIpAddress(srcData *AvpData) *AvpData {
+	value := srcData.Value
+	if v, ok := value.(AvpAddress); ok {
+		value = AvpAddress{Family: v.Family, Data: slices.Clone(v.Data)}
+	}
+
 	return &AvpData{
-		Value: srcData.Value.(netip.Addr),
+		Value: value,
 		Size:  srcData.Size,
 	}
 }
@@ -715,7 +648,7 @@ func cpvIpAddress(srcData *AvpData) *AvpData {
 // cpvTime creates a copy of a timestamp as the value.
 func cpvTime(srcData *AvpData) *AvpData {
 	return &AvpData{
-		Value: srcData.Value.(uint32),
+		Value: srcData.Value.(time.Time),
 		Size:  srcData.Size,
 	}
 }
@@ -751,11 +684,6 @@ func cpvGrouped(srcData *AvpData) *AvpData {
 // txtOctetString converts raw bytes to a hex string representation.
 func txtOctetString(avp *Avp) string {
 	if v, ok := avp.Value().([]byte); ok {
-		// Check if this AVP has a special decoder (e.g., PLMN)
-		if ostt, exists := specToText[avp.Code()]; exists {
-			return ostt(v)
-		}
-
 		return fmt.Sprintf("%x", v)
 	}
 	return ""
@@ -809,19 +737,22 @@ func txtFloat64(avp *Avp) string {
 	return ""
 }
 
-// txtIpAddress converts an IP address to string representation.
+// txtIpAddress converts an address to string representation.
 func txtIpAddress(avp *Avp) string {
-	if v, ok := avp.Value().(netip.Addr); ok {
+	switch v := avp.Value().(type) {
+	case netip.Addr:
+		return v.String()
+	case AvpAddress:
 		return v.String()
 	}
 	return ""
 }
 
-// txtTime converts a timestamp (seconds since Unix epoch) to RFC3339 string.
+// txtTime converts a timestamp to RFC3339 string followed by the Unix and NTP seconds.
 func txtTime(avp *Avp) string {
-	if v, ok := avp.Value().(uint32); ok {
-		t := time.Unix(int64(v), 0)
-		return t.Format(time.RFC3339)
+	if v, ok := avp.Value().(time.Time); ok {
+		ntp, _ := TimeNtp(v)
+		return fmt.Sprintf("%s (unix %d, ntp %d)", v.UTC().Format(time.RFC3339), v.Unix(), ntp)
 	}
 	return ""
 }
@@ -863,101 +794,12 @@ func txtGrouped(avp *Avp) string {
 			first = false
 			b.WriteString(member.Name())
 			b.WriteString(": ")
-			txtFn := avp.env.codecs[member.Type()].ToText
-			b.WriteString(txtFn(member))
+			if codec, exists := member.Codec(); exists {
+				b.WriteString(codec.ToText(member))
+			}
 		}
 		b.WriteString("}")
 		return b.String()
 	}
 	return ""
 }
-
-// Special Encoding Functions
-//
-
-// encodePLMN encodes a PLMN (Public Land Mobile Network) identifier.
-// The input is a string of 5 or 6 digits (MCC + MNC).
-// Output is 3 bytes of packed BCD format:
-//   - Byte 0: MCC[0] | MCC[1]<<4
-//   - Byte 1: MCC[2] | MNC[0]<<4 (or 0xF if 5 digits)
-//   - Byte 2: MNC[1] | MNC[2]<<4 (or only MNC[1] if 5 digits)
-func encodePLMN(plmn []byte) (*AvpData, error) {
-	if len(plmn) != 5 && len(plmn) != 6 {
-		return nil, &diwe.ErrInvalidValue{Value: plmn}
-	}
-
-	bytes := make([]byte, 3)
-	// Pack first two digits (MCC)
-	bytes[0] = (plmn[0] - zeroChar) | (plmn[1]-zeroChar)<<4
-	if len(plmn) == 6 {
-		// 6 digits: MCC[2] + all three MNC digits
-		bytes[1] = (plmn[2] - zeroChar) | (plmn[3]-zeroChar)<<4
-		bytes[2] = (plmn[4] - zeroChar) | (plmn[5]-zeroChar)<<4
-	} else {
-		// 5 digits: MCC[2] + filler + MNC[1-2]
-		bytes[1] = (plmn[2] - zeroChar) | (maskLow4bits << 4)
-		bytes[2] = (plmn[3] - zeroChar) | (plmn[4]-zeroChar)<<4
-	}
-	return &AvpData{
-			Value: bytes,
-			Size:  uint32(len(bytes)),
-		},
-		nil
-}
-
-// Special Decoding Functions
-//
-
-// toTextPLMN decodes a PLMN identifier to text string.
-// The input is a array of 3 bytes.
-func toTextPLMN(data []byte) string {
-	if len(data) != 3 {
-		return ""
-	}
-
-	b0, b1, b2 := data[0], data[1], data[2]
-
-	// Decode byte 0: Contains MCC digits 1 and 2
-	// e.g., "25" in 0x52
-	d1 := (b0 & maskLow4bits) + zeroChar
-	d2 := ((b0 >> 4) & maskLow4bits) + zeroChar
-
-	// Decode byte 1: Contains MCC digit 3 (or MNC digit 1 in 6-digit case)
-	// If high nibble is 0xF, it indicates 5-digit mode (filler), so we take the low nibble.
-	// Otherwise, we take the high nibble.
-	var d3 byte
-	if b1&maskHigh4bits == maskHigh4bits {
-		// 5-digit PLMN
-		d3 = (b1 & maskLow4bits) + zeroChar
-	} else {
-		// 6-digit PLMN
-		d3 = ((b1 >> 4) & maskLow4bits) + zeroChar
-	}
-
-	// Decode byte 2: Contains MNC digits 4 and 5
-	d4 := (b2 & maskLow4bits) + zeroChar
-	d5 := ((b2 >> 4) & maskLow4bits) + zeroChar
-
-	return string([]byte{d1, d2, d3, d4, d5})
-}
-
-// toTextMSISDN decodes a MSISDN number to text string.
-// The input is a array of bytes.
-func toTextMSISDN(data []byte) string {
-	i := 0
-	j := 0
-	b := make([]byte, len(data)*2)
-	for ; i < len(data)-1; i++ {
-		b[j] = (data[i] & maskLow4bits) + zeroChar
-		b[j+1] = ((data[i] >> 4) & maskLow4bits) + zeroChar
-		j += 2
-	}
-	b[j] = (data[i] & maskLow4bits) + zeroChar
-	j++
-	if f := ((data[i] >> 4) & maskLow4bits) + zeroChar; f != fChar {
-		b[j] = f
-		j++
-	}
-
-	return string(b[:j])
-}
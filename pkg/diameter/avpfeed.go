@@ -0,0 +1,643 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avpfeed.go
+// Description: Diameter pkg: external data feeds (CSV, JSONL) bound to AVP values
+//
+
+package diameter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	mrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+// Feed row selection
+const (
+	FeedSequential  = iota // rows are taken in the file order
+	FeedRandom             // rows are taken randomly
+	FeedPartitioned        // rows are split between workers: worker N of P takes rows N, N+P, N+2P...
+)
+
+// Feed behaviour at the end of data
+const (
+	FeedWrap = iota // start over from the first row
+	FeedStop        // fail to build messages
+)
+
+// Feed scope - when the next row is taken
+const (
+	FeedScopeMessage = iota // each message takes the next row
+	FeedScopeSession        // each session takes the next row
+)
+
+// Feed file formats
+const (
+	FeedFormatAuto  = iota // by the file extension: .jsonl, .ndjson - JSONL, else CSV
+	FeedFormatCsv          // comma-separated values with the header line
+	FeedFormatJsonl        // one JSON object per line
+)
+
+const maxJsonlLine = 1024 * 1024
+
+// Types
+//
+
+// FeedOptions defines how the feed rows are selected.
+type FeedOptions struct {
+	Format     int
+	Select     int
+	Partitions int
+	OnEnd      int
+	Scope      int
+}
+
+// AvpFeed is a table of values loaded from a data file (e.g. the list of provisioned subscribers).
+// The AVPs bound to the feed columns take their values from the current row.
+type AvpFeed struct {
+	mu      sync.Mutex
+	name    string
+	file    string
+	opts    FeedOptions
+	columns []string
+	index   map[string]int // lowercase column name -> column index
+	rows    [][]string
+	cursors []int // number of rows taken per partition
+	current []int // current row index per partition, -1 if not taken
+	used    uint64
+}
+
+// FeedBinding describes the AVP bound to the feed column.
+type FeedBinding struct {
+	Feed   string
+	Column string
+}
+
+// feedBind is the resolved AVP binding.
+type feedBind struct {
+	feed   *AvpFeed
+	column int
+}
+
+// avpFeeds keeps the data feeds and the AVP bindings of the Diameter environment.
+type avpFeeds struct {
+	mu    sync.RWMutex
+	feeds map[string]*AvpFeed
+	binds map[uint32]feedBind // AVP code -> feed column
+}
+
+// Variables
+//
+
+var (
+	feedFormatNames = []string{FeedFormatAuto: "auto", FeedFormatCsv: "csv", FeedFormatJsonl: "jsonl"}
+	feedSelectNames = []string{FeedSequential: "sequential", FeedRandom: "random", FeedPartitioned: "partitioned"}
+	feedOnEndNames  = []string{FeedWrap: "wrap", FeedStop: "stop"}
+	feedScopeNames  = []string{FeedScopeMessage: "message", FeedScopeSession: "session"}
+)
+
+// Functions
+//
+
+// ParseFeedOptions makes the feed options from their names.
+// Empty names select the defaults: auto format, sequential selection, wrap-around, message scope.
+func ParseFeedOptions(format, sel, onEnd, scope string, partitions int) (FeedOptions, error) {
+	var opts FeedOptions
+	var err error
+
+	if opts.Format, err = feedOption("format", format, feedFormatNames); err != nil {
+		return opts, err
+	}
+	if opts.Select, err = feedOption("select", sel, feedSelectNames); err != nil {
+		return opts, err
+	}
+	if opts.OnEnd, err = feedOption("on_end", onEnd, feedOnEndNames); err != nil {
+		return opts, err
+	}
+	if opts.Scope, err = feedOption("scope", scope, feedScopeNames); err != nil {
+		return opts, err
+	}
+
+	if partitions < 0 || (partitions > 1 && opts.Select != FeedPartitioned) {
+		return opts, &diwe.ErrInvalidFeedOption{Option: "partitions", Value: partitions}
+	}
+	opts.Partitions = max(partitions, 1)
+
+	return opts, nil
+}
+
+// Methods
+//
+
+// Name returns the feed name.
+func (f *AvpFeed) Name() string {
+	return f.name
+}
+
+// File returns the feed data file.
+func (f *AvpFeed) File() string {
+	return f.file
+}
+
+// Columns returns the feed column names.
+func (f *AvpFeed) Columns() []string {
+	return slices.Clone(f.columns)
+}
+
+// Len returns the number of the feed rows.
+func (f *AvpFeed) Len() int {
+	return len(f.rows)
+}
+
+// Used returns the number of rows taken from the feed.
+func (f *AvpFeed) Used() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.used
+}
+
+// Options returns the feed options.
+func (f *AvpFeed) Options() FeedOptions {
+	return f.opts
+}
+
+// Describe returns the feed options as text, e.g. "csv, sequential, wrap, message scope".
+func (f *AvpFeed) Describe() string {
+	sel := feedSelectNames[f.opts.Select]
+	if f.opts.Select == FeedPartitioned {
+		sel += "/" + strconv.Itoa(f.opts.Partitions)
+	}
+	return fmt.Sprintf("%s, %s, %s, %s scope", feedFormatNames[f.opts.Format], sel,
+		feedOnEndNames[f.opts.OnEnd], feedScopeNames[f.opts.Scope])
+}
+
+// NextRow takes the next row for the worker and returns it as a map of column values.
+func (f *AvpFeed) NextRow(worker int) (map[string]string, error) {
+	row, err := f.fetch(worker, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(f.columns))
+	for i, column := range f.columns {
+		values[column] = row[i]
+	}
+
+	return values, nil
+}
+
+// NewSession makes the next message of the worker take the next row (session scope).
+func (f *AvpFeed) NewSession(worker int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current[f.partition(worker)] = -1
+}
+
+// Reset starts the feed over from the first row.
+func (f *AvpFeed) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for p := range f.cursors {
+		f.cursors[p] = 0
+		f.current[p] = -1
+	}
+	f.used = 0
+}
+
+// fetch returns the row for the worker. The current row is returned if advance is false
+// and the worker has taken a row already. The dry call does not change the feed state.
+func (f *AvpFeed) fetch(worker int, advance, dry bool) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := f.partition(worker)
+	if !advance && f.current[p] >= 0 {
+		return f.rows[f.current[p]], nil
+	}
+
+	var index int
+	switch f.opts.Select {
+	case FeedRandom:
+		index = mrand.IntN(len(f.rows))
+	default:
+		taken := f.cursors[p]
+		index = p + taken*len(f.cursors)
+		if index >= len(f.rows) {
+			if f.opts.OnEnd == FeedStop {
+				return nil, &diwe.ErrFeedExhausted{Feed: f.name}
+			}
+			taken, index = 0, p
+		}
+		if !dry {
+			f.cursors[p] = taken + 1
+		}
+	}
+
+	if !dry {
+		f.current[p] = index
+		f.used++
+	}
+
+	return f.rows[index], nil
+}
+
+// partition returns the worker partition.
+func (f *AvpFeed) partition(worker int) int {
+	return max(worker, 0) % len(f.cursors)
+}
+
+// LoadFeed loads the data feed from a CSV or JSONL file.
+// The feed with the same name is replaced, its AVP bindings are kept if the columns still exist.
+func (d *Diameter) LoadFeed(name, file string, opts FeedOptions) (*AvpFeed, error) {
+	if opts.Format == FeedFormatAuto {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".jsonl", ".ndjson":
+			opts.Format = FeedFormatJsonl
+		default:
+			opts.Format = FeedFormatCsv
+		}
+	}
+	opts.Partitions = max(opts.Partitions, 1)
+
+	feed := &AvpFeed{name: name, file: file, opts: opts, index: make(map[string]int)}
+
+	var err error
+	switch opts.Format {
+	case FeedFormatCsv:
+		err = feed.readCsv()
+	case FeedFormatJsonl:
+		err = feed.readJsonl()
+	default:
+		err = &diwe.ErrInvalidFeedOption{Option: "format", Value: opts.Format}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(feed.rows) == 0 {
+		return nil, &diwe.ErrInvalidFeedData{File: file, Line: 1, Reason: "no data rows"}
+	}
+	if opts.Partitions > len(feed.rows) {
+		return nil, &diwe.ErrInvalidFeedOption{Option: "partitions", Value: opts.Partitions}
+	}
+
+	feed.cursors = make([]int, opts.Partitions)
+	feed.current = make([]int, opts.Partitions)
+	feed.Reset()
+
+	d.feeds.mu.Lock()
+	defer d.feeds.mu.Unlock()
+
+	if d.feeds.feeds == nil {
+		d.feeds.feeds = make(map[string]*AvpFeed)
+		d.feeds.binds = make(map[uint32]feedBind)
+	}
+
+	if old, exists := d.feeds.feeds[name]; exists {
+		for code, bind := range d.feeds.binds {
+			if bind.feed != old {
+				continue
+			}
+			if column, ok := feed.index[strings.ToLower(old.columns[bind.column])]; ok {
+				d.feeds.binds[code] = feedBind{feed: feed, column: column}
+			} else {
+				delete(d.feeds.binds, code)
+			}
+		}
+	}
+	d.feeds.feeds[name] = feed
+
+	return feed, nil
+}
+
+// Feed returns the data feed by name.
+func (d *Diameter) Feed(name string) (*AvpFeed, error) {
+	d.feeds.mu.RLock()
+	defer d.feeds.mu.RUnlock()
+
+	if feed, exists := d.feeds.feeds[name]; exists {
+		return feed, nil
+	}
+
+	return nil, &diwe.ErrUnknownFeed{Name: name}
+}
+
+// FeedIter returns a sequence that yields the data feeds sorted by name.
+func (d *Diameter) FeedIter() iter.Seq[*AvpFeed] {
+	d.feeds.mu.RLock()
+	feeds := make([]*AvpFeed, 0, len(d.feeds.feeds))
+	for _, feed := range d.feeds.feeds {
+		feeds = append(feeds, feed)
+	}
+	d.feeds.mu.RUnlock()
+
+	slices.SortFunc(feeds, func(a, b *AvpFeed) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	return slices.Values(feeds)
+}
+
+// RemoveFeed removes the data feed and its AVP bindings.
+func (d *Diameter) RemoveFeed(name string) error {
+	d.feeds.mu.Lock()
+	defer d.feeds.mu.Unlock()
+
+	feed, exists := d.feeds.feeds[name]
+	if !exists {
+		return &diwe.ErrUnknownFeed{Name: name}
+	}
+
+	for code, bind := range d.feeds.binds {
+		if bind.feed == feed {
+			delete(d.feeds.binds, code)
+		}
+	}
+	delete(d.feeds.feeds, name)
+
+	return nil
+}
+
+// BindFeed binds the AVP value to the column of the data feed.
+// The bound AVP takes the value from the feed instead of the AVP store,
+// the store values are used only if the feed cell is empty.
+func (d *Diameter) BindFeed(avpId any, name, column string) error {
+	avp, err := d.dict.GetAvp(avpId)
+	if err != nil {
+		return err
+	}
+	if avp.Type == d.dict.AvpDataType().Grouped {
+		return &diwe.ErrGroupedAvpBind{AvpName: avp.Name}
+	}
+
+	d.feeds.mu.Lock()
+	defer d.feeds.mu.Unlock()
+
+	feed, exists := d.feeds.feeds[name]
+	if !exists {
+		return &diwe.ErrUnknownFeed{Name: name}
+	}
+
+	index, exists := feed.index[strings.ToLower(column)]
+	if !exists {
+		return &diwe.ErrUnknownFeedColumn{Feed: name, Column: column}
+	}
+
+	d.feeds.binds[avp.Code] = feedBind{feed: feed, column: index}
+
+	return nil
+}
+
+// UnbindFeed removes the data feed binding of the AVP.
+// Returns false if the AVP is not bound.
+func (d *Diameter) UnbindFeed(avpId any) (bool, error) {
+	avp, err := d.dict.GetAvp(avpId)
+	if err != nil {
+		return false, err
+	}
+
+	d.feeds.mu.Lock()
+	defer d.feeds.mu.Unlock()
+
+	if _, exists := d.feeds.binds[avp.Code]; !exists {
+		return false, nil
+	}
+	delete(d.feeds.binds, avp.Code)
+
+	return true, nil
+}
+
+// FeedBindings returns the AVP bindings by AVP code.
+func (d *Diameter) FeedBindings() map[uint32]FeedBinding {
+	d.feeds.mu.RLock()
+	defer d.feeds.mu.RUnlock()
+
+	bindings := make(map[uint32]FeedBinding, len(d.feeds.binds))
+	for code, bind := range d.feeds.binds {
+		bindings[code] = FeedBinding{Feed: bind.feed.name, Column: bind.feed.columns[bind.column]}
+	}
+
+	return bindings
+}
+
+// feedText returns the feed value of the bound AVP for the message being built.
+// The row is taken once per message, so all AVPs bound to the feed share it.
+// Returns false if the AVP is not bound or the feed cell is empty.
+func (d *Diameter) feedText(code uint32, bc *buildContext) (string, bool, error) {
+	d.feeds.mu.RLock()
+	bind, exists := d.feeds.binds[code]
+	d.feeds.mu.RUnlock()
+	if !exists {
+		return "", false, nil
+	}
+
+	row, taken := bc.rows[bind.feed]
+	if !taken {
+		var err error
+		switch {
+		case bind.feed.opts.Scope == FeedScopeSession && bc.session != nil:
+			row, err = bc.session.feedRow(bind.feed, bc.worker, bc.dry)
+		default:
+			advance := bind.feed.opts.Scope == FeedScopeMessage || d.Mode() == ModeTransaction
+			row, err = bind.feed.fetch(bc.worker, advance, bc.dry)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		bc.rows[bind.feed] = row
+	}
+
+	text := row[bind.column]
+	return text, text != "", nil
+}
+
+// isFeedBound returns true if the AVP or any of its group members is bound to a data feed.
+func (d *Diameter) isFeedBound(avp *Avp) bool {
+	d.feeds.mu.RLock()
+	if len(d.feeds.binds) == 0 {
+		d.feeds.mu.RUnlock()
+		return false
+	}
+	_, exists := d.feeds.binds[avp.Code()]
+	d.feeds.mu.RUnlock()
+	if exists {
+		return true
+	}
+
+	if members, ok := avp.Value().([]*Avp); ok {
+		for _, member := range members {
+			if d.isFeedBound(member) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readCsv reads the CSV file, the first line contains the column names.
+func (f *AvpFeed) readCsv() error {
+	file, err := os.Open(f.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				return &diwe.ErrInvalidFeedData{File: f.file, Line: pe.Line, Reason: pe.Err.Error()}
+			}
+			return err
+		}
+
+		if f.columns == nil {
+			for _, column := range record {
+				if err := f.addColumn(strings.TrimSpace(column)); err != nil {
+					line, _ := r.FieldPos(0)
+					return &diwe.ErrInvalidFeedData{File: f.file, Line: line, Reason: err.Error()}
+				}
+			}
+			continue
+		}
+
+		f.rows = append(f.rows, record)
+	}
+
+	return nil
+}
+
+// readJsonl reads the JSONL file, the columns are the keys of all objects.
+// Nested objects and arrays are not supported.
+func (f *AvpFeed) readJsonl() error {
+	file, err := os.Open(f.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var objects []map[string]string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJsonlLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		var object map[string]any
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return &diwe.ErrInvalidFeedData{File: f.file, Line: line, Reason: err.Error()}
+		}
+
+		keys := slices.Sorted(func(yield func(string) bool) {
+			for key := range object {
+				if !yield(key) {
+					return
+				}
+			}
+		})
+
+		values := make(map[string]string, len(object))
+		for _, key := range keys {
+			if _, exists := f.index[strings.ToLower(key)]; !exists {
+				if err := f.addColumn(key); err != nil {
+					return &diwe.ErrInvalidFeedData{File: f.file, Line: line, Reason: err.Error()}
+				}
+			}
+
+			switch v := object[key].(type) {
+			case nil:
+				values[key] = ""
+			case string:
+				values[key] = v
+			case json.Number:
+				values[key] = v.String()
+			case bool:
+				values[key] = strconv.FormatBool(v)
+			default:
+				return &diwe.ErrInvalidFeedData{File: f.file, Line: line, Reason: fmt.Sprintf("nested value of '%s'", key)}
+			}
+		}
+		objects = append(objects, values)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		row := make([]string, len(f.columns))
+		for key, value := range object {
+			row[f.index[strings.ToLower(key)]] = value
+		}
+		f.rows = append(f.rows, row)
+	}
+
+	return nil
+}
+
+// addColumn adds the column, the names are case-insensitive.
+func (f *AvpFeed) addColumn(name string) error {
+	if name == "" {
+		return errors.New("empty column name")
+	}
+
+	key := strings.ToLower(name)
+	if _, exists := f.index[key]; exists {
+		return fmt.Errorf("duplicate column '%s'", name)
+	}
+
+	f.index[key] = len(f.columns)
+	f.columns = append(f.columns, name)
+
+	return nil
+}
+
+// Helpers
+//
+
+// feedOption returns the index of the option name, 0 for the empty name.
+func feedOption(option, name string, names []string) (int, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	if index := slices.Index(names, strings.ToLower(name)); index >= 0 {
+		return index, nil
+	}
+
+	return 0, &diwe.ErrInvalidFeedOption{Option: option, Value: name}
+}
@@ -0,0 +1,130 @@
+package diameter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAvpFeeds(t *testing.T) {
+	fmt.Println(">>> AVP data feeds test")
+
+	env := newTestEnv(t)
+	dir := t.TempDir()
+
+	csvFile := filepath.Join(dir, "subs.csv")
+	csvData := "imsi,msisdn,state\n250010000000001,79160000001,1\n250010000000002,79160000002,\n# comment\n250010000000003,79160000003,3\n"
+	if err := os.WriteFile(csvFile, []byte(csvData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonlFile := filepath.Join(dir, "subs.jsonl")
+	jsonlData := "{\"imsi\": \"250020000000001\", \"state\": 7}\n\n{\"imsi\": \"250020000000002\"}\n"
+	if err := os.WriteFile(jsonlFile, []byte(jsonlData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.Store().MakeFromYaml(`
+Session-Id: "mme.test.org"
+User-Name: "001010000000000"
+Origin-State-Id: 99
+Terminal-Information:
+  IMEI: "{{avp:User-Name:to=8}}000000"
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, _ := ParseFeedOptions("", "", "", "", 0)
+	feed, err := env.LoadFeed("subs", csvFile, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(feed.Name(), feed.Describe(), feed.Columns(), feed.Len())
+
+	for avp, column := range map[string]string{"User-Name": "imsi", "MSISDN": "msisdn", "Origin-State-Id": "state"} {
+		if err := env.BindFeed(avp, "subs", column); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.BindFeed("User-Name", "subs", "unknown"); err == nil {
+		t.Fatal("Unknown column bound")
+	}
+	if err := env.BindFeed("Terminal-Information", "subs", "imsi"); err == nil {
+		t.Fatal("Grouped AVP bound")
+	}
+
+	// Sequential selection with wrap-around, the empty cell falls back to the store value
+	expected := []struct {
+		imsi  string
+		state uint32
+	}{{"250010000000001", 1}, {"250010000000002", 99}, {"250010000000003", 3}, {"250010000000001", 1}}
+	for _, exp := range expected {
+		msg, err := env.NewMessage("S6a", "UL", true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Trace(0)
+
+		if imsi, _ := msg.GetAvpValue("User-Name"); imsi != exp.imsi {
+			t.Fatalf("User-Name: %v, expected %s", imsi, exp.imsi)
+		}
+		if state, _ := msg.GetAvpValue("Origin-State-Id"); state != exp.state {
+			t.Fatalf("Origin-State-Id: %v, expected %d", state, exp.state)
+		}
+		msisdn, _ := msg.GetAvp("MSISDN")
+		if text := txtTBCD(msisdn); text != "7916000000"+exp.imsi[14:] {
+			t.Fatalf("MSISDN %s does not match User-Name %s", text, exp.imsi)
+		}
+		terminal, _ := msg.GetAvp("Terminal-Information")
+		if imei := terminal.Value().([]*Avp)[0].Value().(string); imei != exp.imsi[:8]+"000000" {
+			t.Fatalf("IMEI: %s", imei)
+		}
+	}
+
+	// Reloaded feed keeps the bindings of existing columns, stop at the end of data
+	opts, _ = ParseFeedOptions("", "sequential", "stop", "", 0)
+	if _, err := env.LoadFeed("subs", jsonlFile, opts); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(env.FeedBindings())
+	if _, exists := env.FeedBindings()[701]; exists {
+		t.Fatal("MSISDN binding is kept")
+	}
+	for range 2 {
+		if _, err := env.NewMessage("S6a", "UL", true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.NewMessage("S6a", "UL", true, true); err == nil {
+		t.Fatal("Exhausted feed accepted")
+	}
+
+	// Partitioned selection
+	opts, err = ParseFeedOptions("csv", "partitioned", "", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.LoadFeed("parts", csvFile, opts); err != nil {
+		t.Fatal(err)
+	}
+	parts, _ := env.Feed("parts")
+	for worker, imsi := range []string{"250010000000001", "250010000000002", "250010000000003", "250010000000002"} {
+		row, err := parts.NextRow(worker % 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row["imsi"] != imsi {
+			t.Fatalf("Partition %d: %s, expected %s", worker%2, row["imsi"], imsi)
+		}
+	}
+
+	if _, err := ParseFeedOptions("xml", "", "", "", 0); err == nil {
+		t.Fatal("Unknown format accepted")
+	}
+	if err := env.RemoveFeed("subs"); err != nil || len(env.FeedBindings()) != 0 {
+		t.Fatal("Feed is not removed", err)
+	}
+
+	fmt.Println("<<< AVP data feeds test")
+}
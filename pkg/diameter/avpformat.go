@@ -0,0 +1,658 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avpformat.go
+// Description: Diameter pkg: Derived AVP data formats (TBCD, PLMN, ULI, etc.)
+//
+
+package diameter
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+// Derived AVP data formats.
+// The format is declared by the 'format' property of the AVP definition
+// in the dictionary and refines the codec of the AVP base data type.
+const (
+	AvpFormatTBCD     = "TBCD"     // Telephony BCD digits string (3GPP TS 29.002)
+	AvpFormatIMSI     = "IMSI"     // IMSI in TBCD (3GPP TS 23.003)
+	AvpFormatMSISDN   = "MSISDN"   // MSISDN in TBCD (3GPP TS 29.329)
+	AvpFormatE164     = "E164"     // ISDN-AddressString: TON/NPI + TBCD (3GPP TS 29.002)
+	AvpFormatPLMN     = "PLMN"     // MCC + MNC in 3 octets (3GPP TS 24.008)
+	AvpFormatHex      = "Hex"      // Raw octets set and shown as hex string
+	AvpFormatULI      = "ULI"      // 3GPP-User-Location-Info (3GPP TS 29.061)
+	AvpFormatTimeZone = "TimeZone" // 3GPP-MS-TimeZone (3GPP TS 29.061)
+	AvpFormatBitmap   = "Bitmap"   // Unsigned32 bit flags
+
+	AvpFormatResultCode             = "ResultCode"             // Result-Code named by the dictionary
+	AvpFormatExperimentalResultCode = "ExperimentalResultCode" // Experimental-Result-Code named by the dictionary
+)
+
+const (
+	tbcdDigits = "0123456789*#abc"
+	tbcdFiller = 0x0F
+
+	e164International = 0x91 // TON: international number, NPI: ISDN/Telephony
+	e164Unknown       = 0x81 // TON: unknown, NPI: ISDN/Telephony
+
+	tzNegative = 0x08
+	tzMaxDST   = 2
+)
+
+// Geographic Location Types of 3GPP-User-Location-Info (3GPP TS 29.061)
+const (
+	uliCGI     = 0
+	uliSAI     = 1
+	uliRAI     = 2
+	uliTAI     = 128
+	uliECGI    = 129
+	uliTAIECGI = 130
+)
+
+// Variables
+//
+
+var uliTypeNames = map[byte]string{
+	uliCGI:     "cgi",
+	uliSAI:     "sai",
+	uliRAI:     "rai",
+	uliTAI:     "tai",
+	uliECGI:    "ecgi",
+	uliTAIECGI: "tai-ecgi",
+}
+
+// Make Value Functions
+//
+
+// mkvTBCD creates AvpData from a digits string packed in TBCD.
+func mkvTBCD(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, encodeTBCD)
+}
+
+// mkvIMSI creates AvpData from an IMSI (6 to 15 digits) packed in TBCD.
+func mkvIMSI(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, func(text string) ([]byte, error) {
+		if len(text) < 6 || len(text) > 15 || !isDigits(text) {
+			return nil, &diwe.ErrInvalidValue{Value: text}
+		}
+		return encodeTBCD(text)
+	})
+}
+
+// mkvMSISDN creates AvpData from a MSISDN (up to 15 digits, optional '+') packed in TBCD.
+func mkvMSISDN(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, func(text string) ([]byte, error) {
+		text = strings.TrimPrefix(text, "+")
+		if len(text) > 15 || !isDigits(text) {
+			return nil, &diwe.ErrInvalidValue{Value: text}
+		}
+		return encodeTBCD(text)
+	})
+}
+
+// mkvE164 creates AvpData from an E.164 number as ISDN-AddressString.
+// A leading '+' selects the international type of number.
+func mkvE164(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, func(text string) ([]byte, error) {
+		tonNpi := byte(e164Unknown)
+		if strings.HasPrefix(text, "+") {
+			tonNpi = e164International
+			text = text[1:]
+		}
+		if len(text) > 15 || !isDigits(text) {
+			return nil, &diwe.ErrInvalidValue{Value: text}
+		}
+
+		digits, err := encodeTBCD(text)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{tonNpi}, digits...), nil
+	})
+}
+
+// mkvPLMN creates AvpData from a PLMN identifier (MCC + MNC, 5 or 6 digits).
+func mkvPLMN(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, encodePLMN)
+}
+
+// mkvHex creates AvpData from a hex string (optional "0x" prefix and ':' separators).
+func mkvHex(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, func(text string) ([]byte, error) {
+		text = strings.TrimPrefix(strings.ToLower(text), "0x")
+		return hex.DecodeString(strings.ReplaceAll(text, ":", ""))
+	})
+}
+
+// mkvULI creates AvpData from a 3GPP-User-Location-Info text representation.
+func mkvULI(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, encodeULI)
+}
+
+// mkvTimeZone creates AvpData from a 3GPP-MS-TimeZone text representation.
+func mkvTimeZone(avp *Avp, value any) (*AvpData, error) {
+	return makeOctets(avp, value, encodeTimeZone)
+}
+
+// mkvBitmap creates AvpData from a flags bitmap.
+// Accepts a number, a numeric string (e.g. "0x05") or bits list (e.g. "0|2").
+func mkvBitmap(avp *Avp, value any) (*AvpData, error) {
+	bitmap, err := func() (uint32, error) {
+		switch v := (value).(type) {
+		case uint32:
+			return v, nil
+		case int:
+			if v >= 0 && v <= math.MaxUint32 {
+				return uint32(v), nil
+			}
+		case string:
+			return parseBitmap(v)
+		}
+		return 0, &diwe.ErrInvalidValue{Value: value}
+	}()
+
+	if err != nil {
+		return nil, &diwe.ErrInvalidFormatValue{Avp: avp.Name(), Format: avp.Format(), Value: value}
+	}
+
+	return &AvpData{
+			Value: bitmap,
+			Size:  4,
+		},
+		nil
+}
+
+// mkvResultCode creates AvpData from a Result-Code value or name (e.g. "DIAMETER_SUCCESS").
+func mkvResultCode(avp *Avp, value any) (*AvpData, error) {
+	return makeResultCode(avp, value, func(name string) (*dict.ResultCode, error) {
+		return avp.Dict().GetResultCodeByName(name, 0)
+	})
+}
+
+// mkvExperimentalResultCode creates AvpData from an Experimental-Result-Code value or name
+// (e.g. "DIAMETER_ERROR_USER_UNKNOWN").
+func mkvExperimentalResultCode(avp *Avp, value any) (*AvpData, error) {
+	return makeResultCode(avp, value, func(name string) (*dict.ResultCode, error) {
+		return avp.Dict().FindExperimentalResultCode(name)
+	})
+}
+
+// To Text Functions
+//
+
+// txtTBCD converts TBCD packed digits to string.
+func txtTBCD(avp *Avp) string {
+	if v, ok := avp.Value().([]byte); ok {
+		return decodeTBCD(v)
+	}
+	return ""
+}
+
+// txtE164 converts ISDN-AddressString to string ('+' for international numbers).
+func txtE164(avp *Avp) string {
+	v, ok := avp.Value().([]byte)
+	if !ok || len(v) == 0 {
+		return ""
+	}
+
+	switch v[0] {
+	case e164International:
+		return "+" + decodeTBCD(v[1:])
+	case e164Unknown:
+		return decodeTBCD(v[1:])
+	}
+	return fmt.Sprintf("%s (TON/NPI 0x%02x)", decodeTBCD(v[1:]), v[0])
+}
+
+// txtPLMN converts a PLMN identifier to MCC + MNC digits string.
+func txtPLMN(avp *Avp) string {
+	if v, ok := avp.Value().([]byte); ok {
+		if plmn, ok := decodePLMN(v); ok && len(v) == 3 {
+			return plmn
+		}
+		return fmt.Sprintf("%x", v)
+	}
+	return ""
+}
+
+// txtULI converts 3GPP-User-Location-Info to text.
+func txtULI(avp *Avp) string {
+	if v, ok := avp.Value().([]byte); ok {
+		return decodeULI(v)
+	}
+	return ""
+}
+
+// txtTimeZone converts 3GPP-MS-TimeZone to text.
+func txtTimeZone(avp *Avp) string {
+	if v, ok := avp.Value().([]byte); ok {
+		return decodeTimeZone(v)
+	}
+	return ""
+}
+
+// txtBitmap converts a flags bitmap to hex string followed by the set bits.
+func txtBitmap(avp *Avp) string {
+	v, ok := avp.Value().(uint32)
+	if !ok {
+		return ""
+	}
+
+	bits := make([]string, 0, 32)
+	for bit := range 32 {
+		if v&(1<<bit) != 0 {
+			bits = append(bits, strconv.Itoa(bit))
+		}
+	}
+	if len(bits) == 0 {
+		return fmt.Sprintf("0x%08x", v)
+	}
+	return fmt.Sprintf("0x%08x (%s)", v, strings.Join(bits, "|"))
+}
+
+// txtResultCode converts a Result-Code to its name followed by the value.
+func txtResultCode(avp *Avp) string {
+	v, ok := avp.Value().(uint32)
+	if !ok {
+		return ""
+	}
+
+	if rc, err := avp.Dict().GetResultCodeByCode(v, 0); err == nil {
+		return fmt.Sprintf("%s (%d)", rc.Name, v)
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// txtExperimentalResultCode converts an Experimental-Result-Code to its name followed by the value.
+// The Vendor-Id is a sibling AVP, so the first vendor defining the code gives the name.
+func txtExperimentalResultCode(avp *Avp) string {
+	v, ok := avp.Value().(uint32)
+	if !ok {
+		return ""
+	}
+
+	if rc, err := avp.Dict().FindExperimentalResultCode(v); err == nil {
+		return fmt.Sprintf("%s (%d)", rc.Name, v)
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// Helpers
+//
+
+// makeResultCode creates AvpData from a result code value, numeric string or name.
+// Text following the first field (e.g. the value printed by txtResultCode) is ignored.
+func makeResultCode(avp *Avp, value any, lookup func(string) (*dict.ResultCode, error)) (*AvpData, error) {
+	code, err := func() (uint32, error) {
+		switch v := (value).(type) {
+		case uint32:
+			return v, nil
+		case int:
+			if v >= 0 && v <= math.MaxUint32 {
+				return uint32(v), nil
+			}
+		case string:
+			fields := strings.Fields(v)
+			if len(fields) == 0 {
+				break
+			}
+			if n, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+				return uint32(n), nil
+			}
+			if rc, err := lookup(fields[0]); err == nil {
+				return rc.Code, nil
+			}
+		}
+		return 0, &diwe.ErrInvalidValue{Value: value}
+	}()
+
+	if err != nil {
+		return nil, &diwe.ErrInvalidFormatValue{Avp: avp.Name(), Format: avp.Format(), Value: value}
+	}
+
+	return &AvpData{
+			Value: code,
+			Size:  4,
+		},
+		nil
+}
+
+// makeOctets creates AvpData from a value converted by the encoder.
+// Byte slices are accepted as already encoded data.
+func makeOctets(avp *Avp, value any, encode func(string) ([]byte, error)) (*AvpData, error) {
+	encoded, err := func() ([]byte, error) {
+		switch v := (value).(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return encode(strings.TrimSpace(v))
+		case int:
+			return encode(strconv.Itoa(v))
+		}
+		return nil, &diwe.ErrInvalidValue{Value: value}
+	}()
+
+	if err != nil {
+		return nil, &diwe.ErrInvalidFormatValue{Avp: avp.Name(), Format: avp.Format(), Value: value}
+	}
+
+	return &AvpData{
+			Value: encoded,
+			Size:  uint32(len(encoded)),
+		},
+		nil
+}
+
+// isDigits reports whether the string consists of decimal digits only.
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeTBCD packs digits (0-9, '*', '#', 'a', 'b', 'c') two per octet,
+// low nibble first, with 0xF filler for odd length.
+func encodeTBCD(digits string) ([]byte, error) {
+	if len(digits) == 0 {
+		return nil, &diwe.ErrInvalidValue{Value: digits}
+	}
+
+	digits = strings.ToLower(digits)
+	encoded := make([]byte, (len(digits)+1)/2)
+	for i := range len(digits) {
+		n := strings.IndexByte(tbcdDigits, digits[i])
+		if n < 0 {
+			return nil, &diwe.ErrInvalidValue{Value: digits}
+		}
+		if i&1 == 0 {
+			encoded[i/2] = byte(n)
+		} else {
+			encoded[i/2] |= byte(n) << 4
+		}
+	}
+	if len(digits)&1 != 0 {
+		encoded[len(encoded)-1] |= tbcdFiller << 4
+	}
+
+	return encoded, nil
+}
+
+// decodeTBCD unpacks TBCD digits until the end of data or the first filler.
+func decodeTBCD(data []byte) string {
+	var b strings.Builder
+	for _, octet := range data {
+		for _, n := range [2]byte{octet & maskLow4bits, octet >> 4} {
+			if n == tbcdFiller {
+				return b.String()
+			}
+			b.WriteByte(tbcdDigits[n])
+		}
+	}
+	return b.String()
+}
+
+// encodePLMN encodes a PLMN identifier (MCC + MNC, 5 or 6 digits) to 3 octets:
+//   - Octet 1: MCC digit 2 | MCC digit 1
+//   - Octet 2: MNC digit 3 (or 0xF filler) | MCC digit 3
+//   - Octet 3: MNC digit 2 | MNC digit 1
+func encodePLMN(plmn string) ([]byte, error) {
+	if (len(plmn) != 5 && len(plmn) != 6) || !isDigits(plmn) {
+		return nil, &diwe.ErrInvalidValue{Value: plmn}
+	}
+
+	d := func(i int) byte { return plmn[i] - '0' }
+	mnc3 := byte(tbcdFiller)
+	if len(plmn) == 6 {
+		mnc3 = d(5)
+	}
+
+	return []byte{d(1)<<4 | d(0), mnc3<<4 | d(2), d(4)<<4 | d(3)}, nil
+}
+
+// decodePLMN decodes the first 3 octets of data as a PLMN identifier.
+func decodePLMN(data []byte) (string, bool) {
+	if len(data) < 3 {
+		return "", false
+	}
+
+	digits := []byte{data[0] & maskLow4bits, data[0] >> 4, data[1] & maskLow4bits, data[2] & maskLow4bits, data[2] >> 4}
+	if mnc3 := data[1] >> 4; mnc3 != tbcdFiller {
+		digits = append(digits, mnc3)
+	}
+
+	for i, d := range digits {
+		if d > 9 {
+			return "", false
+		}
+		digits[i] = d + '0'
+	}
+
+	return string(digits), true
+}
+
+// encodeULI encodes 3GPP-User-Location-Info from text:
+//   - cgi:<plmn>:<lac>:<ci>, sai:<plmn>:<lac>:<sac>, rai:<plmn>:<lac>:<rac>
+//   - tai:<plmn>:<tac>, ecgi:<plmn>:<eci>
+//   - tai-ecgi:<plmn>:<tac>:<eci> or tai-ecgi:<plmn>:<tac>:<plmn>:<eci>
+//   - <type>:<hex> for other location types
+//
+// Numbers are decimal or hex with "0x" prefix.
+func encodeULI(text string) ([]byte, error) {
+	fields := strings.Split(strings.ToLower(text), ":")
+	if len(fields) < 2 {
+		return nil, &diwe.ErrInvalidValue{Value: text}
+	}
+
+	locType, known := byte(0), false
+	for t, name := range uliTypeNames {
+		if name == fields[0] {
+			locType, known = t, true
+			break
+		}
+	}
+
+	// Unknown location type: raw payload in hex
+	if !known {
+		t, err := strconv.ParseUint(fields[0], 0, 8)
+		if err != nil || len(fields) != 2 {
+			return nil, &diwe.ErrInvalidValue{Value: text}
+		}
+		payload, err := hex.DecodeString(strings.TrimPrefix(fields[1], "0x"))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{byte(t)}, payload...), nil
+	}
+
+	var err error
+	encoded := []byte{locType}
+	putPLMN := func(s string) {
+		if err == nil {
+			var plmn []byte
+			if plmn, err = encodePLMN(s); err == nil {
+				encoded = append(encoded, plmn...)
+			}
+		}
+	}
+	putUint := func(s string, size, bits int) {
+		if err == nil {
+			var n uint64
+			if n, err = strconv.ParseUint(s, 0, bits); err == nil {
+				for i := size - 1; i >= 0; i-- {
+					encoded = append(encoded, byte(n>>(8*i)))
+				}
+			}
+		}
+	}
+
+	switch {
+	case locType <= uliRAI && len(fields) == 4:
+		putPLMN(fields[1])
+		putUint(fields[2], 2, 16)
+		putUint(fields[3], 2, 16)
+	case locType == uliTAI && len(fields) == 3:
+		putPLMN(fields[1])
+		putUint(fields[2], 2, 16)
+	case locType == uliECGI && len(fields) == 3:
+		putPLMN(fields[1])
+		putUint(fields[2], 4, 28)
+	case locType == uliTAIECGI && len(fields) == 4:
+		putPLMN(fields[1])
+		putUint(fields[2], 2, 16)
+		putPLMN(fields[1])
+		putUint(fields[3], 4, 28)
+	case locType == uliTAIECGI && len(fields) == 5:
+		putPLMN(fields[1])
+		putUint(fields[2], 2, 16)
+		putPLMN(fields[3])
+		putUint(fields[4], 4, 28)
+	default:
+		return nil, &diwe.ErrInvalidValue{Value: text}
+	}
+
+	return encoded, err
+}
+
+// decodeULI converts 3GPP-User-Location-Info to text (see encodeULI).
+func decodeULI(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	locType, body := data[0], data[1:]
+	name := uliTypeNames[locType]
+	plmn := func(b []byte) string {
+		if s, ok := decodePLMN(b); ok {
+			return s
+		}
+		return fmt.Sprintf("%x", b[:3])
+	}
+
+	switch {
+	case locType <= uliRAI && len(body) == 7:
+		return fmt.Sprintf("%s:%s:0x%04x:0x%04x", name, plmn(body),
+			binary.BigEndian.Uint16(body[3:5]), binary.BigEndian.Uint16(body[5:7]))
+	case locType == uliTAI && len(body) == 5:
+		return fmt.Sprintf("%s:%s:0x%04x", name, plmn(body), binary.BigEndian.Uint16(body[3:5]))
+	case locType == uliECGI && len(body) == 7:
+		return fmt.Sprintf("%s:%s:0x%07x", name, plmn(body), binary.BigEndian.Uint32(body[3:7])&0x0FFFFFFF)
+	case locType == uliTAIECGI && len(body) == 12:
+		taiPlmn, ecgiPlmn := plmn(body), plmn(body[5:])
+		tac, eci := binary.BigEndian.Uint16(body[3:5]), binary.BigEndian.Uint32(body[8:12])&0x0FFFFFFF
+		if taiPlmn == ecgiPlmn {
+			return fmt.Sprintf("%s:%s:0x%04x:0x%07x", name, taiPlmn, tac, eci)
+		}
+		return fmt.Sprintf("%s:%s:0x%04x:%s:0x%07x", name, taiPlmn, tac, ecgiPlmn, eci)
+	}
+
+	return fmt.Sprintf("%d:%x", locType, body)
+}
+
+// encodeTimeZone encodes 3GPP-MS-TimeZone from text "<+|-><hh>:<mm> [dst=<0..2>]".
+// The offset is kept in quarters of an hour as swapped BCD digits with the sign
+// in bit 3 (3GPP TS 24.008), followed by the daylight saving time adjustment.
+func encodeTimeZone(text string) ([]byte, error) {
+	invalid := &diwe.ErrInvalidValue{Value: text}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields) > 2 || len(fields[0]) < 2 {
+		return nil, invalid
+	}
+
+	sign, offset := fields[0][0], fields[0][1:]
+	if sign != '+' && sign != '-' {
+		return nil, invalid
+	}
+	hh, mm, _ := strings.Cut(offset, ":")
+	hours, err1 := strconv.ParseUint(hh, 10, 8)
+	minutes, err2 := strconv.ParseUint(cmp.Or(mm, "0"), 10, 8)
+	if err1 != nil || err2 != nil || minutes >= 60 {
+		return nil, invalid
+	}
+
+	total := hours*60 + minutes
+	quarters := total / 15
+	if total%15 != 0 || quarters > 79 {
+		return nil, invalid
+	}
+
+	dst := uint64(0)
+	if len(fields) == 2 {
+		v, found := strings.CutPrefix(strings.ToLower(fields[1]), "dst=")
+		n, err := strconv.ParseUint(v, 10, 8)
+		if !found || err != nil || n > tzMaxDST {
+			return nil, invalid
+		}
+		dst = n
+	}
+
+	tz := byte(quarters%10)<<4 | byte(quarters/10)
+	if sign == '-' {
+		tz |= tzNegative
+	}
+
+	return []byte{tz, byte(dst)}, nil
+}
+
+// decodeTimeZone converts 3GPP-MS-TimeZone to text (see encodeTimeZone).
+func decodeTimeZone(data []byte) string {
+	if len(data) != 2 {
+		return fmt.Sprintf("%x", data)
+	}
+
+	tz := data[0]
+	quarters := int(tz&0x07)*10 + int(tz>>4)
+	sign := '+'
+	if tz&tzNegative != 0 {
+		sign = '-'
+	}
+
+	return fmt.Sprintf("%c%02d:%02d dst=%d", sign, quarters*15/60, quarters*15%60, data[1]&0x03)
+}
+
+// parseBitmap parses a bitmap from a number ("5", "0x05") or bits list ("0|2").
+// Text following the first field (e.g. the bits list printed by txtBitmap) is ignored.
+func parseBitmap(text string) (uint32, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return 0, &diwe.ErrInvalidValue{Value: text}
+	}
+
+	if !strings.Contains(fields[0], "|") {
+		n, err := strconv.ParseUint(fields[0], 0, 32)
+		return uint32(n), err
+	}
+
+	bitmap := uint32(0)
+	for bit := range strings.SplitSeq(fields[0], "|") {
+		n, err := strconv.ParseUint(bit, 10, 8)
+		if err != nil || n > 31 {
+			return 0, &diwe.ErrInvalidValue{Value: text}
+		}
+		bitmap |= 1 << n
+	}
+
+	return bitmap, nil
+}
@@ -0,0 +1,71 @@
+package diameter
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestAvpFormats(t *testing.T) {
+	fmt.Println(">>> AVP formats test")
+
+	tbcd, err := encodeTBCD("79161234567")
+	if err != nil || !bytes.Equal(tbcd, []byte{0x97, 0x61, 0x21, 0x43, 0x65, 0xf7}) {
+		t.Fatalf("TBCD: %x, %v", tbcd, err)
+	}
+	if s := decodeTBCD(tbcd); s != "79161234567" {
+		t.Fatalf("TBCD: %s", s)
+	}
+
+	for plmn, encoded := range map[string][]byte{
+		"25001":  {0x52, 0xf0, 0x10},
+		"310410": {0x13, 0x00, 0x14},
+	} {
+		b, err := encodePLMN(plmn)
+		if err != nil || !bytes.Equal(b, encoded) {
+			t.Fatalf("PLMN %s: %x, %v", plmn, b, err)
+		}
+		if s, ok := decodePLMN(b); !ok || s != plmn {
+			t.Fatalf("PLMN %x: %s", b, s)
+		}
+	}
+
+	for _, uli := range []string{
+		"cgi:25001:0x0001:0x0002",
+		"tai:25001:0x0001",
+		"ecgi:310410:0x0000101",
+		"tai-ecgi:25001:0x0001:0x0000101",
+		"tai-ecgi:25001:0x0001:25002:0x0000101",
+		"3:0102",
+	} {
+		b, err := encodeULI(uli)
+		if err != nil {
+			t.Fatalf("ULI %s: %v", uli, err)
+		}
+		if s := decodeULI(b); s != uli {
+			t.Fatalf("ULI %s: %x -> %s", uli, b, s)
+		}
+		fmt.Printf("ULI %s: %x\n", uli, b)
+	}
+
+	for _, tz := range []string{"+03:00 dst=0", "-05:30 dst=1", "+13:45 dst=2"} {
+		b, err := encodeTimeZone(tz)
+		if err != nil {
+			t.Fatalf("TimeZone %s: %v", tz, err)
+		}
+		if s := decodeTimeZone(b); s != tz {
+			t.Fatalf("TimeZone %s: %x -> %s", tz, b, s)
+		}
+	}
+	if b, _ := encodeTimeZone("+03:00"); !bytes.Equal(b, []byte{0x21, 0x00}) {
+		t.Fatalf("TimeZone +03:00: %x", b)
+	}
+
+	for text, bitmap := range map[string]uint32{"0|2": 5, "0x0300": 768, "8": 8, "0x00000005 (0|2)": 5} {
+		if v, err := parseBitmap(text); err != nil || v != bitmap {
+			t.Fatalf("Bitmap %s: %d, %v", text, v, err)
+		}
+	}
+
+	fmt.Println("<<< AVP formats test")
+}
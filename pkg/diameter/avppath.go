@@ -0,0 +1,477 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avppath.go
+// Description: Diameter pkg: paths to the AVPs inside the grouped AVPs
+//
+
+package diameter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+const (
+	avpPathSep = "."
+	// avpRuleAny is the group member rule allowing any AVP ("* [ AVP ]")
+	avpRuleAny = "AVP"
+)
+
+// Types
+//
+
+// AvpPathElem is the element of the AVP path: the AVP and the 0-based index
+// of its occurrence in the parent AVP list (-1 if the index is not specified).
+type AvpPathElem struct {
+	Avp   *dict.Avp
+	Index int
+}
+
+// AvpPath is the path to the AVP inside the grouped AVPs, e.g.
+// "Subscription-Data.APN-Configuration-Profile.APN-Configuration[2].Service-Selection".
+type AvpPath []AvpPathElem
+
+// pathOp is the operation applied to the AVP of the last path element in its parent AVP list.
+// Returns the updated parent AVP list.
+type pathOp func(avps []*Avp, elem AvpPathElem) ([]*Avp, error)
+
+// Functions
+//
+
+// IsAvpPath reports whether the AVP identifier is the path (contains the members or the index).
+func IsAvpPath(avpId string) bool {
+	return strings.ContainsAny(avpId, avpPathSep+"[")
+}
+
+// Methods
+//
+
+// ParseAvpPath parses the AVP path. The path elements are the AVP names or codes separated by dots,
+// each element may have the 0-based occurrence index in brackets. The elements after the first one
+// must be the members of the preceding grouped AVP as defined by the dictionary.
+func (d *Diameter) ParseAvpPath(path string) (AvpPath, error) {
+	if path == "" {
+		return nil, &diwe.ErrInvalidAvpPath{Path: path, Reason: "empty path"}
+	}
+
+	var result AvpPath
+	for part := range strings.SplitSeq(path, avpPathSep) {
+		name, index := part, -1
+		if open := strings.IndexByte(part, '['); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, &diwe.ErrInvalidAvpPath{Path: path, Reason: fmt.Sprintf("invalid index in '%s'", part)}
+			}
+			n, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil || n < 0 {
+				return nil, &diwe.ErrInvalidAvpPath{Path: path, Reason: fmt.Sprintf("invalid index in '%s'", part)}
+			}
+			name, index = part[:open], n
+		}
+
+		avp, err := d.dict.GetAvp(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(result) > 0 {
+			parent := result[len(result)-1].Avp
+			if parent.Group == nil {
+				return nil, &diwe.ErrAvpIsNotGrouped{AvpName: parent.Name}
+			}
+			if !isGroupMember(parent.Group, avp.Name) {
+				return nil, &diwe.ErrInvalidAvpPath{Path: path, Reason: fmt.Sprintf("%s is not a member of %s", avp.Name, parent.Name)}
+			}
+		}
+
+		result = append(result, AvpPathElem{Avp: avp, Index: index})
+	}
+
+	return result, nil
+}
+
+// AvpPathMembers returns the paths to the members of the grouped AVP defined by the path,
+// the top level AVP names if the path is empty. Used for the path completion.
+func (d *Diameter) AvpPathMembers(path string) []string {
+	names := []string{}
+	if path == "" {
+		for avp := range d.dict.AvpIter() {
+			names = append(names, avp.Name)
+		}
+		return names
+	}
+
+	parsed, err := d.ParseAvpPath(path)
+	if err != nil {
+		return names
+	}
+	if group := parsed[len(parsed)-1].Avp.Group; group != nil {
+		for _, member := range group.Members {
+			if member.Name != avpRuleAny {
+				names = append(names, path+avpPathSep+member.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+// String returns the text of the path.
+func (p AvpPath) String() string {
+	parts := make([]string, 0, len(p))
+	for _, elem := range p {
+		if elem.Index >= 0 {
+			parts = append(parts, fmt.Sprintf("%s[%d]", elem.Avp.Name, elem.Index))
+		} else {
+			parts = append(parts, elem.Avp.Name)
+		}
+	}
+
+	return strings.Join(parts, avpPathSep)
+}
+
+// GetPath returns the AVPs of the store defined by the path.
+// The element without index selects all its occurrences.
+func (store *AvpStore) GetPath(path string) ([]*Avp, error) {
+	parsed, err := store.env.ParseAvpPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return findPath(store.data[parsed[0].Avp.Code], parsed), nil
+}
+
+// SetPath sets the value of the AVP defined by the path. The element without index is the first occurrence,
+// the missing AVP is created if its index is the number of the occurrences (e.g. [0] for the first one).
+// The value may be the template, the grouped AVP value may be the YAML mapping text.
+func (store *AvpStore) SetPath(path string, value any) error {
+	parsed, avp, err := store.pathAvp(path, value)
+	if err != nil {
+		return err
+	}
+
+	return store.updatePath(parsed, true, setPath(avp))
+}
+
+// AddPath adds the AVP defined by the path after the existing occurrences.
+func (store *AvpStore) AddPath(path string, value any) error {
+	parsed, avp, err := store.pathAvp(path, value)
+	if err != nil {
+		return err
+	}
+
+	return store.updatePath(parsed, true, addPath(avp))
+}
+
+// DeletePath deletes the AVP defined by the path, all occurrences of the AVP if the last element has no index.
+func (store *AvpStore) DeletePath(path string) error {
+	parsed, err := store.env.ParseAvpPath(path)
+	if err != nil {
+		return err
+	}
+
+	return store.updatePath(parsed, false, deletePath)
+}
+
+// updatePath applies the operation to the store AVPs. The AVPs on the path are copied
+// since the store AVPs are shared with the messages built from the store.
+func (store *AvpStore) updatePath(parsed AvpPath, create bool, op pathOp) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	code := parsed[0].Avp.Code
+	avps, err := walkPath(store.env, slices.Clone(store.data[code]), parsed, create, op)
+	if err != nil {
+		return err
+	}
+
+	if len(avps) == 0 {
+		delete(store.data, code)
+	} else {
+		store.data[code] = avps
+	}
+
+	return nil
+}
+
+// pathAvp parses the path and makes the AVP of the last path element with the value.
+// The AVP is made before the store is locked since the templates are evaluated from the store.
+func (store *AvpStore) pathAvp(path string, value any) (AvpPath, *Avp, error) {
+	parsed, err := store.env.ParseAvpPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	avp, err := store.env.GetAvp(parsed[len(parsed)-1].Avp.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := store.setValue(avp, value); err != nil {
+		return nil, nil, err
+	}
+
+	return parsed, avp, nil
+}
+
+// setValue sets the store AVP value: the template is checked by the dry evaluation as in YAML data,
+// the text of the grouped AVP is the YAML mapping of its members.
+func (store *AvpStore) setValue(avp *Avp, value any) error {
+	text, ok := value.(string)
+	if !ok {
+		return avp.SetValue(value)
+	}
+
+	if avp.IsGrouped() {
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(text), &node); err != nil {
+			return err
+		}
+		if len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+			return &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
+		}
+		mapping := node.Content[0]
+		members := []*Avp{}
+		for i := 0; i < len(mapping.Content); i += 2 {
+			avps, err := store.yamlNodeToAvps(mapping.Content[i], mapping.Content[i+1])
+			if err != nil {
+				return err
+			}
+			members = append(members, avps...)
+		}
+		return avp.SetValue(members)
+	}
+
+	if IsTemplate(text) {
+		tmpl, err := parseTemplate(text, avp.Name())
+		if err != nil {
+			return err
+		}
+		avp.tmpl = tmpl
+		if text, err = store.env.evalTemplate(avp, store.dryContext()); err != nil {
+			return err
+		}
+	}
+
+	return avp.SetValue(text)
+}
+
+// GetPath returns the AVPs of the message defined by the path.
+// The element without index selects all its occurrences.
+func (m *Message) GetPath(path string) ([]*Avp, error) {
+	parsed, err := m.env.ParseAvpPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return findPath(m.avps, parsed), nil
+}
+
+// SetPath sets the value of the AVP defined by the path. The element without index is the first occurrence,
+// the missing AVP is created if its index is the number of the occurrences (e.g. [0] for the first one).
+func (m *Message) SetPath(path string, value any) error {
+	parsed, avp, err := m.pathAvp(path, value)
+	if err != nil {
+		return err
+	}
+
+	return m.updatePath(parsed, true, setPath(avp))
+}
+
+// AddPath adds the AVP defined by the path after the existing occurrences.
+func (m *Message) AddPath(path string, value any) error {
+	parsed, avp, err := m.pathAvp(path, value)
+	if err != nil {
+		return err
+	}
+
+	return m.updatePath(parsed, true, addPath(avp))
+}
+
+// DeletePath deletes the AVP defined by the path, all occurrences of the AVP if the last element has no index.
+func (m *Message) DeletePath(path string) error {
+	parsed, err := m.env.ParseAvpPath(path)
+	if err != nil {
+		return err
+	}
+
+	return m.updatePath(parsed, false, deletePath)
+}
+
+// updatePath applies the operation to the message AVPs. The AVPs on the path are copied
+// since the group members may be shared with the store AVPs.
+func (m *Message) updatePath(parsed AvpPath, create bool, op pathOp) error {
+	avps, err := walkPath(m.env, m.avps, parsed, create, op)
+	if err != nil {
+		return err
+	}
+	m.avps = avps
+	m.bytes = nil // Invalidate cached serialization
+
+	return nil
+}
+
+// pathAvp parses the path and makes the AVP of the last path element with the value.
+func (m *Message) pathAvp(path string, value any) (AvpPath, *Avp, error) {
+	parsed, err := m.env.ParseAvpPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	avp, err := m.env.GetAvp(parsed[len(parsed)-1].Avp.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := avp.SetValue(value); err != nil {
+		return nil, nil, err
+	}
+
+	return parsed, avp, nil
+}
+
+// Helpers
+//
+
+// setPath returns the operation replacing the AVP occurrence by the new AVP.
+// The new AVP is appended if its index is the number of the occurrences.
+func setPath(avp *Avp) pathOp {
+	return func(avps []*Avp, elem AvpPathElem) ([]*Avp, error) {
+		pos := pathPositions(avps, elem.Avp.Code)
+		index := max(elem.Index, 0)
+		switch {
+		case index < len(pos):
+			avps[pos[index]] = avp
+			return avps, nil
+		case index == len(pos):
+			return append(avps, avp), nil
+		}
+
+		return nil, &diwe.ErrIndexOutOfRange{Index: index}
+	}
+}
+
+// addPath returns the operation appending the new AVP to the AVP list.
+func addPath(avp *Avp) pathOp {
+	return func(avps []*Avp, elem AvpPathElem) ([]*Avp, error) {
+		return append(avps, avp), nil
+	}
+}
+
+// walkPath descends the path in the AVP list and applies the operation to the last path element.
+// The grouped AVP without index is the first occurrence, the missing grouped AVP is created
+// if create is set and its index is the number of the occurrences. The grouped AVPs on the way
+// are replaced by their copies. Returns the updated AVP list.
+func walkPath(env *Diameter, avps []*Avp, path AvpPath, create bool, op pathOp) ([]*Avp, error) {
+	elem := path[0]
+	if len(path) == 1 {
+		return op(avps, elem)
+	}
+
+	pos := pathPositions(avps, elem.Avp.Code)
+	index := max(elem.Index, 0)
+
+	var group *Avp
+	switch {
+	case index < len(pos):
+		copied, err := avps[pos[index]].Copy()
+		if err != nil {
+			return nil, err
+		}
+		group = copied
+		avps[pos[index]] = group
+	case create && index == len(pos):
+		var err error
+		if group, err = env.GetAvp(elem.Avp.Code); err != nil {
+			return nil, err
+		}
+		avps = append(avps, group)
+	case len(pos) == 0:
+		return nil, &diwe.ErrMissingAvp{Avp: path.String()}
+	default:
+		return nil, &diwe.ErrIndexOutOfRange{Index: index}
+	}
+
+	members, _ := group.Value().([]*Avp)
+	members, err := walkPath(env, slices.Clone(members), path[1:], create, op)
+	if err != nil {
+		return nil, err
+	}
+	// The grouped AVP size is calculated on the serialization
+	group.value = &AvpData{Value: members}
+
+	return avps, nil
+}
+
+// findPath returns the AVPs defined by the path, the element without index selects all its occurrences.
+func findPath(avps []*Avp, path AvpPath) []*Avp {
+	result := []*Avp{}
+
+	elem := path[0]
+	for i, pos := range pathPositions(avps, elem.Avp.Code) {
+		if elem.Index >= 0 && elem.Index != i {
+			continue
+		}
+		if len(path) == 1 {
+			result = append(result, avps[pos])
+		} else if members, ok := avps[pos].Value().([]*Avp); ok {
+			result = append(result, findPath(members, path[1:])...)
+		}
+	}
+
+	return result
+}
+
+// deletePath removes the AVP of the path element from the AVP list.
+func deletePath(avps []*Avp, elem AvpPathElem) ([]*Avp, error) {
+	pos := pathPositions(avps, elem.Avp.Code)
+	switch {
+	case len(pos) == 0:
+		return nil, &diwe.ErrMissingAvp{Avp: elem.Avp.Name}
+	case elem.Index >= len(pos):
+		return nil, &diwe.ErrIndexOutOfRange{Index: elem.Index}
+	case elem.Index >= 0:
+		return slices.Delete(avps, pos[elem.Index], pos[elem.Index]+1), nil
+	}
+
+	return slices.DeleteFunc(avps, func(avp *Avp) bool {
+		return avp.Code() == elem.Avp.Code
+	}), nil
+}
+
+// pathPositions returns the positions of the AVP occurrences in the AVP list.
+func pathPositions(avps []*Avp, code uint32) []int {
+	pos := []int{}
+	for i, avp := range avps {
+		if avp.Code() == code {
+			pos = append(pos, i)
+		}
+	}
+
+	return pos
+}
+
+// isGroupMember reports whether the AVP is allowed in the group by the dictionary.
+func isGroupMember(group *dict.Group, name string) bool {
+	for _, member := range group.Members {
+		if strings.EqualFold(member.Name, name) || member.Name == avpRuleAny {
+			return true
+		}
+	}
+
+	return false
+}
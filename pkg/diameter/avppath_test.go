@@ -0,0 +1,144 @@
+package diameter
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestAvpPath(t *testing.T) {
+	fmt.Println(">>> AVP path test")
+
+	env := newTestEnv(t)
+	if err := env.Store().MakeFromYaml(`
+Subscription-Data:
+  MSISDN: "79160000001"
+  APN-Configuration-Profile:
+    Context-Identifier: 1
+    APN-Configuration:
+      - Context-Identifier: 1
+        Service-Selection: ims
+      - Context-Identifier: 2
+        Service-Selection: internet
+User-Name: "250010000000001"
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+	store := env.Store()
+
+	values := func(path string) []string {
+		avps, err := store.GetPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := []string{}
+		for _, avp := range avps {
+			codec, _ := avp.Codec()
+			result = append(result, codec.ToText(avp))
+		}
+		return result
+	}
+
+	const apn = "Subscription-Data.APN-Configuration-Profile.APN-Configuration"
+	if got := values(apn + ".Service-Selection"); !slices.Equal(got, []string{"ims", "internet"}) {
+		t.Fatalf("Service-Selection: %v", got)
+	}
+	if got := values(apn + "[1].Service-Selection"); !slices.Equal(got, []string{"internet"}) {
+		t.Fatalf("Service-Selection[1]: %v", got)
+	}
+
+	// The messages built before the change keep the old values
+	before, err := env.NewMessage("S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := before.AddAvp(store.Fetch(1400)[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetPath(apn+"[1].Service-Selection", "internet.mnc001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPath(apn+"[1].Context-Identifier", "0x10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddPath(apn, "{Context-Identifier: 3, Service-Selection: mms}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeletePath(apn + "[0]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPath("User-Name[1]", "{{imsi:prefix=25001}}"); err != nil {
+		t.Fatal(err)
+	}
+	store.Dump()
+
+	if got := values(apn + ".Service-Selection"); !slices.Equal(got, []string{"internet.mnc001", "mms"}) {
+		t.Fatalf("Service-Selection: %v", got)
+	}
+	if got := values(apn + ".Context-Identifier"); !slices.Equal(got, []string{"16", "3"}) {
+		t.Fatalf("Context-Identifier: %v", got)
+	}
+	if got := values("User-Name"); len(got) != 2 {
+		t.Fatalf("User-Name: %v", got)
+	}
+	if avps, _ := before.GetPath(apn + ".Service-Selection"); len(avps) != 2 || avps[0].Value() != "ims" {
+		t.Fatal("The message AVPs are changed by the store")
+	}
+
+	// The message changes do not affect the store
+	msg, err := env.NewMessage("S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.AddAvp(store.Fetch(1400)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetPath(apn+"[0].Service-Selection", "ims.mnc001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetPath("Terminal-Information.IMEI", "35123456789012"); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.DeletePath("Subscription-Data.MSISDN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := msg.Serialize(); err != nil {
+		t.Fatal(err)
+	}
+	msg.Trace(0)
+	if avps, _ := msg.GetPath(apn + "[0].Service-Selection"); len(avps) != 1 || avps[0].Value() != "ims.mnc001" {
+		t.Fatal("Service-Selection is not set in the message")
+	}
+	if got := values(apn + "[0].Service-Selection"); !slices.Equal(got, []string{"internet.mnc001"}) {
+		t.Fatalf("The store is changed by the message: %v", got)
+	}
+
+	for _, path := range []string{
+		"Subscription-Data.User-Name",
+		"User-Name.IMEI",
+		"Subscription-Data[x]",
+		"Unknown-AVP",
+	} {
+		if _, err := env.ParseAvpPath(path); err == nil {
+			t.Fatalf("Invalid path '%s' accepted", path)
+		} else {
+			fmt.Println(err)
+		}
+	}
+	if err := store.SetPath(apn+"[5].Service-Selection", "ims"); err == nil {
+		t.Fatal("Index out of range accepted")
+	}
+	if err := store.DeletePath("Terminal-Information"); err == nil {
+		t.Fatal("Missing AVP deleted")
+	}
+
+	if got := env.AvpPathMembers("Subscription-Data.APN-Configuration-Profile"); !slices.Equal(got, []string{
+		"Subscription-Data.APN-Configuration-Profile.Context-Identifier",
+		"Subscription-Data.APN-Configuration-Profile.APN-Configuration",
+	}) {
+		t.Fatalf("Members: %v", got)
+	}
+
+	fmt.Println("<<< AVP path test")
+}
@@ -0,0 +1,297 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avpprofile.go
+// Description: Diameter pkg: per-command and per-peer AVP profiles
+//
+
+package diameter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"tgdp/pkg/diameter/dict"
+)
+
+// Consts
+//
+
+// Command profile directions, defined by the profile file name:
+// UL.yaml - both, ULR.yaml - request, ULA.yaml - answer.
+const (
+	profileBoth = iota
+	profileRequest
+	profileAnswer
+)
+
+const (
+	profileExt          = ".yaml"
+	profileGlobal       = "global"
+	profileCustom       = "profile"
+	profilePeerPrefix   = "peer "
+	profileRequestShort = "R"
+	profileAnswerShort  = "A"
+)
+
+// Types
+//
+
+// profileKey identifies the command profile.
+type profileKey struct {
+	appId   uint32
+	cmdCode uint32
+	dir     int
+}
+
+// avpLayer is the AVP store with its name ("global", "S6a/ULR", "peer hss").
+type avpLayer struct {
+	name  string
+	store *AvpStore
+}
+
+// avpProfiles keeps the command and peer profiles of the Diameter environment.
+// The profiles sit on top of the global AVP store, the AVP values are taken from the first layer
+// that has them: peer profile, command profile for the direction, command profile, global store.
+type avpProfiles struct {
+	mu    sync.RWMutex
+	cmds  map[profileKey]avpLayer
+	peers map[string]avpLayer // lowercase peer name -> profile
+}
+
+// ProfileValue is the effective value of the command AVP with its source:
+// the profile layer, the data feed ("feed subs:imsi") or empty if the AVP has no value.
+type ProfileValue struct {
+	Rule   dict.AvpRule
+	Source string
+	Avps   []*Avp
+}
+
+// Methods
+//
+
+// LoadProfiles loads the command profiles from the directory layout <dir>/<app>/<command>.yaml,
+// e.g. yaml/S6a/ULR.yaml. The application directory is the application name or ID,
+// the file name is the command short name with the optional 'R' (request) or 'A' (answer) suffix.
+// Directories which are not application names are skipped.
+func (d *Diameter) LoadProfiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	profiles := make(map[profileKey]avpLayer)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		app, err := d.dict.GetApp(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), profileExt) {
+				continue
+			}
+
+			name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+			key, err := d.profileKey(app, name)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", filepath.Join(entry.Name(), file.Name()), err)
+			}
+
+			store := NewAvpStore(d)
+			if err := store.LoadFromFile(filepath.Join(dir, entry.Name(), file.Name()), AvpStoreAppend, 0); err != nil {
+				return fmt.Errorf("profile %s: %w", filepath.Join(entry.Name(), file.Name()), err)
+			}
+			profiles[key] = avpLayer{name: app.Name + "/" + name, store: &store}
+		}
+	}
+
+	d.profiles.mu.Lock()
+	defer d.profiles.mu.Unlock()
+	d.profiles.cmds = profiles
+
+	return nil
+}
+
+// LoadPeerProfiles loads the peer profiles from the 'avps' mappings of the peers file:
+//
+//	hss:
+//	  address: 192.168.11.99
+//	  avps:
+//	    Destination-Realm: epc.mnc001.mcc250.3gppnetwork.org
+func (d *Diameter) LoadPeerProfiles(file string) error {
+	yamlText, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	peers := make(map[string]struct {
+		Avps yaml.Node `yaml:"avps"`
+	})
+	if err := yaml.Unmarshal(yamlText, &peers); err != nil {
+		return err
+	}
+
+	profiles := make(map[string]avpLayer)
+	for name, peer := range peers {
+		if peer.Avps.Kind == 0 {
+			continue
+		}
+
+		store := NewAvpStore(d)
+		if err := store.makeFromNode(&peer.Avps, AvpStoreAppend, 0); err != nil {
+			return fmt.Errorf("peer %s: %w", name, err)
+		}
+		profiles[strings.ToLower(name)] = avpLayer{name: profilePeerPrefix + name, store: &store}
+	}
+
+	d.profiles.mu.Lock()
+	defer d.profiles.mu.Unlock()
+	d.profiles.peers = profiles
+
+	return nil
+}
+
+// Profiles returns the names of the loaded command and peer profiles.
+func (d *Diameter) Profiles() []string {
+	d.profiles.mu.RLock()
+	defer d.profiles.mu.RUnlock()
+
+	names := make([]string, 0, len(d.profiles.cmds)+len(d.profiles.peers))
+	for _, layer := range d.profiles.cmds {
+		names = append(names, layer.name)
+	}
+	for _, layer := range d.profiles.peers {
+		names = append(names, layer.name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Profile returns the effective values of the command AVPs for the peer (optional),
+// showing which layer each value is taken from. Value templates are not evaluated.
+func (d *Diameter) Profile(peer string, appId, cmdId any, request bool) ([]ProfileValue, error) {
+	app, err := d.dict.GetApp(appId)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := d.dict.GetCmd(cmdId, app)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := cmd.Answer
+	if request {
+		rules = cmd.Request
+	}
+
+	layers := d.layers(peer, app.Id, cmd.Code, request)
+	bindings := d.FeedBindings()
+
+	values := make([]ProfileValue, 0, len(rules))
+	for _, rule := range rules {
+		avpDesc, err := d.dict.GetAvp(rule.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		value := ProfileValue{Rule: rule}
+		if bind, exists := bindings[avpDesc.Code]; exists {
+			value.Source = fmt.Sprintf("feed %s:%s", bind.Feed, bind.Column)
+		}
+		for _, layer := range layers {
+			if avps := layer.store.Fetch(avpDesc.Code); avps != nil {
+				value.Avps = avps
+				if value.Source == "" {
+					value.Source = layer.name
+				}
+				break
+			}
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// layers returns the AVP layers of the command for the peer, the first layer has the highest priority.
+func (d *Diameter) layers(peer string, appId, cmdCode uint32, request bool) []avpLayer {
+	d.profiles.mu.RLock()
+	defer d.profiles.mu.RUnlock()
+
+	layers := make([]avpLayer, 0, 4)
+	if layer, exists := d.profiles.peers[strings.ToLower(peer)]; exists && peer != "" {
+		layers = append(layers, layer)
+	}
+
+	dir := profileAnswer
+	if request {
+		dir = profileRequest
+	}
+	if layer, exists := d.profiles.cmds[profileKey{appId: appId, cmdCode: cmdCode, dir: dir}]; exists {
+		layers = append(layers, layer)
+	}
+	if layer, exists := d.profiles.cmds[profileKey{appId: appId, cmdCode: cmdCode, dir: profileBoth}]; exists {
+		layers = append(layers, layer)
+	}
+
+	return append(layers, avpLayer{name: profileGlobal, store: &d.store})
+}
+
+// profileKey makes the command profile key from the profile file name.
+// The exact command short name is preferred to the name with the direction suffix.
+func (d *Diameter) profileKey(app *dict.App, name string) (profileKey, error) {
+	if cmd, err := d.dict.GetCmd(name, app); err == nil {
+		return profileKey{appId: app.Id, cmdCode: cmd.Code, dir: profileBoth}, nil
+	}
+
+	upper := strings.ToUpper(name)
+	for suffix, dir := range map[string]int{profileRequestShort: profileRequest, profileAnswerShort: profileAnswer} {
+		if short, ok := strings.CutSuffix(upper, suffix); ok && short != "" {
+			if cmd, err := d.dict.GetCmd(short, app); err == nil {
+				return profileKey{appId: app.Id, cmdCode: cmd.Code, dir: dir}, nil
+			}
+		}
+	}
+
+	return profileKey{}, fmt.Errorf("unknown command '%s' of application %s", name, app.Name)
+}
+
+// fetch returns the AVPs from the first build context layer that has them,
+// or from the global store if the context has no layers.
+func (bc *buildContext) fetch(d *Diameter, code uint32) []*Avp {
+	if len(bc.layers) == 0 {
+		return d.store.Fetch(code)
+	}
+
+	for _, layer := range bc.layers {
+		if avps := layer.store.Fetch(code); avps != nil {
+			return avps
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package diameter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAvpProfiles(t *testing.T) {
+	fmt.Println(">>> AVP profiles test")
+
+	env := newTestEnv(t)
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"S6a/UL.yaml":  "Origin-State-Id: 2\nUser-Name: \"250010000000002\"\n",
+		"S6a/ULR.yaml": "Origin-State-Id: 3\nMSISDN: \"7916{{avp:User-Name:from=8}}\"\n",
+		"S6a/ULA.yaml": "Result-Code: 2001\n",
+		"other/x.yaml": "Unknown-Avp: 1\n",
+		"peers.yaml":   "hss:\n  address: localhost\n  avps:\n    User-Name: \"250010000000004\"\ndra:\n  address: localhost\n",
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := env.Store().MakeFromYaml("Session-Id: mme.test.org\nUser-Name: \"250010000000001\"\nOrigin-State-Id: 1\nResult-Code: 5001\n", AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.LoadProfiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.LoadPeerProfiles(filepath.Join(dir, "peers.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(env.Profiles())
+	if len(env.Profiles()) != 4 {
+		t.Fatalf("Profiles: %v", env.Profiles())
+	}
+
+	tests := []struct {
+		peer    string
+		request bool
+		avp     string
+		value   any
+	}{
+		{"", true, "User-Name", "250010000000002"},
+		{"", true, "Origin-State-Id", uint32(3)},
+		{"dra", true, "User-Name", "250010000000002"},
+		{"HSS", true, "User-Name", "250010000000004"},
+		{"hss", true, "Origin-State-Id", uint32(3)},
+		{"", false, "Result-Code", uint32(2001)},
+	}
+	for _, test := range tests {
+		msg, err := env.NewPeerMessage(test.peer, "S6a", "UL", test.request, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, _ := msg.GetAvpValue(test.avp); value != test.value {
+			msg.Trace(0)
+			t.Fatalf("Peer '%s' %s: %v, expected %v", test.peer, test.avp, value, test.value)
+		}
+	}
+
+	// Template references are resolved from the profile layers
+	msg, err := env.NewPeerMessage("hss", "S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Trace(0)
+	if msisdn, _ := msg.GetAvp("MSISDN"); txtTBCD(msisdn) != "79160000004" {
+		t.Fatalf("MSISDN: %s", txtTBCD(msisdn))
+	}
+
+	values, err := env.Profile("hss", "S6a", "UL", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{"Session-Id": "global", "User-Name": "peer hss", "Origin-State-Id": "S6a/ULR", "Terminal-Information": ""}
+	for _, value := range values {
+		if source, exists := sources[value.Rule.Name]; exists && value.Source != source {
+			t.Fatalf("%s source: '%s', expected '%s'", value.Rule.Name, value.Source, source)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "S6a", "XYZ.yaml"), []byte("User-Name: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.LoadProfiles(dir); err == nil {
+		t.Fatal("Unknown command profile accepted")
+	}
+
+	fmt.Println("<<< AVP profiles test")
+}
@@ -11,10 +11,16 @@
 package diameter
 
 import (
+	"cmp"
+	"encoding/base64"
 	"iter"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
 
@@ -191,6 +197,7 @@ func (store *AvpStore) LoadFromFile(yamlFile string, action, index int) error {
 //	  - value2
 //	avp_name:                   # Grouped AVPs (nested mapping)
 //	  nested_avp: value
+//	avp_name: "id{{seq:1}}"     # Value template evaluated for each new message
 //
 // The action determines how AVPs are applied:
 //   - AvpAppend: Add to existing AVPs with same code
@@ -206,10 +213,19 @@ func (store *AvpStore) MakeFromYaml(yamlData string, action, index int) error {
 		return nil
 	}
 
+	return store.makeFromNode(node.Content[0], action, index)
+}
+
+// makeFromNode applies the YAML mapping node of AVPs to the store.
+func (store *AvpStore) makeFromNode(node *yaml.Node, action, index int) error {
+	if node.Kind != yaml.MappingNode {
+		return &diwe.ErrInvalidYamlValue{Line: node.Line, Value: node.Value}
+	}
+
 	// Iterate over each top-level key-value pair in the YAML
-	for i := 0; i < len(node.Content[0].Content); i += 2 {
-		nodeName := node.Content[0].Content[i]
-		nodeData := node.Content[0].Content[i+1]
+	for i := 0; i < len(node.Content); i += 2 {
+		nodeName := node.Content[i]
+		nodeData := node.Content[i+1]
 
 		// Convert YAML node to AVP(s)
 		avps, err := store.yamlNodeToAvps(nodeName, nodeData)
@@ -247,6 +263,10 @@ func (store *AvpStore) yamlNodeToAvps(nodeName, nodeData *yaml.Node) ([]*Avp, er
 	if avpData == nil {
 		return nil, &diwe.ErrInvalidYamlValue{Line: nodeData.Line, Value: nodeData.Content}
 	}
+	// The hex scalars are kept as text: octets for OctetString, the number for integer types
+	if nodeData.Kind == yaml.ScalarNode && nodeData.Tag == "!!int" && strings.HasPrefix(strings.ToLower(nodeData.Value), "0x") {
+		avpData = nodeData.Value
+	}
 
 	result := make([]*Avp, 0)
 	switch nodeData.Kind {
@@ -278,9 +298,18 @@ func (store *AvpStore) yamlNodeToAvps(nodeName, nodeData *yaml.Node) ([]*Avp, er
 		if avp, err := store.env.GetAvp(avpName); err != nil {
 			return nil, err
 		} else {
-			// Convert YAML number types to appropriate Go types based on AVP data type
-			convNumber(&avpData, avp)
-			// Set the value (this performs encoding)
+			// Value templates are checked by the dry evaluation,
+			// the result is shown until the template is evaluated for a message
+			if text, ok := avpData.(string); ok && IsTemplate(text) {
+				if avp.tmpl, err = parseTemplate(text, avp.Name()); err != nil {
+					return nil, err
+				}
+				if text, err = store.env.evalTemplate(avp, store.dryContext()); err != nil {
+					return nil, err
+				}
+				avpData = text
+			}
+			// Set the value (this performs conversion and encoding)
 			if err = avp.SetValue(avpData); err != nil {
 				return nil, err
 			}
@@ -293,6 +322,71 @@ func (store *AvpStore) yamlNodeToAvps(nodeName, nodeData *yaml.Node) ([]*Avp, er
 	return result, nil
 }
 
+// SaveToFile writes the store to a YAML file in the format read by LoadFromFile.
+func (store *AvpStore) SaveToFile(yamlFile string) error {
+	yamlText, err := store.ToYaml()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(yamlFile, []byte(yamlText), 0644)
+}
+
+// ToYaml serializes the store to YAML in the format read by MakeFromYaml.
+// The AVPs are sorted by name, multiple values are written as sequences and grouped AVPs as mappings.
+// Value templates are written as their source, enumerations by name, derived formats (TBCD, PLMN, etc.)
+// as their text, OctetStrings as text if they are valid UTF-8 (binary otherwise).
+func (store *AvpStore) ToYaml() (string, error) {
+	store.mu.RLock()
+	codes := make([]uint32, 0, len(store.data))
+	for code, avps := range store.data {
+		if len(avps) > 0 {
+			codes = append(codes, code)
+		}
+	}
+	store.mu.RUnlock()
+
+	avps := make([][]*Avp, 0, len(codes))
+	for _, code := range codes {
+		avps = append(avps, store.Fetch(code))
+	}
+	slices.SortFunc(avps, func(a, b []*Avp) int {
+		return cmp.Compare(a[0].Name(), b[0].Name())
+	})
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, values := range avps {
+		if err := appendYamlAvps(node, values); err != nil {
+			return "", err
+		}
+	}
+	if len(node.Content) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// dryContext creates the dry build context for checking the templates loaded to the store.
+// The references are resolved from the store itself and then from the global store.
+func (store *AvpStore) dryContext() *buildContext {
+	bc := newBuildContext(true)
+	if store != &store.env.store {
+		bc.layers = []avpLayer{{store: store}, {name: profileGlobal, store: &store.env.store}}
+	}
+	return bc
+}
+
 // Iterators
 //
 
@@ -361,27 +455,91 @@ func (store *AvpStore) Dump(shift ...int) {
 // Helpers
 //
 
-// convNumber converts YAML number types to the appropriate Go type
-// based on the AVP's data type definition from the dictionary.
-// YAML decodes all numbers as float64 or int, but Diameter AVP types
-// require specific integer sizes (int32, int64, uint32, uint64) or floats.
-func convNumber(n *any, avp *Avp) {
-	switch (*n).(type) {
-	case int:
-		switch avp.Type() {
-		case avp.Dict().AvpDataType().Integer32:
-			*n = int32((*n).(int))
-		case avp.Dict().AvpDataType().Integer64:
-			*n = int64((*n).(int))
-		case avp.Dict().AvpDataType().Unsigned32:
-			*n = uint32((*n).(int))
-		case avp.Dict().AvpDataType().Unsigned64:
-			*n = uint64((*n).(int))
+// appendYamlAvps appends the AVPs of the same name to the YAML mapping node,
+// multiple values are appended as a sequence.
+func appendYamlAvps(mapping *yaml.Node, avps []*Avp) error {
+	values := make([]*yaml.Node, 0, len(avps))
+	for _, avp := range avps {
+		value, err := avpYamlNode(avp)
+		if err != nil {
+			return err
 		}
-	case float64:
-		switch avp.Type() {
-		case avp.Dict().AvpDataType().Float32:
-			*n = float32((*n).(float64))
+		values = append(values, value)
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: avps[0].Name()}
+	if len(values) == 1 {
+		mapping.Content = append(mapping.Content, key, values[0])
+	} else {
+		mapping.Content = append(mapping.Content, key, &yaml.Node{Kind: yaml.SequenceNode, Content: values})
+	}
+
+	return nil
+}
+
+// avpYamlNode converts the AVP value to the YAML node.
+func avpYamlNode(avp *Avp) (*yaml.Node, error) {
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	}
+
+	if avp.tmpl != nil {
+		return scalar("!!str", avp.tmpl.source), nil
+	}
+
+	if avp.IsGrouped() {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		members, _ := avp.Value().([]*Avp)
+		// Members of the same name are written as a sequence in the order of their first appearance
+		names := make([]string, 0, len(members))
+		byName := make(map[string][]*Avp, len(members))
+		for _, member := range members {
+			if _, exists := byName[member.Name()]; !exists {
+				names = append(names, member.Name())
+			}
+			byName[member.Name()] = append(byName[member.Name()], member)
+		}
+		for _, name := range names {
+			if err := appendYamlAvps(node, byName[name]); err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	}
+
+	codec, exists := avp.Codec()
+	if !exists {
+		return nil, &diwe.ErrUnknownAvpType{Avp: avp.Name(), Type: avp.Type()}
+	}
+	if avp.Format() != "" {
+		return scalar("!!str", codec.ToText(avp)), nil
+	}
+
+	types := avp.Dict().AvpDataType()
+	switch avp.Type() {
+	case types.Integer32, types.Integer64, types.Unsigned32, types.Unsigned64:
+		return scalar("!!int", codec.ToText(avp)), nil
+	case types.Float32, types.Float64:
+		return scalar("!!float", codec.ToText(avp)), nil
+	case types.Enumerated:
+		code, _ := avp.Value().(int32)
+		if name, err := avp.Dict().GetEnumName(avp.Code(), code); err == nil {
+			return scalar("!!str", name), nil
+		}
+		return scalar("!!int", strconv.FormatInt(int64(code), 10)), nil
+	case types.Time:
+		if v, ok := avp.Value().(time.Time); ok {
+			return scalar("!!str", v.UTC().Format(time.RFC3339)), nil
+		}
+	case types.OctetString:
+		if v, ok := avp.Value().([]byte); ok {
+			// The non UTF-8 octets are written as the binary value (base64)
+			if !utf8.Valid(v) {
+				return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!binary", Value: base64.StdEncoding.EncodeToString(v)}, nil
+			}
+			return scalar("!!str", string(v)), nil
 		}
 	}
+
+	return scalar("!!str", codec.ToText(avp)), nil
 }
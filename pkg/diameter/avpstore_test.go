@@ -0,0 +1,76 @@
+package diameter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAvpStoreSave(t *testing.T) {
+	fmt.Println(">>> AVP store save test")
+
+	env := newTestEnv(t)
+	if err := env.Store().MakeFromYaml(`
+Session-Id: "mme.test.org"
+User-Name: "250010000000001"
+MSISDN: "79160000001"
+Origin-State-Id: "{{seq:1000}}"
+Result-Code:
+  - 2001
+  - 5001
+Cancellation-Type: SUBSCRIPTION_WITHDRAWAL
+Event-Timestamp: "2024-05-01T10:20:30Z"
+Terminal-Information:
+  IMEI: "35123456789012"
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+	class, _ := env.GetAvp("Class")
+	if err := class.SetValue("\x00\xff\x10"); err != nil {
+		t.Fatal(err)
+	}
+	env.Store().Append(class.Code(), []*Avp{class})
+
+	yamlText, err := env.Store().ToYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Print(yamlText)
+
+	for _, line := range []string{
+		"Cancellation-Type: SUBSCRIPTION_WITHDRAWAL",
+		"MSISDN: \"79160000001\"",
+		"Origin-State-Id: '{{seq:1000}}'",
+		"Event-Timestamp: \"2024-05-01T10:20:30Z\"",
+		"User-Name: \"250010000000001\"",
+		"  - 5001",
+		"  IMEI: \"35123456789012\"",
+	} {
+		if !strings.Contains(yamlText, line) {
+			t.Fatalf("'%s' is not saved", line)
+		}
+	}
+
+	// The saved store is loaded back unchanged
+	file := filepath.Join(t.TempDir(), "avps.yaml")
+	if err := env.Store().SaveToFile(file); err != nil {
+		t.Fatal(err)
+	}
+	store := NewAvpStore(env)
+	if err := store.LoadFromFile(file, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := store.ToYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded != yamlText {
+		t.Fatalf("Reloaded store:\n%s", reloaded)
+	}
+	if value := store.Fetch(class.Code())[0].Value().([]byte); string(value) != "\x00\xff\x10" {
+		t.Fatalf("Class: %x", value)
+	}
+
+	fmt.Println("<<< AVP store save test")
+}
@@ -0,0 +1,502 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avptemplate.go
+// Description: Diameter pkg: AVP value templates and generators
+//
+
+package diameter
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	mrand "math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+const (
+	tmplOpen  = "{{"
+	tmplClose = "}}"
+
+	// tmplMaxWidth is the maximum width of the zero padded sequence
+	tmplMaxWidth = 64
+)
+
+// Template generators
+const (
+	tmplSeq    = "seq"    // {{seq[:start][:step=N][:width=N][:name=ID]}}
+	tmplRandom = "random" // {{random:digits:N}}, {{random:hex:N}}, {{random:MIN:MAX}}
+	tmplIMSI   = "imsi"   // {{imsi[:prefix=MCCMNC][:len=N]}}
+	tmplNow    = "now"    // {{now[:unix | :ms]}}
+	tmplUUID   = "uuid"   // {{uuid}}
+	tmplEnv    = "env"    // {{env:VAR[:default=VALUE]}}, VALUE may have colons
+	tmplAvp    = "avp"    // {{avp:NAME[:from=N][:to=N]}}
+)
+
+// Types
+//
+
+// avpTemplate is a parsed AVP value template: literal text mixed with
+// generator expressions in double braces, e.g. "user{{seq:1}}@{{env:REALM}}".
+type avpTemplate struct {
+	source string
+	parts  []tmplPart
+}
+
+// tmplPart is a literal text (gen is empty) or a generator expression.
+type tmplPart struct {
+	text string            // literal text or expression source
+	gen  string            // generator name
+	args []string          // positional arguments
+	opts map[string]string // key=value options
+	key  string            // generator state key (sequences)
+}
+
+// generators keeps the generator state of the Diameter environment.
+type generators struct {
+	mu   sync.Mutex
+	seqs map[string]uint64
+}
+
+// buildContext holds the values of templated AVPs evaluated while building one message,
+// so an AVP referenced by other AVPs is evaluated only once, the data feed rows taken for the message
+// and the AVP layers (profiles) of the message. The dry context evaluates templates
+// without advancing the sequences and feeds.
+type buildContext struct {
+	values  map[*Avp]string
+	busy    map[*Avp]bool
+	rows    map[*AvpFeed][]string
+	layers  []avpLayer
+	session *Session
+	worker  int
+	dry     bool
+}
+
+// Functions
+//
+
+// IsTemplate returns true if the text contains template expressions.
+func IsTemplate(text string) bool {
+	return strings.Contains(text, tmplOpen)
+}
+
+// parseTemplate parses an AVP value template.
+// The avpName is used to make the state keys of unnamed sequences.
+func parseTemplate(source, avpName string) (*avpTemplate, error) {
+	tmpl := &avpTemplate{source: source}
+
+	rest := source
+	for len(rest) > 0 {
+		start := strings.Index(rest, tmplOpen)
+		if start < 0 {
+			tmpl.parts = append(tmpl.parts, tmplPart{text: rest})
+			break
+		}
+		if start > 0 {
+			tmpl.parts = append(tmpl.parts, tmplPart{text: rest[:start]})
+		}
+
+		end := strings.Index(rest[start:], tmplClose)
+		if end < 0 {
+			return nil, &diwe.ErrInvalidTemplate{Template: source, Reason: "missing '" + tmplClose + "'"}
+		}
+
+		part, err := parseTmplExpr(strings.TrimSpace(rest[start+len(tmplOpen):start+end]), avpName)
+		if err != nil {
+			return nil, &diwe.ErrInvalidTemplate{Template: source, Reason: err.Error()}
+		}
+		tmpl.parts = append(tmpl.parts, part)
+
+		rest = rest[start+end+len(tmplClose):]
+	}
+
+	return tmpl, nil
+}
+
+// parseTmplExpr parses a generator expression "name[:arg...][:key=value...]".
+// The default option is the last one, its value is the rest of the expression with the colons
+// (URI, host:port or IPv6 address).
+func parseTmplExpr(expr, avpName string) (tmplPart, error) {
+	fields := strings.Split(expr, ":")
+	part := tmplPart{text: expr, gen: strings.ToLower(fields[0]), opts: map[string]string{}}
+	for i, field := range fields[1:] {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			key = strings.ToLower(key)
+			if key == "default" {
+				part.opts[key] = strings.Join(append([]string{value}, fields[i+2:]...), ":")
+				break
+			}
+			part.opts[key] = value
+		} else {
+			part.args = append(part.args, field)
+		}
+	}
+
+	switch part.gen {
+	case tmplSeq:
+		if name, ok := part.opts["name"]; ok {
+			part.key = name
+		} else {
+			part.key = avpName + "/" + expr
+		}
+		if len(part.args) > 0 {
+			if _, err := strconv.ParseUint(part.args[0], 10, 64); err != nil {
+				return part, fmt.Errorf("invalid sequence start '%s'", part.args[0])
+			}
+		}
+		if w, ok := part.opts["width"]; ok {
+			if n, err := strconv.Atoi(w); err != nil || n < 0 || n > tmplMaxWidth {
+				return part, fmt.Errorf("invalid width '%s'", w)
+			}
+		}
+	case tmplRandom:
+		if len(part.args) != 2 {
+			return part, fmt.Errorf("expected '%s:digits:N', '%s:hex:N' or '%s:MIN:MAX'", tmplRandom, tmplRandom, tmplRandom)
+		}
+	case tmplIMSI:
+		prefix := part.opts["prefix"]
+		if !isDigits(prefix) && prefix != "" {
+			return part, fmt.Errorf("invalid IMSI prefix '%s'", prefix)
+		}
+	case tmplNow, tmplUUID:
+	case tmplEnv, tmplAvp:
+		if len(part.args) != 1 {
+			return part, fmt.Errorf("expected '%s:NAME'", part.gen)
+		}
+	default:
+		return part, fmt.Errorf("unknown generator '%s'", part.gen)
+	}
+
+	return part, nil
+}
+
+// Methods
+//
+
+// Template returns the value template source of the store AVP,
+// or an empty string if the AVP has a literal value.
+func (avp *Avp) Template() string {
+	if avp.tmpl == nil {
+		return ""
+	}
+	return avp.tmpl.source
+}
+
+// hasTemplate returns true if the AVP or any of its group members has a value template.
+func (avp *Avp) hasTemplate() bool {
+	if avp.tmpl != nil {
+		return true
+	}
+
+	if members, ok := avp.Value().([]*Avp); ok {
+		for _, member := range members {
+			if member.hasTemplate() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// instantiate copies the store AVP evaluating the value templates of the AVP and its group members.
+// The AVPs bound to data feeds take the values from the feed rows.
+func (d *Diameter) instantiate(avp *Avp, bc *buildContext) (*Avp, error) {
+	if !avp.hasTemplate() && !d.isFeedBound(avp) {
+		return avp.Copy()
+	}
+
+	copied, err := avp.Copy()
+	if err != nil {
+		return nil, err
+	}
+	copied.tmpl = nil
+
+	text, bound, err := d.feedText(avp.Code(), bc)
+	if err != nil {
+		return nil, err
+	}
+	if bound {
+		if err := copied.SetValue(text); err != nil {
+			return nil, err
+		}
+		return copied, nil
+	}
+
+	if avp.tmpl != nil {
+		text, err := d.evalTemplate(avp, bc)
+		if err != nil {
+			return nil, err
+		}
+		if err := copied.SetValue(text); err != nil {
+			return nil, err
+		}
+		return copied, nil
+	}
+
+	// Grouped AVP with templated or bound members
+	members, ok := avp.Value().([]*Avp)
+	if !ok {
+		return copied, nil
+	}
+	instances := make([]*Avp, 0, len(members))
+	for _, member := range members {
+		instance, err := d.instantiate(member, bc)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	copied.value = &AvpData{Value: instances, Size: 0}
+
+	return copied, nil
+}
+
+// evalTemplate evaluates the value template of the store AVP.
+func (d *Diameter) evalTemplate(avp *Avp, bc *buildContext) (string, error) {
+	if text, exists := bc.values[avp]; exists {
+		return text, nil
+	}
+	if bc.busy[avp] {
+		return "", &diwe.ErrInvalidTemplate{Template: avp.tmpl.source, Reason: "circular AVP reference"}
+	}
+	bc.busy[avp] = true
+	defer delete(bc.busy, avp)
+
+	var b strings.Builder
+	for _, part := range avp.tmpl.parts {
+		if part.gen == "" {
+			b.WriteString(part.text)
+			continue
+		}
+
+		text, err := d.evalTmplPart(&part, bc)
+		if err != nil {
+			return "", &diwe.ErrInvalidTemplate{Template: avp.tmpl.source, Reason: err.Error()}
+		}
+		b.WriteString(text)
+	}
+
+	bc.values[avp] = b.String()
+
+	return b.String(), nil
+}
+
+// evalTmplPart evaluates a generator expression.
+func (d *Diameter) evalTmplPart(part *tmplPart, bc *buildContext) (string, error) {
+	switch part.gen {
+	case tmplSeq:
+		start, step := uint64(1), uint64(1)
+		if len(part.args) > 0 {
+			start, _ = strconv.ParseUint(part.args[0], 10, 64)
+		}
+		if s, ok := part.opts["step"]; ok {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("invalid sequence step '%s'", s)
+			}
+			step = n
+		}
+		value := d.gens.next(part.key, start, step, bc.dry)
+		if w, ok := part.opts["width"]; ok {
+			width, _ := strconv.Atoi(w) // checked by parseTmplExpr
+			return fmt.Sprintf("%0*d", width, value), nil
+		}
+		return strconv.FormatUint(value, 10), nil
+
+	case tmplRandom:
+		switch strings.ToLower(part.args[0]) {
+		case "digits":
+			n, err := strconv.Atoi(part.args[1])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid digits number '%s'", part.args[1])
+			}
+			return randomDigits(n), nil
+		case "hex":
+			n, err := strconv.Atoi(part.args[1])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid bytes number '%s'", part.args[1])
+			}
+			b := make([]byte, n)
+			_, _ = rand.Read(b)
+			return fmt.Sprintf("%x", b), nil
+		default:
+			lo, err1 := strconv.ParseInt(part.args[0], 10, 64)
+			hi, err2 := strconv.ParseInt(part.args[1], 10, 64)
+			if err1 != nil || err2 != nil || lo > hi {
+				return "", fmt.Errorf("invalid range '%s:%s'", part.args[0], part.args[1])
+			}
+			// the span of the full int64 range does not fit int64
+			span := uint64(hi) - uint64(lo)
+			offset := mrand.Uint64()
+			if span < math.MaxUint64 {
+				offset = mrand.Uint64N(span + 1)
+			}
+			return strconv.FormatInt(lo+int64(offset), 10), nil
+		}
+
+	case tmplIMSI:
+		length := 15
+		if l, ok := part.opts["len"]; ok {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 6 || n > 15 {
+				return "", fmt.Errorf("invalid IMSI length '%s'", l)
+			}
+			length = n
+		}
+		prefix := part.opts["prefix"]
+		if len(prefix) > length {
+			return "", fmt.Errorf("IMSI prefix '%s' is longer than %d digits", prefix, length)
+		}
+		return prefix + randomDigits(length-len(prefix)), nil
+
+	case tmplNow:
+		now := time.Now()
+		if len(part.args) == 0 {
+			return now.UTC().Format(time.RFC3339), nil
+		}
+		switch strings.ToLower(part.args[0]) {
+		case "unix":
+			return strconv.FormatInt(now.Unix(), 10), nil
+		case "ms":
+			return strconv.FormatInt(now.UnixMilli(), 10), nil
+		}
+		return "", fmt.Errorf("unknown time format '%s'", part.args[0])
+
+	case tmplUUID:
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		b[6] = b[6]&0x0f | 0x40 // version 4
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+
+	case tmplEnv:
+		if value, ok := os.LookupEnv(part.args[0]); ok {
+			return value, nil
+		}
+		if value, ok := part.opts["default"]; ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("environment variable '%s' is not set", part.args[0])
+
+	case tmplAvp:
+		text, err := d.avpRefText(part.args[0], bc)
+		if err != nil {
+			return "", err
+		}
+		from, to := 0, len(text)
+		if f, ok := part.opts["from"]; ok {
+			from, _ = strconv.Atoi(f)
+		}
+		if t, ok := part.opts["to"]; ok {
+			to, _ = strconv.Atoi(t)
+		}
+		from, to = max(0, min(from, len(text))), max(0, min(to, len(text)))
+		if from > to {
+			return "", nil
+		}
+		return text[from:to], nil
+	}
+
+	return "", fmt.Errorf("unknown generator '%s'", part.gen)
+}
+
+// avpRefText returns the value text of the first AVP with the given name from the context layers.
+// Templated AVPs are evaluated and bound AVPs are taken from the data feed within the build context.
+func (d *Diameter) avpRefText(name string, bc *buildContext) (string, error) {
+	hdr, err := d.dict.GetAvp(name)
+	if err != nil {
+		return "", err
+	}
+
+	if text, bound, err := d.feedText(hdr.Code, bc); err != nil || bound {
+		return text, err
+	}
+
+	avps := bc.fetch(d, hdr.Code)
+	if len(avps) == 0 {
+		return "", &diwe.ErrNoValueForReqAvp{Avp: name}
+	}
+
+	avp := avps[0]
+	if avp.tmpl != nil {
+		return d.evalTemplate(avp, bc)
+	}
+
+	switch v := avp.Value().(type) {
+	case string:
+		return v, nil
+	case []byte:
+		if avp.Format() == "" {
+			return string(v), nil
+		}
+	case int32, int64, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	}
+
+	if codec, exists := avp.Codec(); exists {
+		return codec.ToText(avp), nil
+	}
+	return "", &diwe.ErrInvalidAvpValue{Avp: name, Value: avp.Value()}
+}
+
+// next returns the current sequence value and advances the sequence.
+// The dry call returns the current value only.
+func (g *generators) next(key string, start, step uint64, dry bool) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seqs == nil {
+		g.seqs = make(map[string]uint64)
+	}
+
+	value, exists := g.seqs[key]
+	if !exists {
+		value = start
+	}
+	if dry {
+		if !exists {
+			g.seqs[key] = value
+		}
+		return value
+	}
+
+	g.seqs[key] = value + step
+	return value
+}
+
+// newBuildContext creates a build context for one message,
+// or a dry context for checking the templates loaded to the store.
+func newBuildContext(dry bool) *buildContext {
+	return &buildContext{
+		values: make(map[*Avp]string),
+		busy:   make(map[*Avp]bool),
+		rows:   make(map[*AvpFeed][]string),
+		dry:    dry,
+	}
+}
+
+// Helpers
+//
+
+// randomDigits returns a string of n random decimal digits.
+func randomDigits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + mrand.IntN(10))
+	}
+	return string(b)
+}
@@ -0,0 +1,86 @@
+package diameter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAvpTemplates(t *testing.T) {
+	fmt.Println(">>> AVP templates test")
+
+	env := newTestEnv(t)
+	t.Setenv("TGDP_TEST_REALM", "test.org")
+
+	err := env.Store().MakeFromYaml(`
+Session-Id: "mme.{{env:TGDP_TEST_REALM}}"
+User-Name: "{{imsi:prefix=25001}}"
+MSISDN: "7916{{avp:User-Name:from=8}}"
+Origin-State-Id: "{{seq:1000}}"
+Terminal-Information:
+  IMEI: "{{random:digits:14}}"
+`, AvpStoreAppend, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Store().Dump(2)
+
+	for i := range 2 {
+		msg, err := env.NewMessage("S6a", "UL", true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imsi, _ := msg.GetAvpValue("User-Name")
+		if s := imsi.(string); len(s) != 15 || !strings.HasPrefix(s, "25001") {
+			t.Fatalf("User-Name: %v", imsi)
+		}
+		msisdn, _ := msg.GetAvp("MSISDN")
+		if text := txtTBCD(msisdn); text != "7916"+imsi.(string)[8:] {
+			t.Fatalf("MSISDN %s does not match User-Name %s", text, imsi)
+		}
+		if seq, _ := msg.GetAvpValue("Origin-State-Id"); seq != uint32(1000+i) {
+			t.Fatalf("Origin-State-Id: %v", seq)
+		}
+		sessionId, _ := msg.GetAvpValue("Session-Id")
+		if !strings.HasPrefix(sessionId.(string), "mme.test.org;") {
+			t.Fatalf("Session-Id: %v", sessionId)
+		}
+		terminal, _ := msg.GetAvp("Terminal-Information")
+		if imei := terminal.Value().([]*Avp)[0].Value().(string); len(imei) != 14 {
+			t.Fatalf("IMEI: %v", imei)
+		}
+		msg.Trace(0)
+	}
+
+	for _, edge := range []string{"{{random:0:9223372036854775807}}", "{{random:-9223372036854775808:0}}",
+		"{{random:-9223372036854775808:9223372036854775807}}", "{{seq:width=20}}"} {
+		if err := env.Store().MakeFromYaml("User-Name: \""+edge+"\"", AvpStoreAppend, 0); err != nil {
+			t.Fatalf("Template %s: %v", edge, err)
+		}
+	}
+
+	for _, invalid := range []string{"{{unknown}}", "{{seq:x}}", "{{random:digits}}", "{{imsi:prefix=abc}}", "{{now",
+		"{{seq:width=abc}}", "{{seq:width=-1}}", "{{seq:width=1000000000}}"} {
+		if err := env.Store().MakeFromYaml("User-Name: \""+invalid+"\"", AvpStoreAppend, 0); err == nil {
+			t.Fatalf("Template %s accepted", invalid)
+		}
+	}
+
+	// The default value keeps its colons
+	for _, value := range []string{"aaa://hss.test.org:3868;transport=tcp", "[2001:db8::1]:3868"} {
+		env := newTestEnv(t)
+		if err := env.Store().MakeFromYaml("User-Name: \"{{env:TGDP_TEST_UNSET:default="+value+"}}\"", AvpStoreAppend, 0); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := env.NewMessage("S6a", "UL", true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name, _ := msg.GetAvpValue("User-Name"); name != value {
+			t.Fatalf("Default value: %v, expected %s", name, value)
+		}
+	}
+
+	fmt.Println("<<< AVP templates test")
+}
@@ -0,0 +1,124 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avptypes.go
+// Description: Diameter pkg: Address families and NTP time of the Address and Time AVPs
+//
+
+package diameter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consts
+//
+
+const (
+	// ntpUnixOffset is the number of seconds from the NTP epoch (1900-01-01) to the Unix epoch (1970-01-01)
+	ntpUnixOffset = 2208988800
+	// ntpEraSeconds is the length of the NTP era, the 32-bit seconds counter rolls over in 2036
+	ntpEraSeconds = 1 << 32
+	// ntpEraPivot separates the eras (RFC 2030): the values with the most significant bit
+	// cleared belong to the era 1 (2036-02-07T06:28:16Z - 2104-02-26T09:42:23Z)
+	ntpEraPivot = 1 << 31
+
+	// Unix seconds range representable by the Time AVP
+	ntpMinUnix = ntpEraPivot - ntpUnixOffset
+	ntpMaxUnix = ntpEraSeconds + ntpEraPivot - 1 - ntpUnixOffset
+
+	addressE164Prefix = "e164:"
+)
+
+// Types
+//
+
+// AvpAddress is the Address AVP value of the address family other than IPv4 and IPv6
+// (E.164 and others, see IANA "Address Family Numbers"). IP addresses are kept as netip.Addr.
+type AvpAddress struct {
+	Family uint16
+	Data   []byte
+}
+
+// Functions
+//
+
+// ParseAddress parses the text of the Address AVP value:
+// IPv4 or IPv6 address, "e164:<digits>" for E.164 or "<family>:0x<hex>" for other families.
+// Returns netip.Addr for IP addresses and AvpAddress for other families.
+func ParseAddress(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	if ip, err := netip.ParseAddr(text); err == nil {
+		return ip, nil
+	}
+
+	if digits, ok := cutPrefixFold(text, addressE164Prefix); ok {
+		if digits = strings.TrimPrefix(digits, "+"); isDigits(digits) {
+			return AvpAddress{Family: addrE164, Data: []byte(digits)}, nil
+		}
+	} else if family, data, found := strings.Cut(text, ":"); found && len(data) > 2 && strings.EqualFold(data[:2], "0x") {
+		n, errFamily := strconv.ParseUint(family, 10, 16)
+		raw, errData := hex.DecodeString(data[2:])
+		if errFamily == nil && errData == nil {
+			return newAvpAddress(uint16(n), raw), nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid address '%s'", text)
+}
+
+// NtpTime converts the NTP seconds of the Time AVP to time, taking the NTP era rollover into account.
+func NtpTime(seconds uint32) time.Time {
+	unix := int64(seconds) - ntpUnixOffset
+	if seconds < ntpEraPivot {
+		unix += ntpEraSeconds
+	}
+
+	return time.Unix(unix, 0).UTC()
+}
+
+// TimeNtp converts the time to the NTP seconds of the Time AVP.
+// Returns false if the time is out of the range of the NTP eras 0 and 1 (1968 - 2104).
+func TimeNtp(t time.Time) (uint32, bool) {
+	unix := t.Unix()
+	if unix < ntpMinUnix || unix > ntpMaxUnix {
+		return 0, false
+	}
+
+	return uint32((unix + ntpUnixOffset) % ntpEraSeconds), true
+}
+
+// Methods
+//
+
+// String returns the text of the address: "e164:<digits>" for E.164, "<family>:0x<hex>" for other families.
+func (a AvpAddress) String() string {
+	if a.Family == addrE164 && isDigits(string(a.Data)) {
+		return addressE164Prefix + string(a.Data)
+	}
+
+	return fmt.Sprintf("%d:0x%x", a.Family, a.Data)
+}
+
+// Helpers
+//
+
+// newAvpAddress returns the address value of the family:
+// netip.Addr for the valid IPv4 and IPv6 addresses, AvpAddress otherwise.
+func newAvpAddress(family uint16, data []byte) any {
+	switch {
+	case family == addrIPv4 && len(data) == 4, family == addrIPv6 && len(data) == 16:
+		ip, _ := netip.AddrFromSlice(data)
+		return ip
+	}
+
+	return AvpAddress{Family: family, Data: data}
+}
@@ -0,0 +1,122 @@
+package diameter
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAvpTime(t *testing.T) {
+	fmt.Println(">>> AVP Time test")
+
+	env := newTestEnv(t)
+
+	tests := []struct {
+		value any
+		ntp   uint32
+		text  string
+	}{
+		{"2024-05-01T10:20:30Z", 3923547630, "2024-05-01T10:20:30Z"},
+		{"unix:1714558830", 3923547630, "2024-05-01T10:20:30Z"},
+		{int64(1714558830), 3923547630, "2024-05-01T10:20:30Z"},
+		{"ntp:3923547630", 3923547630, "2024-05-01T10:20:30Z"},
+		{"2024-05-01T10:20:30Z (unix 1714558830, ntp 3923547630)", 3923547630, "2024-05-01T10:20:30Z"},
+		// The NTP era rollover
+		{"2036-02-07T06:28:15Z", 4294967295, "2036-02-07T06:28:15Z"},
+		{"2036-02-07T06:28:16Z", 0, "2036-02-07T06:28:16Z"},
+		{"2040-01-01T00:00:00Z", 123010304, "2040-01-01T00:00:00Z"},
+		{"ntp:2147483648", 2147483648, "1968-01-20T03:14:08Z"},
+		{"ntp:2147483647", 2147483647, "2104-02-26T09:42:23Z"},
+	}
+	for _, test := range tests {
+		avp, _ := env.GetAvp("Event-Timestamp")
+		if err := avp.SetValue(test.value); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Println(txtTime(avp))
+
+		buf := new(bytes.Buffer)
+		if err := avp.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		decoded, _ := env.GetAvp("Event-Timestamp")
+		if _, err := decoded.Deserialize(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		value := decoded.Value().(time.Time)
+		if ntp, _ := TimeNtp(value); ntp != test.ntp {
+			t.Fatalf("%v: NTP seconds %d", test.value, ntp)
+		}
+		if text := value.Format(time.RFC3339); text != test.text {
+			t.Fatalf("%v: decoded %s", test.value, text)
+		}
+	}
+
+	avp, _ := env.GetAvp("Event-Timestamp")
+	for _, value := range []any{"1968-01-20T03:14:07Z", "2104-02-26T09:42:24Z", "ntp:4294967296", "today"} {
+		if err := avp.SetValue(value); err == nil {
+			t.Fatalf("Invalid time '%v' accepted", value)
+		} else {
+			fmt.Println(err)
+		}
+	}
+
+	fmt.Println("<<< AVP Time test")
+}
+
+func TestAvpAddress(t *testing.T) {
+	fmt.Println(">>> AVP Address test")
+
+	env := newTestEnv(t)
+
+	tests := []struct {
+		value string
+		wire  []byte
+		text  string
+	}{
+		{"10.0.0.1", []byte{0, 1, 10, 0, 0, 1}, "10.0.0.1"},
+		{"2001:db8::1", append([]byte{0, 2, 0x20, 0x01, 0x0d, 0xb8}, append(make([]byte, 11), 1)...), "2001:db8::1"},
+		{"e164:+79160000001", append([]byte{0, 8}, "79160000001"...), "e164:79160000001"},
+		{"E164:79160000001", append([]byte{0, 8}, "79160000001"...), "e164:79160000001"},
+		{"6:0x0a0b0c", []byte{0, 6, 0x0a, 0x0b, 0x0c}, "6:0x0a0b0c"},
+		{"1:0x0a000001", []byte{0, 1, 10, 0, 0, 1}, "10.0.0.1"},
+		// The invalid IPv4 length is kept raw
+		{"1:0x0a00", []byte{0, 1, 10, 0}, "1:0x0a00"},
+	}
+	for _, test := range tests {
+		avp, _ := env.GetAvp("Host-IP-Address")
+		if err := avp.SetValue(test.value); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := avp.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		if wire := buf.Bytes()[8 : 8+len(test.wire)]; !bytes.Equal(wire, test.wire) {
+			t.Fatalf("%s: encoded %x", test.value, wire)
+		}
+
+		decoded, _ := env.GetAvp("Host-IP-Address")
+		if _, err := decoded.Deserialize(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Println(txtIpAddress(decoded))
+		if text := txtIpAddress(decoded); text != test.text {
+			t.Fatalf("%s: decoded %s", test.value, text)
+		}
+		if decoded.Len() != avp.Len() {
+			t.Fatalf("%s: length %d, expected %d", test.value, decoded.Len(), avp.Len())
+		}
+	}
+
+	avp, _ := env.GetAvp("Host-IP-Address")
+	for _, value := range []string{"10.0.0", "e164:79A", "70000:0x01", "6:0xZZ"} {
+		if err := avp.SetValue(value); err == nil {
+			t.Fatalf("Invalid address '%s' accepted", value)
+		}
+	}
+
+	fmt.Println("<<< AVP Address test")
+}
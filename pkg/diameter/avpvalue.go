@@ -0,0 +1,402 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: avpvalue.go
+// Description: Diameter pkg: conversion of AVP values from Go, YAML, Lua and text representations
+//
+
+package diameter
+
+import (
+	"encoding/hex"
+	"math"
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Methods
+//
+
+// ConvertValue converts the value to the Go type of the AVP data type, the value accepted by the AVP codec.
+// The accepted representations are:
+//   - integer types: any Go integer or integral float (YAML, Lua numbers), decimal or "0x" hex string;
+//     the value is checked against the type range
+//   - Float32, Float64: any Go number or numeric string
+//   - OctetString: string, []byte, integer (as decimal text), "0x" prefixed hex string
+//   - UTF8String, DiameterIdentity, DiameterURI, IPFilterRule, QoSFilterRule: string, UTF-8 []byte, number
+//   - Address: netip.Addr, net.IP, AvpAddress, 4 or 16 octets, address text (see ParseAddress)
+//   - Time: time.Time, RFC 3339 string, Unix epoch seconds (number or numeric string), "ntp:<seconds>"
+//   - Enumerated: item name, item code (number or numeric string), "NAME (code)" as printed by the codec
+//   - Grouped: []*Avp
+//
+// The derived formats (TBCD, PLMN, etc.) parse strings themselves, numbers are converted
+// to text (OctetString based formats) or to uint32 (Unsigned32 based formats).
+func (avp *Avp) ConvertValue(value any) (any, error) {
+	if value == nil {
+		return nil, &diwe.ErrInvalidAvpValue{Avp: avp.Name(), Value: value}
+	}
+
+	types := avp.Dict().AvpDataType()
+	if avp.Format() != "" {
+		return formatValue(avp, value)
+	}
+
+	switch avp.Type() {
+	case types.OctetString:
+		return octetsValue(avp, value)
+	case types.Integer32:
+		n, err := signedValue(avp, value, 32)
+		return int32(n), err
+	case types.Integer64:
+		return signedValue(avp, value, 64)
+	case types.Unsigned32:
+		n, err := unsignedValue(avp, value, 32)
+		return uint32(n), err
+	case types.Unsigned64:
+		return unsignedValue(avp, value, 64)
+	case types.Float32:
+		f, err := floatValue(avp, value, 32)
+		return float32(f), err
+	case types.Float64:
+		return floatValue(avp, value, 64)
+	case types.Address:
+		return addressValue(avp, value)
+	case types.Time:
+		return timeValue(avp, value)
+	case types.UTF8String, types.Identity, types.URI, types.IPFilterRule, types.QoSFilterRule:
+		return stringValue(avp, value)
+	case types.Enumerated:
+		return enumValue(avp, value)
+	case types.Grouped:
+		if members, ok := value.([]*Avp); ok {
+			return members, nil
+		}
+		return nil, avpValueError(avp, value)
+	}
+
+	return nil, &diwe.ErrUnknownAvpType{Avp: avp.Name(), Type: avp.Type()}
+}
+
+// Helpers
+//
+
+// avpValueError returns the error of the value which cannot be converted to the AVP type.
+func avpValueError(avp *Avp, value any) error {
+	return &diwe.ErrInvalidAvpValueType{Avp: avp.Name(), Value: value, Type: avp.Dict().AvpDataTypeName(avp.Type())}
+}
+
+// avpRangeError returns the error of the value out of the AVP type range.
+func avpRangeError(avp *Avp, value any) error {
+	return &diwe.ErrAvpValueRange{Avp: avp.Name(), Value: value, Type: avp.Dict().AvpDataTypeName(avp.Type())}
+}
+
+// signedValue converts the value to a signed integer of the size in bits.
+func signedValue(avp *Avp, value any, bits int) (int64, error) {
+	var n int64
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return 0, avpRangeError(avp, value)
+		}
+		n = int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) {
+			return 0, avpValueError(avp, value)
+		}
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, avpRangeError(avp, value)
+		}
+		n = int64(f)
+	case reflect.String:
+		var err error
+		if n, err = strconv.ParseInt(strings.TrimSpace(v.String()), 0, 64); err != nil {
+			if isRangeError(err) {
+				return 0, avpRangeError(avp, value)
+			}
+			return 0, avpValueError(avp, value)
+		}
+	default:
+		return 0, avpValueError(avp, value)
+	}
+
+	if bits < 64 && (n < -(1<<(bits-1)) || n > 1<<(bits-1)-1) {
+		return 0, avpRangeError(avp, value)
+	}
+
+	return n, nil
+}
+
+// unsignedValue converts the value to an unsigned integer of the size in bits.
+func unsignedValue(avp *Avp, value any, bits int) (uint64, error) {
+	var n uint64
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, avpRangeError(avp, value)
+		}
+		n = uint64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = v.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) {
+			return 0, avpValueError(avp, value)
+		}
+		if f < 0 || f >= math.MaxUint64 {
+			return 0, avpRangeError(avp, value)
+		}
+		n = uint64(f)
+	case reflect.String:
+		text := strings.TrimPrefix(strings.TrimSpace(v.String()), "+")
+		if strings.HasPrefix(text, "-") {
+			if _, err := strconv.ParseInt(text, 0, 64); err == nil || isRangeError(err) {
+				return 0, avpRangeError(avp, value)
+			}
+			return 0, avpValueError(avp, value)
+		}
+		var err error
+		if n, err = strconv.ParseUint(text, 0, 64); err != nil {
+			if isRangeError(err) {
+				return 0, avpRangeError(avp, value)
+			}
+			return 0, avpValueError(avp, value)
+		}
+	default:
+		return 0, avpValueError(avp, value)
+	}
+
+	if bits < 64 && n > 1<<bits-1 {
+		return 0, avpRangeError(avp, value)
+	}
+
+	return n, nil
+}
+
+// floatValue converts the value to a floating point number of the size in bits.
+func floatValue(avp *Avp, value any, bits int) (float64, error) {
+	var f float64
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f = v.Float()
+	case reflect.String:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(v.String()), 64); err != nil {
+			if isRangeError(err) {
+				return 0, avpRangeError(avp, value)
+			}
+			return 0, avpValueError(avp, value)
+		}
+	default:
+		return 0, avpValueError(avp, value)
+	}
+
+	if bits == 32 && !math.IsInf(f, 0) && math.Abs(f) > math.MaxFloat32 {
+		return 0, avpRangeError(avp, value)
+	}
+
+	return f, nil
+}
+
+// octetsValue converts the value to octets: the strings are kept as is (converted by the codec),
+// the "0x" prefixed hex strings are decoded.
+func octetsValue(avp *Avp, value any) (any, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		if len(v) > 2 && strings.EqualFold(v[:2], "0x") {
+			if data, err := hex.DecodeString(v[2:]); err == nil {
+				return data, nil
+			}
+		}
+		return v, nil
+	}
+
+	if text, ok := integerText(value); ok {
+		return text, nil
+	}
+
+	return nil, avpValueError(avp, value)
+}
+
+// stringValue converts the value to a string.
+func stringValue(avp *Avp, value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v), nil
+		}
+		return "", avpValueError(avp, value)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+
+	if text, ok := integerText(value); ok {
+		return text, nil
+	}
+
+	return "", avpValueError(avp, value)
+}
+
+// addressValue converts the value to an address: netip.Addr for IP addresses, AvpAddress for other families.
+func addressValue(avp *Avp, value any) (any, error) {
+	switch v := value.(type) {
+	case netip.Addr:
+		if v.IsValid() {
+			return v, nil
+		}
+	case AvpAddress:
+		return v, nil
+	case net.IP:
+		if ip, ok := netip.AddrFromSlice(v); ok {
+			return ip.Unmap(), nil
+		}
+	case []byte:
+		if ip, ok := netip.AddrFromSlice(v); ok {
+			return ip, nil
+		}
+	case string:
+		if addr, err := ParseAddress(v); err == nil {
+			return addr, nil
+		}
+	}
+
+	return nil, avpValueError(avp, value)
+}
+
+// timeValue converts the value to time: RFC 3339 string, Unix epoch seconds or "ntp:<seconds>".
+// The text after the first field is ignored (the Unix and NTP seconds printed by the codec).
+func timeValue(avp *Avp, value any) (time.Time, error) {
+	t, err := func() (time.Time, error) {
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			text, _, _ := strings.Cut(strings.TrimSpace(v), " ")
+			if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+				return t, nil
+			}
+			if seconds, ok := cutPrefixFold(text, "ntp:"); ok {
+				n, err := unsignedValue(avp, seconds, 32)
+				return NtpTime(uint32(n)), err
+			}
+			text, _ = cutPrefixFold(text, "unix:")
+			if !isDigits(strings.TrimPrefix(text, "-")) {
+				return time.Time{}, avpValueError(avp, value)
+			}
+			value = text
+		}
+
+		seconds, err := signedValue(avp, value, 64)
+		return time.Unix(seconds, 0), err
+	}()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if _, ok := TimeNtp(t); !ok {
+		return time.Time{}, avpRangeError(avp, value)
+	}
+
+	return t, nil
+}
+
+// enumValue converts the value to the enumerated item code.
+// The item name is case-insensitive, the text after the first field is ignored.
+func enumValue(avp *Avp, value any) (int32, error) {
+	if text, ok := value.(string); ok {
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			return 0, avpValueError(avp, value)
+		}
+		if code, err := avp.Dict().GetEnumCode(avp.Code(), fields[0]); err == nil {
+			return code, nil
+		}
+		if n, err := signedValue(avp, fields[0], 32); err == nil {
+			return int32(n), nil
+		}
+		return 0, &diwe.ErrUnknownEnumItem{Avp: avp.Name(), Value: value}
+	}
+
+	n, err := signedValue(avp, value, 32)
+	return int32(n), err
+}
+
+// formatValue prepares the value for the derived format codec:
+// numbers are converted to the text or uint32 depending on the format base type.
+func formatValue(avp *Avp, value any) (any, error) {
+	switch value.(type) {
+	case string, []byte:
+		return value, nil
+	}
+
+	if avp.Type() == avp.Dict().AvpDataType().Unsigned32 {
+		n, err := unsignedValue(avp, value, 32)
+		return uint32(n), err
+	}
+
+	if text, ok := integerText(value); ok {
+		return text, nil
+	}
+	if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+
+	return value, nil
+}
+
+// integerText returns the decimal text of the Go integer value.
+func integerText(value any) (string, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true
+	}
+	return "", false
+}
+
+// cutPrefixFold returns the text without the case-insensitive prefix and reports whether the prefix is found.
+func cutPrefixFold(text, prefix string) (string, bool) {
+	if len(text) >= len(prefix) && strings.EqualFold(text[:len(prefix)], prefix) {
+		return text[len(prefix):], true
+	}
+	return text, false
+}
+
+// isRangeError reports whether the strconv error is the range error.
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
@@ -0,0 +1,107 @@
+package diameter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+func TestAvpConvertValue(t *testing.T) {
+	fmt.Println(">>> AVP value conversion test")
+
+	env := newTestEnv(t)
+
+	stamp := time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)
+	valid := []struct {
+		avp   string
+		value any
+		want  any
+	}{
+		{"Origin-State-Id", "4294967295", uint32(4294967295)},
+		{"Origin-State-Id", 2001, uint32(2001)},
+		{"Origin-State-Id", float64(2001), uint32(2001)},
+		{"Origin-State-Id", "0x10", uint32(16)},
+		{"Accounting-Input-Octets", "18446744073709551615", uint64(18446744073709551615)},
+		{"Class", "0x00ff", []byte{0x00, 0xff}},
+		{"Class", 12345, "12345"},
+		{"Class", "0X0A", []byte{0x0a}},
+		{"Cancellation-Type", "SUBSCRIPTION_WITHDRAWAL", int32(2)},
+		{"Cancellation-Type", "2", int32(2)},
+		{"Cancellation-Type", "SUBSCRIPTION_WITHDRAWAL (2)", int32(2)},
+		{"Cancellation-Type", float64(0), int32(0)},
+		{"Event-Timestamp", "2024-05-01T10:20:30Z", stamp},
+		{"Event-Timestamp", stamp.Unix(), time.Unix(stamp.Unix(), 0)},
+		{"Host-IP-Address", "10.0.0.1", netip.MustParseAddr("10.0.0.1")},
+		{"Host-IP-Address", "2001:db8::1", netip.MustParseAddr("2001:db8::1")},
+		{"User-Name", 250010000000001, "250010000000001"},
+		{"MSISDN", 79160000001, "79160000001"},
+	}
+	for _, test := range valid {
+		avp, err := env.GetAvp(test.avp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := avp.ConvertValue(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(value) != fmt.Sprint(test.want) || fmt.Sprintf("%T", value) != fmt.Sprintf("%T", test.want) {
+			t.Fatalf("%s: %v (%T) converted to %v (%T)", test.avp, test.value, test.value, value, value)
+		}
+		if err := avp.SetValue(test.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var errRange *diwe.ErrAvpValueRange
+	var errType *diwe.ErrInvalidAvpValueType
+	invalid := []struct {
+		avp   string
+		value any
+		err   any
+	}{
+		{"Origin-State-Id", "4294967296", &errRange},
+		{"Origin-State-Id", int64(4294967296), &errRange},
+		{"Origin-State-Id", -1, &errRange},
+		{"Origin-State-Id", "-1", &errRange},
+		{"Origin-State-Id", 1.5, &errType},
+		{"Origin-State-Id", "abc", &errType},
+		{"Accounting-Input-Octets", "18446744073709551616", &errRange},
+		{"Host-IP-Address", "10.0.0", &errType},
+		{"Event-Timestamp", "yesterday", &errType},
+		{"Class", true, &errType},
+	}
+	for _, test := range invalid {
+		avp, _ := env.GetAvp(test.avp)
+		_, err := avp.ConvertValue(test.value)
+		fmt.Println(err)
+		if err == nil || !errors.As(err, test.err) {
+			t.Fatalf("%s: %v (%T) error: %v", test.avp, test.value, test.value, err)
+		}
+		if err := avp.SetValue(test.value); err == nil {
+			t.Fatalf("%s: %v is set", test.avp, test.value)
+		}
+	}
+
+	// The unquoted YAML hex is kept as octets
+	if err := env.Store().MakeFromYaml("Class: 0x00ff\nOrigin-State-Id: 0x10", AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+	if value := env.Store().Fetch(25)[0].Value(); fmt.Sprint(value) != fmt.Sprint([]byte{0x00, 0xff}) {
+		t.Fatalf("Class: %v", value)
+	}
+	if value := env.Store().Fetch(278)[0].Value(); value != uint32(16) {
+		t.Fatalf("Origin-State-Id: %v", value)
+	}
+
+	avp, _ := env.GetAvp("Cancellation-Type")
+	if _, err := avp.ConvertValue("UNKNOWN_ITEM"); err == nil {
+		t.Fatal("Unknown enumerated item is accepted")
+	}
+
+	fmt.Println("<<< AVP value conversion test")
+}
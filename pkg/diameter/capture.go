@@ -0,0 +1,246 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: capture.go
+// Description: Diameter pkg: capture of the received AVP values for the next messages
+//
+
+package diameter
+
+import (
+	"slices"
+	"sync"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Types
+//
+
+// CaptureRule copies the AVP value of the received message to the AVP store,
+// e.g. "on S6a/ULA capture Origin-Host into Destination-Host".
+// The value is stored in the session of the message (by Session-Id) or in the global store.
+// The non-zero increment is added to the integer value (e.g. CC-Request-Number).
+type CaptureRule struct {
+	Command   string // command with the direction: "S6a/ULA", "S6a/UL" - both directions
+	From      string // AVP of the received message
+	To        string // AVP of the store
+	Increment int64
+
+	key  profileKey
+	from uint32
+	to   uint32
+}
+
+// captures keeps the capture rules of the Diameter environment.
+type captures struct {
+	mu    sync.RWMutex
+	rules []CaptureRule
+}
+
+// Methods
+//
+
+// AddCapture adds the capture rule. The command is the command short name with the optional
+// 'R' (request) or 'A' (answer) suffix, e.g. "ULA"; without the suffix both directions are captured.
+// The empty target AVP is the same as the source AVP.
+func (d *Diameter) AddCapture(appId any, cmd string, from, to any, increment int64) (CaptureRule, error) {
+	app, err := d.dict.GetApp(appId)
+	if err != nil {
+		return CaptureRule{}, err
+	}
+
+	key, err := d.profileKey(app, cmd)
+	if err != nil {
+		return CaptureRule{}, err
+	}
+
+	if to == nil || to == "" {
+		to = from
+	}
+	fromDesc, err := d.dict.GetAvp(from)
+	if err != nil {
+		return CaptureRule{}, err
+	}
+	toDesc, err := d.dict.GetAvp(to)
+	if err != nil {
+		return CaptureRule{}, err
+	}
+
+	types := d.dict.AvpDataType()
+	if increment != 0 && !slices.Contains([]int{types.Integer32, types.Integer64, types.Unsigned32, types.Unsigned64}, toDesc.Type) {
+		return CaptureRule{}, &diwe.ErrCaptureIncrement{AvpName: toDesc.Name}
+	}
+
+	rule := CaptureRule{
+		Command:   app.Name + "/" + cmd,
+		From:      fromDesc.Name,
+		To:        toDesc.Name,
+		Increment: increment,
+		key:       key,
+		from:      fromDesc.Code,
+		to:        toDesc.Code,
+	}
+
+	d.captures.mu.Lock()
+	defer d.captures.mu.Unlock()
+	d.captures.rules = append(d.captures.rules, rule)
+
+	return rule, nil
+}
+
+// Captures returns the capture rules in the order they were added.
+func (d *Diameter) Captures() []CaptureRule {
+	d.captures.mu.RLock()
+	defer d.captures.mu.RUnlock()
+	return slices.Clone(d.captures.rules)
+}
+
+// RemoveCapture removes the capture rule by index (0-based), the negative index removes all rules.
+func (d *Diameter) RemoveCapture(index int) error {
+	d.captures.mu.Lock()
+	defer d.captures.mu.Unlock()
+
+	if index < 0 {
+		d.captures.rules = nil
+		return nil
+	}
+	if index >= len(d.captures.rules) {
+		return &diwe.ErrIndexOutOfRange{Index: index}
+	}
+	d.captures.rules = slices.Delete(d.captures.rules, index, index+1)
+
+	return nil
+}
+
+// Capture applies the capture rules to the received message.
+// Returns the number of captured values.
+func (d *Diameter) Capture(msg *Message) (int, error) {
+	request := msg.Flags&d.dict.CmdFlag().R != 0
+	dir := profileAnswer
+	if request {
+		dir = profileRequest
+	}
+
+	d.captures.mu.RLock()
+	rules := make([]CaptureRule, 0, len(d.captures.rules))
+	for _, rule := range d.captures.rules {
+		if rule.key.appId == msg.AppId && rule.key.cmdCode == msg.CmdCode && (rule.key.dir == dir || rule.key.dir == profileBoth) {
+			rules = append(rules, rule)
+		}
+	}
+	d.captures.mu.RUnlock()
+
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	// The session of the message or the global store
+	store := &d.store
+	if value, err := msg.GetAvpValue(avpSessionId); err == nil {
+		if id, ok := value.(string); ok {
+			if s, err := d.Session(id); err == nil {
+				store = &s.store
+			}
+		}
+	}
+
+	captured := 0
+	for _, rule := range rules {
+		src, err := msg.GetAvp(rule.from)
+		if err != nil {
+			continue
+		}
+
+		avp, err := d.captureValue(src, rule)
+		if err != nil {
+			return captured, err
+		}
+		store.Store(rule.to, []*Avp{avp})
+		captured++
+	}
+
+	return captured, nil
+}
+
+// CaptureAvp copies the value of the first AVP of the message path (e.g. "Subscription-Data.MSISDN")
+// into the AVP of the store. The empty target AVP is the same as the source AVP.
+// Returns ErrMissingAvp if the message does not contain the source AVP.
+func (d *Diameter) CaptureAvp(store *AvpStore, msg *Message, from, to string) error {
+	avps, err := msg.GetPath(from)
+	if err != nil {
+		return err
+	}
+	if len(avps) == 0 {
+		return &diwe.ErrMissingAvp{Avp: from}
+	}
+
+	if to == "" {
+		to = avps[0].Name()
+	}
+	toDesc, err := d.dict.GetAvp(to)
+	if err != nil {
+		return err
+	}
+
+	avp, err := d.captureValue(avps[0], CaptureRule{from: avps[0].Code(), to: toDesc.Code})
+	if err != nil {
+		return err
+	}
+	store.Store(toDesc.Code, []*Avp{avp})
+
+	return nil
+}
+
+// captureValue makes the store AVP from the captured AVP.
+func (d *Diameter) captureValue(src *Avp, rule CaptureRule) (*Avp, error) {
+	var avp *Avp
+	if rule.from == rule.to {
+		var err error
+		if avp, err = src.Copy(); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if avp, err = d.GetAvp(rule.to); err != nil {
+			return nil, err
+		}
+		// The different AVP types are converted through the text value
+		if err := avp.SetValue(src.Value()); err != nil {
+			codec, exists := src.Codec()
+			if !exists {
+				return nil, err
+			}
+			if err := avp.SetValue(codec.ToText(src)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if rule.Increment == 0 {
+		return avp, nil
+	}
+
+	var value any
+	switch v := avp.Value().(type) {
+	case int32:
+		value = v + int32(rule.Increment)
+	case int64:
+		value = v + rule.Increment
+	case uint32:
+		value = v + uint32(rule.Increment)
+	case uint64:
+		value = v + uint64(rule.Increment)
+	default:
+		return nil, &diwe.ErrCaptureIncrement{AvpName: avp.Name()}
+	}
+
+	if err := avp.SetValue(value); err != nil {
+		return nil, err
+	}
+
+	return avp, nil
+}
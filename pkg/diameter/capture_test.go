@@ -0,0 +1,106 @@
+package diameter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	fmt.Println(">>> AVP capture test")
+
+	env := newTestEnv(t)
+	if err := env.Store().MakeFromYaml(`
+Session-Id: "mme.test.org"
+Origin-Host: "mme.test.org"
+Origin-Realm: "test.org"
+User-Name: "250010000000001"
+Result-Code: 2001
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []struct {
+		cmd, from, to string
+		increment     int64
+	}{
+		{"ULA", "Origin-Host", "Destination-Host", 0},
+		{"ULA", "Result-Code", "Origin-State-Id", 1},
+		{"ULR", "User-Name", "", 0},
+	}
+	for _, rule := range rules {
+		if _, err := env.AddCapture("S6a", rule.cmd, rule.from, rule.to, rule.increment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.AddCapture("S6a", "ULA", "Result-Code", "Origin-Host", 1); err == nil {
+		t.Fatal("Increment of Origin-Host accepted")
+	}
+	if _, err := env.AddCapture("S6a", "XYZ", "Result-Code", "", 0); err == nil {
+		t.Fatal("Unknown command accepted")
+	}
+	fmt.Println(env.Captures())
+
+	request, err := env.NewMessage("S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := request.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := answer.GetAvp("Origin-Host")
+	if err := host.SetValue("hss.test.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a session the values are captured to the global store
+	if n, err := env.Capture(answer); err != nil || n != 2 {
+		t.Fatal("Captured:", n, err)
+	}
+	next, err := env.NewMessage("S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.Trace(0)
+	if value, _ := next.GetAvpValue("Destination-Host"); value != "hss.test.org" {
+		t.Fatalf("Destination-Host: %v", value)
+	}
+	if value, _ := next.GetAvpValue("Origin-State-Id"); value != uint32(2002) {
+		t.Fatalf("Origin-State-Id: %v", value)
+	}
+
+	// The session values are captured to the session store
+	s, err := env.NewSession("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err = s.NewMessage("S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userName, _ := request.GetAvp("User-Name")
+	if err := userName.SetValue("250010000000002"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := env.Capture(request); err != nil || n != 1 {
+		t.Fatal("Captured:", n, err)
+	}
+	if avps := s.Store().Fetch(1); len(avps) != 1 || avps[0].Value() != "250010000000002" {
+		t.Fatal("User-Name is not captured to the session")
+	}
+	if value, _ := env.Store().Fetch(1)[0].Value().(string); value != "250010000000001" {
+		t.Fatalf("Global User-Name: %s", value)
+	}
+
+	if err := env.RemoveCapture(5); err == nil {
+		t.Fatal("Invalid index accepted")
+	}
+	if err := env.RemoveCapture(0); err != nil || len(env.Captures()) != 2 {
+		t.Fatal("Capture rule is not removed", err)
+	}
+	if err := env.RemoveCapture(-1); err != nil || len(env.Captures()) != 0 {
+		t.Fatal("Capture rules are not removed", err)
+	}
+
+	fmt.Println("<<< AVP capture test")
+}
@@ -17,7 +17,7 @@ import (
 	"log/slog"
 	"math/rand"
 	"os"
-	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,6 +29,7 @@ import (
 	"tgdp/pkg/diameter/net/node"
 	"tgdp/pkg/diameter/net/transport"
 	"tgdp/pkg/diameter/pcap"
+	"tgdp/pkg/diameter/stats"
 )
 
 // Consts
@@ -60,8 +61,15 @@ const (
 
 // AVP codes (RFC 6733)
 const (
-	avpResultCode = uint32(268) // Result-Code
-	avpSessionId  = uint32(263) // Session-Id
+	avpResultCode             = uint32(268) // Result-Code
+	avpSessionId              = uint32(263) // Session-Id
+	avpOriginHost             = uint32(264) // Origin-Host
+	avpOriginRealm            = uint32(296) // Origin-Realm
+	avpDestinationHost        = uint32(293) // Destination-Host
+	avpDestinationRealm       = uint32(283) // Destination-Realm
+	avpVendorId               = uint32(266) // Vendor-Id
+	avpExperimentalResult     = uint32(297) // Experimental-Result
+	avpExperimentalResultCode = uint32(298) // Experimental-Result-Code
 )
 
 // Diameter version
@@ -74,31 +82,35 @@ const (
 // Diameter represents the Diameter protocol environment with configuration,
 // dictionary, peer management, and AVP storage capabilities.
 type Diameter struct {
-	mode    atomic.Int32
-	dict    dict.Dict
-	peers   node.Nodes
-	store   AvpStore
-	codecs  AvpCodecs
-	verbLvl atomic.Int32
-	dia2go  diaTypesToGo
-	ctx     context.Context
-	cancel  context.CancelFunc
-	wgDone  sync.WaitGroup
-	pcap    *pcap.Pcap
-	logger  *slog.Logger
-	rng     *rand.Rand
+	mode     atomic.Int32
+	dict     dict.Dict
+	peers    node.Nodes
+	store    AvpStore
+	codecMu  sync.RWMutex
+	codecs   AvpCodecs
+	formats  AvpFormats
+	verbLvl  atomic.Int32
+	gens     generators
+	feeds    avpFeeds
+	profiles avpProfiles
+	sessions sessions
+	captures captures
+	overload overload
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wgDone   sync.WaitGroup
+	pcap     *pcap.Pcap
+	logger   *slog.Logger
+	rng      *rand.Rand
+	rngMu    sync.Mutex
 }
 
 // Context key for Diameter environment
 type EnvContextKey string
 
-// diaTypesToGo maps Diameter data types to Go types for serialization/deserialization
-type diaTypesToGo map[int]avpGoType
-
-// avpGoType holds reflect.Type information for AVP value conversions
-type avpGoType struct {
-	type1 reflect.Type
-	type2 reflect.Type
+// poolCounters counts the objects taken from the pool, allocated by the pool and returned to it.
+type poolCounters struct {
+	gets, allocs, puts atomic.Uint64
 }
 
 // IDebug defines the interface for debug output functionality
@@ -112,15 +124,20 @@ type ITrace interface {
 var (
 	avpPool = sync.Pool{
 		New: func() any {
+			avpCounters.allocs.Add(1)
 			return &Avp{}
 		},
 	}
 
 	messagePool = sync.Pool{
 		New: func() any {
+			messageCounters.allocs.Add(1)
 			return &Message{}
 		},
 	}
+
+	// avpCounters and messageCounters count the use of the pools, see RuntimeStats
+	avpCounters, messageCounters poolCounters
 )
 
 // Constructor
@@ -137,13 +154,16 @@ func New(mode int32) (*Diameter, error) {
 	logger := slog.New(handler)
 
 	d := &Diameter{
-		peers:  node.NewNodes(),
-		codecs: make(AvpCodecs),
-		dia2go: make(diaTypesToGo),
-		rng:    rand.New(source),
-		logger: logger,
+		peers:   node.NewNodes(),
+		codecs:  make(AvpCodecs),
+		formats: make(AvpFormats),
+		rng:     rand.New(source),
+		logger:  logger,
 	}
 	d.store = NewAvpStore(d)
+	d.sessions.hi = uint32(time.Now().Unix())
+	d.registerFormats()
+	d.peers.SetObserver(d.observeOverload)
 	d.ctx, d.cancel = context.WithCancel(context.Background())
 	return d, d.SetMode(mode)
 }
@@ -190,6 +210,27 @@ func (d *Diameter) Peers() *node.Nodes {
 	return &d.peers
 }
 
+// Stats returns the traffic statistics of the peers.
+func (d *Diameter) Stats() *stats.Stats {
+	return d.peers.Stats()
+}
+
+// CommandNames returns the application name and the command short name of the codes,
+// the unknown application or command is returned as the code.
+func (d *Diameter) CommandNames(appId, cmdCode uint32) (string, string) {
+	appName, cmdName := strconv.FormatUint(uint64(appId), 10), strconv.FormatUint(uint64(cmdCode), 10)
+
+	app, err := d.Dict().GetAppById(appId)
+	if err != nil {
+		return appName, cmdName
+	}
+	if cmd, err := d.Dict().GetCmdByCode(cmdCode, app); err == nil {
+		cmdName = cmd.Short
+	}
+
+	return app.Name, cmdName
+}
+
 // Store returns a reference to the AVP storage.
 func (d *Diameter) Store() *AvpStore {
 	return &d.store
@@ -219,7 +260,13 @@ func (d *Diameter) LoadDict(file string, format int) error {
 	if err := d.dict.LoadFromFile(file, format); err != nil {
 		return err
 	}
+	d.registerCodecs()
 
+	return nil
+}
+
+// registerCodecs registers codecs for all AVP data types of the dictionary.
+func (d *Diameter) registerCodecs() {
 	// Register codecs for each AVP type
 	d.RegisterCodec(d.dict.AvpDataType().OctetString, mkvOctetString, serOctetString, desOctetString, cpvOctetString, txtOctetString)
 	d.RegisterCodec(d.dict.AvpDataType().Integer32, mkvInteger32, serInteger32, desInteger32, cpvInteger32, txtInteger32)
@@ -237,32 +284,31 @@ func (d *Diameter) LoadDict(file string, format int) error {
 	d.RegisterCodec(d.dict.AvpDataType().QoSFilterRule, mkvUTF8String, serUTF8String, desUTF8String, cpvUTF8String, txtUTF8String)
 	d.RegisterCodec(d.dict.AvpDataType().Enumerated, mkvEnumerated, serEnumerated, desEnumerated, cpvEnumerated, txtEnumerated)
 	d.RegisterCodec(d.dict.AvpDataType().Grouped, mkvGrouped, serGrouped, desGrouped, cpvGrouped, txtGrouped)
+}
 
-	// Map Diameter types to Go types for value conversion
-	d.registerDiaTypes(d.Dict().AvpDataType().Address, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().Enumerated, reflect.TypeOf(""), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Identity, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().OctetString, reflect.TypeOf(""), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().IPFilterRule, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().QoSFilterRule, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().Time, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().UTF8String, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().URI, reflect.TypeOf(""), reflect.TypeOf(""))
-	d.registerDiaTypes(d.Dict().AvpDataType().Integer32, reflect.TypeOf(int32(0)), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Integer64, reflect.TypeOf(int64(0)), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Unsigned32, reflect.TypeOf(uint32(0)), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Unsigned64, reflect.TypeOf(uint64(0)), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Float32, reflect.TypeOf(float32(0.0)), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Float64, reflect.TypeOf(float64(0.0)), reflect.TypeOf(0))
-	d.registerDiaTypes(d.Dict().AvpDataType().Grouped, reflect.TypeOf([]*Avp{}), nil)
-
-	return nil
+// registerFormats registers codecs for derived data formats.
+// The formats do not depend on the dictionary content.
+func (d *Diameter) registerFormats() {
+	d.RegisterCodec(AvpFormatTBCD, mkvTBCD, serOctetString, desOctetString, cpvOctetString, txtTBCD)
+	d.RegisterCodec(AvpFormatIMSI, mkvIMSI, serOctetString, desOctetString, cpvOctetString, txtTBCD)
+	d.RegisterCodec(AvpFormatMSISDN, mkvMSISDN, serOctetString, desOctetString, cpvOctetString, txtTBCD)
+	d.RegisterCodec(AvpFormatE164, mkvE164, serOctetString, desOctetString, cpvOctetString, txtE164)
+	d.RegisterCodec(AvpFormatPLMN, mkvPLMN, serOctetString, desOctetString, cpvOctetString, txtPLMN)
+	d.RegisterCodec(AvpFormatHex, mkvHex, serOctetString, desOctetString, cpvOctetString, txtOctetString)
+	d.RegisterCodec(AvpFormatULI, mkvULI, serOctetString, desOctetString, cpvOctetString, txtULI)
+	d.RegisterCodec(AvpFormatTimeZone, mkvTimeZone, serOctetString, desOctetString, cpvOctetString, txtTimeZone)
+	d.RegisterCodec(AvpFormatBitmap, mkvBitmap, serUnsigned32, desUnsigned32, cpvUnsigned32, txtBitmap)
+	d.RegisterCodec(AvpFormatResultCode, mkvResultCode, serUnsigned32, desUnsigned32, cpvUnsigned32, txtResultCode)
+	d.RegisterCodec(AvpFormatExperimentalResultCode, mkvExperimentalResultCode, serUnsigned32, desUnsigned32, cpvUnsigned32, txtExperimentalResultCode)
 }
 
-// LoadPeers loads peer configuration from a file.
+// LoadPeers loads peer configuration and peer AVP profiles from a file.
 // Returns an error if the file cannot be loaded or parsed.
 func (d *Diameter) LoadPeers(file string) error {
-	return d.peers.LoadFromFile(file, d)
+	if err := d.peers.LoadFromFile(file, d); err != nil {
+		return err
+	}
+	return d.LoadPeerProfiles(file)
 }
 
 // LoadData loads AVP data from a file with the specified append mode.
@@ -271,23 +317,41 @@ func (d *Diameter) LoadData(file string) error {
 	return d.store.LoadFromFile(file, AvpStoreAppend, 0)
 }
 
-// registerCodec registers codec functions for a specific AVP type.
-func (d *Diameter) RegisterCodec(avpType int, mkv MakeValueFn, ser SerializeFn, des DeserializeFn, cpv CopyValueFn, txt ToTextFn) {
-	d.codecs[avpType] = CodecFuncs{mkv, ser, des, cpv, txt}
-}
+// RegisterCodec registers codec functions for an AVP data type or a derived data format.
+// The avpType parameter can be:
+//   - int: base AVP data type (e.g. OctetString, Unsigned32)
+//   - string: derived data format name (e.g. TBCD, PLMN), case-insensitive
+func (d *Diameter) RegisterCodec(avpType any, mkv MakeValueFn, ser SerializeFn, des DeserializeFn, cpv CopyValueFn, txt ToTextFn) {
+	d.codecMu.Lock()
+	defer d.codecMu.Unlock()
 
-// Codec return codec functions for a specific AVP type.
-func (d *Diameter) Codec(avpType int) (CodecFuncs, bool) {
-	if codec, exists := d.codecs[avpType]; exists {
-		return codec, true
+	switch t := avpType.(type) {
+	case int:
+		d.codecs[t] = CodecFuncs{mkv, ser, des, cpv, txt}
+	case string:
+		d.formats[strings.ToLower(t)] = CodecFuncs{mkv, ser, des, cpv, txt}
 	}
-
-	return CodecFuncs{}, false
 }
 
-// registerDiaTypes maps Diameter types to Go types.
-func (d *Diameter) registerDiaTypes(diaType int, goType1, goType2 reflect.Type) {
-	d.dia2go[diaType] = avpGoType{type1: goType1, type2: goType2}
+// Codec return codec functions for a specific AVP data type (int)
+// or a derived data format name (string).
+func (d *Diameter) Codec(avpType any) (CodecFuncs, bool) {
+	var (
+		codec  CodecFuncs
+		exists bool
+	)
+
+	d.codecMu.RLock()
+	defer d.codecMu.RUnlock()
+
+	switch t := avpType.(type) {
+	case int:
+		codec, exists = d.codecs[t]
+	case string:
+		codec, exists = d.formats[strings.ToLower(t)]
+	}
+
+	return codec, exists
 }
 
 // Message handling methods
@@ -297,6 +361,26 @@ func (d *Diameter) registerDiaTypes(diaType int, goType1, goType2 reflect.Type)
 // based on command rules.
 // Returns an error if the application, command, or required AVPs cannot be resolved.
 func (d *Diameter) NewMessage(appId any, cmdId any, request, fetchAvps bool) (*Message, error) {
+	return d.NewPeerMessage("", appId, cmdId, request, fetchAvps)
+}
+
+// NewPeerMessage creates a new Diameter message for the peer. The AVP values are taken from
+// the peer profile, the command profile and the global store, in this order of precedence.
+// The empty peer name selects the command profile and the global store only.
+// The application messages are built within the current session if there is one;
+// in the session mode a request starts a new session if there is no current session.
+func (d *Diameter) NewPeerMessage(peer string, appId any, cmdId any, request, fetchAvps bool) (*Message, error) {
+	return d.newMessage(d.CurrentSession(), nil, peer, appId, cmdId, request, fetchAvps)
+}
+
+// NewProfileMessage creates a new Diameter message for the peer with the AVP profile on top of
+// the peer profile, the command profile and the global store. The nil profile is NewPeerMessage.
+func (d *Diameter) NewProfileMessage(profile *AvpStore, peer string, appId any, cmdId any, request, fetchAvps bool) (*Message, error) {
+	return d.newMessage(d.CurrentSession(), profile, peer, appId, cmdId, request, fetchAvps)
+}
+
+// newMessage creates a new Diameter message within the session (optional) with the AVP profile (optional).
+func (d *Diameter) newMessage(s *Session, profile *AvpStore, peer string, appId any, cmdId any, request, fetchAvps bool) (*Message, error) {
 	app, err := d.dict.GetApp(appId)
 	if err != nil {
 		return nil, err
@@ -313,8 +397,7 @@ func (d *Diameter) NewMessage(appId any, cmdId any, request, fetchAvps bool) (*M
 	m.CmdCode = cmd.Code
 	m.Flags = cmd.Flags
 	m.Length = MinMessageLen
-	m.EndToEnd = d.rng.Uint32()
-	m.HopByHop = d.rng.Uint32()
+	m.EndToEnd, m.HopByHop = d.newIdentifiers()
 	m.env = d
 	m.avps = make([]*Avp, 0)
 
@@ -333,14 +416,52 @@ func (d *Diameter) NewMessage(appId any, cmdId any, request, fetchAvps bool) (*M
 		avpRules = cmd.Answer
 	}
 
-	// Populate AVPs from store based on command rules
+	// Base protocol messages do not belong to sessions
+	if app.Id == 0 {
+		s = nil
+	} else if s == nil && request && d.Mode() == ModeSession {
+		if s, err = d.NewSession(peer); err != nil {
+			return nil, err
+		}
+	}
+
+	// Populate AVPs from store based on command rules,
+	// value templates are evaluated and data feed rows are taken for each new message
+	bc := newBuildContext(false)
+	bc.layers = d.layers(peer, app.Id, cmd.Code, request)
+	if profile != nil {
+		bc.layers = append([]avpLayer{{name: profileCustom, store: profile}}, bc.layers...)
+	}
+	if s != nil {
+		bc.session = s
+		bc.layers = append([]avpLayer{{name: fmt.Sprintf("session %d", s.num), store: &s.store}}, bc.layers...)
+	}
 	for _, avpRule := range avpRules {
 		avpDesc, err := d.dict.GetAvp(avpRule.Name)
 		if err != nil {
 			return nil, err
 		}
 
-		avps := d.store.Fetch(avpDesc.Code)
+		text, bound, err := d.feedText(avpDesc.Code, bc)
+		if err != nil {
+			return nil, err
+		}
+		if bound {
+			avp, err := d.GetAvp(avpDesc.Code)
+			if err != nil {
+				return nil, err
+			}
+			if err := avp.SetValue(text); err != nil {
+				return nil, err
+			}
+			if err := m.AddAvp(avp); err != nil {
+				return nil, err
+			}
+			m.Length += alignTo4(avp.Data().Size)
+			continue
+		}
+
+		avps := bc.fetch(d, avpDesc.Code)
 		if avps == nil {
 			if avpRule.Required {
 				return nil, &diwe.ErrNoValueForReqAvp{Avp: avpRule.Name}
@@ -349,19 +470,21 @@ func (d *Diameter) NewMessage(appId any, cmdId any, request, fetchAvps bool) (*M
 		}
 
 		for _, avp := range avps {
-			copied, err := avp.Copy()
+			copied, err := d.instantiate(avp, bc)
 			if err != nil {
 				return nil, err
 			}
 			if err := m.AddAvp(copied); err != nil {
 				return nil, err
 			}
-			m.Length += alignTo4(avp.Data().Size)
+			m.Length += alignTo4(copied.Data().Size)
 		}
 	}
 
-	// Handle Session-Id for transaction mode
-	if m.AppId != 0 && d.Mode() == ModeTransaction {
+	// Handle Session-Id for transaction mode, sessions own their Session-Id
+	if s != nil {
+		s.msgs.Add(1)
+	} else if m.AppId != 0 && d.Mode() == ModeTransaction {
 		if err := d.handleSessionId(m); err != nil {
 			return nil, err
 		}
@@ -370,6 +493,15 @@ func (d *Diameter) NewMessage(appId any, cmdId any, request, fetchAvps bool) (*M
 	return m, nil
 }
 
+// newIdentifiers returns the random End-to-End and Hop-by-Hop Identifiers.
+// The messages are built by many goroutines (server workers, concurrent calls), the generator is locked.
+func (d *Diameter) newIdentifiers() (uint32, uint32) {
+	d.rngMu.Lock()
+	defer d.rngMu.Unlock()
+
+	return d.rng.Uint32(), d.rng.Uint32()
+}
+
 // handleSessionIdTransaction modifies the Session-Id AVP for transaction mode
 // by appending timestamp components.
 func (d *Diameter) handleSessionId(m *Message) error {
@@ -378,16 +510,11 @@ func (d *Diameter) handleSessionId(m *Message) error {
 		return nil // No AVP found, it's optional
 	}
 
-	values := d.Store().Fetch(avpSessionId)
-	if values == nil {
-		return &diwe.ErrNoValueForReqAvp{Avp: sessionId}
-	}
-
 	now := time.Now().UnixNano()
 	hi := now >> 32
 	lo := now & mask32bits
 
-	value := values[0].Value()
+	value := sessionId.Value()
 	if v, ok := value.(string); ok {
 		value = fmt.Sprintf("%s;%d;%d", strings.Clone(v), hi, lo)
 		if err := sessionId.SetValue(value); err != nil {
@@ -488,9 +615,13 @@ func (d *Diameter) NewPeerEx(tr transport.ITransport, ucb node.UserCallbackFn) (
 	return d.peers.NewPeerEx(tr, d, ucb)
 }
 
-// SendMessage sends Diameter message to the peer.
-// Returns an error if the operation fails.
+// SendMessage sends Diameter message to the peer, the overload control is applied to the requests.
+// Returns an error if the operation fails or the request is abated.
 func (d *Diameter) SendMessage(peer *node.Node, msg *Message) error {
+	if err := d.AdmitRequest(peer, msg); err != nil {
+		return err
+	}
+
 	data, err := msg.Serialize()
 	if err != nil {
 		return err
@@ -518,6 +649,14 @@ func (d *Diameter) RecvMessage(peer *node.Node, wait bool) (*Message, error) {
 		return nil, err
 	}
 
+	// Answers update their sessions (e.g. Destination-Host), the capture rules are applied after
+	if msg.Flags&d.dict.CmdFlag().R == 0 {
+		d.updateSession(msg)
+	}
+	if _, err := d.Capture(msg); err != nil {
+		d.logger.Warn("AVP capture failed", "error", err)
+	}
+
 	return msg, nil
 }
 
@@ -528,6 +667,7 @@ func (d *Diameter) ReplyToMessage(peer *node.Node, msg *Message) error {
 	if err != nil {
 		return err
 	}
+	defer reply.Release()
 
 	return d.SendMessage(peer, reply)
 }
@@ -564,19 +704,30 @@ func (d *Diameter) PcapSync() {
 	}
 }
 
+// RuntimeStats returns the runtime statistics of the process with the use of the message and AVP pools.
+func RuntimeStats() stats.Runtime {
+	rt := stats.ReadRuntime()
+	rt.Messages = messageCounters.snapshot()
+	rt.Avps = avpCounters.snapshot()
+	return rt
+}
+
 // getAvp retrieves an Avp from the pool.
 func getAvp() *Avp {
+	avpCounters.gets.Add(1)
 	return avpPool.Get().(*Avp)
 }
 
 // putAvp returns an Avp to the pool after resetting it.
 func putAvp(avp *Avp) {
 	avp.reset()
+	avpCounters.puts.Add(1)
 	avpPool.Put(avp)
 }
 
 // getMessage retrieves a Message from the pool.
 func getMessage() *Message {
+	messageCounters.gets.Add(1)
 	return messagePool.Get().(*Message)
 }
 
@@ -586,9 +737,16 @@ func putMessage(m *Message) {
 		putAvp(avp)
 	}
 	m.reset()
+	messageCounters.puts.Add(1)
 	messagePool.Put(m)
 }
 
+// snapshot returns the pool counters, the gets are read last so they are not behind the allocs and the puts.
+func (c *poolCounters) snapshot() stats.PoolStats {
+	allocs, puts := c.allocs.Load(), c.puts.Load()
+	return stats.PoolStats{Gets: c.gets.Load(), Allocs: allocs, Puts: puts}
+}
+
 // PcapAppend turns on or off appending to the existing PCAP file for the Diameter instance.
 func (d *Diameter) PcapAppend(append bool) {
 	d.pcap.Append(append)
@@ -628,6 +786,7 @@ func (d *Diameter) CreateMessage(appId uint32, cmdCode uint32, request bool) ([]
 	if err != nil {
 		return nil, err
 	}
+	defer msg.Release()
 
 	return msg.Serialize()
 }
@@ -639,11 +798,13 @@ func (d *Diameter) CreateResponse(data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer msg.Release()
 
 	reply, err := msg.Response()
 	if err != nil {
 		return nil, err
 	}
+	defer reply.Release()
 
 	bytes, err := reply.Serialize()
 	if err != nil {
@@ -689,12 +850,13 @@ func (d *Diameter) IsRequest(flags byte) bool {
 	return flags&d.Dict().CmdFlag().R != 0
 }
 
-// GetResultCode returns the result code (AVP 270) from a Diameter message.
+// GetResultCode returns the result code (AVP 268) from a Diameter message.
 func (d *Diameter) GetResultCode(data []byte) (uint32, error) {
 	msg, err := d.BytesToMessage(data)
 	if err != nil {
 		return 0, err
 	}
+	defer msg.Release()
 
 	avpResultCode, err := msg.GetAvp(avpResultCode)
 	if err != nil {
@@ -709,17 +871,30 @@ func (d *Diameter) GetResultCode(data []byte) (uint32, error) {
 	return v, nil
 }
 
-// GetResultCodeEx returns the experimental result code (AVP 297) from a Diameter message.
-func (d *Diameter) GetResultCodeEx(data []byte) (uint32, error) {
-	return 0, &diwe.ErrNotImplemented{}
+// GetResultCodeEx returns the experimental result code (AVP 298) and the Vendor-Id (AVP 266)
+// from the Experimental-Result (AVP 297) of a Diameter message, the Result-Code is not looked at.
+func (d *Diameter) GetResultCodeEx(data []byte) (uint32, uint32, error) {
+	msg, err := d.BytesToMessage(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer msg.Release()
+
+	return msg.ExperimentalResult()
 }
 
 // TracerMessage traces the message.
 func (d *Diameter) TraceMessage(data []byte) {
+	// The message is not decoded for nothing on the hot path of the common messages
+	if TraceCM > d.TraceLevel() {
+		return
+	}
+
 	msg, err := d.BytesToMessage(data)
 	if err != nil {
 		return
 	}
+	defer msg.Release()
 
 	d.Trace(msg, TraceCM)
 }
@@ -12,6 +12,8 @@ type Avp struct {
 
 	Type int `pkl:"type"`
 
+	Format *string `pkl:"format"`
+
 	Enum *Enum `pkl:"enum"`
 
 	Group *Group `pkl:"group"`
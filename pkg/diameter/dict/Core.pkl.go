@@ -19,6 +19,8 @@ type Core interface {
 	GetAvpFlags() AvpBitFlags
 
 	GetAvpTypes() AvpDataTypes
+
+	GetResults() []ResultCode
 }
 
 var _ Core = CoreImpl{}
@@ -33,6 +35,8 @@ type CoreImpl struct {
 	AvpFlags AvpBitFlags `pkl:"avpFlags"`
 
 	AvpTypes AvpDataTypes `pkl:"avpTypes"`
+
+	Results []ResultCode `pkl:"results"`
 }
 
 func (rcv CoreImpl) GetApps() []App {
@@ -55,6 +59,10 @@ func (rcv CoreImpl) GetAvpTypes() AvpDataTypes {
 	return rcv.AvpTypes
 }
 
+func (rcv CoreImpl) GetResults() []ResultCode {
+	return rcv.Results
+}
+
 // LoadFromPath loads the pkl module at the given path and evaluates it into a Core
 func LoadFromPath(ctx context.Context, path string) (ret Core, err error) {
 	evaluator, err := pkl.NewEvaluator(ctx, pkl.PreconfiguredOptions)
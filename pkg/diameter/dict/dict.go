@@ -51,7 +51,9 @@ type lookupCache struct {
 	cmdCacheByName map[uint32]map[string]*Command // keyed by appId -> cmdName
 	avpCacheByCode map[uint32]*Avp
 	avpCacheByName map[string]*Avp
-	enumCache      map[uint32]map[string]int32 // keyed by avpCode -> itemName
+	enumCache      map[uint32]map[string]int32       // keyed by avpCode -> itemName
+	rcCacheByCode  map[uint32]map[uint32]*ResultCode // keyed by vndId -> code
+	rcCacheByName  map[uint32]map[string]*ResultCode // keyed by vndId -> name
 }
 
 // flagsNames maps bit flags to human-readable names for debugging/logging.
@@ -244,21 +246,47 @@ func (d *Dict) GetEnumCode(avpCode uint32, itemName string) (int32, error) {
 	return 0, &diwe.ErrUnknownEnumItem{Avp: fmt.Sprintf("%d", avpCode), Value: itemName}
 }
 
+// GetEnumName returns the name of an enumerated item by its code.
+// Returns ErrUnknownEnumItem if the AVP is not enumerated or the code is not found.
+func (d *Dict) GetEnumName(avpCode uint32, itemCode int32) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if avp, ok := d.cache.avpCacheByCode[avpCode]; ok && avp.Enum != nil {
+		for _, item := range avp.Enum.Items {
+			if item.Code == itemCode {
+				return item.Name, nil
+			}
+		}
+	}
+
+	return "", &diwe.ErrUnknownEnumItem{Avp: fmt.Sprintf("%d", avpCode), Value: itemCode}
+}
+
 // These methods return the flag and type definitions from the dictionary core.
 // They are read-only and return copies or values rather than pointers.
 
 // AvpFlag returns the AVP bit flag definitions (V, M, P flags).
 func (d *Dict) AvpFlag() AvpBitFlags {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	return d.core.GetAvpFlags()
 }
 
 // CmdFlag returns the Command bit flag definitions (R, P, E, T flags).
 func (d *Dict) CmdFlag() CmdBitFlags {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	return d.core.GetCmdFlags()
 }
 
 // AvpDataType returns the AVP data type definitions (e.g., Integer32, UTF8String, Grouped).
 func (d *Dict) AvpDataType() AvpDataTypes {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	return d.core.GetAvpTypes()
 }
 
@@ -369,6 +397,9 @@ func (d *Dict) AvpIter2() iter.Seq2[int, *Avp] {
 // CmdFlagName returns the human-readable name for a command bit flag.
 // Returns "Unknown" if the flag value is not recognized.
 func (d *Dict) CmdFlagName(flag uint8) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	if name, exists := d.flags.cmd[flag]; exists {
 		return name
 	}
@@ -378,6 +409,9 @@ func (d *Dict) CmdFlagName(flag uint8) string {
 // AvpFlagName returns the human-readable name for an AVP bit flag.
 // Returns "-" if the flag value is not recognized.
 func (d *Dict) AvpFlagName(flag uint8) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	if name, exists := d.flags.avp[flag]; exists {
 		return name
 	}
@@ -442,12 +476,12 @@ func (d *Dict) Dump(shift ...int) {
 	fmt.Println("\n>>> AVPs")
 	for _, avp := range d.core.GetAvps() {
 		fmt.Printf("code=%d name=\"%s\" flags=%d type=%d\n", avp.Code, avp.Name, avp.Flags, avp.Type)
-		if avp.Type == d.AvpDataType().Enumerated {
+		if avp.Type == d.core.GetAvpTypes().Enumerated {
 			for _, item := range avp.Enum.Items {
 				fmt.Printf("\tcode=%d name=\"%s\"\n", item.Code, item.Name)
 			}
 		}
-		if avp.Type == d.AvpDataType().Grouped {
+		if avp.Type == d.core.GetAvpTypes().Grouped {
 			for _, member := range avp.Group.Members {
 				fmt.Printf("\tname=\"%s\"\n", member.Name)
 			}
@@ -491,6 +525,23 @@ func (d *Dict) LoadFromFile(file string, format int) error {
 	return &diwe.ErrUnknownFmt{Fmt: format}
 }
 
+// Replace replaces the dictionary content with the content of the source dictionary.
+// This method acquires an exclusive lock, so concurrent lookups see either the old
+// or the new content. Definitions copied from the dictionary before the replacement
+// (e.g. AVP headers of messages in flight) are not affected.
+func (d *Dict) Replace(src *Dict) {
+	src.mu.RLock()
+	core, cache, flags := src.core, src.cache, src.flags
+	src.mu.RUnlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.core = core
+	d.cache = cache
+	d.flags = flags
+}
+
 // loadFromPkl loads dictionary data from a Pkl file.
 // It reads the core data, replaces the existing core, and rebuilds caches.
 func loadFromPkl(d *Dict, pklFile string) error {
@@ -528,6 +579,8 @@ func (d *Dict) fillLookupCache() {
 	d.cache.avpCacheByCode = make(map[uint32]*Avp)
 	d.cache.avpCacheByName = make(map[string]*Avp)
 	d.cache.enumCache = make(map[uint32]map[string]int32)
+	d.cache.rcCacheByCode = make(map[uint32]map[uint32]*ResultCode)
+	d.cache.rcCacheByName = make(map[uint32]map[string]*ResultCode)
 
 	for i := range d.core.GetApps() {
 		app := &d.core.GetApps()[i]
@@ -556,22 +609,32 @@ func (d *Dict) fillLookupCache() {
 			}
 		}
 	}
+
+	for i := range d.core.GetResults() {
+		rc := &d.core.GetResults()[i]
+		if _, exists := d.cache.rcCacheByCode[rc.VndId]; !exists {
+			d.cache.rcCacheByCode[rc.VndId] = make(map[uint32]*ResultCode)
+			d.cache.rcCacheByName[rc.VndId] = make(map[string]*ResultCode)
+		}
+		d.cache.rcCacheByCode[rc.VndId][rc.Code] = rc
+		d.cache.rcCacheByName[rc.VndId][strings.ToLower(rc.Name)] = rc
+	}
 }
 
 // fillFlagsNames populates the flag name mappings from the core flag definitions.
 // This must be called after the core data is loaded.
 func (d *Dict) fillFlagsNames() {
 	d.flags.avp = map[uint8]string{
-		d.AvpFlag().V: "V",
-		d.AvpFlag().M: "M",
-		d.AvpFlag().P: "P",
+		d.core.GetAvpFlags().V: "V",
+		d.core.GetAvpFlags().M: "M",
+		d.core.GetAvpFlags().P: "P",
 	}
 
 	d.flags.cmd = map[uint8]string{
-		d.CmdFlag().R: "Request",
-		d.CmdFlag().P: "Proxyable",
-		d.CmdFlag().E: "Error",
-		d.CmdFlag().T: "Retransmission",
+		d.core.GetCmdFlags().R: "Request",
+		d.core.GetCmdFlags().P: "Proxyable",
+		d.core.GetCmdFlags().E: "Error",
+		d.core.GetCmdFlags().T: "Retransmission",
 	}
 }
 
@@ -73,3 +73,65 @@ func TestAvp(t *testing.T) {
 // func TestVerify(t *testing.T) {
 // 	dic.Verify()
 // }
+
+func TestReplace(t *testing.T) {
+	types := AvpDataTypes{OctetString: 1, Unsigned32: 3, UTF8String: 10, Grouped: 16}
+	app := App{Id: 0, Name: "Common", Cmds: []Command{
+		{Code: 280, Name: "Device-Watchdog", Short: "DW", Request: []AvpRule{{Name: "Origin-Host", Required: true}}},
+	}}
+
+	broken := New(CoreImpl{Apps: []App{app}, AvpTypes: types})
+	if problems := broken.Problems(); len(problems) != 1 {
+		t.Fatalf("Expected 1 problem, found: %v", problems)
+	}
+
+	fixed := New(CoreImpl{Apps: []App{app}, AvpTypes: types, Avps: []Avp{
+		{Code: 264, Name: "Origin-Host", Flags: 64, Type: types.UTF8String},
+	}})
+	if problems := fixed.Problems(); len(problems) != 0 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+
+	broken.Replace(fixed)
+	avp, err := broken.GetAvp("Origin-Host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("AVP after replace: %s(%d)\n", avp.Name, avp.Code)
+}
+
+func TestResultCodes(t *testing.T) {
+	d := New(CoreImpl{Results: []ResultCode{
+		{Code: 2001, Name: "DIAMETER_SUCCESS"},
+		{Code: 5001, Name: "DIAMETER_AVP_UNSUPPORTED"},
+		{Code: 5001, Name: "DIAMETER_ERROR_USER_UNKNOWN", VndId: 10415},
+	}})
+	if problems := d.Problems(); len(problems) != 0 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+
+	rc, err := d.GetResultCode(5001, 10415)
+	if err != nil || rc.Name != "DIAMETER_ERROR_USER_UNKNOWN" || rc.Class() != ResultClassPermanent {
+		t.Fatalf("Experimental-Result-Code 5001: %v, %v", rc, err)
+	}
+	if rc, err = d.GetResultCode("diameter_success", 0); err != nil || rc.Code != 2001 {
+		t.Fatalf("Result-Code DIAMETER_SUCCESS: %v, %v", rc, err)
+	}
+	if _, err = d.GetResultCode(2001, 10415); err == nil {
+		t.Fatal("Result-Code 2001 found for vendor 10415")
+	}
+	if rc, err = d.FindExperimentalResultCode(5001); err != nil || rc.VndId != 10415 {
+		t.Fatalf("Experimental-Result-Code 5001: %v, %v", rc, err)
+	}
+
+	for code, class := range map[uint32]string{1001: "informational", 2002: "success", 3004: "protocol", 4181: "transient", 5012: "permanent", 6000: "unknown"} {
+		if name := ResultClassName(ResultClass(code)); name != class {
+			t.Fatalf("Result class %d: %s", code, name)
+		}
+	}
+
+	duplicated := New(CoreImpl{Results: []ResultCode{{Code: 2001, Name: "A"}, {Code: 2001, Name: "B"}, {Code: 42, Name: "C"}}})
+	if problems := duplicated.Problems(); len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, found: %v", problems)
+	}
+}
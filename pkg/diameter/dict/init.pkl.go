@@ -15,4 +15,5 @@ func init() {
 	pkl.RegisterStrictMapping("Diameter#Enum", Enum{})
 	pkl.RegisterStrictMapping("Diameter#Group", Group{})
 	pkl.RegisterStrictMapping("Diameter#Item", Item{})
+	pkl.RegisterStrictMapping("Diameter#ResultCode", ResultCode{})
 }
@@ -0,0 +1,155 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: results.go
+// Description: Diameter pkg: Result-Code and Experimental-Result-Code registry
+//
+
+package dict
+
+import (
+	"iter"
+	"strings"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+// Result code classes (RFC 6733 7.1), defined by the thousands digit of the code.
+const (
+	ResultClassUnknown       = iota
+	ResultClassInformational // 1xxx
+	ResultClassSuccess       // 2xxx
+	ResultClassProtocol      // 3xxx - protocol errors
+	ResultClassTransient     // 4xxx - transient failures
+	ResultClassPermanent     // 5xxx - permanent failures
+)
+
+// Variables
+//
+
+var resultClassNames = []string{
+	ResultClassUnknown:       "unknown",
+	ResultClassInformational: "informational",
+	ResultClassSuccess:       "success",
+	ResultClassProtocol:      "protocol",
+	ResultClassTransient:     "transient",
+	ResultClassPermanent:     "permanent",
+}
+
+// Functions
+//
+
+// ResultClass returns the class of a Result-Code or Experimental-Result-Code value.
+func ResultClass(code uint32) int {
+	if class := int(code / 1000); class >= ResultClassInformational && class <= ResultClassPermanent {
+		return class
+	}
+	return ResultClassUnknown
+}
+
+// ResultClassName returns the result class name (e.g. "success", "transient").
+func ResultClassName(class int) string {
+	if class < 0 || class >= len(resultClassNames) {
+		return resultClassNames[ResultClassUnknown]
+	}
+	return resultClassNames[class]
+}
+
+// Methods
+//
+
+// Class returns the class of the result code.
+func (rc *ResultCode) Class() int {
+	return ResultClass(rc.Code)
+}
+
+// IsExperimental returns true for vendor Experimental-Result-Code definitions.
+func (rc *ResultCode) IsExperimental() bool {
+	return rc.VndId != 0
+}
+
+// GetResultCode retrieves a result code by its value (uint32) or name (string).
+// The vndId is 0 for Result-Code and the vendor ID for Experimental-Result-Code.
+func (d *Dict) GetResultCode(rcId any, vndId uint32) (*ResultCode, error) {
+	switch id := OID(rcId).(type) {
+	case uint32:
+		return d.GetResultCodeByCode(id, vndId)
+	case string:
+		return d.GetResultCodeByName(id, vndId)
+	case *ResultCode:
+		return id, nil
+	default:
+		return nil, &diwe.ErrUnknownResultCode{Code: rcId, VndId: vndId}
+	}
+}
+
+// GetResultCodeByCode returns a result code definition by its value.
+// Returns ErrUnknownResultCode if the code is not defined for the vendor.
+func (d *Dict) GetResultCodeByCode(code uint32, vndId uint32) (*ResultCode, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if rc, ok := d.cache.rcCacheByCode[vndId][code]; ok {
+		return rc, nil
+	}
+
+	return nil, &diwe.ErrUnknownResultCode{Code: code, VndId: vndId}
+}
+
+// GetResultCodeByName returns a result code definition by its name (case-insensitive).
+// Returns ErrUnknownResultCode if the name is not defined for the vendor.
+func (d *Dict) GetResultCodeByName(name string, vndId uint32) (*ResultCode, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if rc, ok := d.cache.rcCacheByName[vndId][strings.ToLower(name)]; ok {
+		return rc, nil
+	}
+
+	return nil, &diwe.ErrUnknownResultCode{Code: name, VndId: vndId}
+}
+
+// FindExperimentalResultCode returns the first vendor definition of an Experimental-Result-Code.
+// It is used when the Vendor-Id is not known, e.g. when the Experimental-Result-Code AVP
+// is shown apart from its Experimental-Result group.
+func (d *Dict) FindExperimentalResultCode(rcId any) (*ResultCode, error) {
+	for rc := range d.ResultCodeIter() {
+		if !rc.IsExperimental() {
+			continue
+		}
+
+		switch id := OID(rcId).(type) {
+		case uint32:
+			if rc.Code == id {
+				return rc, nil
+			}
+		case string:
+			if strings.EqualFold(rc.Name, id) {
+				return rc, nil
+			}
+		}
+	}
+
+	return nil, &diwe.ErrUnknownResultCode{Code: rcId}
+}
+
+// ResultCodeIter returns a sequence that yields all result code definitions.
+func (d *Dict) ResultCodeIter() iter.Seq[*ResultCode] {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	results := d.core.GetResults()
+	return func(yield func(*ResultCode) bool) {
+		for i := range results {
+			if !yield(&results[i]) {
+				break
+			}
+		}
+	}
+}
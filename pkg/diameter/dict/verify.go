@@ -14,64 +14,93 @@ import (
 	"fmt"
 )
 
+// Verify prints the dictionary problems and returns their number.
 func (d *Dict) Verify() int {
-	errFound := 0
+	problems := d.Problems()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	fmt.Println()
 
-	for _, app := range d.core.GetApps() {
+	if len(problems) > 0 {
+		fmt.Println(">>> Errors: ", len(problems))
+	} else {
+		fmt.Println(">>> No errors foud :)")
+	}
+	return len(problems)
+}
+
+// Problems checks the dictionary consistency and returns the list of found problems:
+// unknown AVPs in command rules and group members, duplicated AVP codes,
+// vendor specific AVPs without vendor id, enumerated/grouped AVPs without definition
+// and duplicated or out of class range result codes.
+func (d *Dict) Problems() []string {
+	var problems []string
+
+	d.mu.RLock()
+	apps, avps, results := d.core.GetApps(), d.core.GetAvps(), d.core.GetResults()
+	avpFlags, avpTypes := d.core.GetAvpFlags(), d.core.GetAvpTypes()
+	d.mu.RUnlock()
+
+	for _, app := range apps {
 		for _, cmd := range app.Cmds {
 			for _, rule := range cmd.Request {
 				if avp, _ := d.GetAvpByName(rule.Name); avp == nil {
-					fmt.Printf("%s/%sR: unknown AVP \"%s\"\n", app.Name, cmd.Short, rule.Name)
-					errFound++
+					problems = append(problems, fmt.Sprintf("%s/%sR: unknown AVP \"%s\"", app.Name, cmd.Short, rule.Name))
 				}
 			}
 			for _, rule := range cmd.Answer {
 				if avp, _ := d.GetAvpByName(rule.Name); avp == nil {
-					fmt.Printf("%s/%sA: unknown AVP \"%s\"\n", app.Name, cmd.Short, rule.Name)
-					errFound++
+					problems = append(problems, fmt.Sprintf("%s/%sA: unknown AVP \"%s\"", app.Name, cmd.Short, rule.Name))
 				}
 			}
 		}
 	}
-	fmt.Println()
 
-	avpCodes := make(map[uint32]uint32)
-	for _, avp := range d.core.GetAvps() {
-		if code, exists := avpCodes[avp.Code]; exists {
-			avpDup, _ := d.GetAvpByCode(code)
-			fmt.Printf("Duplicated code %d for AVPs \"%s\" and \"%s\"\n", code, avp.Name, avpDup.Name)
-			errFound++
+	avpNames := make(map[uint32]string)
+	for _, avp := range avps {
+		if name, exists := avpNames[avp.Code]; exists {
+			problems = append(problems, fmt.Sprintf("Duplicated code %d for AVPs \"%s\" and \"%s\"", avp.Code, avp.Name, name))
 		} else {
-			avpCodes[avp.Code] = avp.Code
+			avpNames[avp.Code] = avp.Name
 		}
 	}
-	fmt.Println()
 
-	for _, avp := range d.core.GetAvps() {
-		if avp.Flags&d.AvpFlag().V != 0 && avp.VndId == 0 {
-			fmt.Printf("AVP \"%s\" V-flag persent without vendor id\n", avp.Name)
-			errFound++
+	for _, avp := range avps {
+		if avp.Flags&avpFlags.V != 0 && avp.VndId == 0 {
+			problems = append(problems, fmt.Sprintf("AVP \"%s\" V-flag persent without vendor id", avp.Name))
 		}
 	}
-	fmt.Println()
 
-	for _, avp := range d.core.GetAvps() {
-		if avp.Type == d.AvpDataType().Grouped {
+	for _, avp := range avps {
+		if avp.Type == avpTypes.Enumerated && avp.Enum == nil {
+			problems = append(problems, fmt.Sprintf("AVP \"%s\" enumerated without items", avp.Name))
+		}
+		if avp.Type == avpTypes.Grouped {
+			if avp.Group == nil {
+				problems = append(problems, fmt.Sprintf("AVP \"%s\" grouped without members", avp.Name))
+				continue
+			}
 			for _, member := range avp.Group.Members {
-				memberAvp, _ := d.GetAvpByName(member.Name)
-				if memberAvp == nil {
-					fmt.Printf("AVP \"%s\" unknown group member: \"%s\"\n", avp.Name, member.Name)
-					errFound++
+				if memberAvp, _ := d.GetAvpByName(member.Name); memberAvp == nil {
+					problems = append(problems, fmt.Sprintf("AVP \"%s\" unknown group member: \"%s\"", avp.Name, member.Name))
 				}
 			}
 		}
 	}
-	fmt.Println()
 
-	if errFound > 0 {
-		fmt.Println(">>> Errors: ", errFound)
-	} else {
-		fmt.Println(">>> No errors foud :)")
+	rcNames := make(map[[2]uint32]string)
+	for _, rc := range results {
+		if ResultClass(rc.Code) == ResultClassUnknown {
+			problems = append(problems, fmt.Sprintf("Result code \"%s\" (%d) out of class range", rc.Name, rc.Code))
+		}
+		key := [2]uint32{rc.VndId, rc.Code}
+		if name, exists := rcNames[key]; exists {
+			problems = append(problems, fmt.Sprintf("Duplicated result code %d (vendor %d) for \"%s\" and \"%s\"", rc.Code, rc.VndId, rc.Name, name))
+		} else {
+			rcNames[key] = rc.Name
+		}
 	}
-	return errFound
+
+	return problems
 }
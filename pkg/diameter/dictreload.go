@@ -0,0 +1,111 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: dictreload.go
+// Description: Diameter pkg: dictionary hot reload and watching
+//
+
+package diameter
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Methods
+//
+
+// ReloadDict loads a dictionary from a file and replaces the current one.
+// The new dictionary is validated before the swap, so a broken file leaves
+// the current dictionary untouched. Peers stay connected; messages and AVPs
+// built before the reload keep the definitions they were created with.
+// The AVP store content is not reloaded.
+func (d *Diameter) ReloadDict(file string, format int) error {
+	newDict := &dict.Dict{}
+	if err := newDict.LoadFromFile(file, format); err != nil {
+		return err
+	}
+
+	problems := newDict.Problems()
+	for avp := range newDict.AvpIter() {
+		if avp.Format == nil {
+			continue
+		}
+		if _, exists := d.Codec(*avp.Format); !exists {
+			problems = append(problems, fmt.Sprintf("AVP \"%s\" unknown format \"%s\"", avp.Name, *avp.Format))
+		}
+	}
+	if len(problems) > 0 {
+		return &diwe.ErrInvalidDict{File: file, Problems: problems}
+	}
+
+	d.dict.Replace(newDict)
+	d.registerCodecs()
+
+	return nil
+}
+
+// WatchDict polls the dictionary files with the given interval and reloads
+// the dictionary when any of them is modified. For the Pkl format all *.pkl
+// files of the dictionary directory are watched, as the dictionary module
+// amends and imports its neighbours. Watching stops when the Diameter
+// environment context is cancelled.
+func (d *Diameter) WatchDict(file string, format int, interval time.Duration) {
+	lastMod := dictModTime(file, format)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			modTime := dictModTime(file, format)
+			if !modTime.After(lastMod) {
+				continue
+			}
+			lastMod = modTime
+
+			if err := d.ReloadDict(file, format); err != nil {
+				d.logger.Error("Dictionary reload failed", slog.String("file", file), slog.Any("error", err))
+			} else {
+				d.logger.Info("Dictionary reloaded", slog.String("file", file))
+			}
+		}
+	}()
+}
+
+// Helpers
+//
+
+// dictModTime returns the latest modification time of the dictionary files.
+func dictModTime(file string, format int) time.Time {
+	files := []string{file}
+	if format == dict.FormatPkl {
+		if matches, err := filepath.Glob(filepath.Join(filepath.Dir(file), "*.pkl")); err == nil {
+			files = append(files, matches...)
+		}
+	}
+
+	var latest time.Time
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest
+}
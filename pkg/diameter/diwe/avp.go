@@ -54,3 +54,51 @@ type ErrAvpIsNotGrouped struct {
 func (e *ErrAvpIsNotGrouped) Error() string {
 	return fmt.Sprintf("AVP %s is not grouped type", e.AvpName)
 }
+
+type ErrInvalidFormatValue struct {
+	Avp    any
+	Format string
+	Value  any
+}
+
+func (e *ErrInvalidFormatValue) Error() string {
+	return fmt.Sprintf("AVP %s: invalid %s value '%v'", e.Avp, e.Format, e.Value)
+}
+
+type ErrInvalidTemplate struct {
+	Template string
+	Reason   string
+}
+
+func (e *ErrInvalidTemplate) Error() string {
+	return fmt.Sprintf("Invalid value template '%s': %s", e.Template, e.Reason)
+}
+
+type ErrInvalidAvpValueType struct {
+	Avp   any
+	Value any
+	Type  string
+}
+
+func (e *ErrInvalidAvpValueType) Error() string {
+	return fmt.Sprintf("AVP %s: cannot convert '%v' (%T) to %s", e.Avp, e.Value, e.Value, e.Type)
+}
+
+type ErrAvpValueRange struct {
+	Avp   any
+	Value any
+	Type  string
+}
+
+func (e *ErrAvpValueRange) Error() string {
+	return fmt.Sprintf("AVP %s: value '%v' is out of %s range", e.Avp, e.Value, e.Type)
+}
+
+type ErrInvalidAvpPath struct {
+	Path   string
+	Reason string
+}
+
+func (e *ErrInvalidAvpPath) Error() string {
+	return fmt.Sprintf("Invalid AVP path '%s': %s", e.Path, e.Reason)
+}
@@ -27,3 +27,63 @@ type ErrIndexOutOfRange struct {
 func (e *ErrIndexOutOfRange) Error() string {
 	return fmt.Sprintf("Index out of data range: %d", e.Index)
 }
+
+type ErrUnknownFeed struct {
+	Name string
+}
+
+func (e *ErrUnknownFeed) Error() string {
+	return fmt.Sprintf("Unknown data feed: %s", e.Name)
+}
+
+type ErrUnknownFeedColumn struct {
+	Feed   string
+	Column string
+}
+
+func (e *ErrUnknownFeedColumn) Error() string {
+	return fmt.Sprintf("Data feed %s has no column '%s'", e.Feed, e.Column)
+}
+
+type ErrFeedExhausted struct {
+	Feed string
+}
+
+func (e *ErrFeedExhausted) Error() string {
+	return fmt.Sprintf("Data feed %s is exhausted", e.Feed)
+}
+
+type ErrInvalidFeedOption struct {
+	Option string
+	Value  any
+}
+
+func (e *ErrInvalidFeedOption) Error() string {
+	return fmt.Sprintf("Invalid data feed option %s: '%v'", e.Option, e.Value)
+}
+
+type ErrInvalidFeedData struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (e *ErrInvalidFeedData) Error() string {
+	return fmt.Sprintf("Invalid data feed file %s at line %d: %s", e.File, e.Line, e.Reason)
+}
+
+type ErrGroupedAvpBind struct {
+	AvpName string
+}
+
+func (e *ErrGroupedAvpBind) Error() string {
+	return fmt.Sprintf("Grouped AVP %s cannot be bound to a data feed", e.AvpName)
+}
+
+type ErrCaptureIncrement struct {
+	AvpName string
+}
+
+func (e *ErrCaptureIncrement) Error() string {
+	return fmt.Sprintf("AVP %s value is not an integer and cannot be incremented", e.AvpName)
+}
@@ -62,3 +62,24 @@ type ErrUnknownEnumItem struct {
 func (e *ErrUnknownEnumItem) Error() string {
 	return fmt.Sprintf("AVP %s: unknown enum item '%v'", e.Avp, e.Value)
 }
+
+type ErrInvalidDict struct {
+	File     string
+	Problems []string
+}
+
+func (e *ErrInvalidDict) Error() string {
+	return fmt.Sprintf("Invalid dictionary '%s': %d problem(s), first: %s", e.File, len(e.Problems), e.Problems[0])
+}
+
+type ErrUnknownResultCode struct {
+	Code  any
+	VndId uint32
+}
+
+func (e *ErrUnknownResultCode) Error() string {
+	if e.VndId != 0 {
+		return fmt.Sprintf("Unknown Experimental-Result-Code for vendor %d: '%v'", e.VndId, e.Code)
+	}
+	return fmt.Sprintf("Unknown Result-Code: '%v'", e.Code)
+}
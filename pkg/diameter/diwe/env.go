@@ -32,3 +32,19 @@ type ErrInvalidMode struct {
 func (e *ErrInvalidMode) Error() string {
 	return fmt.Sprintf("Invalid mode: %d", e.Mode)
 }
+
+type ErrOfflineUnsupported struct {
+	Mode string
+}
+
+func (e *ErrOfflineUnsupported) Error() string {
+	return fmt.Sprintf("The %s mode does not support the offline mode", e.Mode)
+}
+
+type ErrUnknownSession struct {
+	Id string
+}
+
+func (e *ErrUnknownSession) Error() string {
+	return fmt.Sprintf("Unknown session: %s", e.Id)
+}
@@ -0,0 +1,69 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: load.go
+// Description: Diameter pkg: Load generation Debug, Info, Warnings, Errors
+//
+
+package diwe
+
+import "fmt"
+
+// Errors
+//
+
+type ErrInvalidRate struct {
+	Rate string
+}
+
+func (e *ErrInvalidRate) Error() string {
+	return fmt.Sprintf("Invalid rate '%s', expected <number>[/s | /m | /h]", e.Rate)
+}
+
+type ErrInvalidLoadConfig struct {
+	Param  string
+	Reason string
+}
+
+func (e *ErrInvalidLoadConfig) Error() string {
+	return fmt.Sprintf("Invalid load parameter '%s': %s", e.Param, e.Reason)
+}
+
+type ErrInvalidMix struct {
+	File   string
+	Entry  int // 1-based, 0 for the mix itself
+	Reason string
+}
+
+func (e *ErrInvalidMix) Error() string {
+	if e.Entry == 0 {
+		return fmt.Sprintf("Invalid load mix '%s': %s", e.File, e.Reason)
+	}
+	return fmt.Sprintf("Invalid load mix '%s' entry %d: %s", e.File, e.Entry, e.Reason)
+}
+
+type ErrInvalidRateProfile struct {
+	File    string
+	Segment int // 1-based, 0 for the profile itself
+	Reason  string
+}
+
+func (e *ErrInvalidRateProfile) Error() string {
+	if e.Segment == 0 {
+		return fmt.Sprintf("Invalid rate profile '%s': %s", e.File, e.Reason)
+	}
+	return fmt.Sprintf("Invalid rate profile '%s' segment %d: %s", e.File, e.Segment, e.Reason)
+}
+
+type ErrLeakGuard struct {
+	Resource string
+	Value    string
+	Limit    string
+}
+
+func (e *ErrLeakGuard) Error() string {
+	return fmt.Sprintf("Load stopped by the leak guard: %s %s over the limit %s", e.Resource, e.Value, e.Limit)
+}
@@ -52,3 +52,20 @@ type ErrNoAvpValue struct {
 func (e *ErrNoAvpValue) Error() string {
 	return fmt.Sprintf("No value found for AVP '%v'", e.Avp)
 }
+
+type ErrInvalidFault struct {
+	Fault  string
+	Reason string
+}
+
+func (e *ErrInvalidFault) Error() string {
+	return fmt.Sprintf("Invalid message fault '%s': %s", e.Fault, e.Reason)
+}
+
+type ErrInvalidHex struct {
+	Text string
+}
+
+func (e *ErrInvalidHex) Error() string {
+	return fmt.Sprintf("Invalid hex payload '%s'", e.Text)
+}
@@ -145,3 +145,12 @@ type ErrNoSuitableAddr struct {
 func (e *ErrNoSuitableAddr) Error() string {
 	return fmt.Sprintf("Node '%s' No sutable IP address found: %s", e.Peer, e.Addr)
 }
+
+type ErrMetricsListen struct {
+	Addr string
+	Err  error
+}
+
+func (e *ErrMetricsListen) Error() string {
+	return fmt.Sprintf("Metrics endpoint '%s' listen error: %s", e.Addr, e.Err)
+}
@@ -0,0 +1,34 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: overload.go
+// Description: Diameter pkg: Overload control Debug, Info, Warnings, Errors
+//
+
+package diwe
+
+import "fmt"
+
+// Errors
+//
+
+type ErrOverloadAbated struct {
+	Peer      string
+	Node      string
+	Reduction uint32
+}
+
+func (e *ErrOverloadAbated) Error() string {
+	return fmt.Sprintf("Request to peer '%s' abated: '%s' is overloaded, reduction %d%%", e.Peer, e.Node, e.Reduction)
+}
+
+type ErrInvalidOverloadReport struct {
+	Reason string
+}
+
+func (e *ErrInvalidOverloadReport) Error() string {
+	return fmt.Sprintf("Invalid overload report: %s", e.Reason)
+}
@@ -0,0 +1,35 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: report.go
+// Description: Diameter pkg: Test report Debug, Info, Warnings, Errors
+//
+
+package diwe
+
+import (
+	"fmt"
+)
+
+// Errors
+//
+
+type ErrReportFormat struct {
+	File string
+}
+
+func (e *ErrReportFormat) Error() string {
+	return fmt.Sprintf("Unknown report format of '%s', expected .xml, .json or .html", e.File)
+}
+
+type ErrTestFailed struct {
+	Failed int
+	Errors int
+}
+
+func (e *ErrTestFailed) Error() string {
+	return fmt.Sprintf("Test failed: %d failed, %d errors", e.Failed, e.Errors)
+}
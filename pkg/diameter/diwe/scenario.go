@@ -0,0 +1,68 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: scenario.go
+// Description: Diameter pkg: Scenario Debug, Info, Warnings, Errors
+//
+
+package diwe
+
+import (
+	"fmt"
+	"time"
+)
+
+// Errors
+//
+
+type ErrInvalidScenario struct {
+	File   string
+	Step   int // 1-based, 0 for the scenario itself
+	Reason string
+}
+
+func (e *ErrInvalidScenario) Error() string {
+	if e.Step == 0 {
+		return fmt.Sprintf("Invalid scenario '%s': %s", e.File, e.Reason)
+	}
+	return fmt.Sprintf("Invalid scenario '%s' step %d: %s", e.File, e.Step, e.Reason)
+}
+
+type ErrRecvTimeout struct {
+	Peer    string
+	Timeout time.Duration
+}
+
+func (e *ErrRecvTimeout) Error() string {
+	return fmt.Sprintf("No message from peer '%s' within %s", e.Peer, e.Timeout)
+}
+
+type ErrUnexpectedValue struct {
+	Avp      string
+	Value    string
+	Expected string
+}
+
+func (e *ErrUnexpectedValue) Error() string {
+	return fmt.Sprintf("AVP '%s' value '%s', expected '%s'", e.Avp, e.Value, e.Expected)
+}
+
+type ErrUnexpectedResult struct {
+	Result   string
+	Expected string
+}
+
+func (e *ErrUnexpectedResult) Error() string {
+	return fmt.Sprintf("Result %s, expected %s", e.Result, e.Expected)
+}
+
+type ErrUnexpectedAvp struct {
+	Avp string
+}
+
+func (e *ErrUnexpectedAvp) Error() string {
+	return fmt.Sprintf("AVP '%s' is present, expected absent", e.Avp)
+}
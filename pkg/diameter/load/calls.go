@@ -0,0 +1,250 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: calls.go
+// Description: Diameter pkg: concurrent multi-step calls load
+//
+
+package load
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/metrics"
+	"tgdp/pkg/diameter/scenario"
+	"tgdp/pkg/diameter/stats"
+)
+
+// Types
+//
+
+// CallStats is the snapshot of the call load counters.
+type CallStats struct {
+	Phase     string
+	Elapsed   time.Duration
+	Rate      float64 // target rate of the calls per second
+	Started   uint64
+	Passed    uint64
+	Failed    uint64
+	Missed    uint64 // calls not started in time for the target rate
+	Active    int
+	Failures  []uint64        // failed calls by the step index
+	Duration  stats.Histogram // duration of the completed calls
+	LastError string
+}
+
+// Calls runs the scenario as the load: the calls are started at the configured rate, each call runs
+// the scenario steps in its own session (Session-Id, session store and session scope feed rows).
+// Up to Concurrency calls run at the same time on the shared peer connections.
+type Calls struct {
+	env *diameter.Diameter
+	sc  *scenario.Scenario
+	cfg Config
+
+	// slots limits the active calls, each running call holds a slot
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	// failedLog is the writer of the failed calls exchange
+	failedLog io.Writer
+	logMu     sync.Mutex
+
+	// mu protects the fields below
+	mu       sync.Mutex
+	start    time.Time
+	phase    string
+	lastErr  string
+	failures []uint64
+	duration stats.Histogram
+
+	started atomic.Uint64
+	passed  atomic.Uint64
+	failed  atomic.Uint64
+	missed  atomic.Uint64
+}
+
+// Constructor
+//
+
+// NewCalls creates the call load of the scenario. The Concurrency is the maximum number of the active calls,
+// the Timeout is not used: the steps have their own timeouts. The failed calls are written to the failedLog
+// with their message exchange, nil disables the log.
+func NewCalls(env *diameter.Diameter, sc *scenario.Scenario, cfg Config, failedLog io.Writer) (*Calls, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	if cfg.Reconnect > 0 {
+		return nil, &diwe.ErrInvalidLoadConfig{Param: "reconnect", Reason: "not supported by the scenario calls"}
+	}
+
+	return &Calls{
+		env:       env,
+		sc:        sc,
+		cfg:       cfg,
+		slots:     make(chan struct{}, cfg.Concurrency),
+		failedLog: failedLog,
+		failures:  make([]uint64, len(sc.Steps)),
+	}, nil
+}
+
+// Methods
+//
+
+// Config returns the load configuration.
+func (c *Calls) Config() Config {
+	return c.cfg
+}
+
+// Run starts the calls until the load phases are completed or the context is canceled.
+// The running calls are completed before return, they are not interrupted by the context.
+// The leak guards stop the calls with ErrLeakGuard.
+func (c *Calls) Run(ctx context.Context) error {
+	runner := scenario.NewRunner(c.env)
+	defer runner.Close()
+
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	go guard(ctx, &c.cfg, stop)
+
+	c.mu.Lock()
+	c.start = time.Now()
+	c.mu.Unlock()
+
+	callCtx := context.WithoutCancel(ctx)
+	lim := newLimiter(&c.cfg)
+loop:
+	for {
+		if err := lim.wait(ctx); err != nil {
+			break
+		}
+		c.missed.Add(lim.takeMissed())
+
+		if !takeSlot(ctx, c.slots, c.cfg.OpenLoop) {
+			if ctx.Err() != nil {
+				break loop
+			}
+			c.missed.Add(1)
+			continue
+		}
+
+		c.wg.Add(1)
+		c.started.Add(1)
+		go c.call(callCtx, runner)
+	}
+
+	c.setPhase(PhaseDrain)
+	c.wg.Wait()
+	c.setPhase(PhaseDone)
+
+	return guardError(ctx)
+}
+
+// Stats returns the snapshot of the call load counters.
+func (c *Calls) Stats() CallStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CallStats{
+		Phase:     c.phase,
+		Started:   c.started.Load(),
+		Passed:    c.passed.Load(),
+		Failed:    c.failed.Load(),
+		Missed:    c.missed.Load(),
+		Active:    len(c.slots),
+		Failures:  slices.Clone(c.failures),
+		Duration:  c.duration,
+		LastError: c.lastErr,
+	}
+	if !c.start.IsZero() {
+		stats.Elapsed = time.Since(c.start)
+		if stats.Phase == "" {
+			stats.Phase, stats.Rate = c.cfg.Phase(stats.Elapsed)
+		}
+	}
+
+	return stats
+}
+
+// Collect adds the call load metrics: the phase, the target rate, the call counters and the call duration.
+func (c *Calls) Collect(w *metrics.Writer) {
+	stats := c.Stats()
+
+	for _, phase := range []string{PhaseRampUp, PhaseSteady, PhaseRampDown, PhaseProfile, PhaseDrain, PhaseDone} {
+		current := 0.0
+		if phase == stats.Phase {
+			current = 1
+		}
+		w.Gauge("tgdp_load_phase", "Current load phase", current, "phase", phase)
+	}
+	w.Gauge("tgdp_load_target_rate", "Target rate of the calls per second", stats.Rate)
+	w.Gauge("tgdp_calls_active", "Calls in progress", float64(stats.Active))
+	w.Counter("tgdp_calls_started_total", "Calls started", float64(stats.Started))
+	w.Counter("tgdp_calls_passed_total", "Calls completed with all steps passed", float64(stats.Passed))
+	w.Counter("tgdp_calls_missed_total", "Calls not started in time for the target rate", float64(stats.Missed))
+	for i, failed := range stats.Failures {
+		w.Counter("tgdp_calls_failed_total", "Calls failed by the step", float64(failed),
+			"step", strconv.Itoa(i+1), "name", c.sc.Steps[i].String())
+	}
+	w.Histogram("tgdp_calls_duration_seconds", "Duration of the completed calls", &stats.Duration)
+}
+
+// String returns the one line text of the call counters and the call duration.
+func (s CallStats) String() string {
+	return fmt.Sprintf("[%6s] %-9s rate %8.1f/s  calls %d  passed %d  failed %d  missed %d  active %d  %s",
+		s.Elapsed.Truncate(time.Second), s.Phase, s.Rate, s.Started, s.Passed, s.Failed, s.Missed, s.Active,
+		&s.Duration)
+}
+
+// Helpers
+//
+
+// call runs the scenario and counts the outcome, the slot is taken by the caller.
+func (c *Calls) call(ctx context.Context, runner *scenario.Runner) {
+	defer c.wg.Done()
+	defer func() { <-c.slots }()
+
+	result := runner.Run(ctx, c.sc)
+
+	c.mu.Lock()
+	c.duration.Add(result.Duration)
+	for i, step := range result.Steps {
+		if step.Status == scenario.StatusFail {
+			c.failures[i]++
+			c.lastErr = step.Err.Error()
+		}
+	}
+	c.mu.Unlock()
+
+	if result.Passed() {
+		c.passed.Add(1)
+		return
+	}
+	c.failed.Add(1)
+
+	if c.failedLog != nil {
+		c.logMu.Lock()
+		defer c.logMu.Unlock()
+		if err := result.WriteExchange(c.failedLog); err != nil {
+			c.env.Logger().Warn("Failed call log write failed", "error", err)
+		}
+	}
+}
+
+// setPhase sets the phase after the calls are started.
+func (c *Calls) setPhase(phase string) {
+	c.mu.Lock()
+	c.phase = phase
+	c.mu.Unlock()
+}
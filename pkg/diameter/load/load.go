@@ -0,0 +1,735 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: load.go
+// Description: Diameter pkg: rate-controlled load generation
+//
+
+package load
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/metrics"
+	"tgdp/pkg/diameter/net/node"
+	"tgdp/pkg/diameter/pcap"
+	"tgdp/pkg/diameter/stats"
+)
+
+// Consts
+//
+
+const (
+	// DefaultConcurrency is the default maximum number of the outstanding requests
+	DefaultConcurrency = 16
+	// DefaultTimeout is the default answer timeout
+	DefaultTimeout = 5 * time.Second
+
+	// sweepInterval is the interval of the outstanding requests timeout check
+	sweepInterval = 100 * time.Millisecond
+	// reconnectDelay is the minimum interval between the reconnection attempts to the lost peer
+	reconnectDelay = time.Second
+)
+
+// Types
+//
+
+// Config is the load configuration: the request, the target rate and the phases.
+type Config struct {
+	// Peer is the peer name to send the requests to, not used by the mix
+	Peer string
+	// App is the application name or ID, not used by the mix
+	App string
+	// Cmd is the command short name or code, not used by the mix
+	Cmd string
+	// Rate is the steady rate of the requests per second, the weighted mix entries share it
+	Rate float64
+	// Duration is the steady phase duration, zero means until the load is interrupted
+	Duration time.Duration
+	// RampUp is the ramp-up phase duration, the rate grows from zero to Rate
+	RampUp time.Duration
+	// RampDown is the ramp-down phase duration, the rate falls from Rate to zero
+	RampDown time.Duration
+	// Concurrency is the maximum number of the outstanding requests
+	Concurrency int
+	// Timeout is the answer timeout
+	Timeout time.Duration
+	// Profile is the rate profile instead of the Rate and the ramps, the Duration limits it
+	Profile *RateProfile
+	// OpenLoop keeps the target rate when the outstanding requests are at the Concurrency limit:
+	// the request is not sent and counted as missed instead of waiting for the answers
+	OpenLoop bool
+	// Reconnect is the interval of the peer reconnections of the soak run, zero keeps the connections.
+	// Not supported by the scenario calls
+	Reconnect time.Duration
+	// MaxHeap stops the load when the live heap grows over it (bytes), zero is no limit
+	MaxHeap uint64
+	// MaxGoroutines stops the load when the goroutines grow over it, zero is no limit
+	MaxGoroutines int
+
+	// scale is the share of the rate profile of the mix entry with the own rate, 1 if not set
+	scale float64
+}
+
+// Stats is the snapshot of the load counters.
+type Stats struct {
+	Phase       string
+	Elapsed     time.Duration
+	Rate        float64 // target rate of the phase
+	Sent        uint64
+	Answered    uint64
+	Timeouts    uint64
+	Errors      uint64 // requests failed to build or send and undecodable answers
+	Unexpected  uint64 // received messages other than the answers to the outstanding requests
+	Missed      uint64 // requests not sent in time for the target rate
+	Abated      uint64 // requests abated by the overload control (DOIC)
+	Reconnects  uint64 // peer reconnections of the soak run
+	Dropped     uint64 // outstanding requests dropped by the reconnections, their answers cannot arrive
+	Abandoned   uint64 // outstanding requests not awaited after Abandon
+	Outstanding int
+	Results     map[uint32]uint64 // answers by the Result-Code (Experimental-Result-Code)
+	Latency     stats.Histogram   // latency of the answered requests
+	LastError   string
+	Entries     []EntryStats // counters by the mix entry, the single entry of the command load
+}
+
+// EntryStats is the snapshot of the mix entry counters.
+type EntryStats struct {
+	Name     string
+	Rate     float64 // target rate of the entry in the phase
+	Sent     uint64
+	Answered uint64
+	Timeouts uint64
+	Errors   uint64
+	Results  map[uint32]uint64
+	Latency  stats.Histogram
+}
+
+// Generator sends the requests of the mix entries to the peers in turn at the configured rate.
+// The requests are pipelined: up to Concurrency requests are outstanding, the answers are matched
+// by the peer and the Hop-by-Hop Identifier.
+type Generator struct {
+	env     *diameter.Diameter
+	cfg     Config
+	peers   []*node.Node
+	entries []*entry
+
+	// weighted are the entries sharing the load rate, cumulative are their cumulative weights
+	weighted   []*entry
+	cumulative []float64
+	// slots limits the outstanding requests, each pending request holds a slot
+	slots chan struct{}
+	// next is the counter of the peer turns
+	next atomic.Uint64
+	// cycleMu pauses the sending while the soak run reconnects the peers
+	cycleMu sync.RWMutex
+	// abandon stops the waiting for the outstanding requests after the sending is stopped
+	abandon     chan struct{}
+	abandonOnce sync.Once
+
+	// mu protects the fields below and the entry results and latency
+	mu        sync.Mutex
+	pending   map[pendingKey]request
+	results   map[uint32]uint64
+	latency   stats.Histogram
+	start     time.Time
+	phase     string // drain and done phases, empty while the requests are sent
+	lastErr   string
+	connected map[*node.Node]time.Time // last reconnection attempt
+
+	sent       atomic.Uint64
+	answered   atomic.Uint64
+	timeouts   atomic.Uint64
+	errors     atomic.Uint64
+	unexpected atomic.Uint64
+	missed     atomic.Uint64
+	abated     atomic.Uint64
+	reconnects atomic.Uint64
+	dropped    atomic.Uint64
+	abandoned  atomic.Uint64
+
+	// pcapMu serializes the PCAP writes of the sender and the receiver
+	pcapMu sync.Mutex
+}
+
+// entry is the mix entry of the generator with its counters.
+type entry struct {
+	MixEntry
+
+	results map[uint32]uint64
+	latency stats.Histogram
+
+	sent     atomic.Uint64
+	answered atomic.Uint64
+	timeouts atomic.Uint64
+	errors   atomic.Uint64
+}
+
+// pendingKey identifies the outstanding request.
+type pendingKey struct {
+	peer     *node.Node
+	hopByHop uint32
+}
+
+// request is the outstanding request.
+type request struct {
+	sent  time.Time
+	entry *entry
+}
+
+// Constructor
+//
+
+// New creates the load generator of the command. The zero Concurrency and Timeout are set to the defaults.
+func New(env *diameter.Diameter, cfg Config) (*Generator, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+
+	app, err := env.Dict().GetApp(cfg.App)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := env.Dict().GetCmd(cfg.Cmd, app)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGenerator(env, cfg, &Mix{
+		Peers:   []string{cfg.Peer},
+		Entries: []MixEntry{{Name: fmt.Sprintf("%s/%sR", app.Name, cmd.Short), App: cfg.App, Cmd: cfg.Cmd, Weight: 1}},
+	})
+}
+
+// NewMix creates the load generator of the traffic mix, the weighted entries share the Rate
+// (the rate of the Profile). The Rate is not required if all entries have the own rates.
+// The zero Concurrency and Timeout are set to the defaults.
+func NewMix(env *diameter.Diameter, mix *Mix, cfg Config) (*Generator, error) {
+	if !mix.Weighted() && cfg.Rate != 0 {
+		return nil, &diwe.ErrInvalidLoadConfig{Param: "rate", Reason: "the mix entries have own rates"}
+	}
+
+	check := cfg.checkLimits
+	if mix.Weighted() || cfg.Profile != nil {
+		check = cfg.check
+	}
+	if err := check(); err != nil {
+		return nil, err
+	}
+
+	return newGenerator(env, cfg, mix)
+}
+
+// newGenerator creates the load generator of the validated mix.
+func newGenerator(env *diameter.Diameter, cfg Config, mix *Mix) (*Generator, error) {
+	g := &Generator{
+		env:       env,
+		cfg:       cfg,
+		slots:     make(chan struct{}, cfg.Concurrency),
+		pending:   make(map[pendingKey]request),
+		results:   make(map[uint32]uint64),
+		connected: make(map[*node.Node]time.Time),
+		abandon:   make(chan struct{}),
+	}
+
+	for _, name := range mix.Peers {
+		peer, err := env.Peers().GetByName(name)
+		if err != nil {
+			return nil, err
+		}
+		g.peers = append(g.peers, peer)
+	}
+
+	total := 0.0
+	for _, mixEntry := range mix.Entries {
+		e := &entry{MixEntry: mixEntry, results: make(map[uint32]uint64)}
+		g.entries = append(g.entries, e)
+		if e.rate > 0 {
+			continue
+		}
+		total += e.Weight
+		g.weighted = append(g.weighted, e)
+		g.cumulative = append(g.cumulative, total)
+	}
+
+	return g, nil
+}
+
+// Methods
+//
+
+// Config returns the load configuration.
+func (g *Generator) Config() Config {
+	return g.cfg
+}
+
+// Run connects the peers if needed and sends the requests until the load phases are completed
+// or the context is canceled. The weighted entries are sent at the load rate, each entry with
+// the own rate is sent at its rate. The errors do not stop the load, they are counted.
+// The soak run reconnects the peers every Reconnect interval; the leak guards stop the load
+// with ErrLeakGuard. The outstanding requests are awaited up to the answer timeout before return,
+// Abandon stops the waiting.
+func (g *Generator) Run(ctx context.Context) error {
+	for _, peer := range g.peers {
+		if !peer.IsOpen() {
+			if err := peer.Connect(); err != nil {
+				return err
+			}
+		}
+		peer.SetCallback(g.receive)
+		defer peer.SetCallback(nil)
+	}
+
+	g.mu.Lock()
+	g.start = time.Now()
+	g.mu.Unlock()
+
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go g.sweep(sweepCtx)
+
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	go guard(ctx, &g.cfg, stop)
+	if g.cfg.Reconnect > 0 {
+		go g.cycle(ctx)
+	}
+
+	var wg sync.WaitGroup
+	if len(g.weighted) > 0 {
+		wg.Add(1)
+		go g.lane(ctx, &wg, g.cfg, nil)
+	}
+	for _, e := range g.entries {
+		if e.rate > 0 {
+			wg.Add(1)
+			go g.lane(ctx, &wg, g.entryConfig(e), e)
+		}
+	}
+	wg.Wait()
+
+	g.setPhase(PhaseDrain)
+	g.await()
+	g.setPhase(PhaseDone)
+
+	return guardError(ctx)
+}
+
+// Abandon stops the waiting for the outstanding requests after the sending is stopped,
+// e.g. on the second Ctrl-C. The outstanding requests are counted as abandoned.
+func (g *Generator) Abandon() {
+	g.abandonOnce.Do(func() { close(g.abandon) })
+}
+
+// Stats returns the snapshot of the load counters.
+func (g *Generator) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := Stats{
+		Phase:       g.phase,
+		Sent:        g.sent.Load(),
+		Answered:    g.answered.Load(),
+		Timeouts:    g.timeouts.Load(),
+		Errors:      g.errors.Load(),
+		Unexpected:  g.unexpected.Load(),
+		Missed:      g.missed.Load(),
+		Abated:      g.abated.Load(),
+		Reconnects:  g.reconnects.Load(),
+		Dropped:     g.dropped.Load(),
+		Abandoned:   g.abandoned.Load(),
+		Outstanding: len(g.pending),
+		Results:     maps.Clone(g.results),
+		Latency:     g.latency,
+		LastError:   g.lastErr,
+		Entries:     make([]EntryStats, 0, len(g.entries)),
+	}
+
+	// the target rates are known while the requests are sent
+	sending, weighted := false, 0.0
+	if !g.start.IsZero() {
+		stats.Elapsed = time.Since(g.start)
+		if stats.Phase == "" {
+			sending = true
+			stats.Phase, weighted = g.cfg.Phase(stats.Elapsed)
+		}
+	}
+
+	for _, e := range g.entries {
+		rate := 0.0
+		switch {
+		case !sending:
+		case e.rate > 0:
+			cfg := g.entryConfig(e)
+			_, rate = cfg.Phase(stats.Elapsed)
+		default:
+			rate = weighted * e.Weight / g.cumulative[len(g.cumulative)-1]
+		}
+		stats.Rate += rate
+
+		stats.Entries = append(stats.Entries, EntryStats{
+			Name:     e.Name,
+			Rate:     rate,
+			Sent:     e.sent.Load(),
+			Answered: e.answered.Load(),
+			Timeouts: e.timeouts.Load(),
+			Errors:   e.errors.Load(),
+			Results:  maps.Clone(e.results),
+			Latency:  e.latency,
+		})
+	}
+
+	return stats
+}
+
+// Collect adds the load metrics: the phase, the target rate, the load counters and the latency,
+// the counters and the latency by the mix entry.
+func (g *Generator) Collect(w *metrics.Writer) {
+	stats := g.Stats()
+
+	for _, phase := range []string{PhaseRampUp, PhaseSteady, PhaseRampDown, PhaseProfile, PhaseDrain, PhaseDone} {
+		current := 0.0
+		if phase == stats.Phase {
+			current = 1
+		}
+		w.Gauge("tgdp_load_phase", "Current load phase", current, "phase", phase)
+	}
+	w.Gauge("tgdp_load_target_rate", "Target rate of the requests per second", stats.Rate)
+	w.Gauge("tgdp_load_outstanding", "Load requests waiting for the answers", float64(stats.Outstanding))
+	w.Counter("tgdp_load_requests_sent_total", "Load requests sent", float64(stats.Sent))
+	w.Counter("tgdp_load_answers_total", "Load requests answered", float64(stats.Answered))
+	w.Counter("tgdp_load_timeouts_total", "Load requests without the answer within the timeout", float64(stats.Timeouts))
+	w.Counter("tgdp_load_errors_total", "Load requests failed to build or send and undecodable answers",
+		float64(stats.Errors))
+	w.Counter("tgdp_load_unexpected_total", "Received messages other than the load answers", float64(stats.Unexpected))
+	w.Counter("tgdp_load_missed_total", "Load requests not sent in time for the target rate", float64(stats.Missed))
+	w.Counter("tgdp_load_abated_total", "Load requests abated by the overload control", float64(stats.Abated))
+	w.Counter("tgdp_load_reconnects_total", "Peer reconnections of the soak run", float64(stats.Reconnects))
+	w.Counter("tgdp_load_dropped_total", "Outstanding load requests dropped by the reconnections",
+		float64(stats.Dropped))
+	w.Histogram("tgdp_load_latency_seconds", "Load request to answer latency", &stats.Latency)
+
+	for _, e := range stats.Entries {
+		w.Gauge("tgdp_load_entry_target_rate", "Target rate of the mix entry requests per second", e.Rate,
+			"entry", e.Name)
+		w.Counter("tgdp_load_entry_requests_sent_total", "Mix entry requests sent", float64(e.Sent), "entry", e.Name)
+		w.Counter("tgdp_load_entry_answers_total", "Mix entry requests answered", float64(e.Answered), "entry", e.Name)
+		w.Counter("tgdp_load_entry_timeouts_total", "Mix entry requests without the answer within the timeout",
+			float64(e.Timeouts), "entry", e.Name)
+		w.Counter("tgdp_load_entry_errors_total", "Mix entry requests failed to build or send and undecodable answers",
+			float64(e.Errors), "entry", e.Name)
+		w.Histogram("tgdp_load_entry_latency_seconds", "Mix entry request to answer latency", &e.Latency,
+			"entry", e.Name)
+	}
+}
+
+// String returns the one line text of the load counters and the latency.
+func (s Stats) String() string {
+	return fmt.Sprintf("[%6s] %-9s rate %8.1f/s  sent %d  answered %d  timeouts %d  errors %d  missed %d  outstanding %d  %s",
+		s.Elapsed.Truncate(time.Second), s.Phase, s.Rate, s.Sent, s.Answered, s.Timeouts, s.Errors, s.Missed,
+		s.Outstanding, &s.Latency)
+}
+
+// String returns the one line text of the mix entry counters and the latency.
+func (s EntryStats) String() string {
+	return fmt.Sprintf("%-16s rate %8.1f/s  sent %d  answered %d  timeouts %d  errors %d  %s",
+		s.Name, s.Rate, s.Sent, s.Answered, s.Timeouts, s.Errors, &s.Latency)
+}
+
+// Helpers
+//
+
+// lane sends the requests at the rate of the load phases until they are completed or the context is canceled.
+// The nil entry picks the weighted entry for each request.
+func (g *Generator) lane(ctx context.Context, wg *sync.WaitGroup, cfg Config, e *entry) {
+	defer wg.Done()
+
+	lim := newLimiter(&cfg)
+	for {
+		if err := lim.wait(ctx); err != nil {
+			return
+		}
+		g.missed.Add(lim.takeMissed())
+
+		if !takeSlot(ctx, g.slots, cfg.OpenLoop) {
+			if ctx.Err() != nil {
+				return
+			}
+			g.missed.Add(1)
+			continue
+		}
+
+		if e != nil {
+			g.send(e)
+		} else {
+			g.send(g.weighted[pick(g.cumulative, rand.Float64()*g.cumulative[len(g.cumulative)-1])])
+		}
+	}
+}
+
+// entryConfig returns the load configuration of the entry with the own rate, the rate follows the load phases.
+// With the rate profile the own rate is the rate at the profile peak.
+func (g *Generator) entryConfig(e *entry) Config {
+	cfg := g.cfg
+	cfg.Rate = e.rate
+	if cfg.Profile != nil {
+		cfg.scale = e.rate / cfg.Profile.Peak()
+	}
+
+	return cfg
+}
+
+// send builds and sends the request of the entry to the next peer, the slot is taken by the caller.
+func (g *Generator) send(e *entry) {
+	g.cycleMu.RLock()
+	defer g.cycleMu.RUnlock()
+
+	peer := g.peers[(g.next.Add(1)-1)%uint64(len(g.peers))]
+	if !peer.IsOpen() && !g.reconnect(peer) {
+		g.fail(e, &diwe.ErrNotConnected{Peer: peer.Name})
+		return
+	}
+
+	msg, err := g.env.NewProfileMessage(e.profile, peer.Name, e.App, e.Cmd, true, true)
+	if err != nil {
+		g.fail(e, err)
+		return
+	}
+	defer msg.Release()
+
+	// the overload control is applied before the request is serialized for the PCAP
+	if err := g.env.AdmitRequest(peer, msg); err != nil {
+		if diwe.Is[*diwe.ErrOverloadAbated](err) {
+			<-g.slots
+			g.abated.Add(1)
+			return
+		}
+		g.fail(e, err)
+		return
+	}
+
+	// the Hop-by-Hop Identifier must be unique among the outstanding requests of the peer
+	g.mu.Lock()
+	key := pendingKey{peer: peer, hopByHop: msg.HopByHop}
+	for _, busy := g.pending[key]; busy; _, busy = g.pending[key] {
+		key.hopByHop++
+	}
+	msg.HopByHop = key.hopByHop
+	g.pending[key] = request{sent: time.Now(), entry: e}
+	g.mu.Unlock()
+
+	data, err := msg.Serialize()
+	if err == nil {
+		g.writePcap(data, peer, pcap.DirOutgoing)
+		err = g.env.SendMessage(peer, msg)
+	}
+	if err != nil {
+		g.mu.Lock()
+		_, exists := g.pending[key]
+		delete(g.pending, key)
+		g.mu.Unlock()
+		if exists {
+			g.fail(e, err)
+		}
+		return
+	}
+
+	g.sent.Add(1)
+	e.sent.Add(1)
+}
+
+// receive is the peer callback: matches the answer to the outstanding request.
+// All received messages are consumed, they are not passed to RecvFrom.
+func (g *Generator) receive(data []byte, peer *node.Node) bool {
+	_, _, _, _, flags, hopByHop, _, err := g.env.MessageHeader(data)
+	if err != nil || g.env.IsRequest(flags) {
+		g.unexpected.Add(1)
+		return true
+	}
+
+	key := pendingKey{peer: peer, hopByHop: hopByHop}
+	g.mu.Lock()
+	req, exists := g.pending[key]
+	delete(g.pending, key)
+	if exists {
+		latency := time.Since(req.sent)
+		g.latency.Add(latency)
+		req.entry.latency.Add(latency)
+	}
+	g.mu.Unlock()
+	if !exists {
+		// late answer of the timed out request or unknown Hop-by-Hop Identifier
+		g.unexpected.Add(1)
+		return true
+	}
+	<-g.slots
+	g.writePcap(data, peer, pcap.DirIncoming)
+
+	msg, err := g.env.BytesToMessage(data)
+	if err != nil {
+		g.errors.Add(1)
+		req.entry.errors.Add(1)
+		g.setError(err)
+		return true
+	}
+	code, _, _ := msg.ResultCode()
+	msg.Release()
+
+	g.mu.Lock()
+	g.results[code]++
+	req.entry.results[code]++
+	g.mu.Unlock()
+	g.answered.Add(1)
+	req.entry.answered.Add(1)
+
+	return true
+}
+
+// await waits for the answers to the outstanding requests, they are expired by the sweep.
+// Abandon stops the waiting, the outstanding requests are forgotten.
+func (g *Generator) await() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for g.Stats().Outstanding > 0 {
+		select {
+		case <-g.abandon:
+			g.mu.Lock()
+			g.abandoned.Store(uint64(len(g.pending)))
+			clear(g.pending)
+			g.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep expires the outstanding requests without the answer within the timeout.
+func (g *Generator) sweep(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired := 0
+			g.mu.Lock()
+			for key, req := range g.pending {
+				if now.Sub(req.sent) > g.cfg.Timeout {
+					delete(g.pending, key)
+					req.entry.timeouts.Add(1)
+					expired++
+				}
+			}
+			g.mu.Unlock()
+
+			for range expired {
+				<-g.slots
+			}
+			g.timeouts.Add(uint64(expired))
+		}
+	}
+}
+
+// reconnect connects the lost peer, the attempts are not made more often than reconnectDelay.
+func (g *Generator) reconnect(peer *node.Node) bool {
+	g.mu.Lock()
+	if time.Since(g.connected[peer]) < reconnectDelay {
+		g.mu.Unlock()
+		return false
+	}
+	g.connected[peer] = time.Now()
+	g.mu.Unlock()
+
+	if err := peer.Connect(); err != nil {
+		g.setError(err)
+		return false
+	}
+
+	return true
+}
+
+// fail counts the failed request of the entry and releases its slot.
+func (g *Generator) fail(e *entry, err error) {
+	<-g.slots
+	g.errors.Add(1)
+	e.errors.Add(1)
+	g.setError(err)
+}
+
+// setError keeps the last error text for the progress report.
+func (g *Generator) setError(err error) {
+	g.mu.Lock()
+	g.lastErr = err.Error()
+	g.mu.Unlock()
+}
+
+// check checks the rate or the rate profile, the concurrency and the durations, the zero Concurrency
+// and Timeout are set to the defaults.
+func (c *Config) check() error {
+	if c.Profile != nil {
+		if c.Rate != 0 || c.RampUp != 0 || c.RampDown != 0 {
+			return &diwe.ErrInvalidLoadConfig{Param: "rate", Reason: "the rate and the ramps are set by the rate profile"}
+		}
+	} else if c.Rate <= 0 {
+		return &diwe.ErrInvalidLoadConfig{Param: "rate", Reason: "must be positive"}
+	}
+
+	return c.checkLimits()
+}
+
+// checkLimits checks the concurrency and the durations, the zero Concurrency and Timeout
+// are set to the defaults.
+func (c *Config) checkLimits() error {
+	if c.Concurrency == 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if c.Concurrency < 0 {
+		return &diwe.ErrInvalidLoadConfig{Param: "concurrency", Reason: "must be positive"}
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Timeout < 0 || c.Duration < 0 || c.RampUp < 0 || c.RampDown < 0 || c.Reconnect < 0 {
+		return &diwe.ErrInvalidLoadConfig{Param: "duration", Reason: "must not be negative"}
+	}
+	if c.MaxGoroutines < 0 {
+		return &diwe.ErrInvalidLoadConfig{Param: "max-goroutines", Reason: "must not be negative"}
+	}
+
+	return nil
+}
+
+// setPhase sets the phase after the requests are sent.
+func (g *Generator) setPhase(phase string) {
+	g.mu.Lock()
+	g.phase = phase
+	g.mu.Unlock()
+}
+
+// writePcap writes the message of the peer to the PCAP file if it is open.
+func (g *Generator) writePcap(data []byte, peer *node.Node, dir bool) {
+	pcapWriter := g.env.Pcap()
+	if !pcapWriter.IsOpen() {
+		return
+	}
+
+	g.pcapMu.Lock()
+	defer g.pcapMu.Unlock()
+	if err := pcapWriter.Write(data, peer, dir); err != nil {
+		g.setError(err)
+	}
+}
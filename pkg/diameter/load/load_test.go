@@ -0,0 +1,36 @@
+package load
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"tgdp/pkg/diameter/net/node"
+)
+
+func TestAbandon(t *testing.T) {
+	fmt.Println(">>> Load abandon test")
+
+	g := &Generator{pending: make(map[pendingKey]request), abandon: make(chan struct{})}
+	g.pending[pendingKey{peer: &node.Node{Name: "hss"}, hopByHop: 1}] = request{sent: time.Now()}
+
+	// the waiting for the outstanding requests is stopped by Abandon, Abandon is repeatable
+	done := make(chan struct{})
+	go func() {
+		g.await()
+		close(done)
+	}()
+	g.Abandon()
+	g.Abandon()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Outstanding requests are awaited after Abandon")
+	}
+	if stats := g.Stats(); stats.Outstanding != 0 || stats.Abandoned != 1 {
+		t.Fatalf("Outstanding %d, abandoned %d", stats.Outstanding, stats.Abandoned)
+	}
+
+	fmt.Println("<<< Load abandon test")
+}
@@ -0,0 +1,222 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: mix.go
+// Description: Diameter pkg: weighted traffic mix of the load
+//
+
+package load
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Types
+//
+
+// Mix is the traffic mix of the load: the requests of the entries are sent to the peers in turn.
+// The entries without the own rate share the load rate by their weights, the entries with the own rate
+// are sent at that rate in addition to the load rate:
+//
+//	peers: [hss1, hss2]
+//	entries:
+//	  - { app: S6a, cmd: AI, weight: 40 }
+//	  - { app: S6a, cmd: UL, weight: 30, profile: ulr-roaming.yaml }
+//	  - { name: Sh-UDR, app: Sh, cmd: UD, rate: 5/s }
+type Mix struct {
+	// Peers are the peer names the requests are sent to in turn
+	Peers []string `yaml:"peers"`
+	// Entries are the requests of the mix
+	Entries []MixEntry `yaml:"entries"`
+
+	file string
+}
+
+// MixEntry is the request of the mix.
+type MixEntry struct {
+	// Name is the entry name of the counters, "<app>/<command>R" by default
+	Name string `yaml:"name"`
+	// App is the application name or ID
+	App string `yaml:"app"`
+	// Cmd is the command short name or code
+	Cmd string `yaml:"cmd"`
+	// Weight is the share of the load rate, 1 by default
+	Weight float64 `yaml:"weight"`
+	// Rate is the own rate of the entry <number>[/s | /m | /h], the weight is not used
+	Rate string `yaml:"rate"`
+	// Profile is the AVP profile file on top of the peer and command profiles,
+	// the relative path is relative to the mix file
+	Profile string `yaml:"profile"`
+
+	rate    float64
+	profile *diameter.AvpStore
+}
+
+// Functions
+//
+
+// LoadMix reads and validates the mix file, the AVP profiles of the entries are loaded.
+func LoadMix(env *diameter.Diameter, file string) (*Mix, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	mix, err := ParseMix(data, file)
+	if err != nil {
+		return nil, err
+	}
+	if err := mix.Validate(env); err != nil {
+		return nil, err
+	}
+
+	return mix, nil
+}
+
+// ParseMix parses the mix YAML, the file name is used for the errors and the profile paths.
+func ParseMix(data []byte, file string) (*Mix, error) {
+	mix := &Mix{file: file}
+	if err := yaml.Unmarshal(data, mix); err != nil {
+		return nil, &diwe.ErrInvalidMix{File: file, Reason: err.Error()}
+	}
+
+	if len(mix.Peers) == 0 {
+		return nil, &diwe.ErrInvalidMix{File: file, Reason: "no peers"}
+	}
+	if len(mix.Entries) == 0 {
+		return nil, &diwe.ErrInvalidMix{File: file, Reason: "no entries"}
+	}
+
+	for i := range mix.Entries {
+		if err := mix.Entries[i].parse(); err != nil {
+			return nil, &diwe.ErrInvalidMix{File: file, Entry: i + 1, Reason: err.Error()}
+		}
+	}
+
+	return mix, nil
+}
+
+// Methods
+//
+
+// File returns the mix file name.
+func (m *Mix) File() string {
+	return m.file
+}
+
+// Validate checks the applications, the commands and the peers, sets the default entry names
+// and loads the AVP profiles of the entries.
+func (m *Mix) Validate(env *diameter.Diameter) error {
+	for _, name := range m.Peers {
+		if _, err := env.Peers().GetByName(name); err != nil {
+			return &diwe.ErrInvalidMix{File: m.file, Reason: err.Error()}
+		}
+	}
+
+	names := make(map[string]int)
+	for i := range m.Entries {
+		entry := &m.Entries[i]
+		if err := entry.validate(env, filepath.Dir(m.file)); err != nil {
+			return &diwe.ErrInvalidMix{File: m.file, Entry: i + 1, Reason: err.Error()}
+		}
+
+		if prev, exists := names[entry.Name]; exists {
+			return &diwe.ErrInvalidMix{File: m.file, Entry: i + 1,
+				Reason: fmt.Sprintf("name '%s' is used by entry %d", entry.Name, prev)}
+		}
+		names[entry.Name] = i + 1
+	}
+
+	return nil
+}
+
+// Weighted reports whether the mix has the entries which share the load rate.
+func (m *Mix) Weighted() bool {
+	for i := range m.Entries {
+		if m.Entries[i].rate == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Helpers
+//
+
+// parse checks the entry fields and parses the own rate.
+func (e *MixEntry) parse() error {
+	if e.App == "" || e.Cmd == "" {
+		return fmt.Errorf("'app' and 'cmd' expected")
+	}
+	if e.Weight < 0 {
+		return fmt.Errorf("negative weight")
+	}
+
+	if e.Rate == "" {
+		if e.Weight == 0 {
+			e.Weight = 1
+		}
+		return nil
+	}
+	if e.Weight != 0 {
+		return fmt.Errorf("either 'weight' or 'rate' expected")
+	}
+
+	rate, err := ParseRate(e.Rate)
+	if err != nil {
+		return err
+	}
+	e.rate = rate
+
+	return nil
+}
+
+// validate checks the application and the command, sets the default name and loads the profile,
+// the relative profile path is relative to the dir.
+func (e *MixEntry) validate(env *diameter.Diameter, dir string) error {
+	app, err := env.Dict().GetApp(e.App)
+	if err != nil {
+		return err
+	}
+	cmd, err := env.Dict().GetCmd(e.Cmd, app)
+	if err != nil {
+		return err
+	}
+	if e.Name == "" {
+		e.Name = fmt.Sprintf("%s/%sR", app.Name, cmd.Short)
+	}
+
+	if e.Profile == "" {
+		return nil
+	}
+
+	file := e.Profile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	store := diameter.NewAvpStore(env)
+	if err := store.LoadFromFile(file, diameter.AvpStoreAppend, 0); err != nil {
+		return fmt.Errorf("profile %s: %w", e.Profile, err)
+	}
+	e.profile = &store
+
+	return nil
+}
+
+// pick returns the index of the weight range [cumulative[i-1], cumulative[i]) which x falls in,
+// x is in [0, total weight).
+func pick(cumulative []float64, x float64) int {
+	i := sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > x })
+	return min(i, len(cumulative)-1)
+}
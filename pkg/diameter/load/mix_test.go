@@ -0,0 +1,66 @@
+package load
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMix(t *testing.T) {
+	fmt.Println(">>> Load mix test")
+
+	mix, err := ParseMix([]byte(`
+peers: [hss1, hss2]
+entries:
+  - { app: S6a, cmd: AI, weight: 40 }
+  - { app: S6a, cmd: UL, weight: 30, profile: ulr.yaml }
+  - { app: S6a, cmd: NO }
+  - { name: Sh-UDR, app: Sh, cmd: UD, rate: 300/m }
+`), "mix.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mix.Peers) != 2 || len(mix.Entries) != 4 || !mix.Weighted() {
+		t.Fatalf("Mix: %+v", mix)
+	}
+	if mix.Entries[2].Weight != 1 || mix.Entries[3].rate != 5 || mix.Entries[1].Profile != "ulr.yaml" {
+		t.Fatalf("Mix entries: %+v", mix.Entries)
+	}
+
+	rated, err := ParseMix([]byte("peers: [hss]\nentries:\n  - { app: S6a, cmd: AI, rate: 10 }\n"), "rated.yaml")
+	if err != nil || rated.Weighted() {
+		t.Fatalf("Rated mix: %v %v", rated, err)
+	}
+
+	for _, text := range []string{
+		"entries:\n  - { app: S6a, cmd: AI }\n",
+		"peers: [hss]\n",
+		"peers: [hss]\nentries:\n  - { app: S6a }\n",
+		"peers: [hss]\nentries:\n  - { app: S6a, cmd: AI, weight: -1 }\n",
+		"peers: [hss]\nentries:\n  - { app: S6a, cmd: AI, weight: 2, rate: 10/s }\n",
+		"peers: [hss]\nentries:\n  - { app: S6a, cmd: AI, rate: fast }\n",
+		"peers: hss\n",
+	} {
+		if _, err := ParseMix([]byte(text), "bad.yaml"); err == nil {
+			t.Fatalf("Invalid mix accepted:\n%s", text)
+		} else {
+			fmt.Println(err)
+		}
+	}
+
+	// 40%, 30%, 20%, 10%
+	cumulative := []float64{40, 70, 90, 100}
+	for x, want := range map[float64]int{0: 0, 39.9: 0, 40: 1, 69: 1, 70: 2, 95: 3, 99.99: 3} {
+		if i := pick(cumulative, x); i != want {
+			t.Fatalf("Pick %.2f: %d, expected %d", x, i, want)
+		}
+	}
+
+	counts := make([]int, len(cumulative))
+	for x := range 1000 {
+		counts[pick(cumulative, float64(x)/10)]++
+	}
+	fmt.Printf("Picks of 1000: %v\n", counts)
+	if counts[0] != 400 || counts[1] != 300 || counts[2] != 200 || counts[3] != 100 {
+		t.Fatalf("Picks: %v", counts)
+	}
+}
@@ -0,0 +1,442 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: profile.go
+// Description: Diameter pkg: time-based load rate profiles
+//
+
+package load
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+// Rate profile segment kinds
+const (
+	SegmentRamp   = "ramp"
+	SegmentStep   = "step"
+	SegmentSine   = "sine"
+	SegmentPoints = "points"
+	SegmentReplay = "replay"
+)
+
+// Rate profile interpolations between the points
+const (
+	InterpolateStep   = "step"
+	InterpolateLinear = "linear"
+)
+
+// DefaultReplayInterval is the default interval of the replayed rate rows
+const DefaultReplayInterval = time.Second
+
+// csvExt is the extension of the rate file which is replayed without the profile YAML
+const csvExt = ".csv"
+
+// Types
+//
+
+// RateProfile is the target rate curve of the load: the segments run in order,
+// the profile is completed after the last segment unless it repeats:
+//
+//	repeat: false
+//	segments:
+//	  - { ramp: 0 500/s, duration: 10m }
+//	  - { step: 500/s, duration: 30m }
+//	  - { sine: 500/s 300/s, period: 1h, duration: 2h }
+//	  - { points: [[0s, 500/s], [5m, 900/s], [10m, 500/s]], interpolate: linear }
+//	  - { replay: busy-hour.csv, interval: 1s }
+type RateProfile struct {
+	// Repeat restarts the profile after the last segment
+	Repeat bool `yaml:"repeat"`
+	// Segments are the parts of the rate curve
+	Segments []Segment `yaml:"segments"`
+
+	file     string
+	duration time.Duration
+	peak     float64
+}
+
+// Segment is the part of the rate curve, it has exactly one of the kinds:
+// ramp, step, sine, points and replay.
+type Segment struct {
+	// Ramp is the linear ramp "<from> <to>" over the duration
+	Ramp string `yaml:"ramp"`
+	// Step is the constant rate over the duration
+	Step string `yaml:"step"`
+	// Sine is the sinusoid "<mean> <amplitude>" over the duration, the rate is not negative
+	Sine string `yaml:"sine"`
+	// Points are the [time, rate] points, the duration is the last point time if not set
+	Points [][2]string `yaml:"points"`
+	// Replay is the CSV file of the measured rates, one row per interval,
+	// the relative path is relative to the profile file
+	Replay string `yaml:"replay"`
+
+	// Duration is the segment duration
+	Duration time.Duration `yaml:"duration"`
+	// Period is the sine period, the duration by default
+	Period time.Duration `yaml:"period"`
+	// Shift is the sine phase shift: the time of the mean rate on the rise
+	Shift time.Duration `yaml:"shift"`
+	// Interpolate is the rate between the points and the replayed rows: step or linear
+	Interpolate string `yaml:"interpolate"`
+	// Interval is the time of the replayed row, DefaultReplayInterval by default
+	Interval time.Duration `yaml:"interval"`
+	// Column is the CSV header column of the replayed rates, the last column by default
+	Column string `yaml:"column"`
+	// Scale multiplies the replayed rates, 1 by default
+	Scale float64 `yaml:"scale"`
+
+	kind   string
+	times  []time.Duration // point times of the piecewise segments
+	rates  []float64       // point rates of the piecewise segments
+	linear bool
+	mean   float64
+	amp    float64
+}
+
+// Functions
+//
+
+// LoadRateProfile reads the rate profile file. The CSV file is replayed as the single segment
+// of the last column rates per second.
+func LoadRateProfile(file string) (*RateProfile, error) {
+	if strings.EqualFold(filepath.Ext(file), csvExt) {
+		profile := &RateProfile{file: file, Segments: []Segment{{Replay: filepath.Base(file)}}}
+		if err := profile.parse(); err != nil {
+			return nil, err
+		}
+		return profile, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRateProfile(data, file)
+}
+
+// ParseRateProfile parses the rate profile YAML, the file name is used for the errors and the replay paths.
+func ParseRateProfile(data []byte, file string) (*RateProfile, error) {
+	profile := &RateProfile{file: file}
+	if err := yaml.Unmarshal(data, profile); err != nil {
+		return nil, &diwe.ErrInvalidRateProfile{File: file, Reason: err.Error()}
+	}
+
+	if err := profile.parse(); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// Methods
+//
+
+// File returns the rate profile file name.
+func (p *RateProfile) File() string {
+	return p.file
+}
+
+// Duration returns the duration of the profile segments.
+func (p *RateProfile) Duration() time.Duration {
+	return p.duration
+}
+
+// Peak returns the maximum rate of the profile.
+func (p *RateProfile) Peak() float64 {
+	return p.peak
+}
+
+// Rate returns the target rate at the elapsed time since the load start.
+// Returns false when the profile is completed.
+func (p *RateProfile) Rate(elapsed time.Duration) (float64, bool) {
+	if elapsed >= p.duration {
+		if !p.Repeat {
+			return 0, false
+		}
+		elapsed %= p.duration
+	}
+
+	for i := range p.Segments {
+		seg := &p.Segments[i]
+		if elapsed < seg.Duration {
+			return seg.rate(elapsed), true
+		}
+		elapsed -= seg.Duration
+	}
+
+	return 0, false
+}
+
+// Kind returns the segment kind.
+func (seg *Segment) Kind() string {
+	return seg.kind
+}
+
+// Helpers
+//
+
+// parse checks the segments and computes the duration and the peak rate.
+func (p *RateProfile) parse() error {
+	if len(p.Segments) == 0 {
+		return &diwe.ErrInvalidRateProfile{File: p.file, Reason: "no segments"}
+	}
+
+	p.duration, p.peak = 0, 0
+	for i := range p.Segments {
+		seg := &p.Segments[i]
+		if err := seg.parse(filepath.Dir(p.file)); err != nil {
+			return &diwe.ErrInvalidRateProfile{File: p.file, Segment: i + 1, Reason: err.Error()}
+		}
+		p.duration += seg.Duration
+		p.peak = max(p.peak, seg.peak())
+	}
+
+	if p.peak == 0 {
+		return &diwe.ErrInvalidRateProfile{File: p.file, Reason: "zero rate"}
+	}
+
+	return nil
+}
+
+// parse sets the segment kind and its points or sine, the relative replay path is relative to the dir.
+func (seg *Segment) parse(dir string) error {
+	kinds := []string{}
+	for kind, set := range map[string]bool{
+		SegmentRamp:   seg.Ramp != "",
+		SegmentStep:   seg.Step != "",
+		SegmentSine:   seg.Sine != "",
+		SegmentPoints: len(seg.Points) > 0,
+		SegmentReplay: seg.Replay != "",
+	} {
+		if set {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) != 1 {
+		return fmt.Errorf("exactly one of 'ramp', 'step', 'sine', 'points' and 'replay' expected, got %d", len(kinds))
+	}
+	seg.kind = kinds[0]
+
+	if seg.Duration < 0 || seg.Period < 0 || seg.Interval < 0 {
+		return fmt.Errorf("negative duration")
+	}
+	switch seg.Interpolate {
+	case "":
+		seg.linear = seg.kind == SegmentPoints
+	case InterpolateStep:
+		seg.linear = false
+	case InterpolateLinear:
+		seg.linear = true
+	default:
+		return fmt.Errorf("unknown interpolation '%s', expected step or linear", seg.Interpolate)
+	}
+
+	var err error
+	switch seg.kind {
+	case SegmentRamp:
+		seg.rates, err = parseRates(seg.Ramp, 2)
+		seg.times, seg.linear = []time.Duration{0, seg.Duration}, true
+	case SegmentStep:
+		seg.rates, err = parseRates(seg.Step, 1)
+		seg.times = []time.Duration{0}
+	case SegmentSine:
+		err = seg.parseSine()
+	case SegmentPoints:
+		err = seg.parsePoints()
+	case SegmentReplay:
+		err = seg.parseReplay(dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if seg.Duration == 0 {
+		return fmt.Errorf("'duration' expected")
+	}
+
+	return nil
+}
+
+// parseSine parses the mean and the amplitude of the sine, the period is the duration by default.
+func (seg *Segment) parseSine() error {
+	rates, err := parseRates(seg.Sine, 2)
+	if err != nil {
+		return err
+	}
+	seg.mean, seg.amp = rates[0], rates[1]
+
+	if seg.Period == 0 {
+		seg.Period = seg.Duration
+	}
+
+	return nil
+}
+
+// parsePoints parses the [time, rate] points, the times must grow from zero.
+func (seg *Segment) parsePoints() error {
+	for i, point := range seg.Points {
+		at, err := time.ParseDuration(point[0])
+		if err != nil {
+			return fmt.Errorf("point %d: %w", i+1, err)
+		}
+		if (i == 0 && at != 0) || (i > 0 && at <= seg.times[i-1]) {
+			return fmt.Errorf("point %d: the times must grow from 0s", i+1)
+		}
+
+		rate, err := parseRate(point[1], true)
+		if err != nil {
+			return fmt.Errorf("point %d: %w", i+1, err)
+		}
+		seg.times = append(seg.times, at)
+		seg.rates = append(seg.rates, rate)
+	}
+
+	if seg.Duration == 0 {
+		seg.Duration = seg.times[len(seg.times)-1]
+	}
+
+	return nil
+}
+
+// parseReplay reads the rates of the CSV file, the header line is optional.
+func (seg *Segment) parseReplay(dir string) error {
+	if seg.Interval == 0 {
+		seg.Interval = DefaultReplayInterval
+	}
+	if seg.Scale < 0 {
+		return fmt.Errorf("negative scale")
+	}
+	if seg.Scale == 0 {
+		seg.Scale = 1
+	}
+
+	file := seg.Replay
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close() //nolint:errcheck
+
+	reader := csv.NewReader(fd)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	column := -1
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// the header line selects the column
+		if line == 1 {
+			if index := slices.Index(record, seg.Column); index >= 0 && seg.Column != "" {
+				column = index
+				continue
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(record[len(record)-1]), 64); err != nil {
+				if seg.Column != "" {
+					return fmt.Errorf("%s: no column '%s'", seg.Replay, seg.Column)
+				}
+				continue
+			}
+			if seg.Column != "" {
+				return fmt.Errorf("%s: header line expected for column '%s'", seg.Replay, seg.Column)
+			}
+		}
+
+		index := column
+		if index < 0 || index >= len(record) {
+			index = len(record) - 1
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[index]), 64)
+		if err != nil || rate < 0 {
+			return fmt.Errorf("%s line %d: invalid rate '%s'", seg.Replay, line, record[index])
+		}
+		seg.times = append(seg.times, time.Duration(len(seg.times))*seg.Interval)
+		seg.rates = append(seg.rates, rate*seg.Scale)
+	}
+
+	if len(seg.rates) == 0 {
+		return fmt.Errorf("%s: no rates", seg.Replay)
+	}
+	if seg.Duration == 0 {
+		seg.Duration = time.Duration(len(seg.rates)) * seg.Interval
+	}
+
+	return nil
+}
+
+// rate returns the rate at the elapsed time since the segment start.
+func (seg *Segment) rate(elapsed time.Duration) float64 {
+	if seg.kind == SegmentSine {
+		angle := 2 * math.Pi * float64(elapsed-seg.Shift) / float64(seg.Period)
+		return max(0, seg.mean+seg.amp*math.Sin(angle))
+	}
+
+	// the last point at or before the elapsed time
+	i, found := slices.BinarySearch(seg.times, elapsed)
+	if !found {
+		i--
+	}
+	if !seg.linear || i == len(seg.times)-1 {
+		return seg.rates[i]
+	}
+
+	span := float64(seg.times[i+1] - seg.times[i])
+	return seg.rates[i] + (seg.rates[i+1]-seg.rates[i])*float64(elapsed-seg.times[i])/span
+}
+
+// peak returns the maximum rate of the segment.
+func (seg *Segment) peak() float64 {
+	if seg.kind == SegmentSine {
+		return max(0, seg.mean+math.Abs(seg.amp))
+	}
+	return slices.Max(seg.rates)
+}
+
+// parseRates parses the space separated rates, zero rates are allowed.
+func parseRates(text string, count int) ([]float64, error) {
+	fields := strings.Fields(text)
+	if len(fields) != count {
+		return nil, fmt.Errorf("'%s': %d rates expected", text, count)
+	}
+
+	rates := make([]float64, count)
+	for i, field := range fields {
+		rate, err := parseRate(field, true)
+		if err != nil {
+			return nil, err
+		}
+		rates[i] = rate
+	}
+
+	return rates, nil
+}
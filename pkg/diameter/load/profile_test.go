@@ -0,0 +1,105 @@
+package load
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateProfile(t *testing.T) {
+	fmt.Println(">>> Load rate profile test")
+
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "busy-hour.csv")
+	if err := os.WriteFile(csvFile, []byte("time,rate\n00:00,100\n00:01,200\n00:02,300\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := ParseRateProfile([]byte(`
+segments:
+  - { ramp: 0 600/m, duration: 10s }
+  - { step: 20/s, duration: 5s }
+  - { sine: 100 50, period: 40s, duration: 40s }
+  - { points: [[0s, 0], [10s, 100], [20s, 50]] }
+  - { replay: busy-hour.csv, interval: 2s, scale: 0.5 }
+`), filepath.Join(dir, "profile.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Duration() != 81*time.Second || profile.Peak() != 150 {
+		t.Fatalf("Profile duration %s, peak %.1f", profile.Duration(), profile.Peak())
+	}
+
+	for _, tc := range []struct {
+		elapsed time.Duration
+		rate    float64
+	}{
+		{0, 0},
+		{5 * time.Second, 5},
+		{12 * time.Second, 20},
+		{15 * time.Second, 100},
+		{25 * time.Second, 150},
+		{45 * time.Second, 50},
+		{60 * time.Second, 50},
+		{70 * time.Second, 75},
+		{77 * time.Second, 100},
+		{80 * time.Second, 150},
+	} {
+		if rate, ok := profile.Rate(tc.elapsed); !ok || math.Abs(rate-tc.rate) > 1e-9 {
+			t.Fatalf("Rate at %s: %.3f %v, expected %.1f", tc.elapsed, rate, ok, tc.rate)
+		}
+	}
+	if _, ok := profile.Rate(81 * time.Second); ok {
+		t.Fatal("The completed profile has the rate")
+	}
+
+	profile.Repeat = true
+	if rate, ok := profile.Rate(86 * time.Second); !ok || rate != 5 {
+		t.Fatalf("Repeated rate: %.1f %v", rate, ok)
+	}
+
+	cfg := Config{Profile: profile, Duration: 12 * time.Second}
+	if phase, rate := cfg.Phase(12 * time.Second); phase != PhaseDone || rate != 0 {
+		t.Fatalf("Phase after the duration: %s %.1f", phase, rate)
+	}
+	cfg.scale = 0.5
+	if phase, rate := cfg.Phase(11 * time.Second); phase != PhaseProfile || rate != 10 {
+		t.Fatalf("Scaled phase: %s %.1f", phase, rate)
+	}
+	if err := (&Config{Profile: profile, Rate: 10}).check(); err == nil {
+		t.Fatal("The rate with the profile accepted")
+	}
+
+	replay, err := LoadRateProfile(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate, _ := replay.Rate(2500 * time.Millisecond); replay.Duration() != 3*time.Second || rate != 300 {
+		t.Fatalf("Replay duration %s, rate %.1f", replay.Duration(), rate)
+	}
+
+	for _, text := range []string{
+		"segments: []\n",
+		"segments:\n  - { duration: 1s }\n",
+		"segments:\n  - { step: 10, ramp: 0 10, duration: 1s }\n",
+		"segments:\n  - { step: 10 }\n",
+		"segments:\n  - { ramp: 10, duration: 1s }\n",
+		"segments:\n  - { step: 0, duration: 1s }\n",
+		"segments:\n  - { points: [[1s, 10], [2s, 20]] }\n",
+		"segments:\n  - { points: [[0s, 10], [0s, 20]] }\n",
+		"segments:\n  - { step: 10, duration: 1s, interpolate: cubic }\n",
+		"segments:\n  - { replay: missing.csv }\n",
+		"segments:\n  - { replay: busy-hour.csv, column: tps }\n",
+	} {
+		if _, err := ParseRateProfile([]byte(text), filepath.Join(dir, "bad.yaml")); err == nil {
+			t.Fatalf("Invalid profile accepted:\n%s", text)
+		} else {
+			fmt.Println(err)
+		}
+	}
+
+	fmt.Println("<<< Load rate profile test")
+}
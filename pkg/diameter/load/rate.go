@@ -0,0 +1,207 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: rate.go
+// Description: Diameter pkg: load rate, phases and token bucket limiter
+//
+
+package load
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+// Load phases
+const (
+	PhaseRampUp   = "ramp-up"
+	PhaseSteady   = "steady"
+	PhaseRampDown = "ramp-down"
+	PhaseProfile  = "profile"
+	PhaseDrain    = "drain"
+	PhaseDone     = "done"
+)
+
+const (
+	// maxWait caps the limiter sleep, so the rate changes of the ramps are picked up in time
+	maxWait = 50 * time.Millisecond
+	// burstWindow is the time of the requests the token bucket may accumulate
+	burstWindow = 10 * time.Millisecond
+)
+
+// Variables
+//
+
+// errPhasesDone is returned by the limiter when all load phases are completed.
+var errPhasesDone = errors.New("load phases completed")
+
+// Types
+//
+
+// limiter is the token bucket limiter, the rate follows the load phases.
+type limiter struct {
+	cfg    *Config
+	start  time.Time
+	last   time.Time
+	tokens float64
+	missed float64 // requests behind the target rate which the bucket could not keep
+	timer  *time.Timer
+}
+
+// Functions
+//
+
+// ParseRate parses the rate "<number>[/s | /m | /h]", e.g. "500/s" or "30000/m".
+// Returns the rate in requests per second, the rate without unit is per second.
+func ParseRate(text string) (float64, error) {
+	return parseRate(text, false)
+}
+
+// parseRate parses the rate, the zero rate is allowed for the rate profile points.
+func parseRate(text string, zero bool) (float64, error) {
+	number, unit, _ := strings.Cut(strings.TrimSpace(text), "/")
+
+	rate, err := strconv.ParseFloat(number, 64)
+	if err != nil || rate < 0 || (rate == 0 && !zero) {
+		return 0, &diwe.ErrInvalidRate{Rate: text}
+	}
+
+	switch unit {
+	case "", "s":
+	case "m":
+		rate /= 60
+	case "h":
+		rate /= 3600
+	default:
+		return 0, &diwe.ErrInvalidRate{Rate: text}
+	}
+
+	return rate, nil
+}
+
+// newLimiter returns the limiter of the load phases started now.
+func newLimiter(cfg *Config) *limiter {
+	now := time.Now()
+	timer := time.NewTimer(maxWait)
+	timer.Stop()
+
+	return &limiter{cfg: cfg, start: now, last: now, timer: timer}
+}
+
+// takeSlot takes the slot of the request, waits for the free slot unless the load is open-loop.
+// Returns false if the slot is not taken: all slots are busy (open-loop) or the context is canceled.
+func takeSlot(ctx context.Context, slots chan struct{}, openLoop bool) bool {
+	if openLoop {
+		select {
+		case slots <- struct{}{}:
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Methods
+//
+
+// Phase returns the load phase and its target rate at the elapsed time since the load start.
+// The rate grows linearly from zero during the ramp-up and falls to zero during the ramp-down.
+// The zero duration of the steady phase is endless. With the rate profile the rate follows
+// the profile until it is completed or the Duration is over.
+func (c *Config) Phase(elapsed time.Duration) (string, float64) {
+	if c.Profile != nil {
+		if c.Duration != 0 && elapsed >= c.Duration {
+			return PhaseDone, 0
+		}
+		rate, ok := c.Profile.Rate(elapsed)
+		if !ok {
+			return PhaseDone, 0
+		}
+		if c.scale != 0 {
+			rate *= c.scale
+		}
+		return PhaseProfile, rate
+	}
+
+	if elapsed < c.RampUp {
+		return PhaseRampUp, c.Rate * float64(elapsed) / float64(c.RampUp)
+	}
+	elapsed -= c.RampUp
+
+	if c.Duration == 0 || elapsed < c.Duration {
+		return PhaseSteady, c.Rate
+	}
+	elapsed -= c.Duration
+
+	if elapsed < c.RampDown {
+		return PhaseRampDown, c.Rate * float64(c.RampDown-elapsed) / float64(c.RampDown)
+	}
+
+	return PhaseDone, 0
+}
+
+// takeMissed returns the whole requests behind the target rate since the last call.
+func (l *limiter) takeMissed() uint64 {
+	missed := math.Floor(l.missed)
+	l.missed -= missed
+	return uint64(missed)
+}
+
+// wait blocks until the next request may be sent.
+// Returns errPhasesDone when the load phases are completed or the context error.
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+		phase, rate := l.cfg.Phase(now.Sub(l.start))
+		if phase == PhaseDone {
+			return errPhasesDone
+		}
+
+		// the requests over the burst are lost, a whole lost request is behind the target rate
+		burst := max(1, rate*burstWindow.Seconds())
+		l.tokens += rate * now.Sub(l.last).Seconds()
+		if over := l.tokens - burst; over > 0 {
+			if over >= 1 {
+				l.missed += over
+			}
+			l.tokens = burst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			return nil
+		}
+
+		wait := maxWait
+		if rate > 0 {
+			wait = min(wait, time.Duration((1-l.tokens)/rate*float64(time.Second)))
+		}
+		l.timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			l.timer.Stop()
+			return ctx.Err()
+		case <-l.timer.C:
+		}
+	}
+}
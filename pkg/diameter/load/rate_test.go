@@ -0,0 +1,87 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	fmt.Println(">>> Load rate test")
+
+	for text, want := range map[string]float64{"500/s": 500, "500": 500, "120/m": 2, "7200/h": 2, "0.5/s": 0.5} {
+		if rate, err := ParseRate(text); err != nil || rate != want {
+			t.Fatalf("Rate '%s': %v %v", text, rate, err)
+		}
+	}
+	for _, text := range []string{"", "0/s", "-5", "10/d", "fast"} {
+		if _, err := ParseRate(text); err == nil {
+			t.Fatalf("Invalid rate '%s' accepted", text)
+		} else {
+			fmt.Println(err)
+		}
+	}
+
+	cfg := Config{Rate: 100, RampUp: 10 * time.Second, Duration: time.Minute, RampDown: 20 * time.Second}
+	for _, tc := range []struct {
+		elapsed time.Duration
+		phase   string
+		rate    float64
+	}{
+		{0, PhaseRampUp, 0},
+		{5 * time.Second, PhaseRampUp, 50},
+		{10 * time.Second, PhaseSteady, 100},
+		{70 * time.Second, PhaseRampDown, 100},
+		{85 * time.Second, PhaseRampDown, 25},
+		{90 * time.Second, PhaseDone, 0},
+	} {
+		if phase, rate := cfg.Phase(tc.elapsed); phase != tc.phase || rate != tc.rate {
+			t.Fatalf("Phase at %s: %s %.1f", tc.elapsed, phase, rate)
+		}
+	}
+	if phase, _ := (&Config{Rate: 1}).Phase(time.Hour); phase != PhaseSteady {
+		t.Fatal("The endless steady phase is completed")
+	}
+
+	// 1000/s for 200ms
+	lim := newLimiter(&Config{Rate: 1000, Duration: 200 * time.Millisecond})
+	n := 0
+	for lim.wait(context.Background()) == nil {
+		n++
+	}
+	fmt.Printf("Requests in 200ms at 1000/s: %d\n", n)
+	if n < 150 || n > 250 {
+		t.Fatalf("Limited requests: %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lim = newLimiter(&Config{Rate: 0.1})
+	lim.tokens = -1
+	if err := lim.wait(ctx); err != context.Canceled {
+		t.Fatalf("Canceled wait: %v", err)
+	}
+
+	// the sender is 50ms late at 1000/s: the 10ms burst is sent, the rest is missed
+	lim = newLimiter(&Config{Rate: 1000})
+	if err := lim.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := lim.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	missed := lim.takeMissed()
+	fmt.Printf("Missed in 50ms at 1000/s: %d\n", missed)
+	if missed < 30 || missed > 60 || lim.takeMissed() != 0 {
+		t.Fatalf("Missed requests: %d", missed)
+	}
+
+	slots := make(chan struct{}, 1)
+	if !takeSlot(ctx, slots, true) || takeSlot(context.Background(), slots, true) || takeSlot(ctx, slots, false) {
+		t.Fatal("Slots of the full open-loop load are taken")
+	}
+
+	fmt.Println("<<< Load rate test")
+}
@@ -0,0 +1,167 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: soak.go
+// Description: Diameter pkg: soak runs, the periodic reconnections and the leak guards
+//
+
+package load
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+	"tgdp/pkg/diameter/stats"
+)
+
+// Consts
+//
+
+// guardInterval is the interval of the leak guard checks
+const guardInterval = time.Second
+
+// Functions
+//
+
+// ParseSize parses the memory size "<number>[K | M | G][i][B]" in the binary units, e.g. "512MiB" or "2G".
+// Returns the size in bytes, the size without unit is in bytes.
+func ParseSize(text string) (uint64, error) {
+	number := strings.TrimSpace(text)
+	unit := strings.TrimLeft(number, "0123456789.")
+	number = strings.TrimSpace(number[:len(number)-len(unit)])
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size <= 0 {
+		return 0, &diwe.ErrInvalidLoadConfig{Param: "size", Reason: fmt.Sprintf("invalid size '%s'", text)}
+	}
+
+	unit = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(unit)), "B"), "I")
+	switch unit {
+	case "":
+	case "K":
+		size *= 1 << 10
+	case "M":
+		size *= 1 << 20
+	case "G":
+		size *= 1 << 30
+	default:
+		return 0, &diwe.ErrInvalidLoadConfig{Param: "size", Reason: fmt.Sprintf("invalid size unit '%s'", text)}
+	}
+
+	return uint64(size), nil
+}
+
+// Methods
+//
+
+// CheckGuards returns ErrLeakGuard if the live heap or the goroutines of the runtime statistics
+// are over the limits of the configuration.
+func (c *Config) CheckGuards(rt stats.Runtime) error {
+	if c.MaxHeap > 0 && rt.HeapLive > c.MaxHeap {
+		return &diwe.ErrLeakGuard{Resource: "heap", Value: stats.FormatBytes(rt.HeapLive),
+			Limit: stats.FormatBytes(c.MaxHeap)}
+	}
+	if c.MaxGoroutines > 0 && rt.Goroutines > uint64(c.MaxGoroutines) {
+		return &diwe.ErrLeakGuard{Resource: "goroutines", Value: strconv.FormatUint(rt.Goroutines, 10),
+			Limit: strconv.Itoa(c.MaxGoroutines)}
+	}
+
+	return nil
+}
+
+// Helpers
+//
+
+// guard stops the load with the leak guard error when the live heap or the goroutines grow over the limits.
+func guard(ctx context.Context, cfg *Config, stop context.CancelCauseFunc) {
+	if cfg.MaxHeap == 0 && cfg.MaxGoroutines == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(guardInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.CheckGuards(stats.ReadRuntime()); err != nil {
+				stop(err)
+				return
+			}
+		}
+	}
+}
+
+// guardError returns the leak guard error the load was stopped by, nil if it was not.
+func guardError(ctx context.Context) error {
+	if err := context.Cause(ctx); diwe.Is[*diwe.ErrLeakGuard](err) {
+		return err
+	}
+	return nil
+}
+
+// cycle reconnects the peers every Reconnect interval until the context is canceled. The sending is paused
+// while the peers are reconnected, the requests outstanding on the closed connections are dropped.
+func (g *Generator) cycle(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.Reconnect)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.cycleMu.Lock()
+			for _, peer := range g.peers {
+				g.reconnectPeer(peer)
+			}
+			g.cycleMu.Unlock()
+		}
+	}
+}
+
+// reconnectPeer disconnects the peer (Disconnect-Peer) and connects it again, the failed connection
+// is retried by the sending.
+func (g *Generator) reconnectPeer(peer *node.Node) {
+	if peer.IsOpen() {
+		peer.Disconnect() // nolint: errcheck
+	}
+	g.drop(peer)
+
+	g.mu.Lock()
+	g.connected[peer] = time.Now()
+	g.mu.Unlock()
+	if err := peer.Connect(); err != nil {
+		g.setError(err)
+		return
+	}
+	g.reconnects.Add(1)
+}
+
+// drop forgets the outstanding requests of the peer and releases their slots.
+func (g *Generator) drop(peer *node.Node) {
+	dropped := 0
+	g.mu.Lock()
+	for key := range g.pending {
+		if key.peer == peer {
+			delete(g.pending, key)
+			dropped++
+		}
+	}
+	g.mu.Unlock()
+
+	for range dropped {
+		<-g.slots
+	}
+	g.dropped.Add(uint64(dropped))
+}
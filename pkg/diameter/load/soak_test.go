@@ -0,0 +1,57 @@
+package load
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+	"tgdp/pkg/diameter/stats"
+)
+
+func TestSoak(t *testing.T) {
+	fmt.Println(">>> Load soak test")
+
+	for text, want := range map[string]uint64{"4096": 4096, "64K": 64 << 10, "512MiB": 512 << 20, "1.5GB": 3 << 29, "2 g": 2 << 30} {
+		if size, err := ParseSize(text); err != nil || size != want {
+			t.Fatalf("Size '%s': %v %v", text, size, err)
+		}
+	}
+	for _, text := range []string{"", "0", "-1M", "10T", "big"} {
+		if _, err := ParseSize(text); err == nil {
+			t.Fatalf("Invalid size '%s' accepted", text)
+		} else {
+			fmt.Println(err)
+		}
+	}
+
+	cfg := Config{MaxHeap: 64 << 20, MaxGoroutines: 100}
+	if err := cfg.CheckGuards(stats.Runtime{HeapLive: 32 << 20, Goroutines: 100}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rt := range []stats.Runtime{{HeapLive: 65 << 20}, {Goroutines: 101}} {
+		err := cfg.CheckGuards(rt)
+		if !diwe.Is[*diwe.ErrLeakGuard](err) {
+			t.Fatalf("Guard not triggered: %+v", rt)
+		}
+		fmt.Println(err)
+	}
+	if err := (&Config{Rate: 1, Reconnect: -time.Second}).check(); err == nil {
+		t.Fatal("Negative reconnect interval accepted")
+	}
+
+	// the reconnection drops the outstanding requests of the peer only and releases their slots
+	hss, hss2 := &node.Node{Name: "hss"}, &node.Node{Name: "hss2"}
+	g := &Generator{slots: make(chan struct{}, 4), pending: make(map[pendingKey]request)}
+	for i, peer := range []*node.Node{hss, hss, hss2} {
+		g.slots <- struct{}{}
+		g.pending[pendingKey{peer: peer, hopByHop: uint32(i)}] = request{sent: time.Now()}
+	}
+	g.drop(hss)
+	if len(g.pending) != 1 || len(g.slots) != 1 || g.dropped.Load() != 2 {
+		t.Fatalf("Dropped: pending %d, slots %d, dropped %d", len(g.pending), len(g.slots), g.dropped.Load())
+	}
+
+	fmt.Println("<<< Load soak test")
+}
@@ -14,10 +14,14 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"slices"
+	"strconv"
 	"strings"
 
+	"tgdp/pkg/diameter/dict"
 	"tgdp/pkg/diameter/diwe"
 )
 
@@ -60,6 +64,8 @@ type Message struct {
 	avps []*Avp
 	// bytes holds the serialized wire format (cached after first Serialize call).
 	bytes []byte
+	// admitted is set when the overload control is applied to the request (AdmitRequest).
+	admitted bool
 }
 
 // Methods
@@ -161,10 +167,11 @@ func (m *Message) GetAvpValue(avpId any) (any, error) {
 // It uses the same Application ID, Command Code, HopByHop, and EndToEnd identifiers.
 // The R (Request) flag is cleared in the reply.
 // If the original message contains a Session-Id AVP, it is copied to the reply.
+// The overload report of the environment is added if the request advertises DOIC support.
 // Returns the new answer message or an error if creation fails.
 func (m *Message) Response() (*Message, error) {
 	// Create new message as answer (request=false)
-	r, err := m.env.NewMessage(m.AppId, m.CmdCode, false, true)
+	r, err := m.env.newMessage(nil, nil, "", m.AppId, m.CmdCode, false, true)
 	if err != nil {
 		return nil, err
 	}
@@ -190,6 +197,11 @@ func (m *Message) Response() (*Message, error) {
 	// Clear the Request flag to convert request to answer
 	r.Flags = m.Flags & ^m.env.Dict().CmdFlag().R
 
+	// Add the overload report if the request advertises DOIC support
+	if err := m.env.reportOverload(m, r); err != nil {
+		return nil, err
+	}
+
 	// Explicitly return nil for error to avoid returning a stale 'err' state
 	return r, nil
 }
@@ -256,6 +268,7 @@ func (m *Message) reset() {
 	m.env = nil
 	m.avps = m.avps[:0]
 	m.bytes = nil
+	m.admitted = false
 }
 
 // Deserialize parses a Diameter message from wire format bytes.
@@ -326,6 +339,92 @@ func (m *Message) IsRetransmition() bool {
 	return (m.Flags&m.env.Dict().CmdFlag().T != 0)
 }
 
+// ResultCode returns the result of the answer and the vendor ID it belongs to.
+// The Result-Code value is returned with vendor ID 0. If the answer carries the
+// Experimental-Result AVP instead, its Experimental-Result-Code is returned
+// along with the Vendor-Id.
+// Returns ErrMissingAvp if the message has no result.
+func (m *Message) ResultCode() (uint32, uint32, error) {
+	if avp, err := m.GetAvp(avpResultCode); err == nil {
+		v, ok := avp.Value().(uint32)
+		if !ok {
+			return 0, 0, &diwe.ErrInvalidAvpValue{Avp: avp, Value: avp.Value()}
+		}
+		return v, 0, nil
+	}
+
+	if _, err := m.GetAvp(avpExperimentalResult); err != nil {
+		return 0, 0, &diwe.ErrMissingAvp{Avp: avpResultCode}
+	}
+
+	return m.ExperimentalResult()
+}
+
+// ExperimentalResult returns the Experimental-Result-Code of the Experimental-Result AVP
+// and the Vendor-Id it belongs to, the Result-Code of the answer is not looked at.
+// Returns ErrMissingAvp if the message has no experimental result.
+func (m *Message) ExperimentalResult() (uint32, uint32, error) {
+	avp, err := m.GetAvp(avpExperimentalResult)
+	if err != nil {
+		return 0, 0, &diwe.ErrMissingAvp{Avp: avpExperimentalResult}
+	}
+
+	members, ok := avp.Value().([]*Avp)
+	if !ok {
+		return 0, 0, &diwe.ErrInvalidAvpValue{Avp: avp, Value: avp.Value()}
+	}
+
+	var code, vndId uint32
+	found := false
+	for _, member := range members {
+		switch member.Code() {
+		case avpVendorId:
+			vndId, _ = member.Value().(uint32)
+		case avpExperimentalResultCode:
+			code, found = member.Value().(uint32)
+		}
+	}
+	if !found {
+		return 0, 0, &diwe.ErrMissingAvp{Avp: avpExperimentalResultCode}
+	}
+
+	return code, vndId, nil
+}
+
+// Result returns the dictionary definition of the answer result.
+// Returns ErrUnknownResultCode if the result code is not described in the dictionary.
+func (m *Message) Result() (*dict.ResultCode, error) {
+	code, vndId, err := m.ResultCode()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.env.Dict().GetResultCodeByCode(code, vndId)
+}
+
+// ResultClass returns the class of the answer result (dict.ResultClassXxx).
+// Returns dict.ResultClassUnknown if the message has no result.
+func (m *Message) ResultClass() int {
+	code, _, err := m.ResultCode()
+	if err != nil {
+		return dict.ResultClassUnknown
+	}
+
+	return dict.ResultClass(code)
+}
+
+// Release returns the message and its AVPs to the pools, the message is owned by the caller until released.
+// Neither the message nor its AVPs may be used after the release; the AVP values and the serialized
+// bytes taken before stay valid. The AVPs added to the message are owned by it, so an AVP must not be
+// shared by the messages released. Releasing is optional, the messages not released are collected by
+// the garbage collector; a message is released once, the released message may be reused at once.
+func (m *Message) Release() {
+	if m == nil || m.env == nil {
+		return
+	}
+	putMessage(m)
+}
+
 // Bytes returns the cached wire format bytes.
 // Returns nil if the message has not been serialized.
 func (m *Message) Bytes() []byte {
@@ -341,27 +440,33 @@ func (m *Message) Len() uint32 {
 // Displays the header fields (version, length, app ID, flags, command code,
 // hop-by-hop, end-to-end) and lists all AVPs with their values.
 func (m *Message) Trace(shift ...int) {
+	if err := m.WriteText(os.Stdout); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// WriteText writes the message in the human-readable format of Trace.
+// Returns an error if the application or the command is unknown, nothing is written then.
+func (m *Message) WriteText(w io.Writer) error {
 	// Look up application name
 	app, err := m.env.Dict().GetAppById(m.AppId)
 	if app == nil {
-		slog.Error(err.Error())
-		return
+		return err
 	}
 
 	// Look up command name
 	cmd, err := m.env.Dict().GetCmdByCode(m.CmdCode, app)
 	if cmd == nil {
-		slog.Error(err.Error())
-		return
+		return err
 	}
 
 	// Print header fields
-	fmt.Printf("Version:  %d\n", m.Version)
-	fmt.Printf("Length:   %d\n", m.Length)
-	fmt.Printf("AppId:    %d (%s)\n", m.AppId, app.Name)
-	fmt.Printf("Flags:    0x%02X", m.Flags)
+	fmt.Fprintf(w, "Version:  %d\n", m.Version)
+	fmt.Fprintf(w, "Length:   %d\n", m.Length)
+	fmt.Fprintf(w, "AppId:    %d (%s)\n", m.AppId, app.Name)
+	fmt.Fprintf(w, "Flags:    0x%02X", m.Flags)
 	if m.Flags != 0 {
-		fmt.Print(" (")
+		fmt.Fprint(w, " (")
 		flags := []string{}
 		// Iterate through flag bits from R to T
 		for flag := m.env.Dict().CmdFlag().R; flag > m.env.Dict().CmdFlag().T; flag >>= 1 {
@@ -369,23 +474,47 @@ func (m *Message) Trace(shift ...int) {
 				flags = append(flags, m.env.Dict().CmdFlagName(flag))
 			}
 		}
-		fmt.Print(strings.Join(flags, ", "))
-		fmt.Print(")")
+		fmt.Fprint(w, strings.Join(flags, ", "))
+		fmt.Fprint(w, ")")
 	}
-	fmt.Println()
-	fmt.Printf("CmdCode:  %d (%s)\n", m.CmdCode, cmd.Name)
-	fmt.Printf("EndToEnd: 0x%08X (%d)\n", m.EndToEnd, m.EndToEnd)
-	fmt.Printf("HopByHop: 0x%08X (%d)\n", m.HopByHop, m.HopByHop)
-	fmt.Printf("AVPs:\n")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "CmdCode:  %d (%s)\n", m.CmdCode, cmd.Name)
+	fmt.Fprintf(w, "EndToEnd: 0x%08X (%d)\n", m.EndToEnd, m.EndToEnd)
+	fmt.Fprintf(w, "HopByHop: 0x%08X (%d)\n", m.HopByHop, m.HopByHop)
+	if !m.IsRequest() {
+		if code, vndId, err := m.ResultCode(); err == nil {
+			fmt.Fprintf(w, "Result:   %s\n", resultText(m.env.Dict(), code, vndId))
+		}
+	}
+	fmt.Fprintf(w, "AVPs:\n")
 	// Dump all AVPs with 2-space indentation
 	for _, avp := range m.avps {
-		avp.Dump(2)
+		avp.WriteText(w, 2)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
+
+	return nil
 }
 
 // Helpers
 //
+// resultText returns the result code name (if described in the dictionary),
+// value, vendor and class, e.g. "DIAMETER_SUCCESS (2001) success".
+func resultText(d *dict.Dict, code, vndId uint32) string {
+	text := strconv.FormatUint(uint64(code), 10)
+	if vndId != 0 {
+		text += fmt.Sprintf(", vendor %d", vndId)
+	}
+
+	if rc, err := d.GetResultCodeByCode(code, vndId); err == nil {
+		text = fmt.Sprintf("%s (%s)", rc.Name, text)
+	} else if vndId != 0 {
+		text = fmt.Sprintf("(%s)", text)
+	}
+
+	return text + " " + dict.ResultClassName(dict.ResultClass(code))
+}
+
 // matchAvp checks if an AVP matches the given identifier.
 // The avpId can be:
 //   - int/uint32: matches by AVP code
@@ -0,0 +1,110 @@
+package diameter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRelease(t *testing.T) {
+	fmt.Println(">>> Message release test")
+
+	env := newTestEnv(t)
+	if err := env.Store().MakeFromYaml(`
+Session-Id: "mme.test.org"
+Origin-Host: "mme.test.org"
+Origin-Realm: "test.org"
+Destination-Realm: "test.org"
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	before := RuntimeStats()
+	msg, err := env.NewMessage("S6a", "UL", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := msg.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	avps := len(msg.Avps())
+
+	decoded, err := env.BytesToMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := decoded.GetAvpValue("Origin-Host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := RuntimeStats()
+	if in := after.Messages.InUse() - before.Messages.InUse(); in != 2 {
+		t.Fatalf("Messages in use: %d", in)
+	}
+
+	msg.Release()
+	decoded.Release()
+	(*Message)(nil).Release()
+
+	released := RuntimeStats()
+	fmt.Println(released)
+	if released.Messages.InUse() != before.Messages.InUse() || released.Avps.InUse() != before.Avps.InUse() {
+		t.Fatalf("Not released: messages %d, AVPs %d of %d", released.Messages.InUse()-before.Messages.InUse(),
+			released.Avps.InUse()-before.Avps.InUse(), 2*avps)
+	}
+	if released.Avps.Puts-after.Avps.Puts != uint64(2*avps) {
+		t.Fatalf("AVPs returned: %d of %d", released.Avps.Puts-after.Avps.Puts, 2*avps)
+	}
+
+	// the values and the bytes taken before the release stay valid
+	if host != "mme.test.org" || len(data) == 0 || data[0] != Version {
+		t.Fatalf("Value after release: %v", host)
+	}
+
+	// the decoded helpers return their messages to the pool
+	answer, err := env.NewMessage("S6a", "UL", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := answer.SetPath("Result-Code", 2001); err != nil {
+		t.Fatal(err)
+	}
+	data, err = answer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer.Release()
+	before = RuntimeStats()
+	if code, err := env.GetResultCode(data); err != nil || code != 2001 {
+		t.Fatalf("Result-Code: %d %v", code, err)
+	}
+	if in := RuntimeStats().Messages.InUse(); in != before.Messages.InUse() {
+		t.Fatalf("GetResultCode message not released: %d", in-before.Messages.InUse())
+	}
+
+	// the experimental result is decoded even if the answer has the Result-Code too
+	answer, err = env.NewMessage("S6a", "UL", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, value := range map[string]any{"Result-Code": 2001, "Experimental-Result.Vendor-Id": 10415,
+		"Experimental-Result.Experimental-Result-Code": 5420} {
+		if err := answer.SetPath(path, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err = answer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer.Release()
+	if code, vndId, err := env.GetResultCodeEx(data); err != nil || code != 5420 || vndId != 10415 {
+		t.Fatalf("Experimental-Result-Code: %d, Vendor-Id %d, %v", code, vndId, err)
+	}
+	if code, err := env.GetResultCode(data); err != nil || code != 2001 {
+		t.Fatalf("Result-Code: %d %v", code, err)
+	}
+
+	fmt.Println("<<< Message release test")
+}
@@ -0,0 +1,151 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: exporter.go
+// Description: Diameter pkg: Prometheus metrics HTTP endpoint
+//
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+const (
+	// Path is the HTTP path of the metrics
+	Path = "/metrics"
+
+	// contentType is the Prometheus text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+	// shutdownTimeout is the maximum time to complete the running scrapes on shutdown
+	shutdownTimeout = time.Second
+)
+
+// Types
+//
+
+// Collector adds its metrics to the writer on each scrape.
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// CollectorFunc is the function adapter of the Collector.
+type CollectorFunc func(w *Writer)
+
+// Exporter serves the metrics of the registered collectors over HTTP.
+type Exporter struct {
+	addr       string
+	mu         sync.Mutex
+	collectors []Collector
+	server     *http.Server
+	listener   net.Listener
+}
+
+// Constructor
+//
+
+// New creates the exporter for the listen address, e.g. ":9100".
+func New(addr string) *Exporter {
+	return &Exporter{addr: addr}
+}
+
+// Methods
+//
+
+// Collect calls the function.
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+// Register adds the collector, the collectors are called in the order of registration.
+func (e *Exporter) Register(c Collector) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.collectors = append(e.collectors, c)
+}
+
+// Start listens on the address and serves the metrics in the background.
+func (e *Exporter) Start() error {
+	listener, err := net.Listen("tcp", e.addr)
+	if err != nil {
+		return &diwe.ErrMetricsListen{Addr: e.addr, Err: err}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, e)
+
+	e.mu.Lock()
+	e.listener = listener
+	e.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	server := e.server
+	e.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the listen address, the actual port if the address port is zero.
+func (e *Exporter) Addr() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.listener == nil {
+		return e.addr
+	}
+	return e.listener.Addr().String()
+}
+
+// Shutdown stops serving the metrics, the nil exporter is ignored.
+func (e *Exporter) Shutdown() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	server := e.server
+	e.server, e.listener = nil, nil
+	e.mu.Unlock()
+
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	server.Shutdown(ctx) //nolint:errcheck
+}
+
+// ServeHTTP writes the metrics of all collectors.
+func (e *Exporter) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	e.mu.Lock()
+	collectors := append([]Collector{}, e.collectors...)
+	e.mu.Unlock()
+
+	w := NewWriter()
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	w.WriteTo(rw) //nolint:errcheck
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tgdp/pkg/diameter/stats"
+)
+
+func TestMetrics(t *testing.T) {
+	fmt.Println(">>> Metrics test")
+
+	var latency stats.Histogram
+	for _, ms := range []int{1, 3, 7, 40, 2000} {
+		latency.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	exporter := New("127.0.0.1:0")
+	exporter.Register(CollectorFunc(func(w *Writer) {
+		w.Counter("test_requests_total", "Requests", 10, "peer", "hss1", "command", "UL")
+		w.Gauge("test_up", "Peer is up", 1, "peer", `a"b\c`)
+		w.Counter("test_requests_total", "Requests", 1234567890, "peer", "hss2", "command", "UL")
+		w.Histogram("test_latency_seconds", "Latency", &latency, "peer", "hss1")
+	}))
+	if err := exporter.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown()
+
+	resp, err := http.Get("http://" + exporter.Addr() + Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+	fmt.Print(text)
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type: %s", resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"# HELP test_requests_total Requests\n# TYPE test_requests_total counter\n" +
+			"test_requests_total{peer=\"hss1\",command=\"UL\"} 10\n" +
+			"test_requests_total{peer=\"hss2\",command=\"UL\"} 1234567890\n",
+		`test_up{peer="a\"b\\c"} 1`,
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{peer="hss1",le="0.0025"} 1`,
+		`test_latency_seconds_bucket{peer="hss1",le="0.01"} 3`,
+		`test_latency_seconds_bucket{peer="hss1",le="0.05"} 4`,
+		`test_latency_seconds_bucket{peer="hss1",le="10"} 5`,
+		`test_latency_seconds_bucket{peer="hss1",le="+Inf"} 5`,
+		`test_latency_seconds_sum{peer="hss1"} 2.051`,
+		`test_latency_seconds_count{peer="hss1"} 5`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("Missing metric: %s", want)
+		}
+	}
+
+	if err := New(exporter.Addr()).Start(); err == nil {
+		t.Fatal("Busy address accepted")
+	} else {
+		fmt.Println(err)
+	}
+
+	fmt.Println("<<< Metrics test")
+}
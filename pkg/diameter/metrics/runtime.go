@@ -0,0 +1,45 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: runtime.go
+// Description: Diameter pkg: runtime and pools metrics of the process
+//
+
+package metrics
+
+import (
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/stats"
+)
+
+// Functions
+//
+
+// Runtime returns the collector of the runtime statistics of the process and the use of the message
+// and AVP pools, the metrics to watch for the leaks in the long runs.
+func Runtime() Collector {
+	return CollectorFunc(func(w *Writer) {
+		rt := diameter.RuntimeStats()
+
+		w.Gauge("tgdp_runtime_heap_live_bytes", "Heap bytes marked live by the last GC", float64(rt.HeapLive))
+		w.Gauge("tgdp_runtime_heap_alloc_bytes", "Heap bytes of the allocated objects", float64(rt.HeapAlloc))
+		w.Gauge("tgdp_runtime_heap_objects", "Allocated heap objects", float64(rt.HeapObjects))
+		w.Gauge("tgdp_runtime_sys_bytes", "Memory mapped by the runtime", float64(rt.Sys))
+		w.Counter("tgdp_runtime_gc_total", "Completed GC cycles", float64(rt.GCs))
+		w.Gauge("tgdp_runtime_goroutines", "Live goroutines", float64(rt.Goroutines))
+
+		for _, pool := range []struct {
+			name  string
+			stats *stats.PoolStats
+		}{{"message", &rt.Messages}, {"avp", &rt.Avps}} {
+			w.Counter("tgdp_pool_gets_total", "Objects taken from the pool", float64(pool.stats.Gets), "pool", pool.name)
+			w.Counter("tgdp_pool_allocs_total", "Objects allocated because the pool was empty",
+				float64(pool.stats.Allocs), "pool", pool.name)
+			w.Gauge("tgdp_pool_in_use", "Objects taken from the pool and not returned", float64(pool.stats.InUse()),
+				"pool", pool.name)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: traffic.go
+// Description: Diameter pkg: peers and traffic statistics metrics
+//
+
+package metrics
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"tgdp/pkg/diameter"
+)
+
+// Functions
+//
+
+// Traffic returns the collector of the peers state and the traffic statistics of the environment.
+func Traffic(env *diameter.Diameter) Collector {
+	return CollectorFunc(func(w *Writer) {
+		for peer := range env.Peers().Iter() {
+			role := "peer"
+			if peer.IsClient() {
+				role = "client"
+			}
+			up := 0.0
+			if peer.IsOpen() {
+				up = 1
+			}
+			w.Gauge("tgdp_peer_up", "Peer connection is open", up, "peer", peer.Name, "role", role)
+			w.Gauge("tgdp_peer_state", "Peer state machine state", float64(peer.State()), "peer", peer.Name, "role", role)
+		}
+
+		w.Counter("tgdp_overload_abated_total", "Requests abated by the overload control", float64(env.OverloadAbated()))
+		for _, report := range env.OverloadReports() {
+			w.Gauge("tgdp_overload_reduction_percent", "Reduction percentage of the received overload report",
+				float64(report.Reduction), "type", diameter.OverloadTypeName(report.Type), "node", report.Node)
+		}
+
+		snapshot := env.Stats().Snapshot()
+		w.Gauge("tgdp_stats_start_time_seconds", "Start or reset time of the traffic statistics",
+			float64(snapshot.Started.Unix()))
+		w.Gauge("tgdp_requests_outstanding", "Requests waiting for the answers", float64(env.Stats().Outstanding()))
+
+		for _, entry := range snapshot.Entries {
+			appName, cmdName := env.CommandNames(entry.AppId, entry.CmdCode)
+			labels := []string{"peer", entry.Peer, "app", appName, "command", cmdName}
+
+			w.Counter("tgdp_requests_sent_total", "Requests sent", float64(entry.RequestsSent), labels...)
+			w.Counter("tgdp_requests_received_total", "Requests received", float64(entry.RequestsRecv), labels...)
+			w.Counter("tgdp_answers_sent_total", "Answers sent", float64(entry.AnswersSent), labels...)
+			w.Counter("tgdp_answers_received_total", "Answers received", float64(entry.AnswersRecv), labels...)
+			w.Counter("tgdp_bytes_sent_total", "Message bytes sent", float64(entry.BytesSent), labels...)
+			w.Counter("tgdp_bytes_received_total", "Message bytes received", float64(entry.BytesRecv), labels...)
+			w.Counter("tgdp_timeouts_total", "Requests without the answer within the timeout",
+				float64(entry.Timeouts), labels...)
+			w.Counter("tgdp_retransmissions_total", "Requests with the T flag", float64(entry.Retransmissions), labels...)
+
+			for _, code := range slices.Sorted(maps.Keys(entry.Results)) {
+				w.Counter("tgdp_answers_by_result_total", "Answers received by the Result-Code",
+					float64(entry.Results[code]), append(labels, "result_code", strconv.FormatUint(uint64(code), 10))...)
+			}
+
+			if entry.Latency.Count() > 0 {
+				w.Histogram("tgdp_latency_seconds", "Request to answer latency", &entry.Latency, labels...)
+			}
+		}
+	})
+}
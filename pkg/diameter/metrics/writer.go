@@ -0,0 +1,158 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: writer.go
+// Description: Diameter pkg: Prometheus text format writer
+//
+
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgdp/pkg/diameter/stats"
+)
+
+// Consts
+//
+
+// Metric types of the Prometheus text format.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Types
+//
+
+// Writer collects the metric samples grouped by the metric families and writes them
+// in the Prometheus text exposition format (version 0.0.4).
+type Writer struct {
+	families map[string]*family
+	order    []string
+}
+
+// family is the metric family: the help text, the type and the sample lines.
+type family struct {
+	help    string
+	typ     string
+	samples []string
+}
+
+// Variables
+//
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets.
+var LatencyBuckets = []time.Duration{
+	500 * time.Microsecond, time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second,
+}
+
+// Constructor
+//
+
+// NewWriter creates the empty writer.
+func NewWriter() *Writer {
+	return &Writer{families: make(map[string]*family)}
+}
+
+// Methods
+//
+
+// Counter adds the counter sample, the labels are the name and value pairs.
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.sample(name, help, TypeCounter, name, value, labels)
+}
+
+// Gauge adds the gauge sample, the labels are the name and value pairs.
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.sample(name, help, TypeGauge, name, value, labels)
+}
+
+// Histogram adds the latency histogram in seconds with LatencyBuckets, the labels are the name and value pairs.
+func (w *Writer) Histogram(name, help string, h *stats.Histogram, labels ...string) {
+	for _, le := range LatencyBuckets {
+		bucket := append(labels[:len(labels):len(labels)], "le", formatValue(le.Seconds()))
+		w.sample(name, help, TypeHistogram, name+"_bucket", float64(h.CountBelow(le)), bucket)
+	}
+	w.sample(name, help, TypeHistogram, name+"_bucket", float64(h.Count()),
+		append(labels[:len(labels):len(labels)], "le", "+Inf"))
+	w.sample(name, help, TypeHistogram, name+"_sum", h.Sum().Seconds(), labels)
+	w.sample(name, help, TypeHistogram, name+"_count", float64(h.Count()), labels)
+}
+
+// WriteTo writes the metric families in the order of their first samples.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	bw := bufio.NewWriter(out)
+	var n int64
+
+	for _, name := range w.order {
+		f := w.families[name]
+		k, _ := bw.WriteString("# HELP " + name + " " + escape(f.help, false) + "\n# TYPE " + name + " " + f.typ + "\n")
+		n += int64(k)
+		for _, line := range f.samples {
+			k, _ = bw.WriteString(line)
+			n += int64(k)
+		}
+	}
+
+	return n, bw.Flush()
+}
+
+// Helpers
+//
+
+// sample adds the sample line to the family, the family is created on the first sample.
+func (w *Writer) sample(name, help, typ, sampleName string, value float64, labels []string) {
+	f, exists := w.families[name]
+	if !exists {
+		f = &family{help: help, typ: typ}
+		w.families[name] = f
+		w.order = append(w.order, name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(sampleName)
+	if len(labels) > 0 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i] + `="` + escape(labels[i+1], true) + `"`)
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteString(" " + formatValue(value) + "\n")
+
+	f.samples = append(f.samples, sb.String())
+}
+
+// formatValue formats the sample value, the integers are written without the exponent.
+func formatValue(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escape escapes the help text or the label value.
+func escape(text string, label bool) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, "\n", `\n`)
+	if label {
+		text = strings.ReplaceAll(text, `"`, `\"`)
+	}
+	return text
+}
@@ -0,0 +1,440 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: msgfault.go
+// Description: Diameter pkg: deliberate faults of the serialized messages and raw payloads for negative testing
+//
+
+package diameter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+)
+
+// Consts
+//
+
+// Message fault kinds
+const (
+	// FaultLength sets the message length in the header: absolute value or "+N"/"-N" delta (default "+4")
+	FaultLength = "length"
+	// FaultVersion sets the protocol version in the header (default 2)
+	FaultVersion = "version"
+	// FaultFlags sets the bits in the command flags of the header (default 0x0F, the reserved bits)
+	FaultFlags = "flags"
+	// FaultAvpLength sets the AVP length: absolute value or "+N"/"-N" delta (default "+1")
+	FaultAvpLength = "avp-length"
+	// FaultNoPadding removes the padding of the AVP, the lengths of the enclosing AVPs and the message are adjusted
+	FaultNoPadding = "no-padding"
+	// FaultEnum sets the Enumerated AVP value (default the first value above the dictionary items)
+	FaultEnum = "enum"
+	// FaultAvpFlags changes the AVP flags: "+X" sets, "-X" clears, "~X" toggles the V, M, P flags
+	// or the number replaces all flags (default "~M")
+	FaultAvpFlags = "avp-flags"
+	// FaultTruncate cuts N bytes from the end of the AVP data (default 4), the lengths of the AVP,
+	// the enclosing AVPs and the message are adjusted, so the last member of the grouped AVP is truncated
+	FaultTruncate = "truncate"
+)
+
+// Types
+//
+
+// MessageFault is the deliberate fault applied to the serialized message.
+// The header faults have no AVP path, the AVP faults apply to the AVP of the path.
+type MessageFault struct {
+	Kind  string
+	Path  AvpPath
+	Value string
+}
+
+// RawMessage is the raw message payload, the trace prints it as the hex dump.
+type RawMessage []byte
+
+// faultKind is the definition of the message fault kind.
+type faultKind struct {
+	avp   bool   // the fault applies to the AVP and requires the AVP path
+	value string // default value
+	apply func(d *Diameter, raw []byte, fault MessageFault, chain []wireAvp) ([]byte, error)
+}
+
+// wireAvp is the location of the AVP in the serialized message.
+type wireAvp struct {
+	offset int // offset of the AVP header
+	length int // AVP length (header and data without padding)
+	data   int // offset of the AVP data
+}
+
+// Variables
+//
+
+var faultKinds = map[string]faultKind{
+	FaultLength:    {value: "+4", apply: faultLength},
+	FaultVersion:   {value: "2", apply: faultVersion},
+	FaultFlags:     {value: "0x0F", apply: faultFlags},
+	FaultAvpLength: {avp: true, value: "+1", apply: faultAvpLength},
+	FaultNoPadding: {avp: true, apply: faultNoPadding},
+	FaultEnum:      {avp: true, apply: faultEnum},
+	FaultAvpFlags:  {avp: true, value: "~M", apply: faultAvpFlags},
+	FaultTruncate:  {avp: true, value: "4", apply: faultTruncate},
+}
+
+// Functions
+//
+
+// FaultKinds returns the sorted list of the message fault kinds.
+func FaultKinds() []string {
+	return slices.Sorted(maps.Keys(faultKinds))
+}
+
+// IsAvpFault reports whether the fault kind applies to the AVP.
+func IsAvpFault(kind string) bool {
+	return faultKinds[kind].avp
+}
+
+// ParseHex parses the hex payload. Whitespace, ':' separators and the "0x" prefix are ignored.
+func ParseHex(text string) ([]byte, error) {
+	digits := strings.Join(strings.Fields(text), "")
+	digits = strings.ReplaceAll(digits, ":", "")
+	if prefix, ok := cutPrefixFold(digits, "0x"); ok {
+		digits = prefix
+	}
+
+	data, err := hex.DecodeString(digits)
+	if err != nil || len(data) == 0 {
+		return nil, &diwe.ErrInvalidHex{Text: text}
+	}
+
+	return data, nil
+}
+
+// Methods
+//
+
+// ParseFault parses the message fault "<kind>[:<avp path>][=<value>]", e.g.
+// "version=3", "avp-length:Session-Id=-2" or "truncate:Subscription-Data.APN-Configuration-Profile".
+func (d *Diameter) ParseFault(spec string) (MessageFault, error) {
+	head, value, _ := strings.Cut(spec, "=")
+	kind, path, _ := strings.Cut(head, ":")
+
+	def, exists := faultKinds[kind]
+	if !exists {
+		return MessageFault{}, &diwe.ErrInvalidFault{Fault: spec, Reason: fmt.Sprintf("unknown fault kind '%s'", kind)}
+	}
+
+	fault := MessageFault{Kind: kind, Value: value}
+	switch {
+	case def.avp && path == "":
+		return MessageFault{}, &diwe.ErrInvalidFault{Fault: spec, Reason: "AVP path is required"}
+	case !def.avp && path != "":
+		return MessageFault{}, &diwe.ErrInvalidFault{Fault: spec, Reason: "header fault has no AVP path"}
+	case def.avp:
+		parsed, err := d.ParseAvpPath(path)
+		if err != nil {
+			return MessageFault{}, &diwe.ErrInvalidFault{Fault: spec, Reason: err.Error()}
+		}
+		fault.Path = parsed
+	}
+
+	if kind == FaultEnum && fault.Path[len(fault.Path)-1].Avp.Enum == nil {
+		return MessageFault{}, &diwe.ErrInvalidFault{Fault: spec, Reason: "AVP is not Enumerated"}
+	}
+
+	return fault, nil
+}
+
+// String returns the text of the fault in the ParseFault format.
+func (f MessageFault) String() string {
+	text := f.Kind
+	if f.Path != nil {
+		text += ":" + f.Path.String()
+	}
+	if f.Value != "" {
+		text += "=" + f.Value
+	}
+
+	return text
+}
+
+// Corrupt returns the serialized message with the faults applied. The message itself is not changed.
+// The AVP faults are applied first in the given order and locate the AVPs by their lengths,
+// so an AVP fault may not find the AVP after the preceding fault of the enclosing AVP.
+// The header faults are applied last.
+func (m *Message) Corrupt(faults ...MessageFault) ([]byte, error) {
+	data, err := m.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := slices.Clone(data)
+	for _, header := range []bool{false, true} {
+		for _, fault := range faults {
+			def, exists := faultKinds[fault.Kind]
+			if !exists {
+				return nil, &diwe.ErrInvalidFault{Fault: fault.String(), Reason: "unknown fault kind"}
+			}
+			if def.avp == header {
+				continue
+			}
+			if fault.Value == "" {
+				fault.Value = def.value
+			}
+
+			var chain []wireAvp
+			if def.avp {
+				if chain, err = locateAvp(raw, fault.Path, m.env.dict.AvpFlag().V); err != nil {
+					return nil, &diwe.ErrInvalidFault{Fault: fault.String(), Reason: err.Error()}
+				}
+			}
+			if raw, err = def.apply(m.env, raw, fault, chain); err != nil {
+				return nil, &diwe.ErrInvalidFault{Fault: fault.String(), Reason: err.Error()}
+			}
+		}
+	}
+
+	return raw, nil
+}
+
+// Trace prints the hex dump of the raw message.
+func (r RawMessage) Trace(shift ...int) {
+	fmt.Printf("Raw message: %d bytes\n%s", len(r), hex.Dump(r))
+}
+
+// SendRaw sends the raw bytes to the peer as is.
+// Returns an error if the operation fails.
+func (d *Diameter) SendRaw(peer *node.Node, data []byte) error {
+	return peer.SendTo(data)
+}
+
+// Helpers
+//
+
+// faultLength sets the message length.
+func faultLength(_ *Diameter, raw []byte, fault MessageFault, _ []wireAvp) ([]byte, error) {
+	n, err := faultNumber(fault.Value, getLength(raw, 0))
+	if err != nil {
+		return nil, err
+	}
+	setLength(raw, 0, n)
+
+	return raw, nil
+}
+
+// faultVersion sets the protocol version.
+func faultVersion(_ *Diameter, raw []byte, fault MessageFault, _ []wireAvp) ([]byte, error) {
+	n, err := strconv.ParseUint(fault.Value, 0, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version '%s'", fault.Value)
+	}
+	raw[0] = byte(n)
+
+	return raw, nil
+}
+
+// faultFlags sets the bits in the command flags.
+func faultFlags(_ *Diameter, raw []byte, fault MessageFault, _ []wireAvp) ([]byte, error) {
+	n, err := strconv.ParseUint(fault.Value, 0, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flags '%s'", fault.Value)
+	}
+	raw[4] |= byte(n)
+
+	return raw, nil
+}
+
+// faultAvpLength sets the AVP length.
+func faultAvpLength(_ *Diameter, raw []byte, fault MessageFault, chain []wireAvp) ([]byte, error) {
+	avp := chain[len(chain)-1]
+	n, err := faultNumber(fault.Value, avp.length)
+	if err != nil {
+		return nil, err
+	}
+	setLength(raw, avp.offset+4, n)
+
+	return raw, nil
+}
+
+// faultNoPadding removes the AVP padding.
+func faultNoPadding(_ *Diameter, raw []byte, _ MessageFault, chain []wireAvp) ([]byte, error) {
+	avp := chain[len(chain)-1]
+	end := avp.offset + avp.length
+	padded := min(avp.offset+int(alignTo4(uint32(avp.length))), len(raw))
+	if padded == end {
+		return nil, fmt.Errorf("AVP has no padding")
+	}
+
+	return resizeAvp(raw, chain[:len(chain)-1], end, padded, nil), nil
+}
+
+// faultEnum sets the Enumerated AVP value.
+func faultEnum(_ *Diameter, raw []byte, fault MessageFault, chain []wireAvp) ([]byte, error) {
+	avp := chain[len(chain)-1]
+	if avp.offset+avp.length-avp.data != 4 {
+		return nil, fmt.Errorf("invalid Enumerated AVP length %d", avp.length)
+	}
+
+	var value int64
+	if fault.Value == "" {
+		// first value above the dictionary items
+		for _, item := range fault.Path[len(fault.Path)-1].Avp.Enum.Items {
+			value = max(value, int64(item.Code)+1)
+		}
+	} else {
+		n, err := strconv.ParseInt(fault.Value, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Enumerated value '%s'", fault.Value)
+		}
+		value = n
+	}
+	binary.BigEndian.PutUint32(raw[avp.data:], uint32(int32(value)))
+
+	return raw, nil
+}
+
+// faultAvpFlags changes the AVP flags.
+func faultAvpFlags(d *Diameter, raw []byte, fault MessageFault, chain []wireAvp) ([]byte, error) {
+	avp := chain[len(chain)-1]
+	flags := raw[avp.offset+4]
+
+	if n, err := strconv.ParseUint(fault.Value, 0, 8); err == nil {
+		raw[avp.offset+4] = byte(n)
+		return raw, nil
+	}
+	if len(fault.Value) < 2 {
+		return nil, fmt.Errorf("invalid AVP flags '%s'", fault.Value)
+	}
+
+	bits := d.dict.AvpFlag()
+	var mask uint8
+	for _, flag := range strings.ToUpper(fault.Value[1:]) {
+		switch flag {
+		case 'V':
+			mask |= bits.V
+		case 'M':
+			mask |= bits.M
+		case 'P':
+			mask |= bits.P
+		default:
+			return nil, fmt.Errorf("invalid AVP flag '%c'", flag)
+		}
+	}
+
+	switch fault.Value[0] {
+	case '+':
+		flags |= mask
+	case '-':
+		flags &^= mask
+	case '~':
+		flags ^= mask
+	default:
+		return nil, fmt.Errorf("invalid AVP flags '%s'", fault.Value)
+	}
+	raw[avp.offset+4] = flags
+
+	return raw, nil
+}
+
+// faultTruncate cuts the bytes from the end of the AVP data.
+func faultTruncate(_ *Diameter, raw []byte, fault MessageFault, chain []wireAvp) ([]byte, error) {
+	avp := chain[len(chain)-1]
+	end := avp.offset + avp.length
+	n, err := strconv.Atoi(fault.Value)
+	if err != nil || n <= 0 || n > end-avp.data {
+		return nil, fmt.Errorf("cannot truncate '%s' of %d data bytes", fault.Value, end-avp.data)
+	}
+
+	length := avp.length - n
+	padded := min(avp.offset+int(alignTo4(uint32(avp.length))), len(raw))
+	padding := make([]byte, int(alignTo4(uint32(length)))-length)
+	raw = resizeAvp(raw, chain[:len(chain)-1], end-n, padded, padding)
+	setLength(raw, avp.offset+4, length)
+
+	return raw, nil
+}
+
+// faultNumber parses the length value: absolute or "+N"/"-N" delta to the current length.
+func faultNumber(value string, current int) (int, error) {
+	n, err := strconv.ParseInt(value, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length '%s'", value)
+	}
+	if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+		n += int64(current)
+	}
+	if n < 0 || n > mask24bits {
+		return 0, fmt.Errorf("length %d is out of range", n)
+	}
+
+	return int(n), nil
+}
+
+// locateAvp finds the AVP of the path in the serialized message.
+// Returns the locations of the path AVPs from the top level AVP to the AVP of the path.
+func locateAvp(raw []byte, path AvpPath, flagV uint8) ([]wireAvp, error) {
+	chain := make([]wireAvp, 0, len(path))
+	start, end := int(MinMessageLen), len(raw)
+
+	for _, elem := range path {
+		index, found := max(elem.Index, 0), false
+		for offset := start; !found && offset+8 <= end; {
+			avp := wireAvp{offset: offset, length: getLength(raw, offset+4), data: offset + 8}
+			if raw[offset+4]&flagV != 0 {
+				avp.data += 4
+			}
+			if avp.length < avp.data-offset || offset+avp.length > end {
+				return nil, fmt.Errorf("malformed AVP at offset %d", offset)
+			}
+
+			if binary.BigEndian.Uint32(raw[offset:]) == elem.Avp.Code {
+				if found = index == 0; found {
+					chain = append(chain, avp)
+				}
+				index--
+			}
+			offset += int(alignTo4(uint32(avp.length)))
+		}
+		if !found {
+			return nil, fmt.Errorf("AVP %s is not found", elem.Avp.Name)
+		}
+
+		last := chain[len(chain)-1]
+		start, end = last.data, last.offset+last.length
+	}
+
+	return chain, nil
+}
+
+// resizeAvp replaces the bytes raw[from:to] with the insert bytes and adjusts
+// the lengths of the enclosing AVPs and of the message by the size difference.
+func resizeAvp(raw []byte, parents []wireAvp, from, to int, insert []byte) []byte {
+	delta := len(insert) - (to - from)
+	raw = slices.Concat(raw[:from], insert, raw[to:])
+	for _, parent := range parents {
+		setLength(raw, parent.offset+4, parent.length+delta)
+	}
+	setLength(raw, 0, getLength(raw, 0)+delta)
+
+	return raw
+}
+
+// getLength returns the 24-bit length of the 4-byte word at the offset (message header or AVP header).
+func getLength(raw []byte, offset int) int {
+	return int(binary.BigEndian.Uint32(raw[offset:]) & mask24bits)
+}
+
+// setLength sets the 24-bit length of the 4-byte word at the offset, the first byte is kept.
+func setLength(raw []byte, offset int, length int) {
+	word := uint32(raw[offset])<<24 | uint32(length)&mask24bits
+	binary.BigEndian.PutUint32(raw[offset:], word)
+}
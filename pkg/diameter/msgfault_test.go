@@ -0,0 +1,114 @@
+package diameter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestMessageFault(t *testing.T) {
+	fmt.Println(">>> Message fault test")
+
+	env := newTestEnv(t)
+	msg, err := env.NewMessage("S6a", "UL", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetPath("User-Name", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetPath("Cancellation-Type", "SUBSCRIPTION_WITHDRAWAL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetPath("Terminal-Information.IMEI", "35123456789012"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := msg.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(specs ...string) []byte {
+		faults := []MessageFault{}
+		for _, spec := range specs {
+			fault, err := env.ParseFault(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			faults = append(faults, fault)
+		}
+		raw, err := msg.Corrupt(faults...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	avpAt := func(raw []byte, path string) wireAvp {
+		parsed, err := env.ParseAvpPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain, err := locateAvp(raw, parsed, env.dict.AvpFlag().V)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chain[len(chain)-1]
+	}
+
+	raw := corrupt("version=3", "flags", "length=-4")
+	if raw[0] != 3 || raw[4]&0x0F != 0x0F || getLength(raw, 0) != len(data)-4 {
+		t.Fatalf("Header faults: % x", raw[:8])
+	}
+	if data[0] != 1 || getLength(data, 0) != len(data) {
+		t.Fatal("The message is changed by the faults")
+	}
+
+	if avp := avpAt(corrupt("avp-length:User-Name=-1"), "User-Name"); avp.length != 10 {
+		t.Fatalf("AVP length: %d", avp.length)
+	}
+
+	raw = corrupt("no-padding:User-Name")
+	if len(raw) != len(data)-1 || getLength(raw, 0) != len(raw) {
+		t.Fatalf("No padding: %d of %d", len(raw), len(data))
+	}
+
+	raw = corrupt("enum:Cancellation-Type", "avp-flags:Cancellation-Type=-V")
+	avp := avpAt(data, "Cancellation-Type")
+	if value := binary.BigEndian.Uint32(raw[avp.data:]); value != 3 {
+		t.Fatalf("Enumerated value: %d", value)
+	}
+	if raw[avp.offset+4]&env.dict.AvpFlag().V != 0 {
+		t.Fatal("The V flag is not cleared")
+	}
+
+	raw = corrupt("truncate:Terminal-Information=4")
+	group, member := avpAt(raw, "Terminal-Information"), avpAt(data, "Terminal-Information.IMEI")
+	if len(raw) != len(data)-4 || getLength(raw, 0) != len(raw) || group.length != avpAt(data, "Terminal-Information").length-4 {
+		t.Fatalf("Truncated group: %d of %d", len(raw), len(data))
+	}
+	if member.offset+member.length <= group.offset+group.length {
+		t.Fatal("The member is not truncated")
+	}
+
+	for _, spec := range []string{"unknown", "avp-length", "version:User-Name", "enum:User-Name", "truncate:Unknown-AVP"} {
+		if _, err := env.ParseFault(spec); err == nil {
+			t.Fatalf("Invalid fault '%s' accepted", spec)
+		} else {
+			fmt.Println(err)
+		}
+	}
+	if fault, _ := env.ParseFault("truncate:User-Name=8"); fault.Kind == FaultTruncate {
+		if _, err := msg.Corrupt(fault); err == nil {
+			t.Fatal("Truncate over the AVP data accepted")
+		}
+	}
+
+	if payload, err := ParseHex("0x01 00:00 14"); err != nil || len(payload) != 4 || payload[3] != 0x14 {
+		t.Fatalf("Hex payload: %v %v", payload, err)
+	}
+	if _, err := ParseHex("01 0z"); err == nil {
+		t.Fatal("Invalid hex payload accepted")
+	}
+
+	fmt.Println("<<< Message fault test")
+}
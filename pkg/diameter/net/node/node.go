@@ -20,10 +20,12 @@ import (
 	"os/signal"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"tgdp/pkg/diameter/api"
 	"tgdp/pkg/diameter/diwe"
 	"tgdp/pkg/diameter/net/transport"
+	"tgdp/pkg/diameter/stats"
 
 	netroute "github.com/libp2p/go-netroute"
 )
@@ -107,6 +109,8 @@ type Node struct {
 	rxChan chan rxItem
 	// ccChan is the channel for interrupt signals.
 	ccChan chan os.Signal
+	// done is closed when the receive handler of the connection exits.
+	done chan struct{}
 	// mu is the mutex for race conditions avoiding.
 	mu sync.Mutex
 	// ctx is the context for inform node is shutdown.
@@ -116,7 +120,7 @@ type Node struct {
 	// IDiameter is the API calls to process Diameter messages.
 	diaApi api.IDiameter
 	// User callback function.
-	ucb UserCallbackFn
+	ucb atomic.Pointer[UserCallbackFn]
 }
 
 // RouteInfo holds network routing information for a peer.
@@ -144,6 +148,14 @@ type rxItem struct {
 // User defined callback function calling on a data receied
 type UserCallbackFn func([]byte, *Node) bool
 
+// TapFn is called on every message sent to or received from the peer (including the common messages),
+// the sent flag is true for the outgoing message. The data must not be modified.
+type TapFn func(data []byte, node *Node, sent bool)
+
+// ObserverFn is called on every message received from the peer before it is handled,
+// the data must not be modified or retained.
+type ObserverFn func(data []byte, node *Node)
+
 // Methods
 //
 // # RouteInfo
@@ -229,6 +241,11 @@ func (node *Node) Connect() error {
 		return &diwe.ErrAlreadyConnected{Peer: node.Name}
 	}
 
+	// The receive handler of the previous connection must not touch the new one
+	if node.done != nil {
+		<-node.done
+	}
+
 	node.SetState(StateWaitConnAck)
 
 	node.LocalPort = rand.IntN(32768) + transport.DefaultPort
@@ -244,7 +261,7 @@ func (node *Node) Connect() error {
 
 	err := node.sendCommonMessage(api.CmdCapabilitiesExchange, true)
 	if err != nil {
-		node.SetState(StateClosed)
+		node.Close() // nolint: errcheck
 		return err
 	}
 
@@ -259,9 +276,10 @@ func (node *Node) init() {
 
 	node.rxChan = make(chan rxItem, maxMessages)
 	node.ccChan = make(chan os.Signal, 1)
+	node.done = make(chan struct{})
 
 	ready := make(chan struct{}, 1)
-	go node.asyncHandler(ready)
+	go node.asyncHandler(node.ctx, node.rxChan, node.done, ready)
 	<-ready
 	close(ready)
 }
@@ -296,6 +314,8 @@ func (node *Node) Close() error {
 
 	if node.IsClient() {
 		node.parent.Remove(node.Name)
+		// The client connection names are not reused, the counters are kept by the client host
+		node.stats().Fold(node.Name, clientHostName(node.Address))
 	}
 
 	node.SetState(StateClosed)
@@ -305,10 +325,9 @@ func (node *Node) Close() error {
 		close(node.ccChan)
 		node.ccChan = nil
 	}
-	if node.rxChan != nil {
-		close(node.rxChan)
-		node.ccChan = nil
-	}
+	// The receive channel is kept as it is: the handler may still deliver to it until it sees
+	// the context is done and the waiting recvFrom reads it without the lock. It is replaced by
+	// the next connection only, under the lock.
 
 	err := node.tr.Close()
 	if err != nil {
@@ -337,6 +356,8 @@ func (node *Node) sendTo(data []byte) error {
 	if err := node.tr.Send(data); err != nil {
 		return &diwe.ErrSendTo{Err: err, Peer: node.Name}
 	}
+	node.stats().Sent(node.Name, data, time.Duration(node.Timeout)*time.Second)
+	node.tap(data, true)
 
 	return nil
 }
@@ -435,6 +456,16 @@ func (node *Node) IsClient() bool {
 	return node.client
 }
 
+// SetCallback sets the user callback function called on the received data (except the common messages),
+// the data is not passed to RecvFrom if the callback returns true. The nil callback removes the callback.
+func (node *Node) SetCallback(ucb UserCallbackFn) {
+	if ucb == nil {
+		node.ucb.Store(nil)
+		return
+	}
+	node.ucb.Store(&ucb)
+}
+
 // HasData returns true if there is pending data in the receive channel.
 func (node *Node) HasData() bool {
 	return len(node.rxChan) > 0
@@ -468,42 +499,96 @@ func (node *Node) Trace(shift ...int) {
 	fmt.Println()
 }
 
-// recvHandler handles incoming data from the transport layer.
-func (node *Node) asyncHandler(ready chan struct{}) {
+// stats returns the traffic statistics of the node collection, nil for the node without the collection.
+func (node *Node) stats() *stats.Stats {
+	if node.parent == nil {
+		return nil
+	}
+	return node.parent.stats
+}
+
+// tap passes the message to the tap function of the node collection if it is set.
+func (node *Node) tap(data []byte, sent bool) {
+	if node.parent == nil {
+		return
+	}
+	if fn := node.parent.tap.Load(); fn != nil {
+		(*fn)(data, node, sent)
+	}
+}
+
+// observe passes the received message to the observer function of the node collection if it is set.
+func (node *Node) observe(data []byte) {
+	if node.parent == nil {
+		return
+	}
+	if fn := node.parent.observer.Load(); fn != nil {
+		(*fn)(data, node)
+	}
+}
+
+// asyncHandler handles incoming data from the transport layer.
+// The context and the receive channel belong to the connection the handler was started for,
+// so the handler of a closed connection never delivers to or closes the reconnected one.
+func (node *Node) asyncHandler(ctx context.Context, rx chan rxItem, done chan struct{}, ready chan struct{}) {
+	defer close(done)
 	ready <- struct{}{}
 
 	for {
 		select {
-		case <-node.ctx.Done():
+		case <-ctx.Done():
 			return
 
 		default:
 			data, err := node.tr.Recv()
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				if transport.IsClosedError(err) {
 					node.Close() // nolint: errcheck
 					return
 
 				}
-				node.rxChan <- rxItem{nil, err}
+				deliver(ctx, rx, rxItem{nil, err})
 				continue
 			}
+			node.stats().Received(node.Name, data)
+			node.tap(data, false)
+			node.observe(data)
 
-			if node.handleCommonMessage(data) {
+			if node.handleCommonMessage(ctx, rx, data) {
 				continue
 			}
 
-			if node.ucb != nil && node.ucb(data, node) {
+			if ucb := node.ucb.Load(); ucb != nil && (*ucb)(data, node) {
 				continue
 			}
 
-			node.rxChan <- rxItem{data, err}
+			deliver(ctx, rx, rxItem{data, err})
 		}
 	}
 }
 
+// clientHostName returns the peer name of the client host without the port of the connection.
+func clientHostName(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return fmt.Sprintf("peer-%s", host)
+}
+
+// deliver passes the received item to the receive channel, gives up when the connection is closed.
+func deliver(ctx context.Context, rx chan rxItem, item rxItem) {
+	select {
+	case rx <- item:
+	case <-ctx.Done():
+	}
+}
+
 // handleCommonMessage auto handles incoming common messages (AppID == 0).
-func (node *Node) handleCommonMessage(data []byte) bool {
+func (node *Node) handleCommonMessage(ctx context.Context, rx chan rxItem, data []byte) bool {
 	_, _, appId, _, flags, _, _, err := node.diaApi.MessageHeader(data)
 	if err != nil {
 		return false
@@ -515,7 +600,7 @@ func (node *Node) handleCommonMessage(data []byte) bool {
 		if node.diaApi.IsRequest(flags) {
 			return node.replyCommonMessage(data) == nil
 		}
-		node.rxChan <- rxItem{data, nil}
+		deliver(ctx, rx, rxItem{data, nil})
 		return true
 	}
 
@@ -19,10 +19,12 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"tgdp/pkg/diameter/api"
 	"tgdp/pkg/diameter/diwe"
 	"tgdp/pkg/diameter/net/transport"
+	"tgdp/pkg/diameter/stats"
 
 	"gopkg.in/yaml.v3"
 )
@@ -39,15 +41,48 @@ type yamlPeer struct {
 type Nodes struct {
 	mu    sync.RWMutex
 	nodes []*Node
+	// stats is the traffic statistics of all nodes of the collection
+	stats *stats.Stats
+	// tap is the function observing the messages of all nodes of the collection
+	tap *atomic.Pointer[TapFn]
+	// observer is the function observing the messages received by all nodes of the collection
+	observer *atomic.Pointer[ObserverFn]
 }
 
 // NewNodes creates a new empty Nodes collection.
 func NewNodes() Nodes {
 	return Nodes{
-		nodes: make([]*Node, 0),
+		nodes:    make([]*Node, 0),
+		stats:    stats.New(),
+		tap:      &atomic.Pointer[TapFn]{},
+		observer: &atomic.Pointer[ObserverFn]{},
 	}
 }
 
+// Stats returns the traffic statistics of the collection nodes.
+func (n *Nodes) Stats() *stats.Stats {
+	return n.stats
+}
+
+// SetTap sets the function called on every message of the collection nodes, nil removes the function.
+func (n *Nodes) SetTap(fn TapFn) {
+	if fn == nil {
+		n.tap.Store(nil)
+		return
+	}
+	n.tap.Store(&fn)
+}
+
+// SetObserver sets the function called on every message received by the collection nodes,
+// nil removes the function.
+func (n *Nodes) SetObserver(fn ObserverFn) {
+	if fn == nil {
+		n.observer.Store(nil)
+		return
+	}
+	n.observer.Store(&fn)
+}
+
 // NewPeer creates and adds a new peer to the collection.
 // Returns error if peer with same name already exists.
 func (n *Nodes) NewPeer(name string, addr string, port int, proto string, timeout int, diaApi api.IDiameter) (*Node, error) {
@@ -99,7 +134,7 @@ func (n *Nodes) NewPeerEx(tr transport.ITransport, diaApi api.IDiameter, ucb Use
 	node.Address = tr.RemoteAddr()
 	node.Name = fmt.Sprintf("peer-%s", node.Address)
 	node.diaApi = diaApi
-	node.ucb = ucb
+	node.SetCallback(ucb)
 	node.ctx = context.Background()
 
 	node.init()
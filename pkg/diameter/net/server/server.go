@@ -19,6 +19,7 @@ import (
 
 	"tgdp/pkg/diameter"
 	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/metrics"
 	"tgdp/pkg/diameter/net/node"
 	"tgdp/pkg/diameter/net/transport"
 )
@@ -69,6 +70,10 @@ type Server struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	env          *diameter.Diameter
+	// accepted, rejected and connections are the client connections counters
+	accepted    atomic.Uint64
+	rejected    atomic.Uint64
+	connections atomic.Int64
 }
 
 // WorkerPool manages a pool of worker goroutines for handling concurrent tasks.
@@ -107,6 +112,16 @@ func (wp *WorkerPool) Wait() {
 	wp.wg.Wait()
 }
 
+// Busy returns the number of the running tasks.
+func (wp *WorkerPool) Busy() int {
+	return len(wp.workers)
+}
+
+// Size returns the maximum number of the concurrent tasks.
+func (wp *WorkerPool) Size() int {
+	return wp.maxWorkers
+}
+
 // Add increments the wait group counter.
 func (wp *WorkerPool) Add(delta int) {
 	wp.wg.Add(delta)
@@ -309,6 +324,21 @@ func (s *Server) Dump() {
 	}
 }
 
+// Collect adds the server metrics: the state, the client connections and the worker pool usage.
+func (s *Server) Collect(w *metrics.Writer) {
+	running := 0.0
+	if s.IsRunning() {
+		running = 1
+	}
+	w.Gauge("tgdp_server_running", "Server is accepting connections", running)
+	w.Counter("tgdp_server_connections_accepted_total", "Client connections accepted", float64(s.accepted.Load()))
+	w.Counter("tgdp_server_connections_rejected_total", "Client connections rejected, the worker pool is full",
+		float64(s.rejected.Load()))
+	w.Gauge("tgdp_server_connections", "Client connections open", float64(s.connections.Load()))
+	w.Gauge("tgdp_server_workers_busy", "Worker pool running connection handlers", float64(s.wp.Busy()))
+	w.Gauge("tgdp_server_workers_max", "Worker pool size", float64(s.wp.Size()))
+}
+
 // runListener starts a goroutine that accepts incoming connections on the given listener.
 // The autoReply parameter controls whether connections are handled with automatic message receiving.
 // The wg WaitGroup is decremented when the listener is ready or fails to start.
@@ -334,14 +364,18 @@ func (s *Server) runListener(listener transport.IListener) {
 						return
 					}
 					s.Verbose(Error, "Accept failed", slog.Any("error", err))
+					continue
 				}
 
 				if !s.wp.Execute(func() {
 					s.connHandler(tr)
 				}) {
+					s.rejected.Add(1)
 					s.Verbose(Warn, "Number of clients exceeded")
 					tr.Close() //nolint:errcheck
+					continue
 				}
+				s.accepted.Add(1)
 			}
 		}
 	}()
@@ -354,6 +388,8 @@ func (s *Server) connHandler(tr transport.ITransport) {
 	rAddr := tr.RemoteAddr()
 
 	s.Verbose(Info, "Connected from", slog.String("address", rAddr))
+	s.connections.Add(1)
+	defer s.connections.Add(-1)
 
 	peer, _ := s.env.NewPeerEx(tr, s.reply)
 	if s.VerboseLevel() == Debug {
@@ -389,12 +425,14 @@ func (s *Server) reply(data []byte, peer *node.Node) bool {
 		s.Verbose(Error, "Reply failed", slog.String("peer", peer.Name), slog.Any("error", err))
 		return false
 	}
+	defer msg.Release()
 	s.env.Trace(msg, diameter.TraceMsg) // FIXME: Remove or comment for better performance
 
 	response, err := msg.Response()
 	if err == nil {
 		s.env.Trace(response, diameter.TraceMsg) // FIXME: Remove or comment for better performance
 		err = s.env.SendMessage(peer, response)
+		response.Release()
 	}
 	if err != nil {
 		s.Verbose(Error, "Reply failed", slog.String("peer", peer.Name), slog.Any("error", err))
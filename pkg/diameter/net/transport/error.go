@@ -31,3 +31,11 @@ type ErrUnknownProto struct {
 func (e *ErrUnknownProto) Error() string {
 	return fmt.Sprintf("Unknown protocol: %s", e.Proto)
 }
+
+type ErrInvalidLength struct {
+	Length uint32
+}
+
+func (e *ErrInvalidLength) Error() string {
+	return fmt.Sprintf("Invalid message length %d, the message framing is lost", e.Length)
+}
@@ -11,7 +11,10 @@
 package transport
 
 import (
+	"bufio"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"net/netip"
 	"time"
@@ -22,6 +25,11 @@ import (
 
 const (
 	TransportTcp = 2
+
+	// tcpLengthBytes is the size of the message header part with the Version and the Message Length
+	tcpLengthBytes = 4
+	// tcpHeaderBytes is the size of the Diameter message header, the minimum Message Length
+	tcpHeaderBytes = 20
 )
 
 // Types
@@ -31,6 +39,8 @@ const (
 type Tcp struct {
 	Connection *net.TCPConn
 	Err        error
+	// reader buffers the TCP stream for framing the messages
+	reader *bufio.Reader
 }
 
 // TcpListener wraps a TCP network listener.
@@ -60,15 +70,16 @@ func (t *Tcp) Connect(remoteAddr netip.Addr, remotePort int, localAddr netip.Add
 	}
 
 	t.Connection = conn
+	t.reader = nil
 
 	return nil
 }
 
+// Close closes the connection. The error of the Close is returned only, Err is owned by the
+// receiving goroutine which can still be in Recv.
 func (t *Tcp) Close() error {
 	if t != nil && t.Connection != nil {
-		err := t.Connection.Close()
-		t.Err = err
-		return err
+		return t.Connection.Close()
 	}
 
 	return nil
@@ -87,17 +98,24 @@ func (t *Tcp) Send(buf []byte) error {
 	return nil
 }
 
+// Recv receives one Diameter message. TCP is a stream, so the messages are framed
+// by the Message Length of the header, the pipelined messages are received one by one.
+// The invalid Message Length loses the framing, the connection is closed.
 func (t *Tcp) Recv() ([]byte, error) {
-	var buf [65535]byte
+	if t.reader == nil {
+		t.reader = bufio.NewReader(t.Connection)
+	}
 
-	if n, err := t.Connection.Read(buf[:]); err == nil {
-		data := make([]byte, n)
-		copy(data, buf[:n])
-		return data, nil
-	} else {
+	data, err := readMessage(t.reader)
+	if err != nil {
 		t.Err = err
+		if _, ok := err.(*ErrInvalidLength); ok {
+			t.Connection.Close() // nolint: errcheck
+		}
 		return nil, err
 	}
+
+	return data, nil
 }
 
 func (t *Tcp) IsConnected() bool {
@@ -220,3 +238,35 @@ func (l *TcpListener) Uri() string {
 func (l *TcpListener) Name() string {
 	return "TCP"
 }
+
+// Helpers
+//
+
+// readMessage reads one Diameter message framed by the Message Length of the header.
+// The Message Length shorter than the header is ErrInvalidLength.
+func readMessage(reader *bufio.Reader) ([]byte, error) {
+	var header [tcpLengthBytes]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:]) & 0x00FFFFFF
+	if length < tcpHeaderBytes {
+		return nil, &ErrInvalidLength{Length: length}
+	}
+
+	data := make([]byte, length)
+	copy(data, header[:])
+	if _, err := io.ReadFull(reader, data[tcpLengthBytes:]); err != nil {
+		// the connection is closed in the middle of the message
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestTcpFraming(t *testing.T) {
+	fmt.Println(">>> TCP message framing test")
+
+	header := func(length uint32) []byte {
+		data := make([]byte, tcpHeaderBytes)
+		binary.BigEndian.PutUint32(data, 1<<24|length)
+		return data
+	}
+
+	for _, length := range []uint32{0, tcpLengthBytes, tcpHeaderBytes - 1} {
+		client, server := net.Pipe()
+		go func() {
+			client.Write(header(tcpHeaderBytes)) // nolint: errcheck
+			client.Write(header(length))         // nolint: errcheck
+			client.Close()                       // nolint: errcheck
+		}()
+
+		reader := bufio.NewReader(server)
+		data, err := readMessage(reader)
+		if err != nil || len(data) != tcpHeaderBytes {
+			t.Fatalf("Valid message: %d bytes, %v", len(data), err)
+		}
+
+		_, err = readMessage(reader)
+		fmt.Printf("<<< length %d: %v\n", length, err)
+		if _, ok := err.(*ErrInvalidLength); !ok {
+			t.Fatalf("Length %d accepted: %v", length, err)
+		}
+		if !IsClosedError(err) {
+			t.Fatalf("Length %d: the connection is not closed by %v", length, err)
+		}
+		server.Close() // nolint: errcheck
+	}
+}
+
+func TestTcpRecvInvalidLength(t *testing.T) {
+	fmt.Println(">>> TCP receive of the invalid message length test")
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close() // nolint: errcheck
+
+	// The peer sends a valid message and the header with Message Length 0
+	peerClosed := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			peerClosed <- err
+			return
+		}
+		defer conn.Close() // nolint: errcheck
+
+		data := make([]byte, 2*tcpHeaderBytes)
+		binary.BigEndian.PutUint32(data, 1<<24|tcpHeaderBytes)
+		binary.BigEndian.PutUint32(data[tcpHeaderBytes:], 1<<24)
+		conn.Write(data) // nolint: errcheck
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+		_, err = conn.Read(make([]byte, 1))
+		peerClosed <- err
+	}()
+
+	tcp := &Tcp{}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := tcp.Connect(netip.MustParseAddr("127.0.0.1"), port, netip.MustParseAddr("127.0.0.1"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := tcp.Recv(); err != nil || len(data) != tcpHeaderBytes {
+		t.Fatalf("Valid message: %d bytes, %v", len(data), err)
+	}
+
+	_, err = tcp.Recv()
+	fmt.Printf("<<< %v\n", err)
+	if _, ok := err.(*ErrInvalidLength); !ok || tcp.Error() != err {
+		t.Fatalf("Invalid length accepted: %v, transport error %v", err, tcp.Error())
+	}
+
+	// The connection is closed on both sides
+	if _, err := tcp.Connection.Write([]byte{0}); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Connection is not closed: %v", err)
+	}
+	if err := <-peerClosed; err != io.EOF {
+		t.Fatalf("Peer connection is not closed: %v", err)
+	}
+}
@@ -86,11 +86,17 @@ func New(proto string) (ITransport, error) {
 
 // Helpers
 //
-// isClosedError returns true if the error is a closed error (net.ErrClosed, io.EOF, syscall.EPIPE, ...).
+// IsClosedError returns true if the error is a closed error (net.ErrClosed, io.EOF, syscall.EPIPE, ...)
+// or the error the connection was closed by (ErrInvalidLength).
 func IsClosedError(err error) bool {
 	if _, ok := err.(*net.OpError); ok {
 		return true
 	}
+	// the stream with the lost framing is closed by Recv
+	var length *ErrInvalidLength
+	if errors.As(err, &length) {
+		return true
+	}
 	return errors.Is(err, net.ErrClosed) ||
 		errors.Is(err, fs.ErrClosed) ||
 		errors.Is(err, os.ErrClosed) ||
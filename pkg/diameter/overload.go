@@ -0,0 +1,444 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: overload.go
+// Description: Diameter pkg: DOIC overload control (RFC 7683)
+//
+
+package diameter
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tgdp/pkg/diameter/dict"
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+)
+
+// Consts
+//
+
+// AVP codes (RFC 7683)
+const (
+	avpOcSupportedFeatures = uint32(621) // OC-Supported-Features
+	avpOcOlr               = uint32(623) // OC-OLR
+)
+
+// AVP paths of the DOIC AVPs
+const (
+	ocFeatureVectorPath = "OC-Supported-Features.OC-Feature-Vector"
+	ocSequencePath      = "OC-OLR.OC-Sequence-Number"
+	ocReportTypePath    = "OC-OLR.OC-Report-Type"
+	ocReductionPath     = "OC-OLR.OC-Reduction-Percentage"
+	ocValidityPath      = "OC-OLR.OC-Validity-Duration"
+)
+
+// Overload report types (OC-Report-Type)
+const (
+	OverloadHost  = int32(0) // HOST_REPORT
+	OverloadRealm = int32(1) // REALM_REPORT
+)
+
+const (
+	// OverloadDefaultValidity is the validity of the report without OC-Validity-Duration
+	OverloadDefaultValidity = 30 * time.Second
+	// OverloadMaxValidity is the maximum validity of the report
+	OverloadMaxValidity = 86400 * time.Second
+	// ocLossAlgorithm is the OC-Feature-Vector bit of the loss abatement algorithm (OLR_DEFAULT_ALGO)
+	ocLossAlgorithm = uint64(1)
+)
+
+// Types
+//
+
+// OverloadReport is the overload report (OC-OLR): the reporting host or realm asks the reacting nodes
+// to abate the given percentage of their requests during the validity.
+type OverloadReport struct {
+	// Type is OverloadHost or OverloadRealm
+	Type int32
+	// Node is the reporting host (Origin-Host) or realm (Origin-Realm) of the answer
+	Node string
+	// Sequence is OC-Sequence-Number, the report replaces the reports with the lower sequence numbers
+	Sequence uint64
+	// Reduction is OC-Reduction-Percentage 0-100
+	Reduction uint32
+	// Validity is OC-Validity-Duration, the zero validity ends the overload condition
+	Validity time.Duration
+	// Expires is the end of the received report validity
+	Expires time.Time
+	// Abated is the number of the requests abated by the received report
+	Abated uint64
+}
+
+// overloadKey identifies the received report.
+type overloadKey struct {
+	typ  int32
+	node string
+}
+
+// overload is the DOIC state of the environment: the reports received as the reacting node
+// and the report added to the answers as the reporting node.
+type overload struct {
+	enabled atomic.Bool
+	abated  atomic.Uint64
+
+	// mu protects the fields below
+	mu       sync.Mutex
+	reports  map[overloadKey]*OverloadReport
+	answer   *OverloadReport
+	sequence uint64
+}
+
+// Variables
+//
+
+// ocOlrPath is the path of the top level OC-OLR located in the received messages
+var ocOlrPath = AvpPath{{Avp: &dict.Avp{Code: avpOcOlr, Name: "OC-OLR"}, Index: -1}}
+
+// Functions
+//
+
+// OverloadTypeName returns the report type name: "host" or "realm".
+func OverloadTypeName(typ int32) string {
+	if typ == OverloadRealm {
+		return "realm"
+	}
+	return "host"
+}
+
+// ParseOverloadType returns the report type of the name: "host" or "realm".
+func ParseOverloadType(name string) (int32, error) {
+	switch strings.ToLower(name) {
+	case "host", "":
+		return OverloadHost, nil
+	case "realm":
+		return OverloadRealm, nil
+	}
+	return 0, &diwe.ErrInvalidOverloadReport{Reason: fmt.Sprintf("unknown type '%s', expected host | realm", name)}
+}
+
+// Methods
+//
+
+// OverloadControl reports whether the DOIC reacting node is enabled.
+func (d *Diameter) OverloadControl() bool {
+	return d.overload.enabled.Load()
+}
+
+// SetOverloadControl enables or disables the DOIC reacting node: the application requests advertise
+// the loss algorithm in OC-Supported-Features, OC-OLR of the answers are tracked and the requests
+// to the overloaded nodes are abated. The dictionary must define the DOIC AVPs.
+func (d *Diameter) SetOverloadControl(enabled bool) error {
+	if enabled {
+		if err := d.checkOverloadAvps(); err != nil {
+			return err
+		}
+	}
+	d.overload.enabled.Store(enabled)
+
+	return nil
+}
+
+// OverloadReports returns the valid received reports sorted by the type and the node.
+func (d *Diameter) OverloadReports() []OverloadReport {
+	o := &d.overload
+	now := time.Now()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	reports := make([]OverloadReport, 0, len(o.reports))
+	for key, report := range o.reports {
+		if now.After(report.Expires) {
+			delete(o.reports, key)
+			continue
+		}
+		reports = append(reports, *report)
+	}
+	slices.SortFunc(reports, func(a, b OverloadReport) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), strings.Compare(a.Node, b.Node))
+	})
+
+	return reports
+}
+
+// OverloadAbated returns the number of the requests abated by the received reports.
+func (d *Diameter) OverloadAbated() uint64 {
+	return d.overload.abated.Load()
+}
+
+// ClearOverloadReports removes the received reports.
+func (d *Diameter) ClearOverloadReports() {
+	d.overload.mu.Lock()
+	d.overload.reports = nil
+	d.overload.mu.Unlock()
+}
+
+// OverloadAnswer returns the report added to the answers, nil if the answers have no report.
+func (d *Diameter) OverloadAnswer() *OverloadReport {
+	d.overload.mu.Lock()
+	defer d.overload.mu.Unlock()
+
+	if d.overload.answer == nil {
+		return nil
+	}
+	report := *d.overload.answer
+	return &report
+}
+
+// SetOverloadAnswer sets the report added to the answers to the requests advertising DOIC support,
+// nil stops reporting. The zero sequence number is set to the next one, the Node is not used:
+// the report is sent by the Origin-Host or the Origin-Realm of the answer.
+func (d *Diameter) SetOverloadAnswer(report *OverloadReport) error {
+	if report == nil {
+		d.overload.mu.Lock()
+		d.overload.answer = nil
+		d.overload.mu.Unlock()
+		return nil
+	}
+
+	if report.Type != OverloadHost && report.Type != OverloadRealm {
+		return &diwe.ErrInvalidOverloadReport{Reason: fmt.Sprintf("unknown type %d", report.Type)}
+	}
+	if report.Reduction > 100 {
+		return &diwe.ErrInvalidOverloadReport{Reason: "reduction must be 0-100%"}
+	}
+	if report.Validity < 0 || report.Validity > OverloadMaxValidity {
+		return &diwe.ErrInvalidOverloadReport{Reason: fmt.Sprintf("validity must be 0-%s", OverloadMaxValidity)}
+	}
+	if err := d.checkOverloadAvps(); err != nil {
+		return err
+	}
+
+	answer := *report
+	d.overload.mu.Lock()
+	defer d.overload.mu.Unlock()
+
+	// the sequence numbers grow across the restarts
+	if answer.Sequence == 0 {
+		answer.Sequence = max(d.overload.sequence+1, uint64(time.Now().Unix()))
+	}
+	d.overload.sequence = answer.Sequence
+	d.overload.answer = &answer
+
+	return nil
+}
+
+// AdmitRequest applies the DOIC reacting node to the request sent to the peer: OC-Supported-Features
+// is added if the request has none and the loss algorithm of the matching report is applied.
+// Returns diwe.ErrOverloadAbated if the request is abated and must not be sent.
+// The control is applied once: the admitted request is sent by SendMessage as it is.
+// The host report applies to the requests with its Destination-Host, the realm report applies
+// to the requests with its Destination-Realm and without Destination-Host.
+func (d *Diameter) AdmitRequest(peer *node.Node, msg *Message) error {
+	if !d.overload.enabled.Load() || !msg.IsRequest() || msg.IsCommon() || msg.admitted {
+		return nil
+	}
+	msg.admitted = true
+
+	if _, err := msg.GetAvp(avpOcSupportedFeatures); err != nil {
+		if err := msg.SetPath(ocFeatureVectorPath, ocLossAlgorithm); err != nil {
+			return err
+		}
+	}
+
+	key := overloadKey{typ: OverloadRealm}
+	if host, err := msg.GetAvpValue(avpDestinationHost); err == nil {
+		key = overloadKey{typ: OverloadHost, node: strings.ToLower(fmt.Sprint(host))}
+	} else if realm, err := msg.GetAvpValue(avpDestinationRealm); err == nil {
+		key.node = strings.ToLower(fmt.Sprint(realm))
+	} else {
+		return nil
+	}
+
+	o := &d.overload
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	report, exists := o.reports[key]
+	if !exists {
+		return nil
+	}
+	if time.Now().After(report.Expires) {
+		delete(o.reports, key)
+		return nil
+	}
+	if report.Reduction == 0 || d.lossDraw() >= float64(report.Reduction) {
+		return nil
+	}
+
+	report.Abated++
+	o.abated.Add(1)
+
+	return &diwe.ErrOverloadAbated{Peer: peer.Name, Node: report.Node, Reduction: report.Reduction}
+}
+
+// Helpers
+//
+
+// checkOverloadAvps checks that the dictionary defines the DOIC AVPs.
+func (d *Diameter) checkOverloadAvps() error {
+	for _, path := range []string{ocFeatureVectorPath, ocSequencePath, ocReportTypePath, ocReductionPath, ocValidityPath} {
+		if _, err := d.ParseAvpPath(path); err != nil {
+			return &diwe.ErrInvalidOverloadReport{Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// lossDraw returns the random number in [0, 100) compared with the reduction percentage.
+func (d *Diameter) lossDraw() float64 {
+	d.rngMu.Lock()
+	defer d.rngMu.Unlock()
+
+	return d.rng.Float64() * 100
+}
+
+// observeOverload is the observer of the received messages: OC-OLR of the application answers
+// updates the received reports. The OC-OLR is located in the serialized message before
+// the message is decoded.
+func (d *Diameter) observeOverload(data []byte, peer *node.Node) {
+	if !d.overload.enabled.Load() || len(data) < int(MinMessageLen) {
+		return
+	}
+	_, _, appId, _, flags, _, _, err := d.MessageHeader(data)
+	if err != nil || d.IsRequest(flags) || d.IsCommonMessage(appId) {
+		return
+	}
+	if _, err := locateAvp(data, ocOlrPath, d.dict.AvpFlag().V); err != nil {
+		return
+	}
+
+	msg, err := d.BytesToMessage(data)
+	if err != nil {
+		return
+	}
+	defer msg.Release()
+
+	report, err := readOverloadReport(msg)
+	if err != nil {
+		d.logger.Warn("Overload report ignored", "peer", peer.Name, "error", err)
+		return
+	}
+	d.overload.update(report, time.Now())
+}
+
+// update applies the received report: the report with the higher sequence number replaces
+// the valid report of the node, the zero validity ends the overload condition.
+func (o *overload) update(report *OverloadReport, now time.Time) {
+	key := overloadKey{typ: report.Type, node: strings.ToLower(report.Node)}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	current, exists := o.reports[key]
+	if exists && report.Sequence <= current.Sequence && !now.After(current.Expires) {
+		return
+	}
+	if report.Validity == 0 {
+		delete(o.reports, key)
+		return
+	}
+
+	if exists {
+		report.Abated = current.Abated
+	}
+	report.Expires = now.Add(report.Validity)
+	if o.reports == nil {
+		o.reports = make(map[overloadKey]*OverloadReport)
+	}
+	o.reports[key] = report
+}
+
+// readOverloadReport returns the report of the OC-OLR of the answer.
+func readOverloadReport(msg *Message) (*OverloadReport, error) {
+	report := &OverloadReport{Validity: OverloadDefaultValidity}
+
+	sequence, ok := pathValue(msg, ocSequencePath).(uint64)
+	if !ok {
+		return nil, &diwe.ErrInvalidOverloadReport{Reason: "OC-Sequence-Number expected"}
+	}
+	report.Sequence = sequence
+
+	typ, ok := pathValue(msg, ocReportTypePath).(int32)
+	if !ok || (typ != OverloadHost && typ != OverloadRealm) {
+		return nil, &diwe.ErrInvalidOverloadReport{Reason: "OC-Report-Type expected"}
+	}
+	report.Type = typ
+
+	if reduction, ok := pathValue(msg, ocReductionPath).(uint32); ok {
+		report.Reduction = min(reduction, 100)
+	}
+	if validity, ok := pathValue(msg, ocValidityPath).(uint32); ok {
+		report.Validity = min(time.Duration(validity)*time.Second, OverloadMaxValidity)
+	}
+
+	origin := avpOriginHost
+	if typ == OverloadRealm {
+		origin = avpOriginRealm
+	}
+	node, err := msg.GetAvpValue(origin)
+	if err != nil {
+		return nil, err
+	}
+	report.Node = fmt.Sprint(node)
+
+	return report, nil
+}
+
+// reportOverload adds the report of the reporting node to the answer if the request advertises
+// the loss algorithm. The OC-Supported-Features of the answer carries the selected algorithm only
+// (RFC 7683 5.3.2), not all the features of the request.
+func (d *Diameter) reportOverload(request, answer *Message) error {
+	if request.IsCommon() {
+		return nil
+	}
+	vector, ok := pathValue(request, ocFeatureVectorPath).(uint64)
+	if !ok || vector&ocLossAlgorithm == 0 {
+		return nil
+	}
+
+	d.overload.mu.Lock()
+	report := d.overload.answer
+	d.overload.mu.Unlock()
+	if report == nil {
+		return nil
+	}
+
+	answer.RemoveAvp(avpOcSupportedFeatures) // nolint: errcheck
+
+	for _, value := range []struct {
+		path  string
+		value any
+	}{
+		{ocFeatureVectorPath, ocLossAlgorithm},
+		{ocSequencePath, report.Sequence},
+		{ocReportTypePath, report.Type},
+		{ocReductionPath, report.Reduction},
+		{ocValidityPath, uint32(report.Validity / time.Second)},
+	} {
+		if err := answer.SetPath(value.path, value.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pathValue returns the value of the first AVP of the path, nil if the AVP is missing.
+func pathValue(msg *Message, path string) any {
+	avps, err := msg.GetPath(path)
+	if err != nil || len(avps) == 0 {
+		return nil
+	}
+	return avps[0].Value()
+}
@@ -0,0 +1,160 @@
+package diameter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+)
+
+func TestOverload(t *testing.T) {
+	fmt.Println(">>> DOIC overload control test")
+
+	env := newTestEnv(t)
+	if err := env.Store().MakeFromYaml(`
+Session-Id: "mme.test.org"
+Origin-Host: "hss.test.org"
+Origin-Realm: "test.org"
+Destination-Host: "hss.test.org"
+Destination-Realm: "test.org"
+Result-Code: 2001
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+	peer := &node.Node{Name: "hss"}
+
+	request := func(host bool) *Message {
+		msg, err := env.NewMessage("S6a", "UL", true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !host {
+			if err := msg.RemoveAvp("Destination-Host"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return msg
+	}
+
+	// Without the overload control the requests are not changed
+	plain := request(true)
+	if err := env.AdmitRequest(peer, plain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.GetAvp("OC-Supported-Features"); err == nil {
+		t.Fatal("OC-Supported-Features added with the overload control off")
+	}
+
+	if err := env.SetOverloadControl(true); err != nil {
+		t.Fatal(err)
+	}
+	msg := request(true)
+	if err := env.AdmitRequest(peer, msg); err != nil {
+		t.Fatal(err)
+	}
+	if v := pathValue(msg, ocFeatureVectorPath); v != ocLossAlgorithm {
+		t.Fatalf("OC-Feature-Vector: %v", v)
+	}
+
+	// The answers to the requests without OC-Supported-Features have no report
+	if err := env.SetOverloadAnswer(&OverloadReport{Type: OverloadHost, Reduction: 100, Validity: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := plain.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := answer.GetAvp("OC-OLR"); err == nil {
+		t.Fatal("OC-OLR added to the answer of the request without DOIC support")
+	}
+
+	// The answer carries the selected loss algorithm only, not all the advertised features
+	features := request(true)
+	if err := features.SetPath(ocFeatureVectorPath, ocLossAlgorithm|4); err != nil {
+		t.Fatal(err)
+	}
+	answer, err = features.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := pathValue(answer, ocFeatureVectorPath); v != ocLossAlgorithm {
+		t.Fatalf("Answer OC-Feature-Vector: %v", v)
+	}
+	if err := features.SetPath(ocFeatureVectorPath, uint64(4)); err != nil {
+		t.Fatal(err)
+	}
+	if answer, err = features.Response(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := answer.GetAvp("OC-OLR"); err == nil {
+		t.Fatal("OC-OLR added to the answer of the request without the loss algorithm")
+	}
+
+	answer, err = msg.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer.Trace()
+	data, err := answer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.observeOverload(data, peer)
+
+	reports := env.OverloadReports()
+	if len(reports) != 1 || reports[0].Node != "hss.test.org" || reports[0].Reduction != 100 ||
+		reports[0].Sequence != env.OverloadAnswer().Sequence {
+		t.Fatalf("Reports: %+v", reports)
+	}
+
+	err = env.AdmitRequest(peer, request(true))
+	if !diwe.Is[*diwe.ErrOverloadAbated](err) {
+		t.Fatalf("Request to the overloaded host: %v", err)
+	}
+	fmt.Println(err)
+	// The host report does not apply to the realm routed requests
+	if err := env.AdmitRequest(peer, request(false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The report with the same sequence number does not replace the report
+	sequence := reports[0].Sequence
+	env.overload.update(&OverloadReport{Type: OverloadHost, Node: "HSS.test.org", Sequence: sequence, Reduction: 10,
+		Validity: time.Minute}, time.Now())
+	if reports := env.OverloadReports(); reports[0].Reduction != 100 || reports[0].Abated != 1 {
+		t.Fatalf("Report replaced: %+v", reports)
+	}
+
+	// Loss algorithm: about 30% of the realm routed requests are abated
+	env.overload.update(&OverloadReport{Type: OverloadRealm, Node: "test.org", Sequence: 1, Reduction: 30,
+		Validity: time.Minute}, time.Now())
+	abated := 0
+	for range 1000 {
+		if err := env.AdmitRequest(peer, request(false)); err != nil {
+			abated++
+		}
+	}
+	fmt.Printf("Abated of 1000: %d\n", abated)
+	if abated < 200 || abated > 400 || env.OverloadAbated() != uint64(abated)+1 {
+		t.Fatalf("Abated: %d, total %d", abated, env.OverloadAbated())
+	}
+
+	// The zero validity ends the overload condition
+	env.overload.update(&OverloadReport{Type: OverloadHost, Node: "hss.test.org", Sequence: sequence + 1}, time.Now())
+	if reports := env.OverloadReports(); len(reports) != 1 || reports[0].Type != OverloadRealm {
+		t.Fatalf("Reports: %+v", reports)
+	}
+	if err := env.AdmitRequest(peer, request(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.SetOverloadAnswer(&OverloadReport{Reduction: 101}); err == nil {
+		t.Fatal("Reduction 101% accepted")
+	}
+	if err := env.SetOverloadAnswer(&OverloadReport{Reduction: 10}); err != nil ||
+		env.OverloadAnswer().Sequence != sequence+1 {
+		t.Fatalf("Next sequence: %v %+v", err, env.OverloadAnswer())
+	}
+}
@@ -0,0 +1,299 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: report.go
+// Description: Diameter pkg: test report model and recorder
+//
+
+package report
+
+import (
+	"sync"
+	"time"
+)
+
+// Consts
+//
+
+// Test case statuses
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusError   = "error"
+	StatusSkipped = "skipped"
+)
+
+// Types
+//
+
+// Report is the test run: the suites are the batch files, the Lua scripts or the scenarios.
+type Report struct {
+	Name     string        `json:"name"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"`
+	Suites   []*Suite      `json:"suites"`
+}
+
+// Suite is the group of the test cases of one file.
+type Suite struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"`
+	Cases    []*Case       `json:"cases"`
+}
+
+// Case is the test case: the batch line, the CLI command, the scenario step or the Lua script case.
+type Case struct {
+	Name       string        `json:"name"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration_ns"`
+	Assertions []Assertion   `json:"assertions,omitempty"`
+	Messages   []Message     `json:"messages,omitempty"`
+}
+
+// Assertion is the check of the test case.
+type Assertion struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// Message is the message sent or received during the test case.
+type Message struct {
+	Sent    bool      `json:"sent"`
+	Peer    string    `json:"peer"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Hex     string    `json:"hex"`
+	Text    string    `json:"text,omitempty"` // decoded message
+}
+
+// Counts is the number of the test cases by the status.
+type Counts struct {
+	Tests   int
+	Failed  int
+	Errors  int
+	Skipped int
+}
+
+// Recorder builds the report as the test run goes: the suite and the case are started by Suite and Case,
+// the checks, the failures and the messages are added to the current case. The current case is completed
+// by the next case, the suite or End. The recorder is safe for the concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	report *Report
+	suite  *Suite
+	cur    *Case
+	ended  bool
+}
+
+// Constructor
+//
+
+// NewRecorder creates the recorder of the named report.
+func NewRecorder(name string) *Recorder {
+	return &Recorder{report: &Report{Name: name, Started: time.Now()}}
+}
+
+// Methods
+//
+
+// Suite completes the current suite and starts the new one.
+func (r *Recorder) Suite(name, file string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.endSuite()
+	r.suite = &Suite{Name: name, File: file, Started: time.Now()}
+	r.report.Suites = append(r.report.Suites, r.suite)
+}
+
+// Case completes the current case and starts the new one.
+func (r *Recorder) Case(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.startCase(name)
+}
+
+// AddCase adds the completed case to the current suite, the current case is completed.
+func (r *Recorder) AddCase(c *Case) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.endCase()
+	suite := r.currentSuite()
+	suite.Cases = append(suite.Cases, c)
+}
+
+// Check adds the assertion to the current case, the case fails if the assertion is not passed.
+func (r *Recorder) Check(name string, passed bool, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.currentCase()
+	c.Assertions = append(c.Assertions, Assertion{Name: name, Passed: passed, Message: message})
+	if !passed && c.Status == "" {
+		c.Status = StatusFailed
+		c.Error = message
+	}
+}
+
+// Fail fails the current case with the error, the first failure is kept.
+func (r *Recorder) Fail(err error) {
+	r.setStatus(StatusFailed, err)
+}
+
+// Error marks the current case as not completed because of the error (not the failed check).
+func (r *Recorder) Error(err error) {
+	r.setStatus(StatusError, err)
+}
+
+// Skip marks the current case as skipped.
+func (r *Recorder) Skip(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.currentCase()
+	if c.Status == "" {
+		c.Status = StatusSkipped
+		c.Error = reason
+	}
+}
+
+// Message adds the message to the current case, the message received after End is dropped.
+func (r *Recorder) Message(msg Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ended {
+		return
+	}
+
+	c := r.currentCase()
+	c.Messages = append(c.Messages, msg)
+}
+
+// End completes the current suite and returns the report.
+func (r *Recorder) End() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.endSuite()
+	if !r.ended {
+		r.report.Duration = time.Since(r.report.Started)
+		r.ended = true
+	}
+
+	return r.report
+}
+
+// Counts returns the number of the test cases by the status.
+func (rep *Report) Counts() Counts {
+	counts := Counts{}
+	for _, suite := range rep.Suites {
+		c := suite.Counts()
+		counts.Tests += c.Tests
+		counts.Failed += c.Failed
+		counts.Errors += c.Errors
+		counts.Skipped += c.Skipped
+	}
+
+	return counts
+}
+
+// Passed returns true if there are no failed cases and no errors.
+func (rep *Report) Passed() bool {
+	counts := rep.Counts()
+	return counts.Failed == 0 && counts.Errors == 0
+}
+
+// Counts returns the number of the suite test cases by the status.
+func (s *Suite) Counts() Counts {
+	counts := Counts{Tests: len(s.Cases)}
+	for _, c := range s.Cases {
+		switch c.Status {
+		case StatusFailed:
+			counts.Failed++
+		case StatusError:
+			counts.Errors++
+		case StatusSkipped:
+			counts.Skipped++
+		}
+	}
+
+	return counts
+}
+
+// Helpers
+//
+
+// setStatus sets the status of the current case if it is not failed yet.
+func (r *Recorder) setStatus(status string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.currentCase()
+	if c.Status == "" || c.Status == StatusSkipped {
+		c.Status = status
+		c.Error = err.Error()
+	}
+}
+
+// currentSuite returns the current suite, the suite of the report name is started if there is none.
+func (r *Recorder) currentSuite() *Suite {
+	if r.suite == nil {
+		r.suite = &Suite{Name: r.report.Name, Started: time.Now()}
+		r.report.Suites = append(r.report.Suites, r.suite)
+	}
+
+	return r.suite
+}
+
+// currentCase returns the current case, the case of the suite name is started if there is none.
+func (r *Recorder) currentCase() *Case {
+	if r.cur == nil {
+		r.startCase(r.currentSuite().Name)
+	}
+
+	return r.cur
+}
+
+// startCase completes the current case and starts the new one.
+func (r *Recorder) startCase(name string) {
+	r.endCase()
+	suite := r.currentSuite()
+	r.cur = &Case{Name: name, Started: time.Now()}
+	suite.Cases = append(suite.Cases, r.cur)
+}
+
+// endCase completes the current case, the case without the failure is passed.
+func (r *Recorder) endCase() {
+	if r.cur == nil {
+		return
+	}
+	r.cur.Duration = time.Since(r.cur.Started)
+	if r.cur.Status == "" {
+		r.cur.Status = StatusPassed
+	}
+	r.cur = nil
+}
+
+// endSuite completes the current case and the current suite, the suite without the cases is removed.
+func (r *Recorder) endSuite() {
+	r.endCase()
+	if r.suite == nil {
+		return
+	}
+	r.suite.Duration = time.Since(r.suite.Started)
+	if len(r.suite.Cases) == 0 {
+		r.report.Suites = r.report.Suites[:len(r.report.Suites)-1]
+	}
+	r.suite = nil
+}
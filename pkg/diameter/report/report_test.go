@@ -0,0 +1,141 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	rec := NewRecorder("run")
+
+	rec.Suite("attach", "attach.tgdp")
+	rec.Case("send request HSS S6a UL")
+	rec.Message(Message{Sent: true, Peer: "HSS", Time: time.Now(), Command: "S6a ULR", Hex: "01000014", Text: "AppId: 16777251\n"})
+	rec.Message(Message{Peer: "HSS", Time: time.Now(), Command: "S6a ULA", Hex: "01000014"})
+	rec.Check("Result-Code", true, "DIAMETER_SUCCESS (2001)")
+	rec.Case("send request HSS S6a PU")
+	rec.Check("Result-Code", false, "Result DIAMETER_UNABLE_TO_COMPLY (5012), expected success")
+	rec.Fail(errors.New("ignored, the first failure is kept"))
+
+	rec.Suite("detach.lua", "detach.lua")
+	rec.Case("connect")
+	rec.Error(errors.New("connection refused"))
+	rec.Case("cancel")
+	rec.Skip("not connected")
+	rec.AddCase(&Case{Name: "step", Status: StatusPassed, Duration: time.Second})
+
+	// the empty suite is removed, the case is created on demand
+	rec.Suite("", "")
+	rec.Suite("messages", "")
+	rec.Message(Message{Peer: "DRA", Command: "Base DWR"})
+
+	return rec.End()
+}
+
+func TestRecorder(t *testing.T) {
+	fmt.Println(">>> Report recorder test")
+
+	rep := testReport()
+	if len(rep.Suites) != 3 {
+		t.Fatalf("Suites: %d", len(rep.Suites))
+	}
+
+	attach := rep.Suites[0]
+	if len(attach.Cases) != 2 || attach.Cases[0].Status != StatusPassed || len(attach.Cases[0].Messages) != 2 {
+		t.Fatalf("Passed case: %+v", attach.Cases[0])
+	}
+	if c := attach.Cases[1]; c.Status != StatusFailed || !strings.HasPrefix(c.Error, "Result") {
+		t.Fatalf("Failed case: %+v", c)
+	}
+
+	counts := rep.Suites[1].Counts()
+	if counts != (Counts{Tests: 3, Errors: 1, Skipped: 1}) {
+		t.Fatalf("Suite counts: %+v", counts)
+	}
+
+	messages := rep.Suites[2]
+	if len(messages.Cases) != 1 || messages.Cases[0].Name != "messages" || messages.Cases[0].Status != StatusPassed {
+		t.Fatalf("Default case: %+v", messages.Cases)
+	}
+
+	counts = rep.Counts()
+	if counts != (Counts{Tests: 6, Failed: 1, Errors: 1, Skipped: 1}) || rep.Passed() {
+		t.Fatalf("Report counts: %+v", counts)
+	}
+	fmt.Printf("%+v\n", counts)
+
+	fmt.Println("<<< Report recorder test")
+}
+
+func TestWrite(t *testing.T) {
+	fmt.Println(">>> Report write test")
+
+	rep := testReport()
+
+	buf := bytes.Buffer{}
+	if err := rep.WriteJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+	suites := junitSuites{}
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 6 || suites.Failures != 1 || suites.Errors != 1 || suites.Skipped != 1 || len(suites.Suites) != 3 {
+		t.Fatalf("JUnit: %+v", suites)
+	}
+	if jc := suites.Suites[0].Cases[1]; jc.Failure == nil || !strings.Contains(jc.Failure.Text, "failed: Result-Code") {
+		t.Fatalf("JUnit failure: %+v", jc)
+	}
+	if jc := suites.Suites[0].Cases[0]; !strings.Contains(jc.SystemOut, "--> ") || !strings.Contains(jc.SystemOut, "AppId") {
+		t.Fatalf("JUnit output: %+v", jc)
+	}
+	fmt.Println(buf.String()[:200])
+
+	buf.Reset()
+	if err := rep.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := Report{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Counts() != rep.Counts() || decoded.Suites[0].Cases[0].Messages[0].Command != "S6a ULR" {
+		t.Fatalf("JSON: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := rep.WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"FAILED", "detach.lua", "--&gt; HSS S6a ULR", "AppId: 16777251"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("HTML: '%s' is missing", s)
+		}
+	}
+
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "report.xml"), filepath.Join(dir, "report.json"), filepath.Join(dir, "report.html")}
+	if err := Save(rep, files...); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil || info.Size() == 0 {
+			t.Fatalf("Report file %s: %v", file, err)
+		}
+	}
+	if err := Save(rep, filepath.Join(dir, "report.txt")); err == nil {
+		t.Fatal("Unknown format accepted")
+	} else {
+		fmt.Println(err)
+	}
+
+	fmt.Println("<<< Report write test")
+}
@@ -0,0 +1,281 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: write.go
+// Description: Diameter pkg: test report JUnit XML, JSON and HTML writers
+//
+
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Types
+//
+
+// JUnit XML elements
+type (
+	junitSuites struct {
+		XMLName   xml.Name     `xml:"testsuites"`
+		Name      string       `xml:"name,attr"`
+		Tests     int          `xml:"tests,attr"`
+		Failures  int          `xml:"failures,attr"`
+		Errors    int          `xml:"errors,attr"`
+		Skipped   int          `xml:"skipped,attr"`
+		Time      string       `xml:"time,attr"`
+		Timestamp string       `xml:"timestamp,attr"`
+		Suites    []junitSuite `xml:"testsuite"`
+	}
+
+	junitSuite struct {
+		Name      string      `xml:"name,attr"`
+		File      string      `xml:"file,attr,omitempty"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Errors    int         `xml:"errors,attr"`
+		Skipped   int         `xml:"skipped,attr"`
+		Time      string      `xml:"time,attr"`
+		Timestamp string      `xml:"timestamp,attr"`
+		Cases     []junitCase `xml:"testcase"`
+	}
+
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Error     *junitFailure `xml:"error,omitempty"`
+		Skipped   *junitFailure `xml:"skipped,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// Variables
+//
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"time":     func(t time.Time) string { return t.Format("2006-01-02 15:04:05.000") },
+	"passed":   func(rep *Report) bool { return rep.Passed() },
+	"inc":      func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+pre { background: #f6f6f6; padding: 8px; overflow-x: auto; }
+.passed { color: #2a7d2a; } .failed, .error { color: #c62828; } .skipped { color: #888; }
+details { margin: 4px 0 4px 1em; }
+</style>
+</head>
+<body>
+{{- $counts := .Counts}}
+<h1>{{.Name}} <span class="{{if passed .}}passed">PASSED{{else}}failed">FAILED{{end}}</span></h1>
+<p>Started {{time .Started}}, duration {{duration .Duration}}:
+{{$counts.Tests}} tests, {{$counts.Failed}} failed, {{$counts.Errors}} errors, {{$counts.Skipped}} skipped</p>
+{{- range .Suites}}
+<h2>{{.Name}}{{if .File}} <small>({{.File}})</small>{{end}}</h2>
+<table>
+<tr><th>#</th><th>Case</th><th>Status</th><th>Duration</th><th>Error</th></tr>
+{{- range $i, $c := .Cases}}
+<tr><td>{{inc $i}}</td><td>{{$c.Name}}</td><td class="{{$c.Status}}">{{$c.Status}}</td><td>{{duration $c.Duration}}</td><td>{{$c.Error}}</td></tr>
+{{- end}}
+</table>
+{{- range .Cases}}
+{{- if or .Assertions .Messages}}
+<details{{if ne .Status "passed"}} open{{end}}>
+<summary class="{{.Status}}">{{.Name}}</summary>
+{{- if .Assertions}}
+<ul>
+{{- range .Assertions}}
+<li class="{{if .Passed}}passed{{else}}failed{{end}}">{{.Name}}{{if .Message}}: {{.Message}}{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range .Messages}}
+<details>
+<summary>{{time .Time}} {{if .Sent}}--&gt;{{else}}&lt;--{{end}} {{.Peer}} {{.Command}}</summary>
+<pre>{{if .Text}}{{.Text}}{{else}}{{.Hex}}{{end}}</pre>
+</details>
+{{- end}}
+</details>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// Functions
+//
+
+// Save writes the report to the files, the format is selected by the file extension:
+// .xml is JUnit XML, .json is JSON, .html is the HTML summary.
+func Save(rep *Report, files ...string) error {
+	for _, file := range files {
+		var write func(io.Writer) error
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".xml":
+			write = rep.WriteJUnit
+		case ".json":
+			write = rep.WriteJSON
+		case ".html", ".htm":
+			write = rep.WriteHTML
+		default:
+			return &diwe.ErrReportFormat{File: file}
+		}
+
+		fd, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		err = write(fd)
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Methods
+//
+
+// WriteJUnit writes the report in the JUnit XML format, the case messages are the system output.
+func (rep *Report) WriteJUnit(w io.Writer) error {
+	counts := rep.Counts()
+	suites := junitSuites{
+		Name:      rep.Name,
+		Tests:     counts.Tests,
+		Failures:  counts.Failed,
+		Errors:    counts.Errors,
+		Skipped:   counts.Skipped,
+		Time:      seconds(rep.Duration),
+		Timestamp: rep.Started.Format(time.RFC3339),
+	}
+
+	for _, suite := range rep.Suites {
+		counts := suite.Counts()
+		js := junitSuite{
+			Name:      suite.Name,
+			File:      suite.File,
+			Tests:     counts.Tests,
+			Failures:  counts.Failed,
+			Errors:    counts.Errors,
+			Skipped:   counts.Skipped,
+			Time:      seconds(suite.Duration),
+			Timestamp: suite.Started.Format(time.RFC3339),
+		}
+
+		for _, c := range suite.Cases {
+			jc := junitCase{Name: c.Name, ClassName: suite.Name, Time: seconds(c.Duration)}
+			detail := &junitFailure{Message: c.Error, Text: c.assertionsText()}
+			switch c.Status {
+			case StatusFailed:
+				jc.Failure = detail
+			case StatusError:
+				jc.Error = detail
+			case StatusSkipped:
+				jc.Skipped = detail
+			}
+			jc.SystemOut = c.messagesText()
+			js.Cases = append(js.Cases, jc)
+		}
+		suites.Suites = append(suites.Suites, js)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// WriteJSON writes the report in the JSON format.
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// WriteHTML writes the static HTML summary of the report with the decoded messages.
+func (rep *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, rep)
+}
+
+// Helpers
+//
+
+// assertionsText returns the assertions of the case, one per line.
+func (c *Case) assertionsText() string {
+	sb := strings.Builder{}
+	for _, a := range c.Assertions {
+		status := StatusPassed
+		if !a.Passed {
+			status = StatusFailed
+		}
+		fmt.Fprintf(&sb, "%s: %s", status, a.Name)
+		if a.Message != "" {
+			fmt.Fprintf(&sb, ": %s", a.Message)
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// messagesText returns the decoded messages of the case.
+func (c *Case) messagesText() string {
+	sb := strings.Builder{}
+	for _, msg := range c.Messages {
+		dir := "<--"
+		if msg.Sent {
+			dir = "-->"
+		}
+		fmt.Fprintf(&sb, "%s %s %s %s\n", dir, msg.Time.Format("15:04:05.000"), msg.Peer, msg.Command)
+		if msg.Text != "" {
+			sb.WriteString(msg.Text)
+		} else {
+			sb.WriteString(msg.Hex + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// seconds returns the duration in seconds as JUnit time attribute.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,241 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: dispatch.go
+// Description: Diameter pkg: received messages routing to the scenario steps
+//
+
+package scenario
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/net/node"
+	"tgdp/pkg/diameter/pcap"
+)
+
+// Consts
+//
+
+// maxQueued is the maximum number of the received requests waiting for the receive steps,
+// the oldest request is dropped on overflow.
+const maxQueued = 1000
+
+// Types
+//
+
+// answerKey identifies the outstanding request.
+type answerKey struct {
+	peer     string
+	hopByHop uint32
+}
+
+// request is the received request waiting for the receive step.
+type request struct {
+	peer string
+	msg  *diameter.Message
+}
+
+// waiter is the receive step waiting for the request.
+type waiter struct {
+	peer   string
+	accept func(msg *diameter.Message) bool
+	ch     chan *diameter.Message
+}
+
+// dispatcher routes the received messages of the peers to the running steps: the answers
+// by the Hop-by-Hop Identifier, the requests to the first waiting step accepting them.
+// The dispatcher is the peers callback, so the flows run concurrently on the same peers.
+type dispatcher struct {
+	env *diameter.Diameter
+
+	// mu protects the fields below
+	mu      sync.Mutex
+	peers   map[string]*node.Node
+	answers map[answerKey]chan []byte
+	waiters []*waiter
+	queue   []request
+
+	// pcapMu serializes the PCAP writes
+	pcapMu sync.Mutex
+}
+
+// Constructor
+//
+
+// newDispatcher creates the dispatcher, the peers are attached on the first use.
+func newDispatcher(env *diameter.Diameter) *dispatcher {
+	return &dispatcher{
+		env:     env,
+		peers:   map[string]*node.Node{},
+		answers: map[answerKey]chan []byte{},
+	}
+}
+
+// Methods
+//
+
+// attach sets the dispatcher as the peer callback.
+func (dp *dispatcher) attach(peer *node.Node) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
+	if _, exists := dp.peers[peer.Name]; !exists {
+		dp.peers[peer.Name] = peer
+		peer.SetCallback(dp.receive)
+	}
+}
+
+// detach restores the peers callback, the queued requests are released.
+func (dp *dispatcher) detach() {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
+	for _, peer := range dp.peers {
+		peer.SetCallback(nil)
+	}
+	dp.peers = map[string]*node.Node{}
+	dp.queue = nil
+}
+
+// expect registers the outstanding request before it is sent, the answer is delivered to the channel.
+// The Hop-by-Hop Identifier must be unique among the outstanding requests of the peer, the next free
+// identifier is taken if it is used. Returns the identifier of the request.
+func (dp *dispatcher) expect(peer string, hopByHop uint32) (uint32, chan []byte) {
+	ch := make(chan []byte, 1)
+
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
+	for _, busy := dp.answers[answerKey{peer, hopByHop}]; busy; _, busy = dp.answers[answerKey{peer, hopByHop}] {
+		hopByHop++
+	}
+	dp.answers[answerKey{peer, hopByHop}] = ch
+
+	return hopByHop, ch
+}
+
+// forget removes the outstanding request, the late answer is dropped.
+func (dp *dispatcher) forget(peer string, hopByHop uint32) {
+	dp.mu.Lock()
+	delete(dp.answers, answerKey{peer, hopByHop})
+	dp.mu.Unlock()
+}
+
+// wait waits for the request of the peer accepted by the function. The queued requests are checked first.
+// Returns ErrRecvTimeout if no request is accepted within the timeout.
+func (dp *dispatcher) wait(ctx context.Context, peer string, accept func(msg *diameter.Message) bool,
+	timeout time.Duration) (*diameter.Message, error) {
+	dp.mu.Lock()
+	for i, req := range dp.queue {
+		if req.peer == peer && accept(req.msg) {
+			dp.queue = append(dp.queue[:i], dp.queue[i+1:]...)
+			dp.mu.Unlock()
+			return req.msg, nil
+		}
+	}
+	w := &waiter{peer: peer, accept: accept, ch: make(chan *diameter.Message, 1)}
+	dp.waiters = append(dp.waiters, w)
+	dp.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case msg := <-w.ch:
+		return msg, nil
+	case <-timer.C:
+		err = &diwe.ErrRecvTimeout{Peer: peer, Timeout: timeout}
+	case <-ctx.Done():
+		err = &diwe.InfInterrupted{Peer: peer}
+	}
+
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	for i := range dp.waiters {
+		if dp.waiters[i] == w {
+			dp.waiters = append(dp.waiters[:i], dp.waiters[i+1:]...)
+			break
+		}
+	}
+	// the request delivered between the timeout and the removal is not lost
+	select {
+	case msg := <-w.ch:
+		return msg, nil
+	default:
+	}
+
+	return nil, err
+}
+
+// writePcap writes the message to the PCAP file if it is open.
+func (dp *dispatcher) writePcap(data []byte, peer *node.Node, dir bool) {
+	pcapWriter := dp.env.Pcap()
+	if !pcapWriter.IsOpen() {
+		return
+	}
+
+	dp.pcapMu.Lock()
+	defer dp.pcapMu.Unlock()
+	if err := pcapWriter.Write(data, peer, dir); err != nil {
+		dp.env.Logger().Warn("PCAP write failed", "error", err)
+	}
+}
+
+// Helpers
+//
+
+// receive is the peer callback. All received messages are consumed, they are not passed to RecvFrom.
+func (dp *dispatcher) receive(data []byte, peer *node.Node) bool {
+	_, _, _, _, flags, hopByHop, _, err := dp.env.MessageHeader(data)
+	if err != nil {
+		return true
+	}
+	dp.writePcap(data, peer, pcap.DirIncoming)
+
+	if !dp.env.IsRequest(flags) {
+		key := answerKey{peer.Name, hopByHop}
+		dp.mu.Lock()
+		ch, exists := dp.answers[key]
+		delete(dp.answers, key)
+		dp.mu.Unlock()
+
+		// the late answer of the timed out request is dropped
+		if exists {
+			ch <- data
+		}
+		return true
+	}
+
+	msg, err := dp.env.BytesToMessage(data)
+	if err != nil {
+		dp.env.Logger().Warn("Invalid request", "peer", peer.Name, "error", err)
+		return true
+	}
+
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	for i, w := range dp.waiters {
+		if w.peer == peer.Name && w.accept(msg) {
+			dp.waiters = append(dp.waiters[:i], dp.waiters[i+1:]...)
+			w.ch <- msg
+			return true
+		}
+	}
+
+	if len(dp.queue) == maxQueued {
+		dp.queue[0].msg.Release()
+		dp.queue = dp.queue[1:]
+	}
+	dp.queue = append(dp.queue, request{peer.Name, msg})
+
+	return true
+}
@@ -0,0 +1,542 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: run.go
+// Description: Diameter pkg: scenario steps execution and checks
+//
+
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+	"tgdp/pkg/diameter/pcap"
+)
+
+// Consts
+//
+
+// Step statuses.
+const (
+	StatusPass = "PASS"
+	StatusFail = "FAIL"
+	StatusSkip = "SKIP"
+)
+
+// Types
+//
+
+// StepResult is the outcome of the step.
+type StepResult struct {
+	Step     *Step
+	Status   string
+	Err      error
+	Duration time.Duration
+	// Sent and Received are the wire bytes of the step messages: the request and the answer (send),
+	// the request and the answer to it (receive)
+	Sent     []byte
+	Received []byte
+}
+
+// Record is the message sent or received by the step.
+type Record struct {
+	Step int // 1-based step number
+	Sent bool
+	Time time.Time
+	Data []byte
+}
+
+// Result is the outcome of the scenario run.
+type Result struct {
+	Scenario  *Scenario
+	SessionId string
+	Steps     []StepResult
+	// Messages are all messages of the flow in the exchange order
+	Messages []Record
+	Started  time.Time
+	Duration time.Duration
+
+	env *diameter.Diameter
+}
+
+// Runner runs the scenarios on the shared peers: the received messages are routed to the running
+// flows by the Hop-by-Hop Identifier and the receive step matches, so many flows run concurrently.
+type Runner struct {
+	env *diameter.Diameter
+	dp  *dispatcher
+}
+
+// flow is the state of the running scenario.
+type flow struct {
+	env     *diameter.Diameter
+	dp      *dispatcher
+	session *diameter.Session
+	result  *Result
+	// step is the 1-based number of the running step
+	step int
+	// last is the last sent request, the 'match' paths of the receive steps are compared with it
+	last *diameter.Message
+}
+
+// Constructor
+//
+
+// NewRunner creates the runner, the peers are taken over on the first use until Close.
+func NewRunner(env *diameter.Diameter) *Runner {
+	return &Runner{env: env, dp: newDispatcher(env)}
+}
+
+// Methods
+//
+
+// Run runs the steps in order within a new session on the scenario peer. The peers are connected
+// if needed. The first failed step stops the flow, the rest steps are skipped.
+func (sc *Scenario) Run(ctx context.Context, env *diameter.Diameter) *Result {
+	r := NewRunner(env)
+	defer r.Close()
+
+	return r.Run(ctx, sc)
+}
+
+// Run runs the scenario as Scenario.Run does, the method is safe for concurrent use.
+func (r *Runner) Run(ctx context.Context, sc *Scenario) *Result {
+	return sc.run(ctx, r.env, r.dp)
+}
+
+// Close restores the callbacks of the peers used by the runner.
+func (r *Runner) Close() {
+	r.dp.detach()
+}
+
+// Passed reports whether all steps passed.
+func (r *Result) Passed() bool {
+	for _, step := range r.Steps {
+		if step.Status != StatusPass {
+			return false
+		}
+	}
+	return true
+}
+
+// Counts returns the number of the passed, failed and skipped steps.
+func (r *Result) Counts() (passed, failed, skipped int) {
+	for _, step := range r.Steps {
+		switch step.Status {
+		case StatusPass:
+			passed++
+		case StatusFail:
+			failed++
+		default:
+			skipped++
+		}
+	}
+	return
+}
+
+// Err returns the error of the failed step, nil if the scenario passed.
+func (r *Result) Err() error {
+	if step := r.Failed(); step != nil {
+		return step.Err
+	}
+	return nil
+}
+
+// Failed returns the failed step, nil if the scenario passed.
+func (r *Result) Failed() *StepResult {
+	for i := range r.Steps {
+		if r.Steps[i].Status == StatusFail {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// WriteExchange writes the outcome and all messages of the flow in the human-readable format.
+func (r *Result) WriteExchange(w io.Writer) error {
+	status := StatusPass
+	if step := r.Failed(); step != nil {
+		status = fmt.Sprintf("%s at step '%s': %v", StatusFail, step.Step, step.Err)
+	}
+	if _, err := fmt.Fprintf(w, "=== %s [%s] %s %s (%s)\n", r.Scenario.Name, r.SessionId,
+		r.Started.Format(time.RFC3339Nano), status, r.Duration.Round(time.Microsecond)); err != nil {
+		return err
+	}
+
+	for _, record := range r.Messages {
+		dir := "<--"
+		if record.Sent {
+			dir = "-->"
+		}
+		fmt.Fprintf(w, "%s step %d %s\n", dir, record.Step, record.Time.Format("15:04:05.000000"))
+
+		msg, err := r.env.BytesToMessage(record.Data)
+		if err == nil {
+			err = msg.WriteText(w)
+			msg.Release()
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%v\n%x\n\n", err, record.Data)
+		}
+	}
+
+	return nil
+}
+
+// Helpers
+//
+
+// run runs the steps with the messages routed by the dispatcher.
+func (sc *Scenario) run(ctx context.Context, env *diameter.Diameter, dp *dispatcher) *Result {
+	result := &Result{Scenario: sc, Steps: make([]StepResult, len(sc.Steps)), Started: time.Now(), env: env}
+	defer func() { result.Duration = time.Since(result.Started) }()
+
+	for i := range sc.Steps {
+		result.Steps[i] = StepResult{Step: &sc.Steps[i], Status: StatusSkip}
+	}
+
+	peer := sc.Peer
+	if peer == "" {
+		peer = sc.Steps[0].Peer
+	}
+	session, err := env.NewCallSession(peer)
+	if err != nil {
+		result.Steps[0].Status, result.Steps[0].Err = StatusFail, err
+		return result
+	}
+	defer session.End()
+	result.SessionId = session.Id()
+
+	f := &flow{env: env, dp: dp, session: session, result: result}
+	for i := range sc.Steps {
+		sr := &result.Steps[i]
+		f.step = i + 1
+		started := time.Now()
+		for range sr.Step.Repeat {
+			if sr.Err = f.runStep(ctx, sr); sr.Err != nil {
+				break
+			}
+		}
+		sr.Duration = time.Since(started)
+
+		if sr.Err != nil {
+			sr.Status = StatusFail
+			break
+		}
+		sr.Status = StatusPass
+	}
+
+	return result
+}
+
+// runStep runs the step, the step messages are kept in the result.
+func (f *flow) runStep(ctx context.Context, sr *StepResult) error {
+	step := sr.Step
+
+	if step.kind == KindSleep {
+		timer := time.NewTimer(step.Sleep)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	peer, err := f.env.Peers().GetByName(step.Peer)
+	if err != nil {
+		return err
+	}
+	if !peer.IsOpen() {
+		if err := peer.Connect(); err != nil && !peer.IsOpen() {
+			return err
+		}
+		f.env.Trace(peer, diameter.TracePeer)
+	}
+	f.dp.attach(peer)
+
+	if step.kind == KindSend {
+		return f.send(ctx, sr)
+	}
+	return f.answer(ctx, sr)
+}
+
+// send sends the request of the step and checks the answer.
+func (f *flow) send(ctx context.Context, sr *StepResult) error {
+	step := sr.Step
+	peer, _ := f.env.Peers().GetByName(step.Peer)
+
+	msg, err := f.session.NewPeerMessage(step.Peer, step.app, step.cmd, true, true)
+	if err != nil {
+		return err
+	}
+	if err := setValues(msg, step.Avps); err != nil {
+		return err
+	}
+	if err := f.env.AdmitRequest(peer, msg); err != nil {
+		return err
+	}
+
+	var ch chan []byte
+	msg.HopByHop, ch = f.dp.expect(step.Peer, msg.HopByHop)
+	defer f.dp.forget(step.Peer, msg.HopByHop)
+
+	data, err := msg.Serialize()
+	if err != nil {
+		return err
+	}
+	sr.Sent = data
+	// the request of the previous send step is not matched anymore
+	f.last.Release()
+	f.last = msg
+	f.record(true, data)
+	f.env.Trace(msg, diameter.TraceMsg)
+
+	f.dp.writePcap(data, peer, pcap.DirOutgoing)
+	if err := peer.SendTo(data); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(step.Timeout)
+	defer timer.Stop()
+	select {
+	case sr.Received = <-ch:
+	case <-timer.C:
+		return &diwe.ErrRecvTimeout{Peer: step.Peer, Timeout: step.Timeout}
+	case <-ctx.Done():
+		return &diwe.InfInterrupted{Peer: step.Peer}
+	}
+
+	f.record(false, sr.Received)
+
+	answer, err := f.env.BytesToMessage(sr.Received)
+	if err != nil {
+		return err
+	}
+	defer answer.Release()
+	f.env.Trace(answer, diameter.TraceMsg)
+
+	if err := f.session.Update(answer); err != nil {
+		return err
+	}
+	if _, err := f.env.Capture(answer); err != nil {
+		return err
+	}
+	if err := f.check(answer, step.Expect); err != nil {
+		return err
+	}
+
+	return f.capture(answer, step.Capture)
+}
+
+// answer waits for the request of the step, checks it and sends the answer.
+func (f *flow) answer(ctx context.Context, sr *StepResult) error {
+	step := sr.Step
+	peer, _ := f.env.Peers().GetByName(step.Peer)
+
+	app, _ := f.env.Dict().GetApp(step.app)
+	cmd, _ := f.env.Dict().GetCmd(step.cmd, app)
+	last := f.last
+
+	accept := func(msg *diameter.Message) bool {
+		if msg.AppId != app.Id || msg.CmdCode != cmd.Code {
+			return false
+		}
+		for _, path := range step.Match {
+			if last == nil || pathText(msg, path) != pathText(last, path) {
+				return false
+			}
+		}
+		return true
+	}
+
+	msg, err := f.dp.wait(ctx, step.Peer, accept, step.Timeout)
+	if err != nil {
+		return err
+	}
+	defer msg.Release()
+	sr.Received = msg.Bytes()
+	f.record(false, sr.Received)
+	f.env.Trace(msg, diameter.TraceMsg)
+
+	if _, err := f.env.Capture(msg); err != nil {
+		return err
+	}
+	checkErr := f.check(msg, step.Expect)
+	if checkErr == nil {
+		checkErr = f.capture(msg, step.Capture)
+	}
+
+	// the request is answered even if the checks fail, the peer does not wait for the timeout
+	reply, err := msg.Response()
+	if err != nil {
+		return err
+	}
+	defer reply.Release()
+	if err := setValues(reply, step.Answer); err != nil {
+		return err
+	}
+	data, err := reply.Serialize()
+	if err != nil {
+		return err
+	}
+	sr.Sent = data
+	f.record(true, data)
+	f.env.Trace(reply, diameter.TraceMsg)
+
+	f.dp.writePcap(data, peer, pcap.DirOutgoing)
+	if err := peer.SendTo(data); err != nil {
+		return err
+	}
+
+	return checkErr
+}
+
+// record adds the message of the step to the flow exchange.
+func (f *flow) record(sent bool, data []byte) {
+	f.result.Messages = append(f.result.Messages, Record{Step: f.step, Sent: sent, Time: time.Now(), Data: data})
+}
+
+// check checks the received message against the expectations.
+func (f *flow) check(msg *diameter.Message, expect *Expect) error {
+	if expect == nil {
+		return nil
+	}
+
+	if expect.Result != "" {
+		if err := f.checkResult(msg, expect.Result); err != nil {
+			return err
+		}
+	}
+
+	for _, value := range expect.Avps {
+		avps, err := msg.GetPath(value.Path)
+		if err != nil {
+			return err
+		}
+		if len(avps) == 0 {
+			return &diwe.ErrMissingAvp{Avp: value.Path}
+		}
+
+		expected, err := f.env.GetAvp(avps[0].Code())
+		if err != nil {
+			return err
+		}
+		if err := expected.SetValue(value.Value); err != nil {
+			return err
+		}
+		if actual, want := avpText(avps[0]), avpText(expected); actual != want {
+			return &diwe.ErrUnexpectedValue{Avp: value.Path, Value: actual, Expected: want}
+		}
+	}
+
+	for _, path := range expect.Present {
+		avps, err := msg.GetPath(path)
+		if err != nil {
+			return err
+		}
+		if len(avps) == 0 {
+			return &diwe.ErrMissingAvp{Avp: path}
+		}
+	}
+
+	for _, path := range expect.Absent {
+		avps, err := msg.GetPath(path)
+		if err != nil {
+			return err
+		}
+		if len(avps) > 0 {
+			return &diwe.ErrUnexpectedAvp{Avp: path}
+		}
+	}
+
+	return nil
+}
+
+// checkResult compares the Result-Code (Experimental-Result-Code) with the expected code or name.
+func (f *flow) checkResult(msg *diameter.Message, expected string) error {
+	code, vndId, err := msg.ResultCode()
+	if err != nil {
+		return err
+	}
+
+	actual := strconv.FormatUint(uint64(code), 10)
+	if rc, err := f.env.Dict().GetResultCodeByCode(code, vndId); err == nil {
+		actual = fmt.Sprintf("%d (%s)", code, rc.Name)
+	}
+
+	if want, err := strconv.ParseUint(expected, 10, 32); err == nil {
+		if uint32(want) != code {
+			return &diwe.ErrUnexpectedResult{Result: actual, Expected: expected}
+		}
+		return nil
+	}
+
+	rc, err := f.env.Dict().GetResultCodeByName(expected, vndId)
+	if err != nil || rc.Code != code {
+		return &diwe.ErrUnexpectedResult{Result: actual, Expected: expected}
+	}
+
+	return nil
+}
+
+// capture copies the AVP values of the received message into the session store.
+func (f *flow) capture(msg *diameter.Message, captures AvpCaptures) error {
+	for _, c := range captures {
+		if err := f.env.CaptureAvp(f.session.Store(), msg, c.From, c.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValues sets the AVP path values of the message, the sequence value sets the occurrences.
+func setValues(msg *diameter.Message, values AvpValues) error {
+	for _, value := range values {
+		items, isList := value.Value.([]any)
+		if !isList {
+			if err := msg.SetPath(value.Path, value.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := msg.DeletePath(value.Path); err != nil {
+			if _, missing := err.(*diwe.ErrMissingAvp); !missing {
+				return err
+			}
+		}
+		for _, item := range items {
+			if err := msg.AddPath(value.Path, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pathText returns the text of the first AVP of the message path, empty if the AVP is missing.
+func pathText(msg *diameter.Message, path string) string {
+	avps, err := msg.GetPath(path)
+	if err != nil || len(avps) == 0 {
+		return ""
+	}
+	return avpText(avps[0])
+}
+
+// avpText returns the AVP value as text.
+func avpText(avp *diameter.Avp) string {
+	if codec, exists := avp.Codec(); exists {
+		return codec.ToText(avp)
+	}
+	return fmt.Sprint(avp.Value())
+}
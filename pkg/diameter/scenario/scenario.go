@@ -0,0 +1,362 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: scenario.go
+// Description: Diameter pkg: declarative multi-step call flows
+//
+
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"tgdp/pkg/diameter"
+	"tgdp/pkg/diameter/diwe"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Consts
+//
+
+// DefaultTimeout is the default answer and request wait timeout.
+const DefaultTimeout = 5 * time.Second
+
+// Step kinds.
+const (
+	KindSend    = "send"
+	KindReceive = "receive"
+	KindSleep   = "sleep"
+)
+
+// Types
+//
+
+// Scenario is the call flow: the steps run in order within one Diameter session.
+//
+//	name: S6a attach
+//	peer: hss
+//	steps:
+//	  - send: S6a UL
+//	    avps: {User-Name: "001010000000001"}
+//	    expect: {result: DIAMETER_SUCCESS}
+//	  - send: S6a NO
+//	    repeat: 3
+//	  - receive: S6a CL
+//	    answer: {Result-Code: 2001}
+type Scenario struct {
+	// Name is the scenario name, the file name if not set
+	Name string `yaml:"name"`
+	// Peer is the default peer of the steps
+	Peer string `yaml:"peer"`
+	// Timeout is the default timeout of the steps
+	Timeout time.Duration `yaml:"timeout"`
+	// Steps are the flow steps
+	Steps []Step `yaml:"steps"`
+
+	file string
+}
+
+// Step is the flow step, exactly one of Send, Receive and Sleep is set.
+type Step struct {
+	// Name is the step name for the report
+	Name string `yaml:"name"`
+	// Send is the request to send: "<app> <command>"
+	Send string `yaml:"send"`
+	// Receive is the request to wait for and to answer: "<app> <command>"
+	Receive string `yaml:"receive"`
+	// Sleep is the pause duration
+	Sleep time.Duration `yaml:"sleep"`
+	// Peer is the step peer, the scenario peer if not set
+	Peer string `yaml:"peer"`
+	// Timeout is the answer (send) or the request (receive) wait timeout
+	Timeout time.Duration `yaml:"timeout"`
+	// Repeat is the number of the step runs in a row, e.g. the interim updates of the call
+	Repeat int `yaml:"repeat"`
+	// Avps are the AVP values set in the request after it is built (send)
+	Avps AvpValues `yaml:"avps"`
+	// Match are the AVP paths of the received request equal to the last sent request of the flow (receive)
+	Match []string `yaml:"match"`
+	// Expect are the checks of the answer (send) or the received request (receive)
+	Expect *Expect `yaml:"expect"`
+	// Answer are the AVP values set in the answer to the received request (receive)
+	Answer AvpValues `yaml:"answer"`
+	// Capture copies the AVP values of the received message into the session store: target AVP to source path
+	Capture AvpCaptures `yaml:"capture"`
+
+	kind string
+	app  string
+	cmd  string
+}
+
+// Expect are the checks of the received message.
+type Expect struct {
+	// Result is the Result-Code or Experimental-Result-Code: code or name
+	Result string `yaml:"result"`
+	// Avps are the expected values of the AVP paths
+	Avps AvpValues `yaml:"avps"`
+	// Present are the AVP paths which must be present
+	Present []string `yaml:"present"`
+	// Absent are the AVP paths which must be absent
+	Absent []string `yaml:"absent"`
+}
+
+// AvpValue is the value of the AVP path.
+type AvpValue struct {
+	Path  string
+	Value any
+}
+
+// AvpValues are the AVP path values in the YAML mapping order. The sequence value
+// sets the occurrences of the AVP.
+type AvpValues []AvpValue
+
+// AvpCapture copies the value of the source path into the target AVP.
+type AvpCapture struct {
+	To   string
+	From string
+}
+
+// AvpCaptures are the captures in the YAML mapping order.
+type AvpCaptures []AvpCapture
+
+// Functions
+//
+
+// Load reads and validates the scenario file.
+func Load(env *diameter.Diameter, file string) (*Scenario, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := Parse(data, file)
+	if err != nil {
+		return nil, err
+	}
+	if err := sc.Validate(env); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+// Parse parses the scenario YAML, the file name is used for the errors and the default name.
+func Parse(data []byte, file string) (*Scenario, error) {
+	sc := &Scenario{file: file}
+	if err := yaml.Unmarshal(data, sc); err != nil {
+		return nil, &diwe.ErrInvalidScenario{File: file, Reason: err.Error()}
+	}
+
+	if sc.Name == "" {
+		sc.Name = file
+	}
+	if sc.Timeout == 0 {
+		sc.Timeout = DefaultTimeout
+	}
+	if len(sc.Steps) == 0 {
+		return nil, &diwe.ErrInvalidScenario{File: file, Reason: "no steps"}
+	}
+
+	for i := range sc.Steps {
+		if err := sc.Steps[i].parse(sc, i+1); err != nil {
+			return nil, err
+		}
+	}
+
+	return sc, nil
+}
+
+// Methods
+//
+
+// File returns the scenario file name.
+func (sc *Scenario) File() string {
+	return sc.file
+}
+
+// Validate checks the applications, the commands, the AVP paths and the peers of the steps.
+func (sc *Scenario) Validate(env *diameter.Diameter) error {
+	for i := range sc.Steps {
+		if err := sc.Steps[i].validate(env); err != nil {
+			return &diwe.ErrInvalidScenario{File: sc.file, Step: i + 1, Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the step kind: send, receive or sleep.
+func (step *Step) Kind() string {
+	return step.kind
+}
+
+// String returns the step text for the report.
+func (step *Step) String() string {
+	text := step.Name
+	if text == "" {
+		switch step.kind {
+		case KindSend:
+			text = fmt.Sprintf("send %s %s to %s", step.app, step.cmd, step.Peer)
+		case KindReceive:
+			text = fmt.Sprintf("receive %s %s from %s", step.app, step.cmd, step.Peer)
+		default:
+			text = fmt.Sprintf("sleep %s", step.Sleep)
+		}
+	}
+
+	if step.Repeat > 1 {
+		text += fmt.Sprintf(" x%d", step.Repeat)
+	}
+	return text
+}
+
+// UnmarshalYAML decodes the mapping of the AVP paths to the values.
+func (values *AvpValues) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return &diwe.ErrInvalidYamlValue{Line: node.Line, Column: node.Column, Value: node.Value}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var value any
+		if err := node.Content[i+1].Decode(&value); err != nil {
+			return err
+		}
+		*values = append(*values, AvpValue{Path: node.Content[i].Value, Value: value})
+	}
+
+	return nil
+}
+
+// UnmarshalYAML decodes the mapping of the target AVPs to the source paths.
+func (captures *AvpCaptures) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return &diwe.ErrInvalidYamlValue{Line: node.Line, Column: node.Column, Value: node.Value}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		from := node.Content[i+1]
+		if from.Kind != yaml.ScalarNode {
+			return &diwe.ErrInvalidYamlValue{Line: from.Line, Column: from.Column, Value: from.Value}
+		}
+		*captures = append(*captures, AvpCapture{To: node.Content[i].Value, From: from.Value})
+	}
+
+	return nil
+}
+
+// Helpers
+//
+
+// parse sets the step kind, the command and the defaults of the scenario, num is the step number.
+func (step *Step) parse(sc *Scenario, num int) error {
+	invalid := func(format string, args ...any) error {
+		return &diwe.ErrInvalidScenario{File: sc.file, Step: num, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	kinds := []string{}
+	if step.Send != "" {
+		kinds = append(kinds, KindSend)
+	}
+	if step.Receive != "" {
+		kinds = append(kinds, KindReceive)
+	}
+	if step.Sleep != 0 {
+		kinds = append(kinds, KindSleep)
+	}
+	if len(kinds) != 1 {
+		return invalid("exactly one of 'send', 'receive' and 'sleep' expected, got %d", len(kinds))
+	}
+	step.kind = kinds[0]
+
+	if step.Sleep < 0 || step.Timeout < 0 {
+		return invalid("negative duration")
+	}
+	if step.Repeat < 0 {
+		return invalid("negative repeat")
+	}
+	if step.Repeat == 0 {
+		step.Repeat = 1
+	}
+	if step.Timeout == 0 {
+		step.Timeout = sc.Timeout
+	}
+	if step.kind == KindSleep {
+		return nil
+	}
+
+	command := step.Send + step.Receive
+	fields := strings.Fields(command)
+	if len(fields) != 2 {
+		return invalid("'%s': '<app> <command>' expected", command)
+	}
+	step.app, step.cmd = fields[0], fields[1]
+
+	if step.Peer == "" {
+		step.Peer = sc.Peer
+	}
+	if step.Peer == "" {
+		return invalid("no peer")
+	}
+
+	switch {
+	case step.kind == KindSend && (len(step.Answer) > 0 || len(step.Match) > 0):
+		return invalid("'answer' and 'match' are the 'receive' step parameters")
+	case step.kind == KindReceive && len(step.Avps) > 0:
+		return invalid("'avps' is the 'send' step parameter, use 'answer'")
+	}
+
+	return nil
+}
+
+// validate resolves the command, the peer and the AVP paths of the step.
+func (step *Step) validate(env *diameter.Diameter) error {
+	if step.kind == KindSleep {
+		return nil
+	}
+
+	app, err := env.Dict().GetApp(step.app)
+	if err != nil {
+		return err
+	}
+	if _, err := env.Dict().GetCmd(step.cmd, app); err != nil {
+		return err
+	}
+	if _, err := env.Peers().GetByName(step.Peer); err != nil {
+		return err
+	}
+
+	paths := step.Match
+	for _, values := range []AvpValues{step.Avps, step.Answer} {
+		for _, value := range values {
+			paths = append(paths, value.Path)
+		}
+	}
+	if step.Expect != nil {
+		for _, value := range step.Expect.Avps {
+			paths = append(paths, value.Path)
+		}
+		paths = append(paths, step.Expect.Present...)
+		paths = append(paths, step.Expect.Absent...)
+	}
+	for _, capture := range step.Capture {
+		paths = append(paths, capture.From)
+		if _, err := env.Dict().GetAvp(capture.To); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		if _, err := env.ParseAvpPath(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
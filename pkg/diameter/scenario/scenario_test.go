@@ -0,0 +1,98 @@
+package scenario
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	fmt.Println(">>> Scenario parse test")
+
+	sc, err := Parse([]byte(`
+peer: hss
+steps:
+  - send: S6a UL
+    avps:
+      User-Name: "001010000000001"
+      Subscription-Data.MSISDN: 79001234567
+      Class: [a, b]
+    expect:
+      result: DIAMETER_SUCCESS
+      avps: {Origin-Host: hss.test}
+      absent: [Error-Message]
+    capture: {User-Name: User-Name, Class: Origin-Host}
+  - sleep: 500ms
+    repeat: 2
+  - name: cancel
+    receive: S6a CL
+    peer: hss2
+    timeout: 1s
+    match: [User-Name]
+    answer: {Result-Code: 2001}
+`), "attach.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.Name != "attach.yaml" || sc.File() != "attach.yaml" || sc.Timeout != DefaultTimeout || len(sc.Steps) != 3 {
+		t.Fatalf("Scenario: %+v", sc)
+	}
+
+	send := &sc.Steps[0]
+	if send.Kind() != KindSend || send.Peer != "hss" || send.Timeout != DefaultTimeout {
+		t.Fatalf("Send step: %+v", send)
+	}
+	paths := []string{}
+	for _, value := range send.Avps {
+		paths = append(paths, value.Path)
+	}
+	if fmt.Sprint(paths) != "[User-Name Subscription-Data.MSISDN Class]" {
+		t.Fatalf("AVP values order: %v", paths)
+	}
+	if fmt.Sprint(send.Avps[1].Value, send.Avps[2].Value) != "79001234567 [a b]" {
+		t.Fatalf("AVP values: %v", send.Avps)
+	}
+	if send.Expect.Result != "DIAMETER_SUCCESS" || len(send.Expect.Absent) != 1 {
+		t.Fatalf("Expect: %+v", send.Expect)
+	}
+	if fmt.Sprint(send.Capture) != "[{User-Name User-Name} {Class Origin-Host}]" {
+		t.Fatalf("Capture: %v", send.Capture)
+	}
+	fmt.Println(send)
+
+	if send.Repeat != 1 {
+		t.Fatalf("Default repeat: %d", send.Repeat)
+	}
+
+	if sc.Steps[1].Kind() != KindSleep || sc.Steps[1].Sleep != 500*time.Millisecond || sc.Steps[1].Repeat != 2 {
+		t.Fatalf("Sleep step: %+v", sc.Steps[1])
+	}
+	fmt.Println(&sc.Steps[1])
+
+	recv := &sc.Steps[2]
+	if recv.Kind() != KindReceive || recv.Peer != "hss2" || recv.Timeout != time.Second || recv.String() != "cancel" {
+		t.Fatalf("Receive step: %+v", recv)
+	}
+
+	for _, invalid := range []string{
+		`steps: []`,
+		`steps: [{send: S6a UL}]`,
+		`{peer: hss, steps: [{send: S6a UL, sleep: 1s}]}`,
+		`{peer: hss, steps: [{name: nothing}]}`,
+		`{peer: hss, steps: [{send: UL}]}`,
+		`{peer: hss, steps: [{send: S6a UL, answer: {Result-Code: 2001}}]}`,
+		`{peer: hss, steps: [{receive: S6a CL, avps: {User-Name: 1}}]}`,
+		`{peer: hss, steps: [{send: S6a UL, avps: [User-Name]}]}`,
+		`{peer: hss, steps: [{send: S6a UL, timeout: -1s}]}`,
+		`{peer: hss, steps: [{send: S6a UL, repeat: -1}]}`,
+	} {
+		if _, err := Parse([]byte(invalid), "invalid.yaml"); err == nil {
+			t.Fatalf("Invalid scenario accepted: %s", invalid)
+		} else {
+			fmt.Println(err)
+		}
+	}
+
+	fmt.Println("<<< Scenario parse test")
+}
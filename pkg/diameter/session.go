@@ -0,0 +1,317 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: session.go
+// Description: Diameter pkg: Diameter sessions
+//
+
+package diameter
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tgdp/pkg/diameter/diwe"
+)
+
+// Consts
+//
+
+const defaultSessionHost = "tgdp"
+
+// Types
+//
+
+// Session is a Diameter session (RFC 6733 8). The session owns the generated Session-Id
+// and a private AVP store layered on top of the profiles and the global store.
+// The session store holds the Session-Id and the values learned from the answers
+// (Destination-Host and Destination-Realm), all requests of the session reuse them.
+type Session struct {
+	mu      sync.Mutex
+	id      string
+	num     int
+	peer    string
+	store   AvpStore
+	rows    map[*AvpFeed][]string // data feed rows of the session scope feeds
+	msgs    atomic.Uint64
+	started time.Time
+	env     *Diameter
+}
+
+// sessions keeps the sessions of the Diameter environment.
+type sessions struct {
+	mu      sync.RWMutex
+	byId    map[string]*Session
+	current *Session
+	hi      uint32 // high 32 bits of Session-Id, the start time
+	lo      atomic.Uint32
+	num     int
+}
+
+// Methods
+//
+
+// Id returns the session Session-Id.
+func (s *Session) Id() string {
+	return s.id
+}
+
+// Num returns the session sequence number, used as a short session identifier.
+func (s *Session) Num() int {
+	return s.num
+}
+
+// Peer returns the name of the session peer, empty if the session is not bound to a peer.
+func (s *Session) Peer() string {
+	return s.peer
+}
+
+// Store returns the session AVP store.
+func (s *Session) Store() *AvpStore {
+	return &s.store
+}
+
+// Messages returns the number of the messages built within the session.
+func (s *Session) Messages() uint64 {
+	return s.msgs.Load()
+}
+
+// Started returns the session start time.
+func (s *Session) Started() time.Time {
+	return s.started
+}
+
+// NewMessage creates a new Diameter message within the session.
+func (s *Session) NewMessage(appId any, cmdId any, request, fetchAvps bool) (*Message, error) {
+	return s.env.newMessage(s, nil, s.peer, appId, cmdId, request, fetchAvps)
+}
+
+// NewPeerMessage creates a new Diameter message within the session for the peer other than the session peer,
+// the AVP values are taken from the session store and the peer profiles.
+func (s *Session) NewPeerMessage(peer string, appId any, cmdId any, request, fetchAvps bool) (*Message, error) {
+	return s.env.newMessage(s, nil, peer, appId, cmdId, request, fetchAvps)
+}
+
+// Update learns the session values from the answer: the Origin-Host and Origin-Realm
+// of the answer become the Destination-Host and Destination-Realm of the next requests.
+func (s *Session) Update(answer *Message) error {
+	learn := []struct{ from, to uint32 }{
+		{avpOriginHost, avpDestinationHost},
+		{avpOriginRealm, avpDestinationRealm},
+	}
+
+	for _, l := range learn {
+		value, err := answer.GetAvpValue(l.from)
+		if err != nil {
+			continue
+		}
+
+		avp, err := s.env.GetAvp(l.to)
+		if err != nil {
+			return err
+		}
+		if err := avp.SetValue(value); err != nil {
+			return err
+		}
+		s.store.Store(l.to, []*Avp{avp})
+	}
+
+	return nil
+}
+
+// End ends the session.
+func (s *Session) End() {
+	s.env.EndSession(s.id) //nolint:errcheck
+}
+
+// feedRow returns the session row of the data feed, the row is taken on the first use.
+func (s *Session) feedRow(feed *AvpFeed, worker int, dry bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if row, exists := s.rows[feed]; exists {
+		return row, nil
+	}
+
+	row, err := feed.fetch(worker, true, dry)
+	if err != nil {
+		return nil, err
+	}
+	if !dry {
+		s.rows[feed] = row
+	}
+
+	return row, nil
+}
+
+// NewSession starts a new session for the peer (optional) and makes it current.
+// The Session-Id is "<DiameterIdentity>;<high 32 bits>;<low 32 bits>" (RFC 6733 8.8),
+// where the Diameter identity is the Origin-Host value for the peer.
+func (d *Diameter) NewSession(peer string) (*Session, error) {
+	return d.newSession(peer, true)
+}
+
+// NewCallSession starts a new session for the peer (optional) without making it current.
+// The scenario calls run in their own sessions, the current session of the user is kept.
+func (d *Diameter) NewCallSession(peer string) (*Session, error) {
+	return d.newSession(peer, false)
+}
+
+// newSession starts and registers a new session, the session is made current if requested.
+func (d *Diameter) newSession(peer string, current bool) (*Session, error) {
+	host := defaultSessionHost
+	for _, layer := range d.layers(peer, 0, 0, true) {
+		if avps := layer.store.Fetch(avpOriginHost); len(avps) > 0 {
+			if value, ok := avps[0].Value().(string); ok && value != "" {
+				host = value
+				break
+			}
+		}
+	}
+
+	s := &Session{
+		id:      fmt.Sprintf("%s;%d;%d", host, d.sessions.hi, d.sessions.lo.Add(1)),
+		peer:    peer,
+		store:   NewAvpStore(d),
+		rows:    make(map[*AvpFeed][]string),
+		started: time.Now(),
+		env:     d,
+	}
+
+	sessionId, err := d.GetAvp(avpSessionId)
+	if err != nil {
+		return nil, err
+	}
+	if err := sessionId.SetValue(s.id); err != nil {
+		return nil, err
+	}
+	s.store.Store(avpSessionId, []*Avp{sessionId})
+
+	d.sessions.mu.Lock()
+	defer d.sessions.mu.Unlock()
+
+	if d.sessions.byId == nil {
+		d.sessions.byId = make(map[string]*Session)
+	}
+	d.sessions.num++
+	s.num = d.sessions.num
+	d.sessions.byId[s.id] = s
+	if current {
+		d.sessions.current = s
+	}
+
+	return s, nil
+}
+
+// Session returns the session by Session-Id or sequence number.
+func (d *Diameter) Session(id string) (*Session, error) {
+	d.sessions.mu.RLock()
+	defer d.sessions.mu.RUnlock()
+
+	if s, exists := d.sessions.byId[id]; exists {
+		return s, nil
+	}
+
+	if num, err := strconv.Atoi(id); err == nil {
+		for _, s := range d.sessions.byId {
+			if s.num == num {
+				return s, nil
+			}
+		}
+	}
+
+	return nil, &diwe.ErrUnknownSession{Id: id}
+}
+
+// CurrentSession returns the current session, nil if there is no current session.
+func (d *Diameter) CurrentSession() *Session {
+	d.sessions.mu.RLock()
+	defer d.sessions.mu.RUnlock()
+	return d.sessions.current
+}
+
+// UseSession makes the session (Session-Id or sequence number) current.
+func (d *Diameter) UseSession(id string) (*Session, error) {
+	s, err := d.Session(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.sessions.mu.Lock()
+	defer d.sessions.mu.Unlock()
+	d.sessions.current = s
+
+	return s, nil
+}
+
+// EndSession ends the session (Session-Id or sequence number), the empty id ends the current session.
+func (d *Diameter) EndSession(id string) error {
+	var s *Session
+	if id == "" {
+		if s = d.CurrentSession(); s == nil {
+			return &diwe.ErrUnknownSession{Id: "current"}
+		}
+	} else {
+		var err error
+		if s, err = d.Session(id); err != nil {
+			return err
+		}
+	}
+
+	d.sessions.mu.Lock()
+	defer d.sessions.mu.Unlock()
+
+	delete(d.sessions.byId, s.id)
+	if d.sessions.current == s {
+		d.sessions.current = nil
+	}
+
+	return nil
+}
+
+// SessionIter returns a sequence that yields the sessions in the start order.
+func (d *Diameter) SessionIter() iter.Seq[*Session] {
+	d.sessions.mu.RLock()
+	list := make([]*Session, 0, len(d.sessions.byId))
+	for _, s := range d.sessions.byId {
+		list = append(list, s)
+	}
+	d.sessions.mu.RUnlock()
+
+	slices.SortFunc(list, func(a, b *Session) int {
+		return a.num - b.num
+	})
+
+	return slices.Values(list)
+}
+
+// updateSession updates the session of the received answer.
+func (d *Diameter) updateSession(answer *Message) {
+	value, err := answer.GetAvpValue(avpSessionId)
+	if err != nil {
+		return
+	}
+
+	id, ok := value.(string)
+	if !ok {
+		return
+	}
+
+	d.sessions.mu.RLock()
+	s, exists := d.sessions.byId[id]
+	d.sessions.mu.RUnlock()
+
+	if exists {
+		if err := s.Update(answer); err != nil {
+			d.logger.Warn("Session update failed", "session", id, "error", err)
+		}
+	}
+}
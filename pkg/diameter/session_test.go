@@ -0,0 +1,139 @@
+package diameter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	fmt.Println(">>> Sessions test")
+
+	env := newTestEnv(t)
+	if err := env.SetMode(ModeSession); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.Store().MakeFromYaml(`
+Session-Id: "mme.test.org"
+Origin-Host: "mme.test.org"
+Origin-Realm: "test.org"
+Destination-Realm: "home.org"
+User-Name: "250010000000000"
+Result-Code: 2001
+`, AvpStoreAppend, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "subs.csv")
+	if err := os.WriteFile(file, []byte("imsi\n250010000000001\n250010000000002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts, _ := ParseFeedOptions("", "", "", "session", 0)
+	if _, err := env.LoadFeed("subs", file, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.BindFeed("User-Name", "subs", "imsi"); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func() *Message {
+		msg, err := env.NewMessage("S6a", "UL", true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	value := func(msg *Message, avp string) any {
+		value, _ := msg.GetAvpValue(avp)
+		return value
+	}
+
+	// The first request starts the session, the next requests reuse its Session-Id and feed row
+	first := request()
+	first.Trace(0)
+	sessionId := value(first, "Session-Id").(string)
+	if !strings.HasPrefix(sessionId, "mme.test.org;") || strings.Count(sessionId, ";") != 2 {
+		t.Fatalf("Session-Id: %s", sessionId)
+	}
+	second := request()
+	if value(second, "Session-Id") != sessionId || value(second, "User-Name") != "250010000000001" {
+		t.Fatalf("Session-Id %v, User-Name %v", value(second, "Session-Id"), value(second, "User-Name"))
+	}
+	if value(second, "Destination-Host") != nil {
+		t.Fatalf("Destination-Host: %v", value(second, "Destination-Host"))
+	}
+
+	// The answer Origin-Host and Origin-Realm become Destination-Host and Destination-Realm
+	answer, err := second.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value(answer, "Session-Id") != sessionId {
+		t.Fatalf("Answer Session-Id: %v", value(answer, "Session-Id"))
+	}
+	origin, _ := answer.GetAvp("Origin-Host")
+	if err := origin.SetValue("hss.home.org"); err != nil {
+		t.Fatal(err)
+	}
+	env.updateSession(answer)
+
+	third := request()
+	third.Trace(0)
+	if value(third, "Destination-Host") != "hss.home.org" || value(third, "Destination-Realm") != "test.org" {
+		t.Fatalf("Destination-Host %v, Destination-Realm %v", value(third, "Destination-Host"), value(third, "Destination-Realm"))
+	}
+	if s := env.CurrentSession(); s == nil || s.Messages() != 3 {
+		t.Fatal("Current session messages:", s)
+	}
+
+	// The new session has its own Session-Id, feed row and learned values
+	s, err := env.NewSession("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fourth := request()
+	if value(fourth, "Session-Id") != s.Id() || s.Id() == sessionId || value(fourth, "User-Name") != "250010000000002" {
+		t.Fatalf("Session-Id %v, User-Name %v", value(fourth, "Session-Id"), value(fourth, "User-Name"))
+	}
+	if value(fourth, "Destination-Host") != nil {
+		t.Fatal("Destination-Host is learned by the new session")
+	}
+
+	if _, err := env.UseSession("1"); err != nil {
+		t.Fatal(err)
+	}
+	if value(request(), "Session-Id") != sessionId {
+		t.Fatal("Session 1 is not current")
+	}
+
+	// The call session does not replace the current session
+	call, err := env.NewCallSession("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	call.End()
+	if value(request(), "Session-Id") != sessionId {
+		t.Fatal("Call session replaced the current session")
+	}
+	if err := env.EndSession(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Session(sessionId); err == nil {
+		t.Fatal("Ended session is found")
+	}
+	if value(request(), "Session-Id") == sessionId {
+		t.Fatal("Ended session is used")
+	}
+
+	for s := range env.SessionIter() {
+		fmt.Println(s.Num(), s.Id(), s.Messages())
+	}
+	if _, err := env.UseSession("unknown"); err == nil {
+		t.Fatal("Unknown session accepted")
+	}
+
+	fmt.Println("<<< Sessions test")
+}
@@ -0,0 +1,170 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: histogram.go
+// Description: Diameter pkg: latency histogram
+//
+
+package stats
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// Consts
+//
+
+const (
+	// histSubBits is the number of bits of the sub-buckets in each power of two range
+	histSubBits = 4
+	histSub     = 1 << histSubBits
+	// histRanges is the number of the power of two ranges of microseconds (up to ~13 days)
+	histRanges = 37
+	histSize   = (histRanges + 1) * histSub
+)
+
+// Types
+//
+
+// Histogram is the latency histogram with the log-linear buckets of microseconds: each power of two
+// range is split into 16 buckets, so the relative error of the percentiles is below 1/16.
+// The zero value is ready to use.
+type Histogram struct {
+	counts [histSize]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// Methods
+//
+
+// Add records the latency.
+func (h *Histogram) Add(latency time.Duration) {
+	latency = max(latency, 0)
+	h.counts[histBucket(uint64(latency/time.Microsecond))]++
+	h.count++
+	h.sum += latency
+	h.max = max(h.max, latency)
+}
+
+// Merge adds the latencies of the other histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	h.count += other.count
+	h.sum += other.sum
+	h.max = max(h.max, other.max)
+}
+
+// Count returns the number of the recorded latencies.
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+// Max returns the maximum latency.
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Sum returns the sum of the latencies.
+func (h *Histogram) Sum() time.Duration {
+	return h.sum
+}
+
+// CountBelow returns the number of the latencies not greater than the limit. The buckets crossing
+// the limit are not counted, so the count is underestimated by less than one bucket.
+func (h *Histogram) CountBelow(limit time.Duration) uint64 {
+	if limit >= h.max {
+		return h.count
+	}
+
+	var n uint64
+	for i, c := range h.counts {
+		if histUpper(i)*time.Microsecond > limit {
+			break
+		}
+		n += c
+	}
+
+	return n
+}
+
+// Mean returns the average latency.
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Percentile returns the latency below which the p percents (0-100) of the latencies fall.
+// The value is the upper bound of the bucket, not greater than the maximum latency.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(p / 100 * float64(h.count))
+	rank = min(max(rank, 1), h.count)
+
+	var seen uint64
+	for i, n := range h.counts {
+		if seen += n; seen >= rank {
+			return min(histUpper(i)*time.Microsecond, h.max)
+		}
+	}
+
+	return h.max
+}
+
+// String returns the latency summary: p50, p90, p99 and max.
+func (h *Histogram) String() string {
+	return fmt.Sprintf("p50 %s  p90 %s  p99 %s  max %s",
+		roundLatency(h.Percentile(50)), roundLatency(h.Percentile(90)),
+		roundLatency(h.Percentile(99)), roundLatency(h.Max()))
+}
+
+// Helpers
+//
+
+// histBucket returns the bucket index of the value.
+func histBucket(v uint64) int {
+	if v < histSub {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - histSubBits - 1
+	if shift >= histRanges {
+		return histSize - 1
+	}
+
+	return (shift+1)*histSub + int(v>>shift) - histSub
+}
+
+// histUpper returns the upper bound of the bucket values.
+func histUpper(i int) time.Duration {
+	if i < histSub {
+		return time.Duration(i)
+	}
+
+	shift := i/histSub - 1
+	return time.Duration((uint64(i%histSub+histSub+1) << shift) - 1)
+}
+
+// roundLatency rounds the latency for the output.
+func roundLatency(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,131 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: runtime.go
+// Description: Diameter pkg: runtime statistics of the process for the long runs
+//
+
+package stats
+
+import (
+	"fmt"
+	"runtime/metrics"
+)
+
+// Consts
+//
+
+// Runtime metrics read by ReadRuntime, they are cheaper than runtime.ReadMemStats (no stop the world)
+const (
+	metricHeapLive    = "/gc/heap/live:bytes"
+	metricHeapAlloc   = "/memory/classes/heap/objects:bytes"
+	metricHeapObjects = "/gc/heap/objects:objects"
+	metricSys         = "/memory/classes/total:bytes"
+	metricGCs         = "/gc/cycles/total:gc-cycles"
+	metricGoroutines  = "/sched/goroutines:goroutines"
+)
+
+// Types
+//
+
+// PoolStats is the use of the object pool: the objects taken from the pool, allocated
+// by the pool because it was empty and returned to the pool.
+type PoolStats struct {
+	Gets   uint64
+	Allocs uint64
+	Puts   uint64
+}
+
+// Runtime is the runtime statistics of the process and the use of the message and AVP pools.
+type Runtime struct {
+	HeapLive    uint64 // heap bytes marked live by the last GC, the base of the leak checks
+	HeapAlloc   uint64 // heap bytes of the allocated objects including the garbage not yet collected
+	HeapObjects uint64
+	Sys         uint64 // memory mapped by the runtime
+	GCs         uint64
+	Goroutines  uint64
+	Messages    PoolStats
+	Avps        PoolStats
+}
+
+// Functions
+//
+
+// ReadRuntime returns the runtime statistics of the process, the pool stats are not filled.
+func ReadRuntime() Runtime {
+	samples := []metrics.Sample{
+		{Name: metricHeapLive},
+		{Name: metricHeapAlloc},
+		{Name: metricHeapObjects},
+		{Name: metricSys},
+		{Name: metricGCs},
+		{Name: metricGoroutines},
+	}
+	metrics.Read(samples)
+
+	value := func(i int) uint64 {
+		if samples[i].Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+		return samples[i].Value.Uint64()
+	}
+
+	return Runtime{
+		HeapLive:    value(0),
+		HeapAlloc:   value(1),
+		HeapObjects: value(2),
+		Sys:         value(3),
+		GCs:         value(4),
+		Goroutines:  value(5),
+	}
+}
+
+// FormatBytes returns the size in the binary units, e.g. 1.5 MiB.
+func FormatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Methods
+//
+
+// Hits returns the objects taken from the pool without the allocation.
+func (p PoolStats) Hits() uint64 {
+	return p.Gets - p.Allocs
+}
+
+// InUse returns the objects taken from the pool and not returned, the objects left
+// to the garbage collector are counted too.
+func (p PoolStats) InUse() uint64 {
+	return p.Gets - p.Puts
+}
+
+// String returns the pool use text: the objects in use and the hit ratio.
+func (p PoolStats) String() string {
+	ratio := 0.0
+	if p.Gets > 0 {
+		ratio = 100 * float64(p.Hits()) / float64(p.Gets)
+	}
+
+	return fmt.Sprintf("%d in use, %.1f%% pool hits", p.InUse(), ratio)
+}
+
+// String returns the one line text of the runtime statistics.
+func (r Runtime) String() string {
+	return fmt.Sprintf("heap live %s, allocated %s (%d objects), sys %s, GC %d, goroutines %d, messages %s, AVPs %s",
+		FormatBytes(r.HeapLive), FormatBytes(r.HeapAlloc), r.HeapObjects, FormatBytes(r.Sys), r.GCs, r.Goroutines,
+		r.Messages, r.Avps)
+}
@@ -0,0 +1,391 @@
+//
+// Project: TGDP - Traffic Generator for Diameter Protocol
+// Description: Simple tool for testing and debugging the Diameter protocol
+//
+// Author: Alexander Kefeli <alexander.kefeli@gmail.com>
+//
+// File: stats.go
+// Description: Diameter pkg: traffic statistics of the peers
+//
+
+package stats
+
+import (
+	"cmp"
+	"encoding/binary"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Consts
+//
+
+const (
+	// DefaultTimeout is the answer timeout of the requests sent to the peers without the timeout
+	DefaultTimeout = 5 * time.Second
+
+	// sweepInterval is the minimum interval of the outstanding requests timeout check
+	sweepInterval = 100 * time.Millisecond
+)
+
+// Diameter message header and AVPs (RFC 6733), the statistics do not depend on the dictionary
+const (
+	headerLen      = 20
+	flagRequest    = 0x80
+	flagRetransmit = 0x10
+	avpFlagVendor  = 0x80
+
+	avpResultCode             = 268
+	avpExperimentalResult     = 297
+	avpExperimentalResultCode = 298
+)
+
+// Types
+//
+
+// Key identifies the traffic counters: the peer, the application and the command.
+type Key struct {
+	Peer    string
+	AppId   uint32
+	CmdCode uint32
+}
+
+// Counters are the traffic counters of the peer command.
+type Counters struct {
+	RequestsSent    uint64
+	RequestsRecv    uint64
+	AnswersSent     uint64
+	AnswersRecv     uint64
+	BytesSent       uint64
+	BytesRecv       uint64
+	Timeouts        uint64 // requests sent without the answer within the timeout
+	Retransmissions uint64 // requests sent or received with the T flag
+	// Results are the received answers by the Result-Code (Experimental-Result-Code), 0 if missing
+	Results map[uint32]uint64
+	// Latency is the time from the request sent to its answer received
+	Latency Histogram
+}
+
+// Entry is the counters of the key.
+type Entry struct {
+	Key
+	Counters
+}
+
+// Snapshot is the copy of the statistics.
+type Snapshot struct {
+	Started time.Time // statistics start or reset time
+	Taken   time.Time
+	Entries []Entry // sorted by the peer, the application and the command
+}
+
+// Stats collects the traffic statistics of the peers. The nil Stats ignores the traffic.
+type Stats struct {
+	mu      sync.Mutex
+	started time.Time
+	entries map[Key]*Counters
+	pending map[pendingKey]pendingRequest
+	swept   time.Time
+}
+
+// pendingKey identifies the outstanding request sent to the peer.
+type pendingKey struct {
+	peer     string
+	hopByHop uint32
+}
+
+// pendingRequest is the outstanding request.
+type pendingRequest struct {
+	key     Key
+	sent    time.Time
+	timeout time.Duration
+}
+
+// Constructor
+//
+
+// New creates the empty statistics.
+func New() *Stats {
+	now := time.Now()
+	return &Stats{
+		started: now,
+		swept:   now,
+		entries: make(map[Key]*Counters),
+		pending: make(map[pendingKey]pendingRequest),
+	}
+}
+
+// Functions
+//
+
+// ResultCode returns the Result-Code or the Experimental-Result-Code of the serialized answer.
+// The top level AVPs are scanned without decoding, so the dictionary is not used.
+func ResultCode(data []byte) (uint32, bool) {
+	if len(data) < headerLen {
+		return 0, false
+	}
+
+	return scanResultCode(data[headerLen:], true)
+}
+
+// Methods
+//
+
+// Sent records the message sent to the peer. The requests wait for the answers within the timeout,
+// the zero timeout is DefaultTimeout.
+func (s *Stats) Sent(peer string, data []byte, timeout time.Duration) {
+	flags, appId, cmdCode, hopByHop, ok := parseHeader(data)
+	if s == nil || !ok {
+		return
+	}
+
+	now := time.Now()
+	key := Key{Peer: peer, AppId: appId, CmdCode: cmdCode}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	counters := s.counters(key)
+	counters.BytesSent += uint64(len(data))
+	if flags&flagRequest == 0 {
+		counters.AnswersSent++
+		return
+	}
+
+	counters.RequestsSent++
+	if flags&flagRetransmit != 0 {
+		counters.Retransmissions++
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	s.pending[pendingKey{peer: peer, hopByHop: hopByHop}] = pendingRequest{key: key, sent: now, timeout: timeout}
+}
+
+// Received records the message received from the peer.
+func (s *Stats) Received(peer string, data []byte) {
+	flags, appId, cmdCode, hopByHop, ok := parseHeader(data)
+	if s == nil || !ok {
+		return
+	}
+
+	now := time.Now()
+	key := Key{Peer: peer, AppId: appId, CmdCode: cmdCode}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	counters := s.counters(key)
+	counters.BytesRecv += uint64(len(data))
+	if flags&flagRequest != 0 {
+		counters.RequestsRecv++
+		if flags&flagRetransmit != 0 {
+			counters.Retransmissions++
+		}
+		return
+	}
+
+	counters.AnswersRecv++
+	code, _ := ResultCode(data)
+	counters.Results[code]++
+
+	pk := pendingKey{peer: peer, hopByHop: hopByHop}
+	if request, exists := s.pending[pk]; exists {
+		delete(s.pending, pk)
+		s.counters(request.key).Latency.Add(now.Sub(request.sent))
+	}
+}
+
+// Reset clears the statistics, the outstanding requests are forgotten.
+func (s *Stats) Reset() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = time.Now()
+	s.swept = s.started
+	clear(s.entries)
+	clear(s.pending)
+}
+
+// Fold merges the counters of the peer into the counters of the other peer and forgets the peer,
+// the outstanding requests of the peer are counted for the other peer. It keeps the statistics
+// bounded when the peer names are not reused, e.g. the client connections of the server.
+func (s *Stats) Fold(peer, into string) {
+	if s == nil || peer == into {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, counters := range s.entries {
+		if key.Peer != peer {
+			continue
+		}
+		delete(s.entries, key)
+		key.Peer = into
+		s.counters(key).Add(counters)
+	}
+	for pk, request := range s.pending {
+		if request.key.Peer == peer {
+			request.key.Peer = into
+			s.pending[pk] = request
+		}
+	}
+}
+
+// Outstanding returns the number of the requests waiting for the answers.
+func (s *Stats) Outstanding() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(time.Now())
+
+	return len(s.pending)
+}
+
+// Snapshot returns the copy of the statistics.
+func (s *Stats) Snapshot() Snapshot {
+	if s == nil {
+		return Snapshot{}
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	snapshot := Snapshot{Started: s.started, Taken: now, Entries: make([]Entry, 0, len(s.entries))}
+	for key, counters := range s.entries {
+		entry := Entry{Key: key, Counters: *counters}
+		entry.Results = maps.Clone(counters.Results)
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	slices.SortFunc(snapshot.Entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(a.Peer, b.Peer), cmp.Compare(a.AppId, b.AppId), cmp.Compare(a.CmdCode, b.CmdCode))
+	})
+
+	return snapshot
+}
+
+// Total returns the sum of the counters of the entries.
+func (s Snapshot) Total() Counters {
+	total := Counters{Results: make(map[uint32]uint64)}
+	for i := range s.Entries {
+		total.Add(&s.Entries[i].Counters)
+	}
+
+	return total
+}
+
+// Elapsed returns the time the statistics are collected.
+func (s Snapshot) Elapsed() time.Duration {
+	return s.Taken.Sub(s.Started)
+}
+
+// Add adds the other counters.
+func (c *Counters) Add(other *Counters) {
+	c.RequestsSent += other.RequestsSent
+	c.RequestsRecv += other.RequestsRecv
+	c.AnswersSent += other.AnswersSent
+	c.AnswersRecv += other.AnswersRecv
+	c.BytesSent += other.BytesSent
+	c.BytesRecv += other.BytesRecv
+	c.Timeouts += other.Timeouts
+	c.Retransmissions += other.Retransmissions
+	if c.Results == nil {
+		c.Results = make(map[uint32]uint64)
+	}
+	for code, n := range other.Results {
+		c.Results[code] += n
+	}
+	c.Latency.Merge(&other.Latency)
+}
+
+// Helpers
+//
+
+// counters returns the counters of the key, the counters are created on the first use.
+func (s *Stats) counters(key Key) *Counters {
+	counters, exists := s.entries[key]
+	if !exists {
+		counters = &Counters{Results: make(map[uint32]uint64)}
+		s.entries[key] = counters
+	}
+
+	return counters
+}
+
+// sweep counts the timeouts of the outstanding requests, not more often than sweepInterval.
+func (s *Stats) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+
+	for pk, request := range s.pending {
+		if now.Sub(request.sent) > request.timeout {
+			delete(s.pending, pk)
+			s.counters(request.key).Timeouts++
+		}
+	}
+}
+
+// parseHeader returns the header fields of the serialized message.
+func parseHeader(data []byte) (flags byte, appId, cmdCode, hopByHop uint32, ok bool) {
+	if len(data) < headerLen {
+		return 0, 0, 0, 0, false
+	}
+
+	flags = data[4]
+	cmdCode = binary.BigEndian.Uint32(data[4:8]) & 0x00FFFFFF
+	appId = binary.BigEndian.Uint32(data[8:12])
+	hopByHop = binary.BigEndian.Uint32(data[12:16])
+
+	return flags, appId, cmdCode, hopByHop, true
+}
+
+// scanResultCode scans the AVPs for the Result-Code, the Experimental-Result is scanned
+// for the Experimental-Result-Code if top is true.
+func scanResultCode(avps []byte, top bool) (uint32, bool) {
+	for len(avps) >= 8 {
+		code := binary.BigEndian.Uint32(avps[0:4])
+		flags := avps[4]
+		length := int(binary.BigEndian.Uint32(avps[4:8]) & 0x00FFFFFF)
+		offset := 8
+		if flags&avpFlagVendor != 0 {
+			offset += 4
+		}
+		if length < offset || length > len(avps) {
+			return 0, false
+		}
+		data := avps[offset:length]
+
+		switch {
+		case top && code == avpResultCode, !top && code == avpExperimentalResultCode:
+			if len(data) == 4 {
+				return binary.BigEndian.Uint32(data), true
+			}
+		case top && code == avpExperimentalResult:
+			if value, ok := scanResultCode(data, false); ok {
+				return value, true
+			}
+		}
+
+		avps = avps[min((length+3)&^3, len(avps)):]
+	}
+
+	return 0, false
+}
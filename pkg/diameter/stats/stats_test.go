@@ -0,0 +1,197 @@
+package stats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testMessage builds the serialized message with the optional Result-Code or Experimental-Result.
+func testMessage(flags byte, appId, cmdCode, hopByHop uint32, resultCode uint32, experimental bool) []byte {
+	avp := func(code uint32, flags byte, vndId uint32, data []byte) []byte {
+		hdr := 8
+		if vndId != 0 {
+			hdr = 12
+		}
+		buf := make([]byte, hdr, hdr+len(data)+3)
+		binary.BigEndian.PutUint32(buf[0:4], code)
+		binary.BigEndian.PutUint32(buf[4:8], uint32(hdr+len(data)))
+		buf[4] = flags
+		if vndId != 0 {
+			buf[4] |= avpFlagVendor
+			binary.BigEndian.PutUint32(buf[8:12], vndId)
+		}
+		buf = append(buf, data...)
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+		return buf
+	}
+	u32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+	data := make([]byte, headerLen)
+	data = append(data, avp(263, 0x40, 0, []byte("session;1"))...)
+	switch {
+	case resultCode != 0 && experimental:
+		group := append(avp(266, 0x40, 0, u32(10415)), avp(avpExperimentalResultCode, 0x40, 0, u32(resultCode))...)
+		data = append(data, avp(avpExperimentalResult, 0x40, 0, group)...)
+	case resultCode != 0:
+		data = append(data, avp(avpResultCode, 0x40, 0, u32(resultCode))...)
+	}
+
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(data)))
+	data[0] = 1
+	binary.BigEndian.PutUint32(data[4:8], cmdCode)
+	data[4] = flags
+	binary.BigEndian.PutUint32(data[8:12], appId)
+	binary.BigEndian.PutUint32(data[12:16], hopByHop)
+
+	return data
+}
+
+func TestHistogram(t *testing.T) {
+	fmt.Println(">>> Histogram test")
+
+	var h Histogram
+	for i := 1; i <= 1000; i++ {
+		h.Add(time.Duration(i) * time.Millisecond)
+	}
+	fmt.Println(&h)
+
+	for p, want := range map[float64]time.Duration{50: 500 * time.Millisecond, 90: 900 * time.Millisecond, 99: 990 * time.Millisecond} {
+		got := h.Percentile(p)
+		if got < want || got > want+want/histSub {
+			t.Fatalf("p%.0f: %s, want %s", p, got, want)
+		}
+	}
+	if h.Max() != time.Second || h.Percentile(100) != time.Second || h.Count() != 1000 {
+		t.Fatalf("Max %s, p100 %s, count %d", h.Max(), h.Percentile(100), h.Count())
+	}
+	if h.Mean() != 500500*time.Microsecond {
+		t.Fatalf("Mean %s", h.Mean())
+	}
+
+	var merged Histogram
+	merged.Merge(&h)
+	merged.Add(2 * time.Second)
+	if merged.Count() != 1001 || merged.Max() != 2*time.Second {
+		t.Fatalf("Merged count %d, max %s", merged.Count(), merged.Max())
+	}
+
+	for v := uint64(0); v < 1<<20; v = v*3/2 + 1 {
+		if i := histBucket(v); uint64(histUpper(i)) < v || (i > 0 && uint64(histUpper(i-1)) >= v) {
+			t.Fatalf("Value %d in bucket %d [%d, %d]", v, i, histUpper(i-1)+1, histUpper(i))
+		}
+	}
+
+	fmt.Println("<<< Histogram test")
+}
+
+func TestStats(t *testing.T) {
+	fmt.Println(">>> Stats test")
+
+	s := New()
+	const s6a, ul = 16777251, 316
+
+	// answered request, retransmission, answer with Experimental-Result and a timed out request
+	s.Sent("HSS", testMessage(0xC0, s6a, ul, 1, 0, false), time.Second)
+	s.Received("HSS", testMessage(0x40, s6a, ul, 1, 2001, false))
+	s.Sent("HSS", testMessage(0xD0, s6a, ul, 2, 0, false), time.Second)
+	s.Received("HSS", testMessage(0x40, s6a, ul, 2, 5001, true))
+	s.Sent("HSS", testMessage(0xC0, s6a, ul, 3, 0, false), time.Millisecond)
+
+	// request from the peer and the answer
+	s.Received("MME", testMessage(0xC0, s6a, ul, 7, 0, false))
+	s.Sent("MME", testMessage(0x40, s6a, ul, 7, 2001, false), 0)
+
+	// garbage is ignored
+	s.Received("MME", []byte{1, 2, 3})
+
+	time.Sleep(sweepInterval + 10*time.Millisecond)
+	if s.Outstanding() != 0 {
+		t.Fatalf("Outstanding requests: %d", s.Outstanding())
+	}
+
+	snapshot := s.Snapshot()
+	if len(snapshot.Entries) != 2 || snapshot.Entries[0].Peer != "HSS" || snapshot.Entries[1].Peer != "MME" {
+		t.Fatalf("Entries: %+v", snapshot.Entries)
+	}
+
+	hss := snapshot.Entries[0].Counters
+	fmt.Printf("HSS: %+v\n", hss.Results)
+	if hss.RequestsSent != 3 || hss.AnswersRecv != 2 || hss.Timeouts != 1 || hss.Retransmissions != 1 ||
+		hss.Results[2001] != 1 || hss.Results[5001] != 1 || hss.Latency.Count() != 2 {
+		t.Fatalf("HSS counters: %+v", hss)
+	}
+
+	mme := snapshot.Entries[1].Counters
+	if mme.RequestsRecv != 1 || mme.AnswersSent != 1 || mme.BytesSent == 0 || mme.BytesRecv == 0 {
+		t.Fatalf("MME counters: %+v", mme)
+	}
+
+	total := snapshot.Total()
+	if total.RequestsSent+total.RequestsRecv != 4 || total.Results[2001] != 1 {
+		t.Fatalf("Total counters: %+v", total)
+	}
+
+	if code, ok := ResultCode(testMessage(0x40, s6a, ul, 1, 0, false)); ok || code != 0 {
+		t.Fatalf("Missing Result-Code: %d", code)
+	}
+
+	s.Reset()
+	if snapshot = s.Snapshot(); len(snapshot.Entries) != 0 {
+		t.Fatalf("Reset entries: %d", len(snapshot.Entries))
+	}
+
+	var none *Stats
+	none.Sent("HSS", testMessage(0xC0, s6a, ul, 1, 0, false), 0)
+	none.Reset()
+
+	fmt.Println("<<< Stats test")
+}
+
+func TestFold(t *testing.T) {
+	fmt.Println(">>> Stats fold test")
+
+	s := New()
+	const s6a, ul = 16777251, 316
+
+	// the closed client connections are folded into the client host, the outstanding request follows
+	s.Received("peer-10.0.0.1:3868", testMessage(0xC0, s6a, ul, 1, 0, false))
+	s.Sent("peer-10.0.0.1:3868", testMessage(0x40, s6a, ul, 1, 2001, false), 0)
+	s.Received("peer-10.0.0.1:3870", testMessage(0xC0, s6a, ul, 1, 0, false))
+	s.Sent("peer-10.0.0.1:3870", testMessage(0xC0, s6a, ul, 2, 0, false), time.Millisecond)
+	s.Fold("peer-10.0.0.1:3868", "peer-10.0.0.1")
+	s.Fold("peer-10.0.0.1:3870", "peer-10.0.0.1")
+
+	time.Sleep(sweepInterval + 10*time.Millisecond)
+	if s.Outstanding() != 0 {
+		t.Fatalf("Outstanding requests: %d", s.Outstanding())
+	}
+
+	snapshot := s.Snapshot()
+	if len(snapshot.Entries) != 1 || snapshot.Entries[0].Peer != "peer-10.0.0.1" {
+		t.Fatalf("Entries: %+v", snapshot.Entries)
+	}
+	if c := snapshot.Entries[0].Counters; c.RequestsRecv != 2 || c.AnswersSent != 1 || c.RequestsSent != 1 ||
+		c.Timeouts != 1 {
+		t.Fatalf("Folded counters: %+v", c)
+	}
+
+	rt := ReadRuntime()
+	fmt.Println(rt)
+	if rt.Goroutines == 0 || rt.Sys == 0 {
+		t.Fatalf("Runtime: %+v", rt)
+	}
+	for size, want := range map[uint64]string{512: "512 B", 1536: "1.5 KiB", 3 << 30: "3.0 GiB"} {
+		if text := FormatBytes(size); text != want {
+			t.Fatalf("Size %d: %s", size, text)
+		}
+	}
+	if pool := (PoolStats{Gets: 100, Allocs: 10, Puts: 95}); pool.Hits() != 90 || pool.InUse() != 5 {
+		t.Fatalf("Pool: %s", pool)
+	}
+
+	fmt.Println("<<< Stats fold test")
+}
@@ -0,0 +1,79 @@
+package diameter
+
+import (
+	"testing"
+
+	"tgdp/pkg/diameter/dict"
+)
+
+// newTestEnv creates the Diameter environment with a small dictionary built without Pkl.
+func newTestEnv(t *testing.T) *Diameter {
+	types := dict.AvpDataTypes{OctetString: 1, Integer32: 2, Integer64: 3, Unsigned32: 4, Unsigned64: 5,
+		Float32: 6, Float64: 7, Address: 8, Time: 9, UTF8String: 10, Identity: 11, URI: 12,
+		IPFilterRule: 13, QoSFilterRule: 14, Enumerated: 15, Grouped: 16}
+	msisdn := AvpFormatMSISDN
+	rule := func(name string) dict.AvpRule { return dict.AvpRule{Name: name} }
+
+	core := dict.CoreImpl{
+		CmdFlags: dict.CmdBitFlags{R: 128, P: 64, E: 32, T: 16},
+		AvpFlags: dict.AvpBitFlags{V: 128, M: 64, P: 32},
+		AvpTypes: types,
+		Apps: []dict.App{{Id: 16777251, Name: "S6a", Cmds: []dict.Command{{Code: 316, Name: "Update Location", Short: "UL", Flags: 192,
+			Request: []dict.AvpRule{rule("Session-Id"), rule("Origin-Host"), rule("Destination-Host"), rule("Destination-Realm"),
+				rule("User-Name"), rule("MSISDN"), rule("Origin-State-Id"), rule("Terminal-Information")},
+			Answer: []dict.AvpRule{rule("Session-Id"), rule("Origin-Host"), rule("Origin-Realm"), rule("Result-Code"),
+				rule("Experimental-Result")},
+		}}}},
+		Avps: []dict.Avp{
+			{Code: 263, Name: "Session-Id", Flags: 64, Type: types.UTF8String},
+			{Code: 264, Name: "Origin-Host", Flags: 64, Type: types.Identity},
+			{Code: 296, Name: "Origin-Realm", Flags: 64, Type: types.Identity},
+			{Code: 293, Name: "Destination-Host", Flags: 64, Type: types.Identity},
+			{Code: 283, Name: "Destination-Realm", Flags: 64, Type: types.Identity},
+			{Code: 1, Name: "User-Name", Flags: 64, Type: types.UTF8String},
+			{Code: 701, Name: "MSISDN", Flags: 192, VndId: 10415, Type: types.OctetString, Format: &msisdn},
+			{Code: 278, Name: "Origin-State-Id", Flags: 64, Type: types.Unsigned32},
+			{Code: 268, Name: "Result-Code", Flags: 64, Type: types.Unsigned32},
+			{Code: 266, Name: "Vendor-Id", Flags: 64, Type: types.Unsigned32},
+			{Code: 298, Name: "Experimental-Result-Code", Flags: 64, Type: types.Unsigned32},
+			{Code: 297, Name: "Experimental-Result", Flags: 64, Type: types.Grouped,
+				Group: &dict.Group{Members: []dict.AvpRule{rule("Vendor-Id"), rule("Experimental-Result-Code")}}},
+			{Code: 1402, Name: "IMEI", Flags: 192, VndId: 10415, Type: types.UTF8String},
+			{Code: 1401, Name: "Terminal-Information", Flags: 192, VndId: 10415, Type: types.Grouped,
+				Group: &dict.Group{Members: []dict.AvpRule{rule("IMEI")}}},
+			{Code: 1420, Name: "Cancellation-Type", Flags: 192, VndId: 10415, Type: types.Enumerated,
+				Enum: &dict.Enum{Items: []dict.Item{{Code: 0, Name: "MME_UPDATE_PROCEDURE"}, {Code: 2, Name: "SUBSCRIPTION_WITHDRAWAL"}}}},
+			{Code: 55, Name: "Event-Timestamp", Flags: 64, Type: types.Time},
+			{Code: 25, Name: "Class", Flags: 64, Type: types.OctetString},
+			{Code: 257, Name: "Host-IP-Address", Flags: 64, Type: types.Address},
+			{Code: 363, Name: "Accounting-Input-Octets", Flags: 64, Type: types.Unsigned64},
+			{Code: 493, Name: "Service-Selection", Flags: 64, Type: types.UTF8String},
+			{Code: 1423, Name: "Context-Identifier", Flags: 192, VndId: 10415, Type: types.Unsigned32},
+			{Code: 1430, Name: "APN-Configuration", Flags: 192, VndId: 10415, Type: types.Grouped,
+				Group: &dict.Group{Members: []dict.AvpRule{rule("Context-Identifier"), rule("Service-Selection")}}},
+			{Code: 1429, Name: "APN-Configuration-Profile", Flags: 192, VndId: 10415, Type: types.Grouped,
+				Group: &dict.Group{Members: []dict.AvpRule{rule("Context-Identifier"), rule("APN-Configuration")}}},
+			{Code: 1400, Name: "Subscription-Data", Flags: 192, VndId: 10415, Type: types.Grouped,
+				Group: &dict.Group{Members: []dict.AvpRule{rule("MSISDN"), rule("APN-Configuration-Profile")}}},
+			{Code: 622, Name: "OC-Feature-Vector", Flags: 64, Type: types.Unsigned64},
+			{Code: 621, Name: "OC-Supported-Features", Type: types.Grouped,
+				Group: &dict.Group{Members: []dict.AvpRule{rule("OC-Feature-Vector")}}},
+			{Code: 624, Name: "OC-Sequence-Number", Type: types.Unsigned64},
+			{Code: 625, Name: "OC-Validity-Duration", Type: types.Unsigned32},
+			{Code: 626, Name: "OC-Report-Type", Type: types.Enumerated,
+				Enum: &dict.Enum{Items: []dict.Item{{Code: 0, Name: "HOST_REPORT"}, {Code: 1, Name: "REALM_REPORT"}}}},
+			{Code: 627, Name: "OC-Reduction-Percentage", Type: types.Unsigned32},
+			{Code: 623, Name: "OC-OLR", Type: types.Grouped, Group: &dict.Group{Members: []dict.AvpRule{
+				rule("OC-Sequence-Number"), rule("OC-Report-Type"), rule("OC-Reduction-Percentage"), rule("OC-Validity-Duration")}}},
+		},
+	}
+
+	env, err := New(ModeTransaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.dict.Replace(dict.New(core))
+	env.registerCodecs()
+
+	return env
+}
@@ -0,0 +1,50 @@
+--[[
+This is a sample Lua script that demonstrates the answer-driven AVP capture:
+the Server-Name of the Cx User-Authorization-Answer is used in the Server-Assignment-Request.
+
+To run this script execute: tgdp @capture.lua
+]]
+
+local d = require("diameter")
+
+-- main
+--
+local rule, err = d.capture.add("Cx", "UAA", "Server-Name")
+if err ~= nil then
+    print(err)
+    return 1
+end
+print(string.format("on %s capture %s into %s", rule.command, rule.from, rule.to))
+
+local hss
+hss, err = d.peer.fetch("hss")
+if err ~= nil then
+    print(err)
+    return 1
+end
+
+err = hss:connect()
+if err ~= nil then
+    print(err)
+    return 1
+end
+
+-- UAR and SAR share the session, the UAA Server-Name is captured to the session store
+d.session.new("hss")
+
+local uar = d.message.fetch("Cx", "UA", true, "hss")
+hss:send_to(uar)
+local uaa
+uaa, err = hss:recv_from()
+if err ~= nil then
+    print(err)
+else
+    local sar = d.message.fetch("Cx", "SA", true, "hss")
+    print(string.format("SAR Server-Name: %s", sar:get_avp_value("Server-Name")))
+    hss:send_to(sar)
+    hss:recv_from()
+end
+
+d.session.close()
+hss:disconnect()
+d.capture.remove()
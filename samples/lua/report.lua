@@ -0,0 +1,40 @@
+--[[
+This is a sample Lua script that demonstrates the test report cases and assertions:
+each S6a request is the report case, the answer result is checked.
+
+To run this script execute: tgdp -report report.xml,report.html @report.lua
+]]
+
+local d = require("diameter")
+
+-- main
+--
+d.report.case("connect")
+local hss, err = d.peer.fetch("hss")
+if not d.report.check("peer", hss ~= nil, err) then
+    return 1
+end
+
+err = hss:connect()
+if not d.report.check("connect", err == nil, err) then
+    return 1
+end
+
+for _, cmd in ipairs({"AI", "UL", "PU"}) do
+    d.report.case("S6a " .. cmd)
+
+    local req = d.message.fetch("S6a", cmd, true, "hss")
+    err = hss:send_to(req)
+    if err ~= nil then
+        d.report.fail(err)
+    else
+        local ans
+        ans, err = hss:recv_from()
+        if d.report.check("answer", ans ~= nil, err) then
+            d.report.result(ans)
+        end
+    end
+end
+
+d.report.case("disconnect")
+hss:disconnect()